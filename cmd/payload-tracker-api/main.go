@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/redhatinsights/payload-tracker-go/internal/config"
 	"github.com/redhatinsights/payload-tracker-go/internal/db"
 	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
+	"github.com/redhatinsights/payload-tracker-go/internal/kafka"
 	"github.com/redhatinsights/payload-tracker-go/internal/logging"
 )
 
@@ -26,6 +28,41 @@ func main() {
 
 	cfg := config.Get()
 
+	if err := endpoints.ValidateSortConfig(cfg); err != nil {
+		logging.Log.Fatal("Invalid sort configuration: ", err)
+	}
+	if err := endpoints.ValidateVerbosityConfig(cfg); err != nil {
+		logging.Log.Fatal("Invalid verbosity configuration: ", err)
+	}
+	if err := endpoints.ValidateQueryPlanConfig(cfg); err != nil {
+		logging.Log.Fatal("Invalid query plan configuration: ", err)
+	}
+	if err := endpoints.ValidateBusinessHoursConfig(cfg); err != nil {
+		logging.Log.Fatal("Invalid business hours configuration: ", err)
+	}
+	if err := endpoints.ValidateSamplingConfig(cfg); err != nil {
+		logging.Log.Fatal("Invalid sampling configuration: ", err)
+	}
+
+	orgRateLimit, err := endpoints.OrgRateLimitMiddleware(
+		cfg.RequestConfig.OrgRequestsPerMinute,
+		cfg.RequestConfig.OrgRateLimitOverrides,
+		cfg.RequestConfig.OrgRateLimitExempt,
+	)
+	if err != nil {
+		logging.Log.Fatal("Invalid org rate limit configuration: ", err)
+	}
+
+	clientIP, err := endpoints.ClientIPMiddleware(cfg.RequestConfig.TrustedProxies)
+	if err != nil {
+		logging.Log.Fatal("Invalid trusted proxies configuration: ", err)
+	}
+
+	idempotent, err := endpoints.IdempotencyMiddleware(cfg.IdempotencyConfig)
+	if err != nil {
+		logging.Log.Fatal("Invalid idempotency configuration: ", err)
+	}
+
 	db.DbConnect(cfg)
 
 	healthHandler := endpoints.HealthCheckHandler(
@@ -33,15 +70,48 @@ func main() {
 		*cfg,
 	)
 
-	payloadArchiveLinkHandler := endpoints.CreatePayloadArchiveLinkHandler(
-		*cfg,
-	)
+	endpoints.ArchiveLookup = endpoints.CreateArchiveLookup(*cfg)
+
+	// replays and reprocessing share one producer rather than connecting to the brokers for every request,
+	// the producer is only created for the topics that are configured and their routes are left out without it
+	var replayHandler, reprocessHandler http.HandlerFunc
+	if cfg.KafkaConfig.KafkaDeadLetterTopic != "" || cfg.KafkaConfig.KafkaReprocessTopic != "" {
+		producer, err := kafka.NewProducer(cfg)
+		if err != nil {
+			logging.Log.Error("Unable to create the replay and reprocess producer, their endpoints are disabled: ", err)
+		} else {
+			if cfg.KafkaConfig.KafkaDeadLetterTopic != "" {
+				replayHandler = endpoints.ReplayDeadLetters(
+					*cfg,
+					kafka.NewDeadLetterReplayer(cfg, db.DB, producer),
+				)
+			}
+			if cfg.KafkaConfig.KafkaReprocessTopic != "" {
+				reprocessHandler = endpoints.ReprocessPayload(
+					*cfg,
+					endpoints.ArchiveLookup,
+					kafka.NewReprocessAnnouncer(cfg, producer),
+				)
+			}
+		}
+	}
+
+	statusEvents := endpoints.NewStatusEvents()
+	go db.ListenStatusEvents(context.Background(), cfg, statusEvents.Publish)
+
+	if interval := cfg.RequestConfig.DBStatsExportInterval; interval > 0 {
+		go endpoints.ExportTableStats(context.Background(), time.Duration(interval)*time.Second)
+	}
 
 	r := chi.NewRouter()
 	mr := chi.NewRouter()
 	sub := chi.NewRouter()
 
-	r.Use(httprate.LimitByIP(cfg.RequestConfig.MaxRequestsPerMinute, 1*time.Minute))
+	r.Use(clientIP)
+	r.Use(endpoints.SamplingMiddleware(cfg.RequestConfig.TraceSampleRate))
+	r.Use(endpoints.RequestDurationMiddleware)
+	r.Use(endpoints.RecoverMiddleware)
+	r.Use(httprate.Limit(cfg.RequestConfig.MaxRequestsPerMinute, 1*time.Minute, httprate.WithKeyFuncs(endpoints.KeyByClientIP)))
 
 	// Mount the root of the api router on /api/v1 unless ENVIRONMENT is DEV
 	if cfg.Environment == "DEV" {
@@ -50,10 +120,6 @@ func main() {
 		r.Mount("/api/v1/", sub)
 	}
 
-	if cfg.RequestConfig.RequestorImpl == "mock" {
-		sub.Get("/archive/{id}", endpoints.ArchiveHandler)
-	}
-
 	r.Get("/", lubdub)
 	r.Get("/health", healthHandler)
 
@@ -61,22 +127,53 @@ func main() {
 	mr.Get("/", lubdub)
 	mr.Handle("/metrics", promhttp.Handler())
 
-	sub.With(endpoints.ResponseMetricsMiddleware).Get("/", lubdub)
-	sub.With(endpoints.ResponseMetricsMiddleware).Get("/payloads", endpoints.Payloads)
-	sub.With(endpoints.ResponseMetricsMiddleware).Get("/payloads/{request_id}", endpoints.RequestIdPayloads)
-	sub.With(endpoints.ResponseMetricsMiddleware).Get("/payloads/{request_id}/archiveLink", payloadArchiveLinkHandler)
-	sub.With(endpoints.ResponseMetricsMiddleware).Get("/payloads/{request_id}/kibanaLink", endpoints.PayloadKibanaLink)
-	sub.With(endpoints.ResponseMetricsMiddleware).Get("/roles/archiveLink", endpoints.RolesArchiveLink)
-	sub.With(endpoints.ResponseMetricsMiddleware).Get("/statuses", endpoints.Statuses)
+	endpoints.RegisterPayloadStreamRoutes(sub, *cfg, statusEvents)
+
+	// only the api routes are limited so that health probes keep working under load
+	sub.Group(func(limited chi.Router) {
+		limited.Use(endpoints.ConcurrencyLimitMiddleware(cfg.RequestConfig.MaxConcurrentRequests))
+		limited.Use(endpoints.PrettyJSONMiddleware)
+
+		if cfg.RequestConfig.RequestorImpl == "mock" {
+			limited.Get("/archive/{id}", endpoints.ArchiveHandler)
+		}
+
+		if cfg.AdminStatusInsert {
+			limited.With(endpoints.ResponseMetricsMiddleware, idempotent).Post("/admin/statuses", endpoints.InsertStatuses(*cfg, kafka.NewStatusInserter(cfg, db.DB)))
+		}
+
+		limited.With(endpoints.ResponseMetricsMiddleware).Get("/", lubdub)
+		endpoints.RegisterPayloadRoutes(limited, *cfg, orgRateLimit)
+		limited.With(endpoints.ResponseMetricsMiddleware).Get("/payloads/{request_id}/kibanaLink", endpoints.CreatePayloadKibanaLinkHandler(*cfg))
+		limited.With(endpoints.ResponseMetricsMiddleware).Get("/roles/archiveLink", endpoints.CreateRolesArchiveLinkHandler(*cfg))
+		limited.With(endpoints.ResponseMetricsMiddleware, orgRateLimit).Get("/statuses", endpoints.CreateStatusesHandler(*cfg))
+		limited.With(endpoints.ResponseMetricsMiddleware).Get("/statuses/distinct", endpoints.CreateDistinctStatusesHandler(*cfg))
+		limited.With(endpoints.ResponseMetricsMiddleware).Get("/services", endpoints.CreateServicesHandler(*cfg))
+		limited.With(endpoints.ResponseMetricsMiddleware).Get("/schema", endpoints.CreateSchemaHandler(*cfg))
+		if replayHandler != nil {
+			limited.With(endpoints.ResponseMetricsMiddleware, idempotent).Post("/admin/replay", replayHandler)
+		}
+		limited.With(endpoints.ResponseMetricsMiddleware).Get("/admin/config", endpoints.CreateAdminConfigHandler(*cfg))
+		limited.With(endpoints.ResponseMetricsMiddleware).Get("/admin/dbstats", endpoints.CreateDBStatsHandler(*cfg))
+		if reprocessHandler != nil {
+			limited.With(endpoints.ResponseMetricsMiddleware, idempotent).Post("/admin/reprocess/{request_id}", reprocessHandler)
+		}
+	})
 
 	srv := http.Server{
-		Addr:    ":" + cfg.PublicPort,
-		Handler: r,
+		Addr:         ":" + cfg.PublicPort,
+		Handler:      r,
+		ReadTimeout:  time.Duration(cfg.ServerConfig.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(cfg.ServerConfig.WriteTimeout) * time.Second,
+		IdleTimeout:  time.Duration(cfg.ServerConfig.IdleTimeout) * time.Second,
 	}
 
 	msrv := http.Server{
-		Addr:    ":" + cfg.MetricsPort,
-		Handler: mr,
+		Addr:         ":" + cfg.MetricsPort,
+		Handler:      mr,
+		ReadTimeout:  time.Duration(cfg.ServerConfig.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(cfg.ServerConfig.WriteTimeout) * time.Second,
+		IdleTimeout:  time.Duration(cfg.ServerConfig.IdleTimeout) * time.Second,
 	}
 
 	go func() {
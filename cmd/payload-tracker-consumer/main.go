@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -29,15 +30,19 @@ func main() {
 	logging.Log.Info("Setting up DB")
 	db.DbConnect(cfg)
 
-	healthHandler := endpoints.HealthCheckHandler(
+	control := &kafka.ConsumerControl{}
+
+	healthHandler := endpoints.ConsumerHealthCheckHandler(
 		db.DB,
 		*cfg,
+		control,
 	)
 
 	logging.Log.Info("Starting a new kafka consumer...")
 
 	// Webserver is created only for metrics collection
 	r := chi.NewRouter()
+	r.Use(endpoints.RecoverMiddleware)
 
 	// Mount the metrics handler on /metrics
 	r.Get("/", lubdub)
@@ -45,9 +50,28 @@ func main() {
 	r.Get("/ready", healthHandler)
 	r.Handle("/metrics", promhttp.Handler())
 
+	// the admin endpoints have a port of their own, the metrics port is open to anything in the cluster
+	ar := chi.NewRouter()
+	ar.Use(endpoints.RecoverMiddleware)
+
+	ar.Post("/admin/consumer/pause", endpoints.PauseConsumer(*cfg, control))
+	ar.Post("/admin/consumer/resume", endpoints.ResumeConsumer(*cfg, control))
+	ar.Get("/admin/config", endpoints.CreateAdminConfigHandler(*cfg))
+
 	msrv := http.Server{
-		Addr:    ":" + cfg.MetricsPort,
-		Handler: r,
+		Addr:         ":" + cfg.MetricsPort,
+		Handler:      r,
+		ReadTimeout:  time.Duration(cfg.ServerConfig.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(cfg.ServerConfig.WriteTimeout) * time.Second,
+		IdleTimeout:  time.Duration(cfg.ServerConfig.IdleTimeout) * time.Second,
+	}
+
+	asrv := http.Server{
+		Addr:         ":" + cfg.PrivatePort,
+		Handler:      ar,
+		ReadTimeout:  time.Duration(cfg.ServerConfig.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(cfg.ServerConfig.WriteTimeout) * time.Second,
+		IdleTimeout:  time.Duration(cfg.ServerConfig.IdleTimeout) * time.Second,
 	}
 
 	consumer, err := kafka.NewConsumer(ctx, cfg, cfg.KafkaConfig.KafkaTopic)
@@ -63,5 +87,16 @@ func main() {
 		}
 	}()
 
-	kafka.NewConsumerEventLoop(ctx, cfg, consumer, db.DB)
+	if cfg.PrivatePort == "" {
+		logging.Log.Warn("No private port is configured, the consumer admin endpoints are not served")
+	} else {
+		go func() {
+
+			if err := asrv.ListenAndServe(); err != nil {
+				panic(err)
+			}
+		}()
+	}
+
+	kafka.NewConsumerEventLoop(ctx, cfg, consumer, db.DB, control)
 }
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"reflect"
 	"strings"
 
 	"github.com/spf13/viper"
@@ -13,22 +14,45 @@ type TrackerConfig struct {
 	Environment                 string
 	PublicPort                  string
 	MetricsPort                 string
+	PrivatePort                 string
 	LogLevel                    string
+	LogLevelOverrides           []string
 	Hostname                    string
 	StorageBrokerURL            string
 	StorageBrokerURLRole        string
 	StorageBrokerRequestTimeout int
+	StorageBrokerRequestParam   string
+	StorageBrokerRequiredStatus string
+	StorageBrokerAllowedOrgs    []string
+	AdminRole                   string
+	StatusStreamRole            string
+	ReprocessRole               string
+	AdminStatusInsert           bool
+	ServerConfig                ServerCfg
 	KafkaConfig                 KafkaCfg
 	CloudwatchConfig            CloudwatchCfg
 	DatabaseConfig              DatabaseCfg
 	RequestConfig               RequestCfg
 	KibanaConfig                KibanaCfg
 	DebugConfig                 DebugCfg
+	EndpointConfig              EndpointCfg
+	ArchivePrefetchConfig       ArchivePrefetchCfg
+	IdempotencyConfig           IdempotencyCfg
+}
+
+// ServerCfg holds the http.Server timeouts in seconds. The write timeout bounds the whole
+// response, so it has to stay above the storage broker timeout and leave room for any
+// streamed/exported responses, which are cut off once it elapses.
+type ServerCfg struct {
+	ReadTimeout  int
+	WriteTimeout int
+	IdleTimeout  int
 }
 
 type KafkaCfg struct {
 	KafkaTimeout               int
 	KafkaGroupID               string
+	KafkaGroupInstanceHostname bool
 	KafkaAutoOffsetReset       string
 	KafkaAutoCommitInterval    int
 	KafkaRequestRequiredAcks   int
@@ -36,33 +60,91 @@ type KafkaCfg struct {
 	KafkaRetryBackoffMs        int
 	KafkaBootstrapServers      string
 	KafkaTopic                 string
+	KafkaDeadLetterTopic       string
+	KafkaReprocessTopic        string
+	KafkaEnrichedTopic         string
+	KafkaDeadLetterReplayLimit int
+	KafkaUnknownServicePolicy  string
+	KafkaServiceAliases        []string
+	KafkaFieldMapping          []string
+	KafkaRecordRawService      bool
+	KafkaRecordReceivedAt      bool
+	KafkaPollTimeoutMs         int
+	KafkaMaxPollRecords        int
+	KafkaMessageFormat         string
+	KafkaSchemaRegistryURL     string
 	KafkaUsername              string
-	KafkaPassword              string
+	KafkaPassword              string `sensitive:"true"`
 	KafkaCA                    string
 	SASLMechanism              string
 	Protocol                   string
 }
 
 type DatabaseCfg struct {
-	DBUser     string
-	DBPassword string
-	DBName     string
-	DBHost     string
-	DBPort     string
-	RDSCa      string
+	DBUser               string
+	DBPassword           string `sensitive:"true"`
+	DBName               string
+	DBHost               string
+	DBPort               string
+	RDSCa                string
+	DBReplicaDSN         string `sensitive:"true"`
+	DBInsertRetries      int
+	DBSlowQueryMs        int
+	DBMigrate            bool
+	DBStatementTimeoutMs int
+	DBConnectMaxWait     int
+	DBConnectIntervalMs  int
 }
 
 type CloudwatchCfg struct {
 	CWLogGroup  string
 	CWRegion    string
-	CWAccessKey string
-	CWSecretKey string
+	CWAccessKey string `sensitive:"true"`
+	CWSecretKey string `sensitive:"true"`
 }
 
 type RequestCfg struct {
 	ValidateRequestIDLength int
+	MinRequestIDPrefix      int
 	RequestorImpl           string
 	MaxRequestsPerMinute    int
+	TrustedProxies          []string
+	OrgRequestsPerMinute    int
+	OrgRateLimitOverrides   []string
+	OrgRateLimitExempt      []string
+	MaxConcurrentRequests   int
+	PageBase                int
+	DistinctCacheTTL        int
+	DBStatsCacheTTL         int
+	DBStatsExportInterval   int
+	PayloadsSortBy          []string
+	RequestIDSortBy         []string
+	PayloadsFilterOrder     []string
+	PayloadsQueryHints      []string
+	BusinessHoursTimezone   string
+	BusinessHoursStart      int
+	BusinessHoursEnd        int
+	TraceSampleRate         float64
+	StrictServiceValidation bool
+	StatsSampleLimit        int
+	StatsBucketLimit        int
+	MaxEventStreams         int
+	MaxStatusSubscribers    int
+	EventsHeartbeat         int
+	ResponseEnvelope        bool
+	ResponseFieldsInclude   []string
+	ResponseFieldsExclude   []string
+	MaxResponseBytes        int
+	MaxArchiveLinkBatch     int
+	ArchiveLookupWorkers    int
+	MaxSubqueryFilters      int
+	TerminalStatuses        []string
+	DefaultVerbosity        string
+	SLASeconds              int
+	MaxAccounts             int
+	TotalCountHeaderOnly    bool
+	MaxEmbeddedStatuses     int
+	MaxPageSize             int
 }
 
 type KibanaCfg struct {
@@ -72,7 +154,53 @@ type KibanaCfg struct {
 }
 
 type DebugCfg struct {
-	LogStatusJson bool
+	LogStatusJson      bool
+	ExplainSlowQueries bool
+}
+
+// EndpointCfg holds which of the api endpoints are registered, a disabled one answers 404
+type EndpointCfg struct {
+	Payloads    bool
+	RequestID   bool
+	ArchiveLink bool
+	Stats       bool
+}
+
+// ArchivePrefetchCfg holds the consumer side prefetch of archive links, the links are kept in the DB for
+// the api to serve PayloadArchiveLink from without asking storage-broker
+type ArchivePrefetchCfg struct {
+	Enabled       bool
+	Status        string
+	Workers       int
+	RatePerSecond float64
+	QueueSize     int
+	LinkTTL       int
+}
+
+// IdempotencyCfg holds how the admin write endpoints remember the responses to their Idempotency-Key headers
+type IdempotencyCfg struct {
+	Store string
+	TTL   int
+}
+
+const redacted = "[REDACTED]"
+
+// Redacted returns a copy of the config with every field tagged sensitive masked
+func (c TrackerConfig) Redacted() TrackerConfig {
+	redactFields(reflect.ValueOf(&c).Elem())
+	return c
+}
+
+func redactFields(value reflect.Value) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct:
+			redactFields(field)
+		case value.Type().Field(i).Tag.Get("sensitive") == "true" && field.Kind() == reflect.String && field.String() != "":
+			field.SetString(redacted)
+		}
+	}
 }
 
 // Get sets each config option with its defaults
@@ -91,26 +219,126 @@ func Get() *TrackerConfig {
 
 	// global logging
 	options.SetDefault("logLevel", "INFO")
+	// the deployments set LOG_LEVEL, LOGLEVEL is kept for the key's own name
+	options.BindEnv("logLevel", "LOGLEVEL", "LOG_LEVEL")
+	// module:level pairs logging one of endpoints, db_methods or consumer at another level than logLevel
+	options.SetDefault("log.level.overrides", "")
 	options.SetDefault("Hostname", hostname)
 
 	// kafka config
 	options.SetDefault("kafka.timeout", 10000)
 	options.SetDefault("kafka.group.id", "payload_tracker")
+	options.SetDefault("kafka.group.instance.hostname", false) // static membership with the hostname as the member, for stable pod names
 	options.SetDefault("kafka.auto.offset.reset", "latest")
 	options.SetDefault("kafka.auto.commit.interval.ms", 5000)
 	options.SetDefault("kafka.request.required.acks", -1) // -1 == "all"
 	options.SetDefault("kafka.message.send.max.retries", 15)
 	options.SetDefault("kafka.retry.backoff.ms", 100)
+	options.SetDefault("kafka.dlq.replay.limit", 100)
+	options.SetDefault("kafka.unknown.service.policy", "create") // create the service or dead_letter the message
+	// comma separated alias:service pairs, statuses sent under an alias are recorded for the service instead
+	options.SetDefault("kafka.service.aliases", "")
+	// comma separated field:name pairs, for producers sending a field under another name
+	options.SetDefault("kafka.field.mapping", "")
+	options.SetDefault("kafka.record.raw.service", false) // keep the name an aliased status was sent under in raw_service
+	// stamp each status with when it was persisted, apart from the date the producer gave it
+	options.SetDefault("kafka.record.received.at", true)
+	options.SetDefault("kafka.poll.timeout.ms", 100)
+	options.SetDefault("kafka.max.poll.records", 100) // events handled per poll before checking for signals and pauses
+	// json or avro, avro messages use the confluent wire format and need kafka.schema.registry.url
+	options.SetDefault("kafka.message.format", "json")
+	options.SetDefault("kafka.schema.registry.url", "")
+
+	// db config
+	options.SetDefault("db.insert.retries", 3)
+	options.SetDefault("db.replica.dsn", "") // queries use the primary unless a replica is set
+	options.SetDefault("db.slow.query.ms", 200)
+	options.SetDefault("db.migrate", false) // migrations run by pt-migration unless enabled
+	// postgres cancels statements running longer than this itself, 0 disables it
+	options.SetDefault("db.statement.timeout.ms", 30000)
+	// on startup the database is pinged from the interval, doubling, until it answers or the max wait runs out
+	options.SetDefault("db.connect.max.wait.seconds", 60)
+	options.SetDefault("db.connect.interval.ms", 1000)
 
 	// request config
 	options.SetDefault("validate.request.id.length", 32)
+	options.SetDefault("min.request.id.prefix", 4) // shorter request_id_prefix values would scan most of the payloads
 	options.SetDefault("requestor.impl", "storage-broker")
 	options.SetDefault("max.requests.per.minute", 3000)
+	options.SetDefault("trusted.proxies", "")          // comma separated CIDRs allowed to set X-Forwarded-For
+	options.SetDefault("org.requests.per.minute", 0)   // per org_id limit on the listing endpoints, 0 disables it
+	options.SetDefault("org.rate.limit.overrides", "") // comma separated org_id:limit pairs
+	options.SetDefault("org.rate.limit.exempt", "")    // comma separated org_ids, e.g. internal service accounts
+	options.SetDefault("max.concurrent.requests", 100)
+	options.SetDefault("page.base", 0) // whether the first page is 0 or 1
+	options.SetDefault("distinct.cache.ttl.seconds", 300)
+	options.SetDefault("dbstats.cache.ttl.seconds", 300)
+	options.SetDefault("dbstats.export.interval.seconds", 0) // how often the table size gauges are refreshed, 0 disables them
+	options.SetDefault("payloads.sort.by", "account,org_id,inventory_id,system_id,created_at")
+	options.SetDefault("request.id.sort.by", "service,source,status_msg,date,created_at")
+	options.SetDefault("payloads.filter.order", "request_id_prefix,inventory_id,system_id,org_id,account")
+	// comma separated filter+filter=hint entries, see Query Plan Tuning in the README
+	options.SetDefault("payloads.query.hints", "")
+	// business_hours=true keeps payloads created from the start hour up to the end hour in the timezone
+	options.SetDefault("business.hours.timezone", "UTC")
+	options.SetDefault("business.hours.start", 9)
+	options.SetDefault("business.hours.end", 17)
+	// share of requests from 0.0 to 1.0 that are logged at debug level along with their queries
+	options.SetDefault("trace.sample.rate", 0.0)
+	// reject filters naming services missing from the services table rather than matching nothing
+	options.SetDefault("strict.service.validation", false)
+	options.SetDefault("stats.sample.limit", 10000) // max payloads aggregated by the /stats endpoints
+	options.SetDefault("stats.bucket.limit", 100)   // max groups returned by the grouped /stats endpoints
+	options.SetDefault("max.event.streams", 100)
+	options.SetDefault("max.status.subscribers", 20)
+	options.SetDefault("events.heartbeat.seconds", 15)
+	options.SetDefault("response.envelope", false) // wrap the /payloads responses as {"meta": {...}, "data": [...]}
+	// comma separated payload and status fields kept in or left out of every response, empty keeps them all
+	options.SetDefault("response.fields.include", "")
+	options.SetDefault("response.fields.exclude", "")
+	options.SetDefault("max.response.bytes", 10485760)
+	options.SetDefault("max.archive.link.batch", 100)
+	options.SetDefault("archive.lookup.workers", 10) // storage-broker requests made at once by a single request
+	// max status subqueries one /payloads request may stack, each service_status pair is one of them
+	options.SetDefault("max.subquery.filters", 20)
+	// statuses that end a payload's processing, marked on /payloads rows with include_terminal=true
+	options.SetDefault("terminal.statuses", "success,error")
+	// verbosity of /payloads/{request_id} when the request doesn't give one, 0 returns every status field
+	options.SetDefault("default.verbosity", "0")
+	// processing time budget of a payload reported with include_sla=true, 0 leaves include_sla unsupported
+	options.SetDefault("sla.seconds", 0)
+	options.SetDefault("max.accounts", 50) // accounts in a single /payloads account list
+	// leave count out of the /payloads body for clients that read it from the X-Total-Count header
+	options.SetDefault("total.count.header.only", false)
+	// statuses nested in a whole /payloads page with embed=statuses, shared out evenly between its payloads
+	options.SetDefault("max.embedded.statuses", 1000)
+	options.SetDefault("max.page.size", 1000) // largest page_size a request may ask for
 
 	// storage broker config
 	options.SetDefault("storageBrokerURL", "http://storage-broker-processor:8000/archive/url")
 	options.SetDefault("storageBrokerURLRole", "platform-archive-download")
 	options.SetDefault("storageBrokerRequestTimeout", 35000)
+	options.SetDefault("storageBrokerRequestParam", "request_id") // the query parameter storage-broker reads the request id from
+	// status, or service:status, a payload must have reported before a link is requested, empty requests it for any payload
+	options.SetDefault("storageBrokerRequiredStatus", "")
+	// comma separated org_ids allowed archive links on top of the role, empty allows every org
+	options.SetDefault("storageBrokerAllowedOrgs", "")
+
+	// server config
+	options.SetDefault("server.read.timeout", 30)
+	options.SetDefault("server.write.timeout", 300)
+	options.SetDefault("server.idle.timeout", 120)
+
+	// admin config
+	options.SetDefault("adminRole", "payload-tracker-admin")
+	options.SetDefault("statusStreamRole", "payload-tracker-admin")
+	options.SetDefault("reprocessRole", "payload-tracker-reprocess") // kept apart from adminRole as it makes services redo work
+	// POST /admin/statuses writes statuses without kafka, for integration tests and backfills
+	options.SetDefault("adminStatusInsert", false)
+	// responses to admin writes with an Idempotency-Key are kept in memory, or in the DB to be shared by the replicas
+	options.SetDefault("idempotency.store", "memory")
+	options.SetDefault("idempotency.ttl.seconds", 86400)
+
 	// kibana config
 	options.SetDefault("kibana.url", "https://kibana.apps.crcs02ue1.urby.p1.openshiftapps.com/app/kibana#/discover")
 	options.SetDefault("kibana.index", "43c5fed0-d5ce-11ea-b58c-a7c95afd7a5d") // the index grabbed from the kibana url
@@ -118,6 +346,23 @@ func Get() *TrackerConfig {
 
 	// debug config
 	options.SetDefault("debug.log.status.json", false)
+	options.SetDefault("debug.explain.slow.queries", false)
+
+	// endpoint config
+	options.SetDefault("endpoints.payloads.enabled", true)     // GET /payloads
+	options.SetDefault("endpoints.request.id.enabled", true)   // GET /payloads/{request_id}
+	options.SetDefault("endpoints.archive.link.enabled", true) // the single and batch archive link lookups
+	options.SetDefault("endpoints.stats.enabled", true)        // every /stats endpoint
+
+	// archive link prefetch config
+	options.SetDefault("archive.prefetch.enabled", false)
+	// status, or service:status, that a payload's archive is prefetched at
+	options.SetDefault("archive.prefetch.status", "upload-success")
+	options.SetDefault("archive.prefetch.workers", 5)
+	options.SetDefault("archive.prefetch.rate.per.second", 10) // storage-broker requests across the workers
+	options.SetDefault("archive.prefetch.queue.size", 1000)    // payloads waiting for a worker, more are dropped
+	// storage-broker links are presigned, so they are only served while they are still valid
+	options.SetDefault("archive.prefetch.link.ttl.seconds", 600)
 
 	if clowder.IsClowderEnabled() {
 		cfg := clowder.LoadedConfig
@@ -125,9 +370,13 @@ func Get() *TrackerConfig {
 		// kafka
 		options.SetDefault("kafka.bootstrap.servers", strings.Join(clowder.KafkaServers, ","))
 		options.SetDefault("topic.payload.status", clowder.KafkaTopics["platform.payload-status"].Name)
+		options.SetDefault("topic.payload.status.dlq", clowder.KafkaTopics["platform.payload-status.dlq"].Name)
+		options.SetDefault("topic.payload.reprocess", clowder.KafkaTopics["platform.upload.announce"].Name)
+		options.SetDefault("topic.payload.status.enriched", clowder.KafkaTopics["platform.payload-status.enriched"].Name)
 		// ports
 		options.SetDefault("publicPort", cfg.PublicPort)
 		options.SetDefault("metricsPort", cfg.MetricsPort)
+		options.SetDefault("privatePort", cfg.PrivatePort)
 		// database
 		options.SetDefault("db.user", cfg.Database.Username)
 		options.SetDefault("db.password", cfg.Database.Password)
@@ -144,9 +393,13 @@ func Get() *TrackerConfig {
 	} else {
 		options.SetDefault("kafka.bootstrap.servers", "localhost:29092")
 		options.SetDefault("topic.payload.status", "platform.payload-status")
+		options.SetDefault("topic.payload.status.dlq", "")
+		options.SetDefault("topic.payload.reprocess", "platform.upload.announce")
+		options.SetDefault("topic.payload.status.enriched", "")
 		// ports
 		options.SetDefault("publicPort", "8080")
 		options.SetDefault("metricsPort", "8081")
+		options.SetDefault("privatePort", "8082")
 		// database
 		options.SetDefault("db.user", "crc")
 		options.SetDefault("db.password", "crc")
@@ -167,14 +420,29 @@ func Get() *TrackerConfig {
 		Environment:                 options.GetString("Environment"),
 		Hostname:                    options.GetString("Hostname"),
 		LogLevel:                    options.GetString("logLevel"),
+		LogLevelOverrides:           splitList(options.GetString("log.level.overrides")),
 		PublicPort:                  options.GetString("publicPort"),
 		MetricsPort:                 options.GetString("metricsPort"),
+		PrivatePort:                 options.GetString("privatePort"),
 		StorageBrokerURL:            options.GetString("storageBrokerURL"),
 		StorageBrokerURLRole:        options.GetString("storageBrokerURLRole"),
 		StorageBrokerRequestTimeout: options.GetInt("storageBrokerRequestTimeout"),
+		StorageBrokerRequestParam:   options.GetString("storageBrokerRequestParam"),
+		StorageBrokerRequiredStatus: options.GetString("storageBrokerRequiredStatus"),
+		StorageBrokerAllowedOrgs:    splitList(options.GetString("storageBrokerAllowedOrgs")),
+		AdminRole:                   options.GetString("adminRole"),
+		StatusStreamRole:            options.GetString("statusStreamRole"),
+		ReprocessRole:               options.GetString("reprocessRole"),
+		AdminStatusInsert:           options.GetBool("adminStatusInsert"),
+		ServerConfig: ServerCfg{
+			ReadTimeout:  options.GetInt("server.read.timeout"),
+			WriteTimeout: options.GetInt("server.write.timeout"),
+			IdleTimeout:  options.GetInt("server.idle.timeout"),
+		},
 		KafkaConfig: KafkaCfg{
 			KafkaTimeout:               options.GetInt("kafka.timeout"),
 			KafkaGroupID:               options.GetString("kafka.group.id"),
+			KafkaGroupInstanceHostname: options.GetBool("kafka.group.instance.hostname"),
 			KafkaAutoOffsetReset:       options.GetString("kafka.auto.offset.reset"),
 			KafkaAutoCommitInterval:    options.GetInt("kafka.auto.commit.interval.ms"),
 			KafkaRequestRequiredAcks:   options.GetInt("kafka.request.required.acks"),
@@ -182,13 +450,33 @@ func Get() *TrackerConfig {
 			KafkaRetryBackoffMs:        options.GetInt("kafka.retry.backoff.ms"),
 			KafkaBootstrapServers:      options.GetString("kafka.bootstrap.servers"),
 			KafkaTopic:                 options.GetString("topic.payload.status"),
+			KafkaDeadLetterTopic:       options.GetString("topic.payload.status.dlq"),
+			KafkaReprocessTopic:        options.GetString("topic.payload.reprocess"),
+			KafkaEnrichedTopic:         options.GetString("topic.payload.status.enriched"),
+			KafkaUnknownServicePolicy:  options.GetString("kafka.unknown.service.policy"),
+			KafkaServiceAliases:        splitList(options.GetString("kafka.service.aliases")),
+			KafkaFieldMapping:          splitList(options.GetString("kafka.field.mapping")),
+			KafkaRecordRawService:      options.GetBool("kafka.record.raw.service"),
+			KafkaRecordReceivedAt:      options.GetBool("kafka.record.received.at"),
+			KafkaPollTimeoutMs:         options.GetInt("kafka.poll.timeout.ms"),
+			KafkaMaxPollRecords:        options.GetInt("kafka.max.poll.records"),
+			KafkaMessageFormat:         options.GetString("kafka.message.format"),
+			KafkaSchemaRegistryURL:     options.GetString("kafka.schema.registry.url"),
+			KafkaDeadLetterReplayLimit: options.GetInt("kafka.dlq.replay.limit"),
 		},
 		DatabaseConfig: DatabaseCfg{
-			DBUser:     options.GetString("db.user"),
-			DBPassword: options.GetString("db.password"),
-			DBName:     options.GetString("db.name"),
-			DBHost:     options.GetString("db.host"),
-			DBPort:     options.GetString("db.port"),
+			DBUser:               options.GetString("db.user"),
+			DBPassword:           options.GetString("db.password"),
+			DBName:               options.GetString("db.name"),
+			DBHost:               options.GetString("db.host"),
+			DBPort:               options.GetString("db.port"),
+			DBReplicaDSN:         options.GetString("db.replica.dsn"),
+			DBInsertRetries:      options.GetInt("db.insert.retries"),
+			DBSlowQueryMs:        options.GetInt("db.slow.query.ms"),
+			DBMigrate:            options.GetBool("db.migrate"),
+			DBStatementTimeoutMs: options.GetInt("db.statement.timeout.ms"),
+			DBConnectMaxWait:     options.GetInt("db.connect.max.wait.seconds"),
+			DBConnectIntervalMs:  options.GetInt("db.connect.interval.ms"),
 		},
 		CloudwatchConfig: CloudwatchCfg{
 			CWLogGroup:  options.GetString("logGroup"),
@@ -198,8 +486,46 @@ func Get() *TrackerConfig {
 		},
 		RequestConfig: RequestCfg{
 			ValidateRequestIDLength: options.GetInt("validate.request.id.length"),
+			MinRequestIDPrefix:      options.GetInt("min.request.id.prefix"),
 			RequestorImpl:           options.GetString("requestor.impl"),
 			MaxRequestsPerMinute:    options.GetInt("max.requests.per.minute"),
+			TrustedProxies:          splitList(options.GetString("trusted.proxies")),
+			OrgRequestsPerMinute:    options.GetInt("org.requests.per.minute"),
+			OrgRateLimitOverrides:   splitList(options.GetString("org.rate.limit.overrides")),
+			OrgRateLimitExempt:      splitList(options.GetString("org.rate.limit.exempt")),
+			MaxConcurrentRequests:   options.GetInt("max.concurrent.requests"),
+			PageBase:                options.GetInt("page.base"),
+			DistinctCacheTTL:        options.GetInt("distinct.cache.ttl.seconds"),
+			DBStatsCacheTTL:         options.GetInt("dbstats.cache.ttl.seconds"),
+			DBStatsExportInterval:   options.GetInt("dbstats.export.interval.seconds"),
+			PayloadsSortBy:          splitList(options.GetString("payloads.sort.by")),
+			RequestIDSortBy:         splitList(options.GetString("request.id.sort.by")),
+			PayloadsFilterOrder:     splitList(options.GetString("payloads.filter.order")),
+			PayloadsQueryHints:      splitList(options.GetString("payloads.query.hints")),
+			BusinessHoursTimezone:   options.GetString("business.hours.timezone"),
+			BusinessHoursStart:      options.GetInt("business.hours.start"),
+			BusinessHoursEnd:        options.GetInt("business.hours.end"),
+			TraceSampleRate:         options.GetFloat64("trace.sample.rate"),
+			StrictServiceValidation: options.GetBool("strict.service.validation"),
+			StatsSampleLimit:        options.GetInt("stats.sample.limit"),
+			StatsBucketLimit:        options.GetInt("stats.bucket.limit"),
+			MaxEventStreams:         options.GetInt("max.event.streams"),
+			MaxStatusSubscribers:    options.GetInt("max.status.subscribers"),
+			EventsHeartbeat:         options.GetInt("events.heartbeat.seconds"),
+			ResponseEnvelope:        options.GetBool("response.envelope"),
+			ResponseFieldsInclude:   splitList(options.GetString("response.fields.include")),
+			ResponseFieldsExclude:   splitList(options.GetString("response.fields.exclude")),
+			MaxResponseBytes:        options.GetInt("max.response.bytes"),
+			MaxArchiveLinkBatch:     options.GetInt("max.archive.link.batch"),
+			ArchiveLookupWorkers:    options.GetInt("archive.lookup.workers"),
+			MaxSubqueryFilters:      options.GetInt("max.subquery.filters"),
+			TerminalStatuses:        splitList(options.GetString("terminal.statuses")),
+			DefaultVerbosity:        options.GetString("default.verbosity"),
+			SLASeconds:              options.GetInt("sla.seconds"),
+			MaxAccounts:             options.GetInt("max.accounts"),
+			TotalCountHeaderOnly:    options.GetBool("total.count.header.only"),
+			MaxEmbeddedStatuses:     options.GetInt("max.embedded.statuses"),
+			MaxPageSize:             options.GetInt("max.page.size"),
 		},
 		KibanaConfig: KibanaCfg{
 			DashboardURL: options.GetString("kibana.url"),
@@ -207,7 +533,26 @@ func Get() *TrackerConfig {
 			ServiceField: options.GetString("kibana.service.field"),
 		},
 		DebugConfig: DebugCfg{
-			LogStatusJson: options.GetBool("debug.log.status.json"),
+			LogStatusJson:      options.GetBool("debug.log.status.json"),
+			ExplainSlowQueries: options.GetBool("debug.explain.slow.queries"),
+		},
+		EndpointConfig: EndpointCfg{
+			Payloads:    options.GetBool("endpoints.payloads.enabled"),
+			RequestID:   options.GetBool("endpoints.request.id.enabled"),
+			ArchiveLink: options.GetBool("endpoints.archive.link.enabled"),
+			Stats:       options.GetBool("endpoints.stats.enabled"),
+		},
+		ArchivePrefetchConfig: ArchivePrefetchCfg{
+			Enabled:       options.GetBool("archive.prefetch.enabled"),
+			Status:        options.GetString("archive.prefetch.status"),
+			Workers:       options.GetInt("archive.prefetch.workers"),
+			RatePerSecond: options.GetFloat64("archive.prefetch.rate.per.second"),
+			QueueSize:     options.GetInt("archive.prefetch.queue.size"),
+			LinkTTL:       options.GetInt("archive.prefetch.link.ttl.seconds"),
+		},
+		IdempotencyConfig: IdempotencyCfg{
+			Store: options.GetString("idempotency.store"),
+			TTL:   options.GetInt("idempotency.ttl.seconds"),
 		},
 	}
 
@@ -246,3 +591,14 @@ func Get() *TrackerConfig {
 
 	return trackerCfg
 }
+
+// splitList splits a comma separated config value, dropping any empty entries
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
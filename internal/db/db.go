@@ -2,6 +2,13 @@ package db
 
 import (
 	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 
 	"github.com/redhatinsights/payload-tracker-go/internal/config"
 	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
@@ -10,9 +17,99 @@ import (
 	"gorm.io/gorm"
 )
 
-var DB *gorm.DB
+var (
+	DB *gorm.DB
+	// ReadDB serves the query endpoints, it is the read replica when one is configured and DB otherwise
+	ReadDB *gorm.DB
+)
 
 func DbConnect(cfg *config.TrackerConfig) {
+	DB = open(cfg, dsn(cfg), "primary")
+	ReadDB = DB
+
+	if cfg.DatabaseConfig.DBMigrate {
+		if err := Migrate(DB); err != nil {
+			l.Log.Fatal(err)
+		}
+	}
+
+	if cfg.DatabaseConfig.DBReplicaDSN != "" {
+		ReadDB = open(cfg, cfg.DatabaseConfig.DBReplicaDSN, "replica")
+		l.Log.Info("Queries use the read replica")
+	}
+
+	l.Log.Info("DB initialization complete")
+}
+
+// open connects a pool and exposes its connection usage as the go_sql_* metrics labelled with the pool name
+func open(cfg *config.TrackerConfig, dsn string, pool string) *gorm.DB {
+	connConfig, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		l.Log.Fatal(err)
+	}
+	// set per connection, so that postgres cancels a runaway query even when nothing else does
+	if timeout := cfg.DatabaseConfig.DBStatementTimeoutMs; timeout > 0 {
+		connConfig.RuntimeParams["statement_timeout"] = strconv.Itoa(timeout)
+	}
+
+	sqlDB := stdlib.OpenDB(*connConfig)
+	maxWait := time.Duration(cfg.DatabaseConfig.DBConnectMaxWait) * time.Second
+	interval := time.Duration(cfg.DatabaseConfig.DBConnectIntervalMs) * time.Millisecond
+	if err := waitForDB(sqlDB.Ping, maxWait, interval, pool); err != nil {
+		l.Log.Fatal(err)
+	}
+
+	// the connection was just checked, so gorm doesn't ping it again
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		l.Log.Fatal(err)
+	}
+
+	if err := registerStatementTimeoutTracking(db); err != nil {
+		l.Log.Fatal(err)
+	}
+
+	if cfg.DebugConfig.ExplainSlowQueries {
+		if err := registerSlowQueryExplain(db, time.Duration(cfg.DatabaseConfig.DBSlowQueryMs)*time.Millisecond); err != nil {
+			l.Log.Fatal(err)
+		}
+	}
+
+	prometheus.MustRegister(collectors.NewDBStatsCollector(sqlDB, pool))
+
+	return db
+}
+
+// waitForDB pings until the database answers, so that the pod doesn't exit while the database is still starting.
+// The wait between attempts doubles from the interval and pinging stops once maxWait has passed.
+func waitForDB(ping func() error, maxWait time.Duration, interval time.Duration, pool string) error {
+	deadline := time.Now().Add(maxWait)
+	wait := interval
+
+	for attempt := 1; ; attempt++ {
+		err := ping()
+		if err == nil {
+			if attempt > 1 {
+				l.Log.Infof("Connected to the %s database after %d attempts", pool, attempt)
+			}
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 || wait <= 0 {
+			return fmt.Errorf("%s database is unreachable after %d attempts: %v", pool, attempt, err)
+		}
+		if wait > remaining {
+			wait = remaining
+		}
+
+		l.Log.Warnf("The %s database is not ready, attempt %d failed, retrying in %v: %v", pool, attempt, wait, err)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+func dsn(cfg *config.TrackerConfig) string {
 	var (
 		user     = cfg.DatabaseConfig.DBUser
 		password = cfg.DatabaseConfig.DBPassword
@@ -26,14 +123,5 @@ func DbConnect(cfg *config.TrackerConfig) {
 		sslmode = "require"
 	}
 
-	dsn := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=%s", user, password, dbname, host, port, sslmode)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		l.Log.Fatal(err)
-	}
-
-	DB = db
-
-	l.Log.Info("DB initialization complete")
+	return fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=%s", user, password, dbname, host, port, sslmode)
 }
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Waiting for the database", func() {
+	It("Retries until the database answers", func() {
+		attempts := 0
+		ping := func() error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("connection refused")
+			}
+			return nil
+		}
+
+		Expect(waitForDB(ping, time.Second, time.Millisecond, "primary")).To(Succeed())
+		Expect(attempts).To(Equal(3))
+	})
+
+	It("Gives up after the max wait", func() {
+		attempts := 0
+		ping := func() error {
+			attempts++
+			return errors.New("connection refused")
+		}
+
+		start := time.Now()
+		err := waitForDB(ping, 20*time.Millisecond, 5*time.Millisecond, "primary")
+		Expect(err).To(MatchError(ContainSubstring("connection refused")))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(attempts).To(BeNumerically(">", 1))
+	})
+
+	It("Doesn't retry without a max wait", func() {
+		attempts := 0
+		ping := func() error {
+			attempts++
+			return errors.New("connection refused")
+		}
+
+		Expect(waitForDB(ping, 0, time.Millisecond, "primary")).ToNot(Succeed())
+		Expect(attempts).To(Equal(1))
+	})
+})
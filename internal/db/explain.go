@@ -0,0 +1,61 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+)
+
+const queryStartKey = "payload_tracker:query_start"
+
+// registerSlowQueryExplain logs the EXPLAIN plan of every SELECT taking longer than the threshold
+func registerSlowQueryExplain(db *gorm.DB, threshold time.Duration) error {
+	err := db.Callback().Query().Before("gorm:query").Register("payload_tracker:query_start", func(tx *gorm.DB) {
+		tx.InstanceSet(queryStartKey, time.Now())
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.Callback().Query().After("gorm:query").Register("payload_tracker:explain_slow_query", func(tx *gorm.DB) {
+		start, ok := tx.InstanceGet(queryStartKey)
+		if !ok || tx.Error != nil {
+			return
+		}
+		elapsed := time.Since(start.(time.Time))
+		if elapsed < threshold {
+			return
+		}
+
+		sql := tx.Statement.SQL.String()
+		if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(sql)), "SELECT") {
+			return
+		}
+		explain(tx, sql, elapsed)
+	})
+}
+
+func explain(tx *gorm.DB, sql string, elapsed time.Duration) {
+	// the statement already holds postgres placeholders, so it goes straight to the connection pool
+	rows, err := tx.Statement.ConnPool.QueryContext(tx.Statement.Context, "EXPLAIN "+sql, tx.Statement.Vars...)
+	if err != nil {
+		l.Log.Error("Failed to explain slow query: ", err)
+		return
+	}
+	defer rows.Close()
+
+	var plan []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			l.Log.Error("Failed to read slow query plan: ", err)
+			return
+		}
+		plan = append(plan, line)
+	}
+
+	l.Log.Warnf("Slow query took %s: %s\n%s", elapsed, tx.Dialector.Explain(sql, tx.Statement.Vars...), strings.Join(plan, "\n"))
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+)
+
+// planConnector stands in for postgres, answering every query after the delay with no rows and every EXPLAIN with the plan
+type planConnector struct {
+	delay time.Duration
+	plan  []string
+
+	mu      sync.Mutex
+	queries []string
+}
+
+func (c *planConnector) Connect(context.Context) (driver.Conn, error) {
+	return planConn{c}, nil
+}
+
+func (c *planConnector) Driver() driver.Driver {
+	return nil
+}
+
+func (c *planConnector) executed() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.queries...)
+}
+
+type planConn struct {
+	connector *planConnector
+}
+
+func (c planConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("statements are not prepared")
+}
+
+func (c planConn) Close() error {
+	return nil
+}
+
+func (c planConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (c planConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.connector.mu.Lock()
+	c.connector.queries = append(c.connector.queries, query)
+	c.connector.mu.Unlock()
+
+	if strings.HasPrefix(query, "EXPLAIN ") {
+		return &planRows{columns: []string{"QUERY PLAN"}, values: c.connector.plan}, nil
+	}
+	time.Sleep(c.connector.delay)
+	return &planRows{columns: []string{"id"}}, nil
+}
+
+type planRows struct {
+	columns []string
+	values  []string
+}
+
+func (r *planRows) Columns() []string {
+	return r.columns
+}
+
+func (r *planRows) Close() error {
+	return nil
+}
+
+func (r *planRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+var _ = Describe("Slow query EXPLAIN", func() {
+	var (
+		hook  *logrustest.Hook
+		level logrus.Level
+	)
+
+	openExplaining := func(connector *planConnector, threshold time.Duration) *gorm.DB {
+		db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(connector)}), &gorm.Config{
+			DisableAutomaticPing: true,
+			Logger:               logger.Discard,
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(registerSlowQueryExplain(db, threshold)).To(Succeed())
+		return db
+	}
+
+	slowQueryLogs := func() []*logrus.Entry {
+		var entries []*logrus.Entry
+		for _, entry := range hook.AllEntries() {
+			if strings.HasPrefix(entry.Message, "Slow query took") {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+
+	BeforeEach(func() {
+		// the suite only logs fatal entries
+		level = l.Log.GetLevel()
+		l.Log.SetLevel(logrus.WarnLevel)
+		hook = logrustest.NewLocal(l.Log)
+	})
+
+	AfterEach(func() {
+		l.Log.SetLevel(level)
+	})
+
+	It("Logs the bound query and its plan for a SELECT over the threshold", func() {
+		connector := &planConnector{
+			delay: 20 * time.Millisecond,
+			plan:  []string{"Index Scan using payloads_request_id_idx on payloads", "  Index Cond: (request_id = 'abc')"},
+		}
+		db := openExplaining(connector, 10*time.Millisecond)
+
+		var rows []map[string]interface{}
+		db.Table("payloads").Where("request_id = ?", "abc").Find(&rows)
+
+		Expect(connector.executed()).To(Equal([]string{
+			`SELECT * FROM "payloads" WHERE request_id = $1`,
+			`EXPLAIN SELECT * FROM "payloads" WHERE request_id = $1`,
+		}))
+
+		entries := slowQueryLogs()
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Level).To(Equal(logrus.WarnLevel))
+		lines := strings.Split(entries[0].Message, "\n")
+		Expect(lines[0]).To(HavePrefix("Slow query took "))
+		Expect(lines[0]).To(HaveSuffix(`: SELECT * FROM "payloads" WHERE request_id = 'abc'`))
+		Expect(lines[1:]).To(Equal(connector.plan))
+	})
+
+	It("Leaves queries under the threshold alone", func() {
+		connector := &planConnector{plan: []string{"Seq Scan on payloads"}}
+		db := openExplaining(connector, time.Second)
+
+		var rows []map[string]interface{}
+		db.Table("payloads").Find(&rows)
+
+		Expect(connector.executed()).To(Equal([]string{`SELECT * FROM "payloads"`}))
+		Expect(slowQueryLogs()).To(BeEmpty())
+	})
+
+	It("Only explains SELECTs", func() {
+		connector := &planConnector{delay: 20 * time.Millisecond, plan: []string{"Seq Scan on payloads"}}
+		db := openExplaining(connector, 10*time.Millisecond)
+
+		var rows []map[string]interface{}
+		db.Raw("SHOW statement_timeout").Find(&rows)
+
+		Expect(connector.executed()).To(Equal([]string{"SHOW statement_timeout"}))
+		Expect(slowQueryLogs()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+	"github.com/redhatinsights/payload-tracker-go/internal/queries"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+)
+
+const listenRetryInterval = 5 * time.Second
+
+// ListenStatusEvents passes every status published by the consumer to publish until the context is done.
+// It holds its own connection outside of the gorm pool and reconnects whenever that connection drops.
+func ListenStatusEvents(ctx context.Context, cfg *config.TrackerConfig, publish func(structs.SinglePayloadData)) {
+	for {
+		err := listen(ctx, cfg, publish)
+		if ctx.Err() != nil {
+			return
+		}
+		l.Log.Error("Listening for status events failed, reconnecting: ", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryInterval):
+		}
+	}
+}
+
+func listen(ctx context.Context, cfg *config.TrackerConfig, publish func(structs.SinglePayloadData)) error {
+	conn, err := pgx.Connect(ctx, dsn(cfg))
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+queries.StatusEventsChannel); err != nil {
+		return err
+	}
+	l.Log.Info("Listening for status events")
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var event structs.SinglePayloadData
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			l.Log.Error("Invalid status event: ", err)
+			continue
+		}
+		publish(event)
+	}
+}
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+)
+
+// migrationLockID is the advisory lock serializing runners started by several replicas at once
+const migrationLockID = 7411001
+
+type migration struct {
+	version uint
+	name    string
+	up      func(tx *gorm.DB) error
+}
+
+// migrations are applied in order and must never be edited or reordered once released, add a new version instead
+var migrations = []migration{
+	// the models are copied as they were when each migration was released, so later changes to them don't
+	// change what a migration creates on a new database
+	{1, "create tables", func(tx *gorm.DB) error {
+		type Payloads struct {
+			Id          uint      `gorm:"primaryKey;not null;autoIncrement"`
+			RequestId   string    `gorm:"not null;type:varchar;unique"`
+			Account     string    `gorm:"type:varchar"`
+			InventoryId string    `gorm:"type:varchar"`
+			SystemId    string    `gorm:"type:varchar"`
+			CreatedAt   time.Time `gorm:"not null"`
+			OrgId       string    `gorm:"type:varchar"`
+		}
+		type Services struct {
+			Id   int32  `gorm:"primaryKey;not null;autoIncrement"`
+			Name string `gorm:"not null;type:varchar"`
+		}
+		type Sources struct {
+			Id   int32  `gorm:"primaryKey;not null;autoIncrement"`
+			Name string `gorm:"not null;type:varchar"`
+		}
+		type Statuses struct {
+			Id   int32  `gorm:"primaryKey;not null;autoIncrement"`
+			Name string `gorm:"not null;type:varchar"`
+		}
+		type PayloadStatuses struct {
+			ID        uint  `gorm:"primaryKey;not null;autoIncrement"`
+			PayloadId uint  `gorm:"not null"`
+			ServiceId int32 `gorm:"not null"`
+			SourceId  int32
+			StatusId  int32     `gorm:"not null"`
+			StatusMsg string    `gorm:"type:varchar"`
+			Date      time.Time `gorm:"primaryKey;not null"`
+			CreatedAt time.Time `gorm:"not null"`
+			Payload   Payloads
+			Service   Services
+			Source    Sources
+			Status    Statuses
+		}
+
+		return tx.AutoMigrate(
+			&Services{},
+			&Sources{},
+			&Statuses{},
+			&PayloadStatuses{},
+			&Payloads{},
+		)
+	}},
+	{2, "bigint payload ids", func(tx *gorm.DB) error {
+		return tx.Exec("ALTER SEQUENCE payloads_id_seq AS bigint").Error
+	}},
+	{3, "payload status received_at", func(tx *gorm.DB) error {
+		return tx.Exec("ALTER TABLE payload_statuses ADD COLUMN IF NOT EXISTS received_at timestamptz").Error
+	}},
+	{4, "payload status raw_service", func(tx *gorm.DB) error {
+		return tx.Exec("ALTER TABLE payload_statuses ADD COLUMN IF NOT EXISTS raw_service varchar").Error
+	}},
+	{5, "payload deleted_at", func(tx *gorm.DB) error {
+		return tx.Exec("ALTER TABLE payloads ADD COLUMN IF NOT EXISTS deleted_at timestamptz").Error
+	}},
+	// status_msg stays varchar since most messages aren't JSON, the function casts the ones that are for msg_path
+	{6, "status_msg jsonb cast", func(tx *gorm.DB) error {
+		return tx.Exec(`CREATE OR REPLACE FUNCTION status_msg_jsonb(msg text) RETURNS jsonb AS $$
+			BEGIN
+				RETURN msg::jsonb;
+			EXCEPTION WHEN others THEN
+				RETURN NULL;
+			END;
+			$$ LANGUAGE plpgsql IMMUTABLE`).Error
+	}},
+	{7, "archive links", func(tx *gorm.DB) error {
+		type ArchiveLinks struct {
+			RequestId string    `gorm:"primaryKey;type:varchar"`
+			Url       string    `gorm:"not null;type:varchar"`
+			ExpiresAt time.Time `gorm:"not null"`
+		}
+
+		return tx.AutoMigrate(&ArchiveLinks{})
+	}},
+	{8, "idempotency keys", func(tx *gorm.DB) error {
+		type IdempotencyKeys struct {
+			Key         string    `gorm:"primaryKey;type:varchar"`
+			StatusCode  int       `gorm:"not null"`
+			ContentType string    `gorm:"type:varchar"`
+			Body        []byte    `gorm:"type:bytea"`
+			ExpiresAt   time.Time `gorm:"not null"`
+		}
+
+		return tx.AutoMigrate(&IdempotencyKeys{})
+	}},
+	{9, "idempotency request hash", func(tx *gorm.DB) error {
+		return tx.Exec("ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS request_hash varchar").Error
+	}},
+}
+
+// SchemaMigrations records every applied migration version
+type SchemaMigrations struct {
+	Version   uint `gorm:"primaryKey;autoIncrement:false"`
+	Dirty     bool
+	AppliedAt time.Time
+}
+
+// Migrate applies the pending migrations, it is a no-op when the schema is up to date and
+// fails without changing anything when a previous run left a migration dirty
+func Migrate(db *gorm.DB) error {
+	return db.Connection(func(conn *gorm.DB) error {
+		// waiting on the lock and rewriting large tables can both outlast the statement timeout
+		if err := conn.Exec("SET statement_timeout = 0").Error; err != nil {
+			return err
+		}
+		defer conn.Exec("RESET statement_timeout")
+
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockID).Error; err != nil {
+			return err
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockID)
+
+		if err := conn.AutoMigrate(&SchemaMigrations{}); err != nil {
+			return err
+		}
+
+		var dirty []SchemaMigrations
+		if err := conn.Where("dirty").Find(&dirty).Error; err != nil {
+			return err
+		}
+		if len(dirty) > 0 {
+			return fmt.Errorf("migration %d is dirty, fix the schema and clear its dirty flag before migrating", dirty[0].Version)
+		}
+
+		var current uint
+		if err := conn.Model(&SchemaMigrations{}).Select("COALESCE(max(version), 0)").Scan(&current).Error; err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if m.version <= current {
+				continue
+			}
+			if err := apply(conn, m); err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %v", m.version, m.name, err)
+			}
+			l.Log.Infof("Applied migration %d (%s)", m.version, m.name)
+		}
+
+		return nil
+	})
+}
+
+// apply marks the version dirty before running the migration so a crash part way through is caught by the next run
+func apply(conn *gorm.DB, m migration) error {
+	record := SchemaMigrations{Version: m.version, Dirty: true, AppliedAt: time.Now()}
+	if err := conn.Create(&record).Error; err != nil {
+		return err
+	}
+
+	if err := conn.Transaction(m.up); err != nil {
+		return err
+	}
+
+	return conn.Model(&record).Update("dirty", false).Error
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/jackc/pgconn"
+	"gorm.io/gorm"
+
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+)
+
+// queryCanceledCode is the SQLSTATE postgres returns for a statement cancelled by the statement_timeout
+const queryCanceledCode = "57014"
+
+type statementTimeoutKey struct{}
+
+// TrackStatementTimeouts returns a context for the queries of a request and a function reporting
+// whether postgres cancelled any of them for running past the statement timeout
+func TrackStatementTimeouts(ctx context.Context) (context.Context, func() bool) {
+	timedOut := new(int32)
+	return context.WithValue(ctx, statementTimeoutKey{}, timedOut), func() bool {
+		return atomic.LoadInt32(timedOut) == 1
+	}
+}
+
+// registerStatementTimeoutTracking records cancelled queries against the context they ran with,
+// the query functions don't return errors so this is how handlers find out
+func registerStatementTimeoutTracking(db *gorm.DB) error {
+	record := func(tx *gorm.DB) {
+		var pgErr *pgconn.PgError
+		if !errors.As(tx.Error, &pgErr) || pgErr.Code != queryCanceledCode {
+			return
+		}
+		l.Log.Warn("Query cancelled by the statement timeout: ", tx.Statement.SQL.String())
+		if timedOut, ok := tx.Statement.Context.Value(statementTimeoutKey{}).(*int32); ok {
+			atomic.StoreInt32(timedOut, 1)
+		}
+	}
+
+	if err := db.Callback().Query().After("gorm:query").Register("payload_tracker:statement_timeout", record); err != nil {
+		return err
+	}
+	return db.Callback().Row().After("gorm:row").Register("payload_tracker:statement_timeout", record)
+}
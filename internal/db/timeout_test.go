@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgconn"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// failingPool fails every statement with err, standing in for a connection to postgres
+type failingPool struct {
+	err error
+}
+
+func (p failingPool) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, p.err
+}
+
+func (p failingPool) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, p.err
+}
+
+func (p failingPool) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, p.err
+}
+
+func (p failingPool) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return nil
+}
+
+var _ = Describe("Statement timeout tracking", func() {
+	openFailing := func(err error) *gorm.DB {
+		db, openErr := gorm.Open(postgres.New(postgres.Config{Conn: failingPool{err: err}}), &gorm.Config{})
+		Expect(openErr).ToNot(HaveOccurred())
+		Expect(registerStatementTimeoutTracking(db)).To(Succeed())
+		return db
+	}
+
+	It("Reports queries cancelled by the statement timeout", func() {
+		db := openFailing(&pgconn.PgError{Code: queryCanceledCode, Message: "canceling statement due to statement timeout"})
+
+		ctx, timedOut := TrackStatementTimeouts(context.Background())
+		Expect(timedOut()).To(BeFalse())
+
+		var rows []map[string]interface{}
+		db.WithContext(ctx).Table("payloads").Find(&rows)
+		Expect(timedOut()).To(BeTrue())
+	})
+
+	It("Reports cancelled scans", func() {
+		db := openFailing(&pgconn.PgError{Code: queryCanceledCode})
+
+		ctx, timedOut := TrackStatementTimeouts(context.Background())
+
+		var count int64
+		db.WithContext(ctx).Raw("SELECT count(*) FROM payloads").Scan(&count)
+		Expect(timedOut()).To(BeTrue())
+	})
+
+	It("Ignores other errors and other requests", func() {
+		db := openFailing(errors.New("connection refused"))
+
+		ctx, timedOut := TrackStatementTimeouts(context.Background())
+		var rows []map[string]interface{}
+		db.WithContext(ctx).Table("payloads").Find(&rows)
+		Expect(timedOut()).To(BeFalse())
+
+		cancelling := openFailing(&pgconn.PgError{Code: queryCanceledCode})
+		_, otherTimedOut := TrackStatementTimeouts(context.Background())
+		cancelling.WithContext(ctx).Table("payloads").Find(&rows)
+		Expect(otherTimedOut()).To(BeFalse())
+		Expect(timedOut()).To(BeTrue())
+	})
+})
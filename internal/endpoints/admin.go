@@ -0,0 +1,311 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+	"github.com/redhatinsights/payload-tracker-go/internal/queries"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+)
+
+var RetrieveTableStats = queries.RetrieveTableStats
+
+// ConsumerControl pauses and resumes message processing in the consumer event loop
+type ConsumerControl interface {
+	Pause()
+	Resume()
+	Paused() bool
+}
+
+// PauseConsumer returns a response for /admin/consumer/pause
+func PauseConsumer(cfg config.TrackerConfig, control ConsumerControl) http.HandlerFunc {
+	return toggleConsumer(cfg, control, true)
+}
+
+// ResumeConsumer returns a response for /admin/consumer/resume
+func ResumeConsumer(cfg config.TrackerConfig, control ConsumerControl) http.HandlerFunc {
+	return toggleConsumer(cfg, control, false)
+}
+
+func toggleConsumer(cfg config.TrackerConfig, control ConsumerControl, pause bool) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		statusCode, err := checkForRole(r, cfg.AdminRole)
+		if err != nil {
+			writeResponse(w, statusCode, getErrorBody(fmt.Sprintf("%v", err), statusCode))
+			return
+		}
+
+		if pause {
+			control.Pause()
+		} else {
+			control.Resume()
+		}
+
+		l.Log.WithFields(identityFields(r)).Infof("Consumer paused set to %v from %s", pause, ClientIP(r))
+
+		dataJson, _ := json.Marshal(structs.ConsumerState{Paused: control.Paused()})
+		writeResponse(w, http.StatusOK, string(dataJson))
+	}
+}
+
+// ReplayDeadLetters returns a response for /admin/replay
+func ReplayDeadLetters(cfg config.TrackerConfig, replay func(context.Context, int) (structs.ReplayResult, error)) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		statusCode, err := checkForRole(r, cfg.AdminRole)
+		if err != nil {
+			writeResponse(w, statusCode, getErrorBody(fmt.Sprintf("%v", err), statusCode))
+			return
+		}
+
+		limit := cfg.KafkaConfig.KafkaDeadLetterReplayLimit
+		if r.URL.Query().Get("limit") != "" {
+			requested, err := strconv.Atoi(r.URL.Query().Get("limit"))
+			if err != nil || requested <= 0 {
+				writeResponse(w, http.StatusBadRequest, getErrorBody("limit must be a positive integer", http.StatusBadRequest))
+				return
+			}
+			if requested < limit {
+				limit = requested
+			}
+		}
+
+		result, err := replay(r.Context(), limit)
+		if err != nil {
+			l.Log.Error("Error replaying dead letters: ", err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody(fmt.Sprintf("%v", err), http.StatusInternalServerError))
+			return
+		}
+
+		dataJson, err := json.Marshal(result)
+		if err != nil {
+			l.Log.Error(err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+			return
+		}
+
+		writeResponse(w, http.StatusOK, string(dataJson))
+	}
+}
+
+// CreateAdminConfigHandler returns a handler for /admin/config with the effective, redacted config
+func CreateAdminConfigHandler(cfg config.TrackerConfig) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		statusCode, err := checkForRole(r, cfg.AdminRole)
+		if err != nil {
+			writeResponse(w, statusCode, getErrorBody(fmt.Sprintf("%v", err), statusCode))
+			return
+		}
+
+		dataJson, err := json.Marshal(cfg.Redacted())
+		if err != nil {
+			l.Log.Error(err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+			return
+		}
+
+		writeResponse(w, http.StatusOK, string(dataJson))
+	}
+}
+
+// ReprocessPayload returns a response for /admin/reprocess/{request_id}. The DB only holds what services
+// reported, so the history can't be rebuilt from it; instead the upload is announced again with a fresh
+// archive link and the services that pick it up report new statuses. Existing rows are left in place.
+// The payload must already be recorded, for its account and org_id, and its archive must still be retained.
+func ReprocessPayload(
+	cfg config.TrackerConfig,
+	requestArchiveLink func(context.Context, string) (*structs.PayloadArchiveLink, error),
+	announce func(context.Context, structs.ReprocessAnnouncement) error,
+) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		statusCode, err := checkForRole(r, cfg.ReprocessRole)
+		if err != nil {
+			writeResponse(w, statusCode, getErrorBody(fmt.Sprintf("%v", err), statusCode))
+			return
+		}
+
+		reqID := chi.URLParam(r, "request_id")
+		if !isValidUUID(reqID) {
+			IncInvalidAPIRequestIDs()
+			writeResponse(w, http.StatusBadRequest, getErrorBody(fmt.Sprintf("%s is not a valid UUID", reqID), http.StatusBadRequest))
+			return
+		}
+
+		if requestArchiveLink == nil {
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Archive links are not supported by requestor "+cfg.RequestConfig.RequestorImpl, http.StatusInternalServerError))
+			return
+		}
+
+		payload, found := RetrievePayload(Db(), reqID)
+		if !found {
+			writeResponse(w, http.StatusNotFound, getErrorBody("No payload has been recorded for "+reqID, http.StatusNotFound))
+			return
+		}
+
+		archive, err := requestArchiveLink(r.Context(), reqID)
+		if err != nil {
+			l.Log.Errorf("Error requesting the archive of %s for reprocessing: %v", reqID, err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody(fmt.Sprintf("%v", err), http.StatusInternalServerError))
+			return
+		}
+		if archive.Url == "" {
+			writeResponse(w, http.StatusNotFound, getErrorBody("No archive is retained for "+reqID, http.StatusNotFound))
+			return
+		}
+
+		announcement := structs.ReprocessAnnouncement{
+			RequestID: reqID,
+			Account:   payload.Account,
+			OrgID:     payload.OrgId,
+			URL:       archive.Url,
+		}
+		if err := announce(r.Context(), announcement); err != nil {
+			l.Log.Errorf("Error announcing %s for reprocessing: %v", reqID, err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody(fmt.Sprintf("%v", err), http.StatusInternalServerError))
+			return
+		}
+
+		l.Log.WithFields(identityFields(r)).Infof("Payload %s sent for reprocessing to %s from %s", reqID, cfg.KafkaConfig.KafkaReprocessTopic, ClientIP(r))
+
+		dataJson, err := json.Marshal(structs.ReprocessResult{
+			RequestID: reqID,
+			Account:   payload.Account,
+			OrgID:     payload.OrgId,
+			Topic:     cfg.KafkaConfig.KafkaReprocessTopic,
+		})
+		if err != nil {
+			l.Log.Error(err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+			return
+		}
+
+		writeResponse(w, http.StatusOK, string(dataJson))
+	}
+}
+
+// InsertStatuses returns a response for /admin/statuses, which records an array of statuses as if they had
+// been consumed. Each status is validated and inserted on its own so the response reports them one by one.
+func InsertStatuses(cfg config.TrackerConfig, insert func(context.Context, []byte) error) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		statusCode, err := checkForRole(r, cfg.AdminRole)
+		if err != nil {
+			writeResponse(w, statusCode, getErrorBody(fmt.Sprintf("%v", err), statusCode))
+			return
+		}
+
+		var statuses []json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&statuses); err != nil || len(statuses) == 0 {
+			writeResponse(w, http.StatusBadRequest, getErrorBody("body must be a non-empty array of statuses", http.StatusBadRequest))
+			return
+		}
+
+		results := structs.StatusInsertResults{Results: make([]structs.StatusInsertResult, 0, len(statuses))}
+		for i, status := range statuses {
+			result := structs.StatusInsertResult{Index: i}
+
+			var identified struct {
+				RequestID string `json:"request_id"`
+			}
+			json.Unmarshal(status, &identified)
+			result.RequestID = identified.RequestID
+
+			if err := insert(r.Context(), status); err != nil {
+				result.Error = err.Error()
+				results.Failed++
+			} else {
+				result.Inserted = true
+				results.Inserted++
+			}
+			results.Results = append(results.Results, result)
+		}
+
+		l.Log.WithFields(identityFields(r)).Infof("%d statuses inserted and %d failed from %s", results.Inserted, results.Failed, ClientIP(r))
+
+		dataJson, err := json.Marshal(results)
+		if err != nil {
+			l.Log.Error(err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+			return
+		}
+
+		writeResponse(w, http.StatusOK, string(dataJson))
+	}
+}
+
+// CreateDBStatsHandler returns a handler for /admin/dbstats, reporting the rows and size of the largest tables.
+// The size queries read every partition, so their result is cached.
+func CreateDBStatsHandler(cfg config.TrackerConfig) http.HandlerFunc {
+	cache := newTTLCache("dbstats", time.Duration(cfg.RequestConfig.DBStatsCacheTTL)*time.Second)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		statusCode, err := checkForRole(r, cfg.AdminRole)
+		if err != nil {
+			writeResponse(w, statusCode, getErrorBody(fmt.Sprintf("%v", err), statusCode))
+			return
+		}
+
+		stats, err := cache.get("tables", func() (interface{}, error) { return loadTableStats() })
+		if err != nil {
+			l.Log.Error("Error retrieving the table stats: ", err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+			return
+		}
+
+		dataJson, err := json.Marshal(structs.DBStatsData{Tables: stats.([]structs.TableStats)})
+		if err != nil {
+			l.Log.Error(err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+			return
+		}
+
+		writeResponse(w, http.StatusOK, string(dataJson))
+	}
+}
+
+// ExportTableStats refreshes the table size gauges every interval until the context is done
+func ExportTableStats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := loadTableStats(); err != nil {
+			l.Log.Error("Error exporting the table stats: ", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// loadTableStats retrieves the table stats and sets the gauges to them, which are left as they were on an error
+func loadTableStats() ([]structs.TableStats, error) {
+	stats, err := RetrieveTableStats(Db(), queries.StatsTables)
+	if err != nil {
+		return nil, err
+	}
+	if stats == nil {
+		stats = []structs.TableStats{}
+	}
+	setTableStats(stats)
+	return stats, nil
+}
@@ -0,0 +1,475 @@
+package endpoints_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/gorm"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+	"github.com/redhatinsights/payload-tracker-go/internal/models"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+	"github.com/redhatinsights/payload-tracker-go/internal/utils/test"
+)
+
+const reprocessIdentityHeader = "eyJpZGVudGl0eSI6IHsiYXNzb2NpYXRlIjp7IlJvbGUiOlsicGF5bG9hZC10cmFja2VyLXJlcHJvY2VzcyIsIm90aGVyUm9sZSJdfSwgImFjY291bnRfbnVtYmVyIjogIjAwMDAwMDEiLCAidHlwZSI6ICJTeXN0ZW0iLCAiaW50ZXJuYWwiOiB7Im9yZ19pZCI6ICIwMDAwMDEifX19"
+
+const adminIdentityHeader = "eyJpZGVudGl0eSI6IHsiYXNzb2NpYXRlIjp7IlJvbGUiOlsicGF5bG9hZC10cmFja2VyLWFkbWluIiwib3RoZXJSb2xlIl19LCAiYWNjb3VudF9udW1iZXIiOiAiMDAwMDAwMSIsICJ0eXBlIjogIlN5c3RlbSIsICJpbnRlcm5hbCI6IHsib3JnX2lkIjogIjAwMDAwMSJ9fX0="
+
+var _ = Describe("ReplayDeadLetters", func() {
+	var (
+		handler http.Handler
+		rr      *httptest.ResponseRecorder
+		query   map[string]interface{}
+
+		requestedLimit int
+		replayErr      error
+	)
+
+	mockedReplay := func(_ context.Context, limit int) (structs.ReplayResult, error) {
+		requestedLimit = limit
+		return structs.ReplayResult{Succeeded: 3, Failed: 1}, replayErr
+	}
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		handler = endpoints.ReplayDeadLetters(*config.Get(), mockedReplay)
+		query = make(map[string]interface{})
+		requestedLimit = 0
+		replayErr = nil
+	})
+
+	Context("Without the admin role", func() {
+		It("Should return 403", func() {
+			req, err := test.MakeTestRequest("/api/v1/admin/replay", query)
+			Expect(err).To(BeNil())
+			req.Header.Set("x-rh-identity", validIdentityHeader)
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusForbidden))
+		})
+	})
+
+	Context("With the admin role", func() {
+		It("Should report the replay results", func() {
+			req, err := test.MakeTestRequest("/api/v1/admin/replay", query)
+			Expect(err).To(BeNil())
+			req.Header.Set("x-rh-identity", adminIdentityHeader)
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+
+			var respData structs.ReplayResult
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &respData)
+
+			Expect(respData.Succeeded).To(Equal(3))
+			Expect(respData.Failed).To(Equal(1))
+			Expect(requestedLimit).To(Equal(100))
+		})
+
+		It("Should honor a smaller limit", func() {
+			query["limit"] = 5
+			req, err := test.MakeTestRequest("/api/v1/admin/replay", query)
+			Expect(err).To(BeNil())
+			req.Header.Set("x-rh-identity", adminIdentityHeader)
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(requestedLimit).To(Equal(5))
+		})
+
+		It("Should return 400 for an invalid limit", func() {
+			query["limit"] = "none"
+			req, err := test.MakeTestRequest("/api/v1/admin/replay", query)
+			Expect(err).To(BeNil())
+			req.Header.Set("x-rh-identity", adminIdentityHeader)
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("Should return 500 when the replay fails", func() {
+			replayErr = errors.New("dead letter topic is not configured")
+			req, err := test.MakeTestRequest("/api/v1/admin/replay", query)
+			Expect(err).To(BeNil())
+			req.Header.Set("x-rh-identity", adminIdentityHeader)
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+		})
+	})
+})
+
+type fakeConsumerControl struct {
+	paused bool
+}
+
+func (c *fakeConsumerControl) Pause()       { c.paused = true }
+func (c *fakeConsumerControl) Resume()      { c.paused = false }
+func (c *fakeConsumerControl) Paused() bool { return c.paused }
+
+var _ = Describe("Consumer pause and resume", func() {
+	var (
+		rr      *httptest.ResponseRecorder
+		query   map[string]interface{}
+		control *fakeConsumerControl
+	)
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		query = make(map[string]interface{})
+		control = &fakeConsumerControl{}
+	})
+
+	Context("Without the admin role", func() {
+		It("Should return 403 and leave the consumer running", func() {
+			req, err := test.MakeTestRequest("/admin/consumer/pause", query)
+			Expect(err).To(BeNil())
+			req.Header.Set("x-rh-identity", validIdentityHeader)
+			endpoints.PauseConsumer(*config.Get(), control).ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusForbidden))
+			Expect(control.Paused()).To(BeFalse())
+		})
+	})
+
+	Context("With the admin role", func() {
+		It("Should pause the consumer", func() {
+			req, err := test.MakeTestRequest("/admin/consumer/pause", query)
+			Expect(err).To(BeNil())
+			req.Header.Set("x-rh-identity", adminIdentityHeader)
+			endpoints.PauseConsumer(*config.Get(), control).ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(control.Paused()).To(BeTrue())
+
+			var respData structs.ConsumerState
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &respData)
+			Expect(respData.Paused).To(BeTrue())
+		})
+
+		It("Should log the org of the identity rather than the identity header", func() {
+			// the suite only logs fatal entries
+			level := l.Log.GetLevel()
+			l.Log.SetLevel(logrus.InfoLevel)
+			defer l.Log.SetLevel(level)
+			hook := logrustest.NewLocal(l.Log)
+
+			req, err := test.MakeTestRequest("/admin/consumer/pause", query)
+			Expect(err).To(BeNil())
+			req.Header.Set("x-rh-identity", adminIdentityHeader)
+			endpoints.PauseConsumer(*config.Get(), control).ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+
+			entry := hook.LastEntry()
+			Expect(entry).ToNot(BeNil())
+			Expect(entry.Message).To(HavePrefix("Consumer paused set to true"))
+			Expect(entry.Data).To(HaveKeyWithValue("org_id", "000001"))
+			Expect(entry.Message).ToNot(ContainSubstring(adminIdentityHeader))
+			for _, value := range entry.Data {
+				Expect(value).ToNot(Equal(adminIdentityHeader))
+			}
+		})
+
+		It("Should resume the consumer", func() {
+			control.Pause()
+			req, err := test.MakeTestRequest("/admin/consumer/resume", query)
+			Expect(err).To(BeNil())
+			req.Header.Set("x-rh-identity", adminIdentityHeader)
+			endpoints.ResumeConsumer(*config.Get(), control).ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(control.Paused()).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("AdminConfig", func() {
+	var (
+		handler http.Handler
+		rr      *httptest.ResponseRecorder
+		query   map[string]interface{}
+	)
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		os.Setenv("DB_PASSWORD", "hunter2")
+		handler = endpoints.CreateAdminConfigHandler(*config.Get())
+		query = make(map[string]interface{})
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("DB_PASSWORD")
+	})
+
+	It("Should return 403 without the admin role", func() {
+		req, err := test.MakeTestRequest("/api/v1/admin/config", query)
+		Expect(err).To(BeNil())
+		req.Header.Set("x-rh-identity", validIdentityHeader)
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("Should return the config with secrets redacted", func() {
+		req, err := test.MakeTestRequest("/api/v1/admin/config", query)
+		Expect(err).To(BeNil())
+		req.Header.Set("x-rh-identity", adminIdentityHeader)
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		var respData config.TrackerConfig
+		readBody, _ := ioutil.ReadAll(rr.Body)
+		Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+		Expect(respData.DatabaseConfig.DBPassword).To(Equal("[REDACTED]"))
+		Expect(respData.DatabaseConfig.DBHost).ToNot(BeEmpty())
+		Expect(string(readBody)).ToNot(ContainSubstring("hunter2"))
+	})
+})
+
+var _ = Describe("DBStats", func() {
+	var (
+		handler http.Handler
+		rr      *httptest.ResponseRecorder
+		query   map[string]interface{}
+
+		retrieved int
+		statsErr  error
+	)
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		query = make(map[string]interface{})
+		retrieved = 0
+		statsErr = nil
+
+		endpoints.RetrieveTableStats = func(_ *gorm.DB, tables []string) ([]structs.TableStats, error) {
+			retrieved++
+			if statsErr != nil {
+				return nil, statsErr
+			}
+			stats := make([]structs.TableStats, 0, len(tables))
+			for i, table := range tables {
+				stats = append(stats, structs.TableStats{Table: table, Rows: int64(i + 1), TotalBytes: int64(8192 * (i + 1))})
+			}
+			return stats, nil
+		}
+		handler = endpoints.CreateDBStatsHandler(*config.Get())
+	})
+
+	It("Should return 403 without the admin role", func() {
+		req, err := test.MakeTestRequest("/api/v1/admin/dbstats", query)
+		Expect(err).To(BeNil())
+		req.Header.Set("x-rh-identity", validIdentityHeader)
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusForbidden))
+		Expect(retrieved).To(Equal(0))
+	})
+
+	It("Should return the table sizes and cache them", func() {
+		for i := 0; i < 2; i++ {
+			rr = httptest.NewRecorder()
+			req, err := test.MakeTestRequest("/api/v1/admin/dbstats", query)
+			Expect(err).To(BeNil())
+			req.Header.Set("x-rh-identity", adminIdentityHeader)
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+		}
+		Expect(retrieved).To(Equal(1))
+
+		var respData structs.DBStatsData
+		readBody, _ := ioutil.ReadAll(rr.Body)
+		Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+		Expect(respData.Tables).To(Equal([]structs.TableStats{
+			{Table: "payloads", Rows: 1, TotalBytes: 8192},
+			{Table: "payload_statuses", Rows: 2, TotalBytes: 16384},
+		}))
+	})
+
+	It("Should return 500 and not cache a failed lookup", func() {
+		statsErr = errors.New("canceling statement due to statement timeout")
+		req, err := test.MakeTestRequest("/api/v1/admin/dbstats", query)
+		Expect(err).To(BeNil())
+		req.Header.Set("x-rh-identity", adminIdentityHeader)
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+
+		statsErr = nil
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusOK))
+		Expect(retrieved).To(Equal(2))
+	})
+})
+
+var _ = Describe("ReprocessPayload", func() {
+	var (
+		handler http.Handler
+		rr      *httptest.ResponseRecorder
+		query   map[string]interface{}
+
+		requestId               string
+		found                   bool
+		archiveURL              string
+		archiveErr              error
+		announced               []structs.ReprocessAnnouncement
+		announceErr             error
+		originalRetrievePayload = endpoints.RetrievePayload
+	)
+
+	mockedArchiveLink := func(_ context.Context, _ string) (*structs.PayloadArchiveLink, error) {
+		return &structs.PayloadArchiveLink{Url: archiveURL}, archiveErr
+	}
+
+	mockedAnnounce := func(_ context.Context, announcement structs.ReprocessAnnouncement) error {
+		announced = append(announced, announcement)
+		return announceErr
+	}
+
+	makeRequest := func(identity string, reqID string) *http.Request {
+		req, err := test.MakeTestRequest("/api/v1/admin/reprocess/"+reqID, query)
+		Expect(err).To(BeNil())
+		req.Header.Set("x-rh-identity", identity)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("request_id", reqID)
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		handler = endpoints.ReprocessPayload(*config.Get(), mockedArchiveLink, mockedAnnounce)
+		query = make(map[string]interface{})
+
+		requestId = getUUID()
+		found = true
+		archiveURL = "https://storage/archive"
+		archiveErr = nil
+		announced = nil
+		announceErr = nil
+
+		endpoints.RetrievePayload = func(_ *gorm.DB, reqID string) (models.Payloads, bool) {
+			return models.Payloads{RequestId: reqID, Account: "0000001", OrgId: "000001"}, found
+		}
+	})
+
+	AfterEach(func() {
+		endpoints.RetrievePayload = originalRetrievePayload
+	})
+
+	It("Should return 403 with only the admin role", func() {
+		handler.ServeHTTP(rr, makeRequest(adminIdentityHeader, requestId))
+		Expect(rr.Code).To(Equal(http.StatusForbidden))
+		Expect(announced).To(BeEmpty())
+	})
+
+	It("Should announce the payload again and summarize it", func() {
+		handler.ServeHTTP(rr, makeRequest(reprocessIdentityHeader, requestId))
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		Expect(announced).To(Equal([]structs.ReprocessAnnouncement{
+			{RequestID: requestId, Account: "0000001", OrgID: "000001", URL: "https://storage/archive"},
+		}))
+
+		var respData structs.ReprocessResult
+		readBody, _ := ioutil.ReadAll(rr.Body)
+		Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+		Expect(respData.RequestID).To(Equal(requestId))
+		Expect(respData.OrgID).To(Equal("000001"))
+		Expect(respData.Topic).To(Equal("platform.upload.announce"))
+	})
+
+	It("Should return 400 for an invalid request_id", func() {
+		handler.ServeHTTP(rr, makeRequest(reprocessIdentityHeader, "not-a-uuid"))
+		Expect(rr.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("Should return 404 when the payload was never recorded", func() {
+		found = false
+		handler.ServeHTTP(rr, makeRequest(reprocessIdentityHeader, requestId))
+		Expect(rr.Code).To(Equal(http.StatusNotFound))
+		Expect(announced).To(BeEmpty())
+	})
+
+	It("Should return 404 when the archive is no longer retained", func() {
+		archiveURL = ""
+		handler.ServeHTTP(rr, makeRequest(reprocessIdentityHeader, requestId))
+		Expect(rr.Code).To(Equal(http.StatusNotFound))
+		Expect(announced).To(BeEmpty())
+	})
+
+	It("Should return 500 when the announcement fails", func() {
+		announceErr = errors.New("broker unavailable")
+		handler.ServeHTTP(rr, makeRequest(reprocessIdentityHeader, requestId))
+		Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+	})
+})
+
+var _ = Describe("InsertStatuses", func() {
+	var (
+		handler  http.Handler
+		rr       *httptest.ResponseRecorder
+		inserted []string
+	)
+
+	mockedInsert := func(_ context.Context, value []byte) error {
+		var status map[string]string
+		json.Unmarshal(value, &status)
+		if status["service"] == "" {
+			return errors.New("missing service")
+		}
+		inserted = append(inserted, status["request_id"])
+		return nil
+	}
+
+	post := func(body string, identity string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/statuses", strings.NewReader(body))
+		req.Header.Set("x-rh-identity", identity)
+		handler.ServeHTTP(rr, req)
+	}
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		handler = endpoints.InsertStatuses(*config.Get(), mockedInsert)
+		inserted = nil
+	})
+
+	It("Should require the admin role", func() {
+		post(`[{"service": "puptoo", "request_id": "abc"}]`, validIdentityHeader)
+		Expect(rr.Code).To(Equal(http.StatusForbidden))
+		Expect(inserted).To(BeEmpty())
+	})
+
+	It("Should report each status", func() {
+		post(`[{"service": "puptoo", "request_id": "abc"}, {"request_id": "def"}, {"service": "ingress", "request_id": "ghi"}]`, adminIdentityHeader)
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		var respData structs.StatusInsertResults
+		readBody, _ := ioutil.ReadAll(rr.Body)
+		Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+
+		Expect(respData.Inserted).To(Equal(2))
+		Expect(respData.Failed).To(Equal(1))
+		Expect(respData.Results).To(Equal([]structs.StatusInsertResult{
+			{Index: 0, RequestID: "abc", Inserted: true},
+			{Index: 1, RequestID: "def", Error: "missing service"},
+			{Index: 2, RequestID: "ghi", Inserted: true},
+		}))
+		Expect(inserted).To(Equal([]string{"abc", "ghi"}))
+	})
+
+	It("Should reject a body that isn't an array of statuses", func() {
+		for _, body := range []string{`{"service": "puptoo"}`, `[]`, `not json`} {
+			rr = httptest.NewRecorder()
+			post(body, adminIdentityHeader)
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		}
+		Expect(inserted).To(BeEmpty())
+	})
+})
@@ -0,0 +1,154 @@
+package endpoints
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+	"github.com/redhatinsights/payload-tracker-go/internal/models"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+)
+
+// ArchiveLookup asks for the archive of a payload when /payloads has include_archive=true,
+// archives aren't recorded in the DB so whether one exists is only known to storage-broker
+var ArchiveLookup func(ctx context.Context, reqID string) (*structs.PayloadArchiveLink, error)
+
+// CreateArchiveLookup returns the ArchiveLookup for the configured requestor implementation
+func CreateArchiveLookup(cfg config.TrackerConfig) func(ctx context.Context, reqID string) (*structs.PayloadArchiveLink, error) {
+	switch cfg.RequestConfig.RequestorImpl {
+	case "storage-broker":
+		return RequestArchiveLink(cfg.StorageBrokerURL, cfg.StorageBrokerRequestTimeout, cfg.StorageBrokerRequestParam)
+	case "mock":
+		return func(ctx context.Context, reqID string) (*structs.PayloadArchiveLink, error) {
+			return &structs.PayloadArchiveLink{Url: fmt.Sprintf("http://%s:%s/app/payload-tracker/api/v1/archive/%s", cfg.Hostname, cfg.PublicPort, reqID)}, nil
+		}
+	default:
+		return nil
+	}
+}
+
+// PayloadArchiveLinks returns a response for POST /payloads/archiveLinks, with the link or the
+// error for each of the requested request_ids
+func PayloadArchiveLinks(cfg config.TrackerConfig, requestArchiveLink func(context.Context, string) (*structs.PayloadArchiveLink, error)) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		statusCode, err := checkArchiveAccess(r, cfg)
+		if err != nil {
+			writeResponse(w, statusCode, getErrorBody(fmt.Sprintf("%v", err), statusCode))
+			return
+		}
+
+		if requestArchiveLink == nil {
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Archive links are not supported by requestor "+cfg.RequestConfig.RequestorImpl, http.StatusInternalServerError))
+			return
+		}
+
+		var request structs.ArchiveLinksRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeResponse(w, http.StatusBadRequest, getErrorBody("Body must be a JSON object with a request_ids list", http.StatusBadRequest))
+			return
+		}
+		if len(request.RequestIDs) == 0 {
+			writeResponse(w, http.StatusBadRequest, getErrorBody("request_ids must not be empty", http.StatusBadRequest))
+			return
+		}
+		if maxBatch := cfg.RequestConfig.MaxArchiveLinkBatch; len(request.RequestIDs) > maxBatch {
+			writeResponse(w, http.StatusBadRequest, getErrorBody(fmt.Sprintf("request_ids must have at most %d entries", maxBatch), http.StatusBadRequest))
+			return
+		}
+
+		links := map[string]structs.ArchiveLinkResult{}
+		var lookups []string
+		for _, reqID := range request.RequestIDs {
+			if _, seen := links[reqID]; seen {
+				continue
+			}
+			if !isValidUUID(reqID) {
+				IncInvalidAPIRequestIDs()
+				links[reqID] = structs.ArchiveLinkResult{Error: fmt.Sprintf("%s is not a valid UUID", reqID)}
+				continue
+			}
+			links[reqID] = structs.ArchiveLinkResult{}
+			lookups = append(lookups, reqID)
+		}
+
+		archiveLinks, errs := lookupArchives(r.Context(), requestArchiveLink, lookups, cfg.RequestConfig.ArchiveLookupWorkers)
+		for i, reqID := range lookups {
+			switch {
+			case errs[i] != nil:
+				l.Log.Errorf("Error getting archive link from storage-broker for request id: %s, error: %v", reqID, errs[i])
+				links[reqID] = structs.ArchiveLinkResult{Error: errs[i].Error()}
+			case archiveLinks[i].Url == "":
+				links[reqID] = structs.ArchiveLinkResult{Error: "Payload not found"}
+			default:
+				links[reqID] = structs.ArchiveLinkResult{Url: archiveLinks[i].Url}
+			}
+		}
+
+		dataJson, err := json.Marshal(structs.ArchiveLinksData{Links: links})
+		if err != nil {
+			l.Log.Error(err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+			return
+		}
+
+		l.Log.Infof("Links generated for %d payloads from identity %s", len(lookups), r.Header.Get("x-rh-identity"))
+		writeResponse(w, http.StatusOK, string(dataJson))
+	}
+}
+
+// withArchives looks up whether each payload still has an archive
+func withArchives(ctx context.Context, payloads []models.Payloads, cfg config.RequestCfg) ([]structs.PayloadWithArchive, error) {
+	if ArchiveLookup == nil {
+		return nil, fmt.Errorf("archive lookups are not supported by requestor %s", cfg.RequestorImpl)
+	}
+
+	reqIDs := make([]string, len(payloads))
+	for i, payload := range payloads {
+		reqIDs[i] = payload.RequestId
+	}
+
+	archiveLinks, errs := lookupArchives(ctx, ArchiveLookup, reqIDs, cfg.ArchiveLookupWorkers)
+
+	enriched := make([]structs.PayloadWithArchive, len(payloads))
+	for i, payload := range payloads {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("archive lookup for %s failed: %v", payload.RequestId, errs[i])
+		}
+		enriched[i] = structs.PayloadWithArchive{Payloads: payload, HasArchive: archiveLinks[i].Url != ""}
+	}
+	return enriched, nil
+}
+
+// lookupArchives requests the archive of every request_id with at most workers requests at once,
+// the links and errors are in the order of reqIDs
+func lookupArchives(ctx context.Context, lookup func(context.Context, string) (*structs.PayloadArchiveLink, error), reqIDs []string, workers int) ([]*structs.PayloadArchiveLink, []error) {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	archiveLinks := make([]*structs.PayloadArchiveLink, len(reqIDs))
+	errs := make([]error, len(reqIDs))
+	slots := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+
+	for i, reqID := range reqIDs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, reqID string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			archiveLinks[i], errs[i] = lookup(ctx, reqID)
+		}(i, reqID)
+	}
+	wg.Wait()
+
+	return archiveLinks, errs
+}
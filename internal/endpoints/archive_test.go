@@ -0,0 +1,121 @@
+package endpoints_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+)
+
+var _ = Describe("PayloadArchiveLinks", func() {
+	var (
+		handler  http.Handler
+		rr       *httptest.ResponseRecorder
+		archived string
+		missing  string
+		broken   string
+	)
+
+	lookup := func(_ context.Context, reqID string) (*structs.PayloadArchiveLink, error) {
+		switch reqID {
+		case archived:
+			return &structs.PayloadArchiveLink{Url: "http://archive/" + reqID}, nil
+		case broken:
+			return nil, errors.New("storage-broker is down")
+		default:
+			return &structs.PayloadArchiveLink{}, nil
+		}
+	}
+
+	post := func(body string, identity string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/payloads/archiveLinks", strings.NewReader(body))
+		req.Header.Set("x-rh-identity", identity)
+		handler.ServeHTTP(rr, req)
+	}
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		handler = perRequest(func(cfg config.TrackerConfig) http.HandlerFunc {
+			return endpoints.PayloadArchiveLinks(cfg, lookup)
+		})
+		archived, missing, broken = getUUID(), getUUID(), getUUID()
+	})
+
+	It("Should return the link or error of every request_id", func() {
+		post(`{"request_ids": ["`+archived+`", "`+missing+`", "`+broken+`", "bogus", "`+archived+`"]}`, validIdentityHeader)
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		var respData structs.ArchiveLinksData
+		readBody, _ := ioutil.ReadAll(rr.Body)
+		Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+
+		Expect(respData.Links).To(HaveLen(4))
+		Expect(respData.Links[archived]).To(Equal(structs.ArchiveLinkResult{Url: "http://archive/" + archived}))
+		Expect(respData.Links[missing].Error).To(Equal("Payload not found"))
+		Expect(respData.Links[broken].Error).To(ContainSubstring("storage-broker is down"))
+		Expect(respData.Links["bogus"].Error).To(ContainSubstring("not a valid UUID"))
+	})
+
+	It("Should require the archive link role", func() {
+		post(`{"request_ids": ["`+archived+`"]}`, invalidIdentityHeader)
+		Expect(rr.Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("Should return 400 for a malformed or empty body", func() {
+		for _, body := range []string{"", "[]", `{"request_ids": []}`} {
+			rr = httptest.NewRecorder()
+			post(body, validIdentityHeader)
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		}
+	})
+
+	Context("With a small batch size and worker count", func() {
+		BeforeEach(func() {
+			os.Setenv("MAX_ARCHIVE_LINK_BATCH", "3")
+			os.Setenv("ARCHIVE_LOOKUP_WORKERS", "2")
+		})
+
+		AfterEach(func() {
+			os.Unsetenv("MAX_ARCHIVE_LINK_BATCH")
+			os.Unsetenv("ARCHIVE_LOOKUP_WORKERS")
+		})
+
+		It("Should return 400 when the batch is too large", func() {
+			post(`{"request_ids": ["`+getUUID()+`", "`+getUUID()+`", "`+getUUID()+`", "`+getUUID()+`"]}`, validIdentityHeader)
+			Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("Should not run more lookups at once than there are workers", func() {
+			var inFlight, maxInFlight int32
+			handler = endpoints.PayloadArchiveLinks(*config.Get(), func(_ context.Context, reqID string) (*structs.PayloadArchiveLink, error) {
+				current := atomic.AddInt32(&inFlight, 1)
+				for {
+					seen := atomic.LoadInt32(&maxInFlight)
+					if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&inFlight, -1)
+				return &structs.PayloadArchiveLink{Url: "http://archive/" + reqID}, nil
+			})
+
+			post(`{"request_ids": ["`+getUUID()+`", "`+getUUID()+`", "`+getUUID()+`"]}`, validIdentityHeader)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(atomic.LoadInt32(&maxInFlight)).To(BeNumerically("<=", 2))
+		})
+	})
+})
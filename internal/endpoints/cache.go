@@ -0,0 +1,53 @@
+package endpoints
+
+import (
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// ttlCache holds values for a fixed amount of time before they are loaded again
+type ttlCache struct {
+	name    string
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+}
+
+func newTTLCache(name string, ttl time.Duration) *ttlCache {
+	return &ttlCache{
+		name:    name,
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// get returns the cached value for key, calling load to fill the cache when it is missing or expired.
+// A failed load isn't cached, its error is returned and the next get loads again.
+func (c *ttlCache) get(key string, load func() (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	switch {
+	case ok && time.Now().Before(entry.expires):
+		incCacheLookups(c.name, "hit")
+		return entry.value, nil
+	case ok:
+		incCacheLookups(c.name, "expired")
+	default:
+		incCacheLookups(c.name, "miss")
+	}
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+	c.entries[key] = cacheEntry{value: value, expires: time.Now().Add(c.ttl)}
+
+	return value, nil
+}
@@ -0,0 +1,95 @@
+package endpoints
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// ClientIPMiddleware resolves the client IP of each request for rate limiting and logging. X-Forwarded-For
+// is only believed when the request comes from one of the trusted proxies, and it is read from the right,
+// skipping the trusted proxies, so a client sending the header itself can't choose its address. Without
+// trusted proxies the client IP is the RemoteAddr. Trusted proxies are CIDRs or single addresses.
+func ClientIPMiddleware(trustedProxies []string) (func(http.Handler) http.Handler, error) {
+	var trusted []*net.IPNet
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxies must be CIDRs or IP addresses, got %s", proxy)
+		}
+		trusted = append(trusted, network)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), clientIPKey{}, resolveClientIP(r, trusted))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}, nil
+}
+
+// ClientIP returns the client IP resolved by ClientIPMiddleware, or the RemoteAddr outside of it
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return resolveClientIP(r, nil)
+}
+
+// KeyByClientIP is an httprate key func for limiting by the resolved client IP
+func KeyByClientIP(r *http.Request) (string, error) {
+	return ClientIP(r), nil
+}
+
+func resolveClientIP(r *http.Request, trusted []*net.IPNet) string {
+	ip := remoteIP(r)
+	if ip == nil {
+		return r.RemoteAddr
+	}
+	if !isTrustedProxy(ip, trusted) {
+		return ip.String()
+	}
+
+	// each proxy appends the address it got the request from, the first untrusted one is the client
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(ip, trusted) {
+			break
+		}
+	}
+
+	return ip.String()
+}
+
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func isTrustedProxy(ip net.IP, trusted []*net.IPNet) bool {
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
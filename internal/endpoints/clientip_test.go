@@ -0,0 +1,62 @@
+package endpoints_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
+)
+
+var _ = Describe("ClientIPMiddleware", func() {
+	var (
+		resolved string
+		echo     = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			resolved = endpoints.ClientIP(r)
+		})
+	)
+
+	resolve := func(trustedProxies []string, remoteAddr string, forwardedFor ...string) string {
+		middleware, err := endpoints.ClientIPMiddleware(trustedProxies)
+		Expect(err).ToNot(HaveOccurred())
+
+		req := httptest.NewRequest("GET", "/api/v1/payloads", nil)
+		req.RemoteAddr = remoteAddr
+		for _, value := range forwardedFor {
+			req.Header.Add("X-Forwarded-For", value)
+		}
+
+		resolved = ""
+		middleware(echo).ServeHTTP(httptest.NewRecorder(), req)
+		return resolved
+	}
+
+	It("Should use the RemoteAddr without trusted proxies", func() {
+		Expect(resolve(nil, "203.0.113.7:5000", "198.51.100.1")).To(Equal("203.0.113.7"))
+	})
+
+	It("Should ignore X-Forwarded-For from an untrusted source", func() {
+		Expect(resolve([]string{"10.0.0.0/8"}, "203.0.113.7:5000", "198.51.100.1")).To(Equal("203.0.113.7"))
+	})
+
+	It("Should take the first untrusted address from the right", func() {
+		Expect(resolve([]string{"10.0.0.0/8"}, "10.1.2.3:5000", "192.0.2.9, 198.51.100.1", "10.4.5.6")).To(Equal("198.51.100.1"))
+	})
+
+	It("Should take the leftmost address when every hop is trusted", func() {
+		Expect(resolve([]string{"10.0.0.0/8", "192.0.2.1"}, "10.1.2.3:5000", "10.9.9.9, 192.0.2.1")).To(Equal("10.9.9.9"))
+	})
+
+	It("Should stop at an invalid entry", func() {
+		Expect(resolve([]string{"10.0.0.0/8"}, "10.1.2.3:5000", "198.51.100.1, unknown, 10.4.5.6")).To(Equal("10.4.5.6"))
+	})
+
+	It("Should reject invalid trusted proxies", func() {
+		_, err := endpoints.ClientIPMiddleware([]string{"10.0.0.0/33"})
+		Expect(err).To(HaveOccurred())
+		_, err = endpoints.ClientIPMiddleware([]string{"load-balancer"})
+		Expect(err).To(HaveOccurred())
+	})
+})
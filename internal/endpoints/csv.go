@@ -0,0 +1,82 @@
+package endpoints
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/models"
+)
+
+var payloadsCSVHeader = []string{"id", "request_id", "account", "org_id", "inventory_id", "system_id", "created_at"}
+
+// csvDelimiter returns the delimiter for a csv response, defaulting to a comma
+func csvDelimiter(value string) (rune, error) {
+	if value == "" {
+		return ',', nil
+	}
+	if !stringInSlice(value, validCSVDelimiters) {
+		return 0, errors.New("delimiter must be one of " + strings.Join(validCSVDelimiters, ", "))
+	}
+	return rune(value[0]), nil
+}
+
+// csvCell keeps a spreadsheet from reading the value as a formula, cells starting with =, +, - or @
+// are prefixed with a quote
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// writePayloadsCSV writes the payloads as csv with a header row, refusing them like any other listing
+// when they are over maxBytes
+func writePayloadsCSV(w http.ResponseWriter, payloads []models.Payloads, delimiter rune, policy fieldPolicy, maxBytes int) error {
+	var body bytes.Buffer
+	writer := csv.NewWriter(&body)
+	writer.Comma = delimiter
+
+	// columns the field policy leaves out are dropped from the header and every row
+	var columns []int
+	header := []string{}
+	for i, field := range payloadsCSVHeader {
+		if policy.allowed(field) {
+			columns = append(columns, i)
+			header = append(header, field)
+		}
+	}
+
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, payload := range payloads {
+		fields := []string{
+			strconv.FormatUint(uint64(payload.Id), 10),
+			payload.RequestId,
+			payload.Account,
+			payload.OrgId,
+			payload.InventoryId,
+			payload.SystemId,
+			payload.CreatedAt.Format(time.RFC3339Nano),
+		}
+		row := make([]string, 0, len(columns))
+		for _, i := range columns {
+			row = append(row, csvCell(fields[i]))
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+
+	writeLimitedResponse(w, maxBytes, "text/csv", body.String())
+	return nil
+}
@@ -0,0 +1,72 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+	"github.com/redhatinsights/payload-tracker-go/internal/queries"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+	"gorm.io/gorm"
+)
+
+var (
+	RetrieveDistinctServices = queries.RetrieveDistinctServices
+	RetrieveDistinctStatuses = queries.RetrieveDistinctStatuses
+)
+
+// CreateServicesHandler returns a handler for /services, listing every service name seen
+func CreateServicesHandler(cfg config.TrackerConfig) http.HandlerFunc {
+	cache := newTTLCache("services", time.Duration(cfg.RequestConfig.DistinctCacheTTL)*time.Second)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		services, err := distinctValues(cache, "services", RetrieveDistinctServices)
+		if err != nil {
+			l.Log.Error("Error retrieving the services: ", err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+			return
+		}
+		writeDistinctValues(w, structs.ServicesData{Services: services})
+	}
+}
+
+// CreateDistinctStatusesHandler returns a handler for /statuses/distinct, listing every status seen
+func CreateDistinctStatusesHandler(cfg config.TrackerConfig) http.HandlerFunc {
+	cache := newTTLCache("statuses", time.Duration(cfg.RequestConfig.DistinctCacheTTL)*time.Second)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		statuses, err := distinctValues(cache, "statuses", RetrieveDistinctStatuses)
+		if err != nil {
+			l.Log.Error("Error retrieving the statuses: ", err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+			return
+		}
+		writeDistinctValues(w, structs.DistinctStatusesData{Statuses: statuses})
+	}
+}
+
+func distinctValues(cache *ttlCache, key string, retrieve func(*gorm.DB) ([]string, error)) ([]string, error) {
+	values, err := cache.get(key, func() (interface{}, error) {
+		values, err := retrieve(Db())
+		sort.Strings(values)
+		return values, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values.([]string), nil
+}
+
+func writeDistinctValues(w http.ResponseWriter, data interface{}) {
+	dataJson, err := json.Marshal(data)
+	if err != nil {
+		l.Log.Error(err)
+		writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+		return
+	}
+
+	writeResponse(w, http.StatusOK, string(dataJson))
+}
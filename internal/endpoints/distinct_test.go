@@ -0,0 +1,132 @@
+package endpoints_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gorm.io/gorm"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+	"github.com/redhatinsights/payload-tracker-go/internal/utils/test"
+)
+
+var _ = Describe("Distinct values", func() {
+	var (
+		rr       *httptest.ResponseRecorder
+		query    map[string]interface{}
+		dbCalls  int
+		response []string
+		dbErr    error
+	)
+
+	mockedRetrieveDistinct := func(_ *gorm.DB) ([]string, error) {
+		dbCalls++
+		return append([]string{}, response...), dbErr
+	}
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		query = make(map[string]interface{})
+		dbCalls = 0
+		response = []string{"success", "error", "received"}
+		dbErr = nil
+
+		endpoints.RetrieveDistinctServices = mockedRetrieveDistinct
+		endpoints.RetrieveDistinctStatuses = mockedRetrieveDistinct
+	})
+
+	Context("Get to /statuses/distinct", func() {
+		It("Should return the sorted statuses", func() {
+			handler := endpoints.CreateDistinctStatusesHandler(*config.Get())
+
+			req, err := test.MakeTestRequest("/api/v1/statuses/distinct", query)
+			Expect(err).To(BeNil())
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+
+			var respData structs.DistinctStatusesData
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &respData)
+
+			Expect(respData.Statuses).To(Equal([]string{"error", "received", "success"}))
+		})
+
+		It("Should cache the statuses", func() {
+			handler := endpoints.CreateDistinctStatusesHandler(*config.Get())
+
+			for i := 0; i < 3; i++ {
+				req, err := test.MakeTestRequest("/api/v1/statuses/distinct", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			Expect(dbCalls).To(Equal(1))
+		})
+
+		It("Should count the cache misses, hits and expirations", func() {
+			lookups := func(outcome string) float64 {
+				return testutil.ToFloat64(endpoints.CacheLookups.WithLabelValues("statuses", outcome))
+			}
+			misses, hits, expirations := lookups("miss"), lookups("hit"), lookups("expired")
+
+			// with a TTL of 0 every lookup after the first finds its entry expired
+			os.Setenv("DISTINCT_CACHE_TTL_SECONDS", "0")
+			expiring := endpoints.CreateDistinctStatusesHandler(*config.Get())
+			os.Unsetenv("DISTINCT_CACHE_TTL_SECONDS")
+			cached := endpoints.CreateDistinctStatusesHandler(*config.Get())
+
+			for _, handler := range []http.Handler{cached, cached, expiring, expiring} {
+				req, err := test.MakeTestRequest("/api/v1/statuses/distinct", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			Expect(lookups("miss")).To(Equal(misses + 2))
+			Expect(lookups("hit")).To(Equal(hits + 1))
+			Expect(lookups("expired")).To(Equal(expirations + 1))
+		})
+
+		It("Should return 500 and not cache a failed lookup", func() {
+			handler := endpoints.CreateDistinctStatusesHandler(*config.Get())
+
+			dbErr = errors.New("connection refused")
+			req, err := test.MakeTestRequest("/api/v1/statuses/distinct", query)
+			Expect(err).To(BeNil())
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+
+			dbErr = nil
+			rr = httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(dbCalls).To(Equal(2))
+		})
+	})
+
+	Context("Get to /services", func() {
+		It("Should return the sorted services", func() {
+			response = []string{"puptoo", "ingress", "advisor"}
+			handler := endpoints.CreateServicesHandler(*config.Get())
+
+			req, err := test.MakeTestRequest("/api/v1/services", query)
+			Expect(err).To(BeNil())
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+
+			var respData structs.ServicesData
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &respData)
+
+			Expect(respData.Services).To(Equal([]string{"advisor", "ingress", "puptoo"}))
+		})
+	})
+})
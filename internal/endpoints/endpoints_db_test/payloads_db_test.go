@@ -14,6 +14,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
 	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
 	"github.com/redhatinsights/payload-tracker-go/internal/models"
 	"github.com/redhatinsights/payload-tracker-go/internal/structs"
@@ -35,11 +36,12 @@ var _ = Describe("Payloads with DB", func() {
 		query = make(map[string]interface{})
 
 		endpoints.Db = db
+		endpoints.ReadDb = db
 	})
 
 	Context("With payloads data in DB", func() {
 		It("retrieves payload", func() {
-			handler = http.HandlerFunc(endpoints.Payloads)
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
 
 			inventoryId := uuid.New().String()
 
@@ -71,9 +73,841 @@ var _ = Describe("Payloads with DB", func() {
 		})
 	})
 
+	Context("With payloads filtered by org_id", func() {
+		It("still returns the account", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			orgId := uuid.New().String()
+
+			payloadData := models.Payloads{
+				Account:   "test-account",
+				OrgId:     orgId,
+				RequestId: uuid.New().String(),
+			}
+
+			Expect(db().Create(&payloadData).Error).ToNot(HaveOccurred())
+
+			query["org_id"] = orgId
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			Expect(payloadRespData.Data[0].OrgId).To(Equal(orgId))
+			Expect(payloadRespData.Data[0].Account).To(Equal(payloadData.Account))
+		})
+	})
+
+	Context("With several payloads in DB", func() {
+		It("returns a unique id for each payload", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			account := uuid.New().String()
+
+			for i := 0; i < 3; i++ {
+				payloadData := models.Payloads{
+					Account:   account,
+					RequestId: uuid.New().String(),
+				}
+				Expect(db().Create(&payloadData).Error).ToNot(HaveOccurred())
+			}
+
+			query["account"] = account
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			Expect(payloadRespData.Data).To(HaveLen(3))
+
+			ids := make(map[uint]bool)
+			for _, payload := range payloadRespData.Data {
+				Expect(payload.Id).ToNot(BeZero())
+				ids[payload.Id] = true
+			}
+			Expect(ids).To(HaveLen(3))
+		})
+	})
+
+	Context("With payloads having different numbers of statuses", func() {
+		It("only returns payloads with at least min_statuses statuses", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			account := uuid.New().String()
+
+			single := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			retried := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			statusData := models.Statuses{Name: "test-status"}
+			serviceData := models.Services{Name: "test-service"}
+
+			Expect(db().Create(&statusData).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&serviceData).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&single).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&retried).Error).ToNot(HaveOccurred())
+
+			payloadDate, _ := time.Parse(time.RFC3339, "2022-06-03T14:00:32.253Z")
+			addStatus := func(payloadId uint, offset int) {
+				Expect(db().Create(&models.PayloadStatuses{
+					PayloadId: payloadId,
+					Status:    statusData,
+					Service:   serviceData,
+					Date:      payloadDate.Add(time.Duration(offset) * time.Second),
+				}).Error).ToNot(HaveOccurred())
+			}
+			addStatus(single.Id, 0)
+			for i := 0; i < 5; i++ {
+				addStatus(retried.Id, i)
+			}
+
+			query["account"] = account
+			query["min_statuses"] = 5
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			Expect(payloadRespData.Count).To(Equal(int64(1)))
+			Expect(payloadRespData.Data[0].RequestId).To(Equal(retried.RequestId))
+		})
+	})
+
+	Context("With skip_count", func() {
+		It("returns the page with a count of -1", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			account := uuid.New().String()
+			payload := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			Expect(db().Create(&payload).Error).ToNot(HaveOccurred())
+
+			query["account"] = account
+			query["skip_count"] = "true"
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			Expect(payloadRespData.Count).To(Equal(int64(-1)))
+			Expect(payloadRespData.Data).To(HaveLen(1))
+			Expect(payloadRespData.Data[0].RequestId).To(Equal(payload.RequestId))
+		})
+	})
+
+	Context("With payloads of several accounts", func() {
+		It("returns the payloads of any of the listed accounts", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			orgId := uuid.New().String()
+			accounts := []string{uuid.New().String(), uuid.New().String(), uuid.New().String()}
+			for _, account := range accounts {
+				payload := models.Payloads{Account: account, OrgId: orgId, RequestId: uuid.New().String()}
+				Expect(db().Create(&payload).Error).ToNot(HaveOccurred())
+			}
+			otherOrg := models.Payloads{Account: accounts[0], OrgId: uuid.New().String(), RequestId: uuid.New().String()}
+			Expect(db().Create(&otherOrg).Error).ToNot(HaveOccurred())
+
+			query["org_id"] = orgId
+			query["account"] = accounts[0] + "," + accounts[2]
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			Expect(payloadRespData.Data).To(HaveLen(2))
+			Expect([]string{payloadRespData.Data[0].Account, payloadRespData.Data[1].Account}).To(ConsistOf(accounts[0], accounts[2]))
+		})
+	})
+
+	Context("With payloads across an account range", func() {
+		It("returns only the numeric accounts within the range", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			orgId := uuid.New().String()
+			for _, account := range []string{"5", "0000150", "200", "not-a-number", "99999999999999999999"} {
+				payload := models.Payloads{Account: account, OrgId: orgId, RequestId: uuid.New().String()}
+				Expect(db().Create(&payload).Error).ToNot(HaveOccurred())
+			}
+
+			query["org_id"] = orgId
+			query["account_gt"] = "10"
+			query["account_lt"] = "200"
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			Expect(payloadRespData.Data).To(HaveLen(1))
+			Expect(payloadRespData.Data[0].Account).To(Equal("0000150"))
+		})
+	})
+
+	Context("With a soft deleted payload", func() {
+		It("leaves it out by default", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			orgId := uuid.New().String()
+			deletedAt := time.Now()
+			kept := models.Payloads{OrgId: orgId, RequestId: uuid.New().String()}
+			deleted := models.Payloads{OrgId: orgId, RequestId: uuid.New().String(), DeletedAt: &deletedAt}
+			Expect(db().Create(&kept).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&deleted).Error).ToNot(HaveOccurred())
+
+			query["org_id"] = orgId
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			Expect(payloadRespData.Count).To(Equal(int64(1)))
+			Expect(payloadRespData.Data[0].RequestId).To(Equal(kept.RequestId))
+		})
+	})
+
+	Context("With payloads sharing a created_at", func() {
+		It("pages through them in id order without repeats", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			account := uuid.New().String()
+			createdAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Microsecond)
+
+			var ids []uint
+			for i := 0; i < 3; i++ {
+				payload := models.Payloads{Account: account, RequestId: uuid.New().String(), CreatedAt: createdAt}
+				Expect(db().Create(&payload).Error).ToNot(HaveOccurred())
+				ids = append(ids, payload.Id)
+			}
+
+			var paged []uint
+			for page := 0; page < 3; page++ {
+				rr = httptest.NewRecorder()
+				query["account"] = account
+				query["sort_by"] = "created_at"
+				query["sort_dir"] = "desc"
+				query["page_size"] = 1
+				query["page"] = page
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				payloadRespData := structs.PayloadsData{}
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				json.Unmarshal(readBody, &payloadRespData)
+
+				Expect(payloadRespData.Data).To(HaveLen(1))
+				paged = append(paged, payloadRespData.Data[0].Id)
+			}
+
+			Expect(paged).To(Equal(ids))
+		})
+	})
+
+	Context("With include_staleness", func() {
+		It("returns the seconds since the latest status of each payload", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			account := uuid.New().String()
+			payload := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			statusData := models.Statuses{Name: "test-status"}
+			serviceData := models.Services{Name: "test-service"}
+			Expect(db().Create(&statusData).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&serviceData).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&payload).Error).ToNot(HaveOccurred())
+
+			for _, age := range []time.Duration{2 * time.Hour, time.Hour} {
+				Expect(db().Create(&models.PayloadStatuses{
+					PayloadId: payload.Id,
+					Status:    statusData,
+					Service:   serviceData,
+					Date:      time.Now().Add(-age),
+				}).Error).ToNot(HaveOccurred())
+			}
+
+			query["account"] = account
+			query["include_staleness"] = "true"
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			Expect(payloadRespData.Data).To(HaveLen(1))
+			Expect(payloadRespData.Data[0].SecondsSinceUpdate).ToNot(BeNil())
+			Expect(*payloadRespData.Data[0].SecondsSinceUpdate).To(BeNumerically("~", time.Hour.Seconds(), 60))
+		})
+	})
+
+	Context("With latest_only", func() {
+		It("returns only the most recent status of each payload", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			account := uuid.New().String()
+			withStatuses := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			withoutStatuses := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			received := models.Statuses{Name: "received"}
+			success := models.Statuses{Name: "success"}
+			ingress := models.Services{Name: "ingress"}
+			puptoo := models.Services{Name: "puptoo"}
+			for _, row := range []interface{}{&received, &success, &ingress, &puptoo, &withStatuses, &withoutStatuses} {
+				Expect(db().Create(row).Error).ToNot(HaveOccurred())
+			}
+
+			latestDate := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+			for _, status := range []models.PayloadStatuses{
+				{PayloadId: withStatuses.Id, Status: received, Service: ingress, Date: latestDate.Add(-time.Hour)},
+				{PayloadId: withStatuses.Id, Status: success, Service: puptoo, Date: latestDate},
+			} {
+				Expect(db().Create(&status).Error).ToNot(HaveOccurred())
+			}
+
+			query["account"] = account
+			query["latest_only"] = "true"
+			query["sort_by"] = "created_at"
+			query["sort_dir"] = "asc"
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			Expect(payloadRespData.Data).To(HaveLen(2))
+			Expect(payloadRespData.Data[0].LatestStatus).ToNot(BeNil())
+			Expect(payloadRespData.Data[0].LatestStatus.Service).To(Equal("puptoo"))
+			Expect(payloadRespData.Data[0].LatestStatus.Status).To(Equal("success"))
+			Expect(payloadRespData.Data[0].LatestStatus.Date.Equal(latestDate)).To(BeTrue())
+			Expect(payloadRespData.Data[1].LatestStatus).To(BeNil())
+		})
+	})
+
+	Context("With include_terminal", func() {
+		It("marks whether the latest status of each payload is terminal", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			account := uuid.New().String()
+			done := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			processing := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			withoutStatuses := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			received := models.Statuses{Name: "received"}
+			success := models.Statuses{Name: "success"}
+			puptoo := models.Services{Name: "puptoo"}
+			for _, row := range []interface{}{&received, &success, &puptoo, &done, &processing, &withoutStatuses} {
+				Expect(db().Create(row).Error).ToNot(HaveOccurred())
+			}
+
+			date := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+			for _, status := range []models.PayloadStatuses{
+				{PayloadId: done.Id, Status: received, Service: puptoo, Date: date.Add(-time.Hour)},
+				{PayloadId: done.Id, Status: success, Service: puptoo, Date: date},
+				{PayloadId: processing.Id, Status: received, Service: puptoo, Date: date},
+			} {
+				Expect(db().Create(&status).Error).ToNot(HaveOccurred())
+			}
+
+			query["account"] = account
+			query["include_terminal"] = "true"
+			query["sort_by"] = "created_at"
+			query["sort_dir"] = "asc"
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			Expect(payloadRespData.Data).To(HaveLen(3))
+			for i, terminal := range []bool{true, false, false} {
+				Expect(payloadRespData.Data[i].Terminal).ToNot(BeNil())
+				Expect(*payloadRespData.Data[i].Terminal).To(Equal(terminal))
+			}
+		})
+	})
+
+	Context("With include_services", func() {
+		var (
+			account      string
+			statusData   models.Statuses
+			payloadsByID map[string]models.Payloads
+		)
+
+		createPayload := func(services ...string) models.Payloads {
+			payload := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			Expect(db().Create(&payload).Error).ToNot(HaveOccurred())
+
+			start := time.Now().Add(-time.Hour)
+			for i, name := range services {
+				service := models.Services{Name: name}
+				Expect(db().Create(&service).Error).ToNot(HaveOccurred())
+				Expect(db().Create(&models.PayloadStatuses{
+					PayloadId: payload.Id,
+					Status:    statusData,
+					Service:   service,
+					Date:      start.Add(time.Duration(i) * time.Minute),
+				}).Error).ToNot(HaveOccurred())
+			}
+			return payload
+		}
+
+		listPayloads := func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			query["account"] = account
+			query["include_services"] = "true"
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			payloadsByID = map[string]models.Payloads{}
+			for _, payload := range payloadRespData.Data {
+				payloadsByID[payload.RequestId] = payload
+			}
+		}
+
+		BeforeEach(func() {
+			account = uuid.New().String()
+			statusData = models.Statuses{Name: "test-status"}
+			Expect(db().Create(&statusData).Error).ToNot(HaveOccurred())
+		})
+
+		It("returns the same first and last service for a single service payload", func() {
+			payload := createPayload("ingress", "ingress")
+
+			listPayloads()
+
+			Expect(payloadsByID[payload.RequestId].FirstService).To(Equal("ingress"))
+			Expect(payloadsByID[payload.RequestId].LastService).To(Equal("ingress"))
+		})
+
+		It("returns the services of the earliest and latest statuses for a multi service payload", func() {
+			payload := createPayload("ingress", "puptoo", "advisor")
+			stuck := createPayload("ingress")
+
+			listPayloads()
+
+			Expect(payloadsByID[payload.RequestId].FirstService).To(Equal("ingress"))
+			Expect(payloadsByID[payload.RequestId].LastService).To(Equal("advisor"))
+			Expect(payloadsByID[stuck.RequestId].LastService).To(Equal("ingress"))
+		})
+	})
+
+	Context("With payloads created in and out of business hours", func() {
+		It("returns only the payloads created within the hours in the timezone", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			account := uuid.New().String()
+			morning := models.Payloads{Account: account, RequestId: uuid.New().String(), CreatedAt: time.Date(2022, 6, 3, 14, 0, 0, 0, time.UTC)}
+			night := models.Payloads{Account: account, RequestId: uuid.New().String(), CreatedAt: time.Date(2022, 6, 3, 3, 0, 0, 0, time.UTC)}
+			Expect(db().Create(&morning).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&night).Error).ToNot(HaveOccurred())
+
+			query["account"] = account
+			query["business_hours"] = "true"
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+			Expect(payloadRespData.Data).To(HaveLen(1))
+			Expect(payloadRespData.Data[0].RequestId).To(Equal(morning.RequestId))
+
+			// 14:00 UTC is 23:00 in Tokyo, 03:00 UTC is noon
+			rr = httptest.NewRecorder()
+			query["business_hours_tz"] = "Asia/Tokyo"
+			req, err = test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData = structs.PayloadsData{}
+			readBody, _ = ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+			Expect(payloadRespData.Data).To(HaveLen(1))
+			Expect(payloadRespData.Data[0].RequestId).To(Equal(night.RequestId))
+		})
+	})
+
+	Context("With payloads sharing a request_id prefix", func() {
+		It("matches the prefix literally", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			prefix := uuid.New().String()[:8]
+			matching := models.Payloads{RequestId: prefix + "_" + uuid.New().String()[:8]}
+			// _ is a LIKE wildcard, so this would match an unescaped prefix
+			wildcard := models.Payloads{RequestId: prefix + "x" + uuid.New().String()[:8]}
+			Expect(db().Create(&matching).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&wildcard).Error).ToNot(HaveOccurred())
+
+			query["request_id_prefix"] = prefix + "_"
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			Expect(payloadRespData.Count).To(Equal(int64(1)))
+			Expect(payloadRespData.Data[0].RequestId).To(Equal(matching.RequestId))
+		})
+	})
+
+	Context("With payloads having statuses from different services", func() {
+		It("returns payloads matching any of the service_status pairs", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			account := uuid.New().String()
+
+			failed := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			advised := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			other := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			errorStatus := models.Statuses{Name: "error"}
+			successStatus := models.Statuses{Name: "success"}
+			puptoo := models.Services{Name: "puptoo"}
+			advisor := models.Services{Name: "advisor"}
+
+			for _, record := range []interface{}{&errorStatus, &successStatus, &puptoo, &advisor, &failed, &advised, &other} {
+				Expect(db().Create(record).Error).ToNot(HaveOccurred())
+			}
+
+			payloadDate, _ := time.Parse(time.RFC3339, "2022-06-03T14:00:32.253Z")
+			addStatus := func(payloadId uint, service models.Services, status models.Statuses) {
+				Expect(db().Create(&models.PayloadStatuses{
+					PayloadId: payloadId,
+					Status:    status,
+					Service:   service,
+					Date:      payloadDate,
+				}).Error).ToNot(HaveOccurred())
+			}
+			addStatus(failed.Id, puptoo, errorStatus)
+			addStatus(advised.Id, advisor, successStatus)
+			// the service and status match different pairs on different rows
+			addStatus(other.Id, puptoo, successStatus)
+			addStatus(other.Id, advisor, errorStatus)
+
+			query["account"] = account
+			query["service_status"] = "puptoo:error,advisor:success"
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			Expect(payloadRespData.Count).To(Equal(int64(2)))
+			requestIds := []string{payloadRespData.Data[0].RequestId, payloadRespData.Data[1].RequestId}
+			Expect(requestIds).To(ConsistOf(failed.RequestId, advised.RequestId))
+		})
+	})
+
+	Context("With payloads and status messages in DB", func() {
+		It("filters payloads by an exact status_msg and service", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			statusMsg := uuid.New().String()
+
+			matching := models.Payloads{RequestId: uuid.New().String()}
+			other := models.Payloads{RequestId: uuid.New().String()}
+			statusData := models.Statuses{Name: "test-status"}
+			serviceData := models.Services{Name: "test-service"}
+
+			Expect(db().Create(&statusData).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&serviceData).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&matching).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&other).Error).ToNot(HaveOccurred())
+
+			payloadDate, _ := time.Parse(time.RFC3339, "2022-06-03T14:00:32.253Z")
+			Expect(db().Create(&models.PayloadStatuses{
+				PayloadId: matching.Id,
+				Status:    statusData,
+				Service:   serviceData,
+				StatusMsg: statusMsg,
+				Date:      payloadDate,
+			}).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&models.PayloadStatuses{
+				PayloadId: other.Id,
+				Status:    statusData,
+				Service:   serviceData,
+				StatusMsg: statusMsg + "-other",
+				Date:      payloadDate,
+			}).Error).ToNot(HaveOccurred())
+
+			query["status_msg"] = statusMsg
+			query["service"] = serviceData.Name
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			Expect(payloadRespData.Count).To(Equal(int64(1)))
+			Expect(payloadRespData.Data[0].RequestId).To(Equal(matching.RequestId))
+		})
+
+		It("filters payloads by the JSON value at msg_path in a status_msg", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			account := uuid.New().String()
+			matching := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			otherCode := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			notJSON := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			statusData := models.Statuses{Name: "error"}
+			serviceData := models.Services{Name: "puptoo"}
+			for _, row := range []interface{}{&statusData, &serviceData, &matching, &otherCode, &notJSON} {
+				Expect(db().Create(row).Error).ToNot(HaveOccurred())
+			}
+
+			payloadDate, _ := time.Parse(time.RFC3339, "2022-06-03T14:00:32.253Z")
+			for payloadId, statusMsg := range map[uint]string{
+				matching.Id:  `{"error": {"code": "E42", "detail": "bad archive"}}`,
+				otherCode.Id: `{"error": {"code": "E7"}}`,
+				notJSON.Id:   "error: E42",
+			} {
+				Expect(db().Create(&models.PayloadStatuses{
+					PayloadId: payloadId,
+					Status:    statusData,
+					Service:   serviceData,
+					StatusMsg: statusMsg,
+					Date:      payloadDate,
+				}).Error).ToNot(HaveOccurred())
+			}
+
+			query["account"] = account
+			query["msg_path"] = "error.code"
+			query["msg_value"] = "E42"
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			Expect(payloadRespData.Count).To(Equal(int64(1)))
+			Expect(payloadRespData.Data[0].RequestId).To(Equal(matching.RequestId))
+		})
+
+		It("separates payloads with a status_msg from the service from silent ones", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			account := uuid.New().String()
+
+			logged := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			silent := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			loggedElsewhere := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			statusData := models.Statuses{Name: "test-status"}
+			serviceData := models.Services{Name: uuid.New().String()}
+			otherService := models.Services{Name: uuid.New().String()}
+
+			Expect(db().Create(&statusData).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&serviceData).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&otherService).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&logged).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&silent).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&loggedElsewhere).Error).ToNot(HaveOccurred())
+
+			payloadDate, _ := time.Parse(time.RFC3339, "2022-06-03T14:00:32.253Z")
+			for _, status := range []models.PayloadStatuses{
+				{PayloadId: logged.Id, Status: statusData, Service: serviceData, StatusMsg: "failed to parse", Date: payloadDate},
+				{PayloadId: silent.Id, Status: statusData, Service: serviceData, Date: payloadDate},
+				{PayloadId: loggedElsewhere.Id, Status: statusData, Service: serviceData, Date: payloadDate},
+				{PayloadId: loggedElsewhere.Id, Status: statusData, Service: otherService, StatusMsg: "retrying", Date: payloadDate},
+			} {
+				Expect(db().Create(&status).Error).ToNot(HaveOccurred())
+			}
+
+			for hasMessage, expected := range map[string][]string{
+				"true":  {logged.RequestId},
+				"false": {silent.RequestId, loggedElsewhere.RequestId},
+			} {
+				rr = httptest.NewRecorder()
+				query["account"] = account
+				query["service"] = serviceData.Name
+				query["has_message"] = hasMessage
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				payloadRespData := structs.PayloadsData{}
+
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				json.Unmarshal(readBody, &payloadRespData)
+
+				var requestIDs []string
+				for _, payload := range payloadRespData.Data {
+					requestIDs = append(requestIDs, payload.RequestId)
+				}
+				Expect(requestIDs).To(ConsistOf(expected))
+			}
+		})
+
+		It("excludes payloads that ever had a status_ne status", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			account := uuid.New().String()
+
+			kept := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			excluded := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			received := models.Statuses{Name: uuid.New().String()}
+			failed := models.Statuses{Name: uuid.New().String()}
+			serviceData := models.Services{Name: "test-service"}
+
+			Expect(db().Create(&received).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&failed).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&serviceData).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&kept).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&excluded).Error).ToNot(HaveOccurred())
+
+			payloadDate, _ := time.Parse(time.RFC3339, "2022-06-03T14:00:32.253Z")
+			for _, status := range []models.PayloadStatuses{
+				{PayloadId: kept.Id, Status: received, Service: serviceData, Date: payloadDate},
+				{PayloadId: excluded.Id, Status: received, Service: serviceData, Date: payloadDate},
+				{PayloadId: excluded.Id, Status: failed, Service: serviceData, Date: payloadDate},
+			} {
+				Expect(db().Create(&status).Error).ToNot(HaveOccurred())
+			}
+
+			query["account"] = account
+			query["status"] = received.Name
+			query["status_ne"] = failed.Name + ",unknown"
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			Expect(payloadRespData.Count).To(Equal(int64(1)))
+			Expect(payloadRespData.Data[0].RequestId).To(Equal(kept.RequestId))
+		})
+
+		It("excludes payloads that ever had a status from a service_ne service", func() {
+			handler = endpoints.CreatePayloadsHandler(*config.Get())
+
+			account := uuid.New().String()
+
+			kept := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			excluded := models.Payloads{Account: account, RequestId: uuid.New().String()}
+			statusData := models.Statuses{Name: "received"}
+			ingress := models.Services{Name: uuid.New().String()}
+			bridge := models.Services{Name: uuid.New().String()}
+
+			Expect(db().Create(&statusData).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&ingress).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&bridge).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&kept).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&excluded).Error).ToNot(HaveOccurred())
+
+			payloadDate, _ := time.Parse(time.RFC3339, "2022-06-03T14:00:32.253Z")
+			for _, status := range []models.PayloadStatuses{
+				{PayloadId: kept.Id, Status: statusData, Service: ingress, Date: payloadDate},
+				{PayloadId: excluded.Id, Status: statusData, Service: ingress, Date: payloadDate},
+				{PayloadId: excluded.Id, Status: statusData, Service: bridge, Date: payloadDate.Add(time.Second)},
+			} {
+				Expect(db().Create(&status).Error).ToNot(HaveOccurred())
+			}
+
+			query["account"] = account
+			query["service_ne"] = bridge.Name + ",unknown"
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+
+			handler.ServeHTTP(rr, req)
+			Expect(rr.Code).To(Equal(200))
+
+			payloadRespData := structs.PayloadsData{}
+
+			readBody, _ := ioutil.ReadAll(rr.Body)
+			json.Unmarshal(readBody, &payloadRespData)
+
+			Expect(payloadRespData.Count).To(Equal(int64(1)))
+			Expect(payloadRespData.Data[0].RequestId).To(Equal(kept.RequestId))
+		})
+	})
+
 	Context("With payload statuses data in DB", func() {
 		It("retrieves request_id payload", func() {
-			handler = http.HandlerFunc(endpoints.RequestIdPayloads)
+			handler = endpoints.CreateRequestIdPayloadsHandler(*config.Get())
 
 			requestId := uuid.New().String()
 
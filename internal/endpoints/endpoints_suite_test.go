@@ -1,13 +1,23 @@
 package endpoints_test
 
 import (
+	"net/http"
 	"testing"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
 	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
 )
 
+// perRequest builds the handler from the config as it is when each request is served, so that a test can
+// change the config through the environment after setting the handler up
+func perRequest(create func(config.TrackerConfig) http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		create(*config.Get())(w, r)
+	}
+}
+
 func TestEndpoints(t *testing.T) {
 	RegisterFailHandler(Fail)
 	l.InitLogger()
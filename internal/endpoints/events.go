@@ -0,0 +1,206 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+	"github.com/redhatinsights/payload-tracker-go/internal/queries"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+)
+
+// events buffered per subscriber before new ones are dropped for a slow client
+const subscriberBuffer = 16
+
+var PayloadExists = queries.PayloadExists
+
+// StatusEvents fans status events out to the subscribers of each request_id and to the subscribers of every status
+type StatusEvents struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan structs.SinglePayloadData]bool
+	all         map[chan structs.SinglePayloadData]bool
+}
+
+func NewStatusEvents() *StatusEvents {
+	return &StatusEvents{
+		subscribers: make(map[string]map[chan structs.SinglePayloadData]bool),
+		all:         make(map[chan structs.SinglePayloadData]bool),
+	}
+}
+
+// Subscribe returns a channel receiving the events for the request_id and a func to stop receiving them
+func (e *StatusEvents) Subscribe(reqID string) (<-chan structs.SinglePayloadData, func()) {
+	events := make(chan structs.SinglePayloadData, subscriberBuffer)
+
+	e.mu.Lock()
+	if e.subscribers[reqID] == nil {
+		e.subscribers[reqID] = make(map[chan structs.SinglePayloadData]bool)
+	}
+	e.subscribers[reqID][events] = true
+	e.mu.Unlock()
+
+	return events, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.subscribers[reqID], events)
+		if len(e.subscribers[reqID]) == 0 {
+			delete(e.subscribers, reqID)
+		}
+	}
+}
+
+// SubscribeAll returns a channel receiving every event and a func to stop receiving them
+func (e *StatusEvents) SubscribeAll() (<-chan structs.SinglePayloadData, func()) {
+	events := make(chan structs.SinglePayloadData, subscriberBuffer)
+
+	e.mu.Lock()
+	e.all[events] = true
+	e.mu.Unlock()
+
+	return events, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.all, events)
+	}
+}
+
+// Publish sends the event to its subscribers without blocking on any of them, slow subscribers miss the event
+func (e *StatusEvents) Publish(event structs.SinglePayloadData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for events := range e.subscribers[event.RequestID] {
+		send(events, event)
+	}
+	for events := range e.all {
+		send(events, event)
+	}
+}
+
+func send(events chan structs.SinglePayloadData, event structs.SinglePayloadData) {
+	select {
+	case events <- event:
+	default:
+		l.Log.Warnf("Dropped status event for request_id %s, subscriber is not keeping up", event.RequestID)
+	}
+}
+
+// PayloadEvents returns a handler for /payloads/{request_id}/events, streaming each new status as a server-sent event
+func PayloadEvents(events *StatusEvents, heartbeat time.Duration) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		reqID := chi.URLParam(r, "request_id")
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Streaming unsupported", http.StatusInternalServerError))
+			return
+		}
+
+		// subscribe before the lookup so nothing written in between is missed
+		statuses, unsubscribe := events.Subscribe(reqID)
+		defer unsubscribe()
+
+		if !PayloadExists(Db(), reqID) {
+			writeResponse(w, http.StatusNotFound, getErrorBody("payload with id: "+reqID+" not found", http.StatusNotFound))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		stream, err := openEventStream(w, flusher, r)
+		if err != nil {
+			l.Log.Error("Error opening the event stream: ", err)
+			return
+		}
+		defer stream.close()
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stream.closed:
+				return
+			case status := <-statuses:
+				data, err := json.Marshal(status)
+				if err != nil {
+					l.Log.Error(err)
+					continue
+				}
+				fmt.Fprintf(stream.w, "event: status\ndata: %s\n\n", data)
+			case <-ticker.C:
+				fmt.Fprint(stream.w, ": heartbeat\n\n")
+			}
+			if err := stream.flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// eventStream is the open body of an event stream and the channel closed once the client goes away
+type eventStream struct {
+	w      io.Writer
+	flush  func() error
+	closed <-chan struct{}
+	close  func()
+}
+
+// openEventStream sends the 200 and headers of an event stream. The server WriteTimeout covers the whole
+// response and net/http has no way to lift it for one, so the connection is hijacked and its deadlines
+// cleared, as for the websockets. Writers that can't be hijacked stream through the flusher until the timeout.
+func openEventStream(w http.ResponseWriter, flusher http.Flusher, r *http.Request) (*eventStream, error) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		return &eventStream{
+			w:      w,
+			flush:  func() error { flusher.Flush(); return nil },
+			closed: r.Context().Done(),
+			close:  func() {},
+		}, nil
+	}
+
+	header := w.Header().Clone()
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	// without a length or chunking the body runs until the connection is closed
+	header.Set("Connection", "close")
+	buf.WriteString("HTTP/1.1 200 OK\r\n")
+	header.Write(buf)
+	buf.WriteString("\r\n")
+	if err := buf.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// nothing is expected from the client, reading only notices it going away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		io.Copy(ioutil.Discard, buf.Reader)
+	}()
+
+	return &eventStream{
+		w:      buf,
+		flush:  buf.Flush,
+		closed: closed,
+		close:  func() { conn.Close() },
+	}, nil
+}
@@ -0,0 +1,133 @@
+package endpoints_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/gorm"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+)
+
+var _ = Describe("StatusEvents", func() {
+	It("Delivers events only to subscribers of the request_id", func() {
+		events := endpoints.NewStatusEvents()
+		first, unsubscribeFirst := events.Subscribe("first")
+		second, unsubscribeSecond := events.Subscribe("second")
+		defer unsubscribeSecond()
+
+		events.Publish(structs.SinglePayloadData{RequestID: "first", Status: "received"})
+
+		Expect(first).To(Receive(Equal(structs.SinglePayloadData{RequestID: "first", Status: "received"})))
+		Expect(second).ToNot(Receive())
+
+		unsubscribeFirst()
+		events.Publish(structs.SinglePayloadData{RequestID: "first", Status: "success"})
+		Expect(first).ToNot(Receive())
+	})
+})
+
+var _ = Describe("PayloadEvents", func() {
+	var (
+		events *endpoints.StatusEvents
+		server *httptest.Server
+		exists bool
+	)
+
+	BeforeEach(func() {
+		exists = true
+		endpoints.PayloadExists = func(_ *gorm.DB, _ string) bool { return exists }
+
+		events = endpoints.NewStatusEvents()
+		r := chi.NewRouter()
+		r.Get("/payloads/{request_id}/events", endpoints.PayloadEvents(events, 50*time.Millisecond))
+		server = httptest.NewServer(r)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	readLine := func(reader *bufio.Reader) string {
+		line, err := reader.ReadString('\n')
+		Expect(err).ToNot(HaveOccurred())
+		return strings.TrimSuffix(line, "\n")
+	}
+
+	It("Streams new statuses for the request_id", func() {
+		resp, err := http.Get(server.URL + "/payloads/abc/events")
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+		events.Publish(structs.SinglePayloadData{RequestID: "abc", Service: "puptoo", Status: "success"})
+
+		reader := bufio.NewReader(resp.Body)
+		line := readLine(reader)
+		for strings.HasPrefix(line, ":") || line == "" {
+			line = readLine(reader)
+		}
+		Expect(line).To(Equal("event: status"))
+		data := readLine(reader)
+		Expect(data).To(HavePrefix("data: "))
+
+		var status structs.SinglePayloadData
+		Expect(json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &status)).To(Succeed())
+		Expect(status.RequestID).To(Equal("abc"))
+		Expect(status.Status).To(Equal("success"))
+	})
+
+	It("Sends heartbeat comments", func() {
+		resp, err := http.Get(server.URL + "/payloads/abc/events")
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+
+		Expect(readLine(bufio.NewReader(resp.Body))).To(Equal(": heartbeat"))
+	})
+
+	It("Keeps streaming past the server write timeout", func() {
+		server.Close()
+		r := chi.NewRouter()
+		r.Get("/payloads/{request_id}/events", endpoints.PayloadEvents(events, 50*time.Millisecond))
+		server = httptest.NewUnstartedServer(r)
+		server.Config.WriteTimeout = 100 * time.Millisecond
+		server.Start()
+
+		resp, err := http.Get(server.URL + "/payloads/abc/events")
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+		reader := bufio.NewReader(resp.Body)
+		deadline := time.Now().Add(300 * time.Millisecond)
+		for time.Now().Before(deadline) {
+			Expect(readLine(reader)).To(Equal(": heartbeat"))
+			Expect(readLine(reader)).To(Equal(""))
+		}
+
+		events.Publish(structs.SinglePayloadData{RequestID: "abc", Status: "success"})
+		line := readLine(reader)
+		for strings.HasPrefix(line, ":") || line == "" {
+			line = readLine(reader)
+		}
+		Expect(line).To(Equal("event: status"))
+	})
+
+	It("Returns 404 for an unknown request_id", func() {
+		exists = false
+		resp, err := http.Get(server.URL + "/payloads/abc/events")
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+})
@@ -0,0 +1,7 @@
+package endpoints
+
+// CacheLookups lets the endpoints_test package read the cache lookup counter
+var CacheLookups = cacheLookups
+
+// OrgThrottledRequests lets the endpoints_test package read the org rate limit counter
+var OrgThrottledRequests = orgThrottledRequests
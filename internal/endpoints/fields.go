@@ -0,0 +1,140 @@
+package endpoints
+
+import (
+	"encoding/json"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+)
+
+// fieldPolicy is the configured set of payload and status fields a response may be served with, it is read
+// from the config once per response rather than for every field of every row
+type fieldPolicy struct {
+	include map[string]bool
+	exclude map[string]bool
+}
+
+func newFieldPolicy(cfg config.RequestCfg) fieldPolicy {
+	policy := fieldPolicy{include: make(map[string]bool), exclude: make(map[string]bool)}
+	for _, field := range cfg.ResponseFieldsInclude {
+		policy.include[field] = true
+	}
+	for _, field := range cfg.ResponseFieldsExclude {
+		policy.exclude[field] = true
+	}
+	return policy
+}
+
+// keepsAll is whether the policy serves every field, so that responses don't need to be filtered
+func (p fieldPolicy) keepsAll() bool {
+	return len(p.include) == 0 && len(p.exclude) == 0
+}
+
+// allowed reports whether a payload or status field may be served under the policy
+func (p fieldPolicy) allowed(field string) bool {
+	if len(p.include) > 0 && !p.include[field] {
+		return false
+	}
+	return !p.exclude[field]
+}
+
+// marshalResponse marshals a response body, dropping the fields of its data rows that the field policy leaves out,
+// the counts, durations and other metadata around the rows are kept as they are
+func marshalResponse(policy fieldPolicy, v interface{}) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy.keepsAll() {
+		return body, nil
+	}
+
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+	rawRows, ok := document["data"]
+	if !ok {
+		return body, nil
+	}
+
+	var rows []map[string]json.RawMessage
+	if err := json.Unmarshal(rawRows, &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		// JSON:API resources carry the fields as attributes next to their type and id
+		if rawAttributes, ok := row["attributes"]; ok {
+			var attributes map[string]json.RawMessage
+			if err := json.Unmarshal(rawAttributes, &attributes); err != nil {
+				return nil, err
+			}
+			if err := policy.dropFields(attributes); err != nil {
+				return nil, err
+			}
+			if row["attributes"], err = json.Marshal(attributes); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := policy.dropFields(row); err != nil {
+			return nil, err
+		}
+	}
+
+	if document["data"], err = json.Marshal(rows); err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+// omitCount drops count from a response body, at the top level or in its meta, leaving it to the X-Total-Count header
+func omitCount(body []byte) ([]byte, error) {
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, err
+	}
+	delete(document, "count")
+
+	if rawMeta, ok := document["meta"]; ok {
+		var meta map[string]json.RawMessage
+		if err := json.Unmarshal(rawMeta, &meta); err != nil {
+			return nil, err
+		}
+		delete(meta, "count")
+		var err error
+		if document["meta"], err = json.Marshal(meta); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(document)
+}
+
+// dropFields drops the fields of a row, and of the statuses nested in it with embed=statuses
+func (p fieldPolicy) dropFields(row map[string]json.RawMessage) error {
+	for field := range row {
+		if !p.allowed(field) {
+			delete(row, field)
+		}
+	}
+
+	rawStatuses, ok := row["statuses"]
+	if !ok {
+		return nil
+	}
+	var statuses []map[string]json.RawMessage
+	if err := json.Unmarshal(rawStatuses, &statuses); err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		for field := range status {
+			if !p.allowed(field) {
+				delete(status, field)
+			}
+		}
+	}
+	var err error
+	row["statuses"], err = json.Marshal(statuses)
+	return err
+}
@@ -10,16 +10,35 @@ import (
 // HealthCheckHandler checks for active DB connection and operational API
 func HealthCheckHandler(db *gorm.DB, cfg config.TrackerConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		d, err := db.DB()
-		if err != nil {
+		if err := pingDB(db); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		if err = d.Ping(); err != nil {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	}
+}
+
+// ConsumerHealthCheckHandler checks for active DB connection and reports whether the consumer is paused
+func ConsumerHealthCheckHandler(db *gorm.DB, cfg config.TrackerConfig, control ConsumerControl) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := pingDB(db); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 		w.WriteHeader(http.StatusOK)
+		if control.Paused() {
+			w.Write([]byte("OK (paused)"))
+			return
+		}
 		w.Write([]byte("OK"))
 	}
 }
+
+func pingDB(db *gorm.DB) error {
+	d, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return d.Ping()
+}
@@ -0,0 +1,199 @@
+package endpoints
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+	models "github.com/redhatinsights/payload-tracker-go/internal/models/db"
+	"github.com/redhatinsights/payload-tracker-go/internal/queries"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotency-Replayed"
+
+	// maxIdempotencyKeyLength keeps keys to what fits a uuid or a job name with some room to spare
+	maxIdempotencyKeyLength = 255
+)
+
+var (
+	RetrieveIdempotentResponse = queries.RetrieveIdempotentResponse
+	StoreIdempotentResponse    = queries.StoreIdempotentResponse
+)
+
+// idempotencyStore remembers the responses to requests sent with an idempotency key until they expire
+type idempotencyStore interface {
+	lookup(key string) (models.IdempotencyKeys, bool)
+	save(response models.IdempotencyKeys)
+}
+
+type memoryIdempotencyStore struct {
+	mu        sync.Mutex
+	responses map[string]models.IdempotencyKeys
+}
+
+func (s *memoryIdempotencyStore) lookup(key string) (models.IdempotencyKeys, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	response, ok := s.responses[key]
+	if !ok || !time.Now().Before(response.ExpiresAt) {
+		return models.IdempotencyKeys{}, false
+	}
+	return response, true
+}
+
+// save drops the expired responses as it goes so the map only holds the ones that can still be replayed
+func (s *memoryIdempotencyStore) save(response models.IdempotencyKeys) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, stored := range s.responses {
+		if !now.Before(stored.ExpiresAt) {
+			delete(s.responses, key)
+		}
+	}
+	s.responses[response.Key] = response
+}
+
+type dbIdempotencyStore struct{}
+
+func (dbIdempotencyStore) lookup(key string) (models.IdempotencyKeys, bool) {
+	return RetrieveIdempotentResponse(Db(), key)
+}
+
+// save only logs a failure, the request was handled and a retry is then processed again as if it had no key
+func (dbIdempotencyStore) save(response models.IdempotencyKeys) {
+	if err := StoreIdempotentResponse(Db(), response); err != nil {
+		l.Log.Errorf("Failed to store the response for idempotency key %s: %v", response.Key, err)
+	}
+}
+
+// IdempotencyMiddleware replays the stored response when a request repeats the Idempotency-Key of an earlier one
+// from the same identity to the same route, instead of handling it again. A different identity reusing the key is
+// handled, and so checked for its roles, as a request of its own. A repeat with a different body gets a 422. Only
+// successful responses are stored, so a request that failed can be retried with its key. A repeat that arrives
+// while the first request is still being handled by the same replica gets a 409, with the db store a repeat sent
+// to another replica at the same time is handled by both.
+// Requests without the header are handled as usual.
+func IdempotencyMiddleware(cfg config.IdempotencyCfg) (func(http.Handler) http.Handler, error) {
+	var store idempotencyStore
+	switch cfg.Store {
+	case "memory":
+		store = &memoryIdempotencyStore{responses: make(map[string]models.IdempotencyKeys)}
+	case "db":
+		store = dbIdempotencyStore{}
+	default:
+		return nil, fmt.Errorf("%s is not an idempotency store, must be memory or db", cfg.Store)
+	}
+	ttl := time.Duration(cfg.TTL) * time.Second
+
+	var mu sync.Mutex
+	inFlight := make(map[string]bool)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idempotencyKey := r.Header.Get(idempotencyKeyHeader)
+			if idempotencyKey == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(idempotencyKey) > maxIdempotencyKeyLength {
+				writeResponse(w, http.StatusBadRequest, getErrorBody(fmt.Sprintf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength), http.StatusBadRequest))
+				return
+			}
+
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				writeResponse(w, http.StatusBadRequest, getErrorBody("Failed to read the request body", http.StatusBadRequest))
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			requestHash := sha256Hex(body)
+
+			// keys are scoped to the route so the same key sent to two endpoints doesn't replay one for the other,
+			// and to the identity so that a response is never replayed to a caller who wasn't checked for the role
+			key := r.Method + " " + r.URL.Path + " " + sha256Hex([]byte(r.Header.Get("x-rh-identity"))) + " " + idempotencyKey
+
+			mu.Lock()
+			if inFlight[key] {
+				mu.Unlock()
+				incIdempotentRequests("in_progress")
+				w.Header().Set("Retry-After", "1")
+				writeResponse(w, http.StatusConflict, getErrorBody("A request with this "+idempotencyKeyHeader+" is still being handled", http.StatusConflict))
+				return
+			}
+			inFlight[key] = true
+			mu.Unlock()
+
+			defer func() {
+				mu.Lock()
+				delete(inFlight, key)
+				mu.Unlock()
+			}()
+
+			if stored, ok := store.lookup(key); ok {
+				if stored.RequestHash != requestHash {
+					incIdempotentRequests("mismatch")
+					writeResponse(w, http.StatusUnprocessableEntity, getErrorBody("This "+idempotencyKeyHeader+" was already used with a different request body", http.StatusUnprocessableEntity))
+					return
+				}
+				incIdempotentRequests("replayed")
+				if stored.ContentType != "" {
+					w.Header().Set("Content-Type", stored.ContentType)
+				}
+				w.Header().Set(idempotencyReplayedHeader, "true")
+				w.WriteHeader(stored.StatusCode)
+				w.Write(stored.Body)
+				return
+			}
+
+			rw := &recordingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rw, r)
+
+			if rw.status < 200 || rw.status >= 300 {
+				return
+			}
+			incIdempotentRequests("stored")
+			store.save(models.IdempotencyKeys{
+				Key:         key,
+				StatusCode:  rw.status,
+				ContentType: w.Header().Get("Content-Type"),
+				Body:        rw.body.Bytes(),
+				ExpiresAt:   time.Now().Add(ttl),
+				RequestHash: requestHash,
+			})
+		})
+	}, nil
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordingResponseWriter passes the response through while keeping a copy of it to store
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(status int) {
+	rw.status = status
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,214 @@
+package endpoints_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/gorm"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
+	models "github.com/redhatinsights/payload-tracker-go/internal/models/db"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+)
+
+var _ = Describe("IdempotencyMiddleware", func() {
+	var (
+		handler http.Handler
+		handled int
+		status  int
+	)
+
+	counting := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"handled": true}`))
+	})
+
+	send := func(path string, key string, identity string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		if identity != "" {
+			req.Header.Set("x-rh-identity", identity)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	post := func(path string, key string) *httptest.ResponseRecorder {
+		return send(path, key, "", "")
+	}
+
+	BeforeEach(func() {
+		handled = 0
+		status = http.StatusOK
+
+		idempotent, err := endpoints.IdempotencyMiddleware(config.IdempotencyCfg{Store: "memory", TTL: 60})
+		Expect(err).ToNot(HaveOccurred())
+		handler = idempotent(counting)
+	})
+
+	It("Should replay the response for a repeated key", func() {
+		first := post("/api/v1/admin/replay", "job-1")
+		Expect(first.Code).To(Equal(http.StatusOK))
+		Expect(first.Header().Get("Idempotency-Replayed")).To(BeEmpty())
+
+		second := post("/api/v1/admin/replay", "job-1")
+		Expect(second.Code).To(Equal(http.StatusOK))
+		Expect(second.Body.String()).To(Equal(first.Body.String()))
+		Expect(second.Header().Get("Content-Type")).To(Equal("application/json"))
+		Expect(second.Header().Get("Idempotency-Replayed")).To(Equal("true"))
+		Expect(handled).To(Equal(1))
+	})
+
+	It("Should handle requests without a key or with new keys", func() {
+		post("/api/v1/admin/replay", "")
+		post("/api/v1/admin/replay", "")
+		post("/api/v1/admin/replay", "job-1")
+		post("/api/v1/admin/replay", "job-2")
+		Expect(handled).To(Equal(4))
+	})
+
+	It("Should scope keys to the route", func() {
+		post("/api/v1/admin/replay", "job-1")
+		post("/api/v1/admin/statuses", "job-1")
+		Expect(handled).To(Equal(2))
+	})
+
+	It("Should return 422 for a repeated key with a different body", func() {
+		Expect(send("/api/v1/admin/replay", "job-1", "", `{"limit": 1}`).Code).To(Equal(http.StatusOK))
+		Expect(send("/api/v1/admin/replay", "job-1", "", `{"limit": 1}`).Header().Get("Idempotency-Replayed")).To(Equal("true"))
+
+		rr := send("/api/v1/admin/replay", "job-1", "", `{"limit": 2}`)
+		Expect(rr.Code).To(Equal(http.StatusUnprocessableEntity))
+		Expect(handled).To(Equal(1))
+	})
+
+	It("Should pass the body on to the handler", func() {
+		idempotent, err := endpoints.IdempotencyMiddleware(config.IdempotencyCfg{Store: "memory", TTL: 60})
+		Expect(err).ToNot(HaveOccurred())
+		var received []byte
+		handler = idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received, _ = ioutil.ReadAll(r.Body)
+		}))
+
+		send("/api/v1/admin/statuses", "job-1", "", `{"statuses": []}`)
+		Expect(string(received)).To(Equal(`{"statuses": []}`))
+	})
+
+	It("Should check the roles of another identity reusing the key", func() {
+		idempotent, err := endpoints.IdempotencyMiddleware(config.IdempotencyCfg{Store: "memory", TTL: 60})
+		Expect(err).ToNot(HaveOccurred())
+		handler = idempotent(endpoints.ReplayDeadLetters(*config.Get(), func(context.Context, int) (structs.ReplayResult, error) {
+			handled++
+			return structs.ReplayResult{Succeeded: 3}, nil
+		}))
+
+		Expect(send("/api/v1/admin/replay", "job-1", adminIdentityHeader, "").Code).To(Equal(http.StatusOK))
+		Expect(send("/api/v1/admin/replay", "job-1", validIdentityHeader, "").Code).To(Equal(http.StatusForbidden))
+		Expect(send("/api/v1/admin/replay", "job-1", adminIdentityHeader, "").Header().Get("Idempotency-Replayed")).To(Equal("true"))
+		Expect(handled).To(Equal(1))
+	})
+
+	It("Should handle a retry of a failed request again", func() {
+		status = http.StatusInternalServerError
+		Expect(post("/api/v1/admin/replay", "job-1").Code).To(Equal(http.StatusInternalServerError))
+
+		status = http.StatusOK
+		Expect(post("/api/v1/admin/replay", "job-1").Code).To(Equal(http.StatusOK))
+		Expect(handled).To(Equal(2))
+	})
+
+	It("Should handle a key again once it expires", func() {
+		idempotent, err := endpoints.IdempotencyMiddleware(config.IdempotencyCfg{Store: "memory", TTL: 0})
+		Expect(err).ToNot(HaveOccurred())
+		handler = idempotent(counting)
+
+		post("/api/v1/admin/replay", "job-1")
+		post("/api/v1/admin/replay", "job-1")
+		Expect(handled).To(Equal(2))
+	})
+
+	It("Should return 409 for a repeat while the first request is handled", func() {
+		entered := make(chan struct{})
+		release := make(chan struct{})
+		idempotent, err := endpoints.IdempotencyMiddleware(config.IdempotencyCfg{Store: "memory", TTL: 60})
+		Expect(err).ToNot(HaveOccurred())
+		handler = idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entered <- struct{}{}
+			<-release
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			Expect(post("/api/v1/admin/replay", "job-1").Code).To(Equal(http.StatusOK))
+			close(done)
+		}()
+		<-entered
+
+		rr := post("/api/v1/admin/replay", "job-1")
+		Expect(rr.Code).To(Equal(http.StatusConflict))
+		Expect(rr.Header().Get("Retry-After")).ToNot(BeEmpty())
+
+		close(release)
+		<-done
+	})
+
+	It("Should reject keys that are too long", func() {
+		rr := post("/api/v1/admin/replay", strings.Repeat("k", 256))
+		Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		Expect(handled).To(Equal(0))
+	})
+
+	It("Should refuse an unknown store", func() {
+		_, err := endpoints.IdempotencyMiddleware(config.IdempotencyCfg{Store: "redis", TTL: 60})
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("With the db store", func() {
+		var stored map[string]models.IdempotencyKeys
+
+		BeforeEach(func() {
+			stored = make(map[string]models.IdempotencyKeys)
+			endpoints.RetrieveIdempotentResponse = func(_ *gorm.DB, key string) (models.IdempotencyKeys, bool) {
+				response, ok := stored[key]
+				return response, ok && time.Now().Before(response.ExpiresAt)
+			}
+			endpoints.StoreIdempotentResponse = func(_ *gorm.DB, response models.IdempotencyKeys) error {
+				stored[response.Key] = response
+				return nil
+			}
+
+			idempotent, err := endpoints.IdempotencyMiddleware(config.IdempotencyCfg{Store: "db", TTL: 60})
+			Expect(err).ToNot(HaveOccurred())
+			handler = idempotent(counting)
+		})
+
+		It("Should store the response and replay it", func() {
+			post("/api/v1/admin/replay", "job-1")
+			Expect(stored).To(HaveLen(1))
+			for key, response := range stored {
+				Expect(key).To(HavePrefix("POST /api/v1/admin/replay "))
+				Expect(key).To(HaveSuffix(" job-1"))
+				Expect(response.StatusCode).To(Equal(http.StatusOK))
+			}
+
+			rr := post("/api/v1/admin/replay", "job-1")
+			Expect(rr.Header().Get("Idempotency-Replayed")).To(Equal("true"))
+			Expect(rr.Body.String()).To(Equal(`{"handled": true}`))
+			Expect(handled).To(Equal(1))
+		})
+	})
+})
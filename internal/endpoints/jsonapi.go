@@ -0,0 +1,47 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+)
+
+const jsonAPIMediaType = "application/vnd.api+json"
+
+// wantsJSONAPI is true when the Accept header asks for JSON:API, plain JSON stays the default for everything else
+func wantsJSONAPI(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && mediaType == jsonAPIMediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// toJSONAPIResources turns each row into a resource object identified by its request_id,
+// the rest of its fields become the attributes so the enrichments come along unchanged. The
+// numeric DB id is dropped, JSON:API doesn't allow an id member among the attributes.
+func toJSONAPIResources(resourceType string, rows interface{}) ([]structs.JSONAPIResource, error) {
+	raw, err := json.Marshal(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var attributes []map[string]interface{}
+	if err := json.Unmarshal(raw, &attributes); err != nil {
+		return nil, err
+	}
+
+	resources := make([]structs.JSONAPIResource, 0, len(attributes))
+	for _, attrs := range attributes {
+		id, _ := attrs["request_id"].(string)
+		delete(attrs, "request_id")
+		delete(attrs, "id")
+		resources = append(resources, structs.JSONAPIResource{Type: resourceType, ID: id, Attributes: attrs})
+	}
+	return resources, nil
+}
@@ -1,12 +1,19 @@
 package endpoints
 
 import (
+	"bufio"
+	"errors"
+	"net"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	p "github.com/prometheus/client_golang/prometheus"
 	pa "github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
 )
 
 var (
@@ -30,6 +37,11 @@ var (
 		Help: "Number of seconds spent waiting on a db response",
 	}, []string{})
 
+	requestElapsed = pa.NewHistogramVec(p.HistogramOpts{
+		Name: "payload_tracker_http_request_seconds",
+		Help: "Number of seconds spent handling a request from start to end of the response by route pattern and method",
+	}, []string{"route", "method"})
+
 	messagesProcessed = pa.NewCounterVec(p.CounterOpts{
 		Name: "payload_tracker_messages_processed",
 		Help: "Count of total messages processed",
@@ -40,11 +52,37 @@ var (
 		Help: "Number of seconds spent processing messages",
 	}, []string{})
 
+	messageProcessingElapsed = pa.NewHistogramVec(p.HistogramOpts{
+		Name: "payload_tracker_message_processing_seconds",
+		Help: "Number of seconds spent handling each message from parsing to the insert by outcome (success, validation-error, db-error)",
+	}, []string{"outcome"})
+
 	messageProcessError = pa.NewCounterVec(p.CounterOpts{
 		Name: "payload_tracker_message_process_errors",
 		Help: "Count of message process errors",
 	}, []string{})
 
+	ingestLatency = pa.NewHistogramVec(p.HistogramOpts{
+		Name:    "payload_tracker_ingest_latency_seconds",
+		Help:    "Number of seconds between a status event being emitted and it being persisted",
+		Buckets: []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600},
+	}, []string{})
+
+	tableRows = pa.NewGaugeVec(p.GaugeOpts{
+		Name: "payload_tracker_table_rows",
+		Help: "Estimated number of rows in each table as of the last time the table stats were loaded",
+	}, []string{"table"})
+
+	tableBytes = pa.NewGaugeVec(p.GaugeOpts{
+		Name: "payload_tracker_table_bytes",
+		Help: "Total size in bytes of each table including its indexes as of the last time the table stats were loaded",
+	}, []string{"table"})
+
+	oldestUnprocessed = pa.NewGaugeVec(p.GaugeOpts{
+		Name: "payload_tracker_oldest_unprocessed_seconds",
+		Help: "Age in seconds of the oldest message on the assigned partitions that hasn't been processed, 0 once the consumer is caught up",
+	}, []string{})
+
 	responseCodes = pa.NewCounterVec(p.CounterOpts{
 		Name: "payload_tracker_responses",
 		Help: "Count of response codes by code",
@@ -59,6 +97,56 @@ var (
 		Name: "payload_tracker_consume_errors",
 		Help: "Number of consumer errors encountered",
 	}, []string{})
+
+	cacheLookups = pa.NewCounterVec(p.CounterOpts{
+		Name: "payload_tracker_cache_lookups",
+		Help: "Number of cache lookups by cache and outcome (hit, miss, expired)",
+	}, []string{"cache", "outcome"})
+
+	deadLetteredMessages = pa.NewCounterVec(p.CounterOpts{
+		Name: "payload_tracker_dead_lettered_messages",
+		Help: "Number of messages forwarded to the dead letter topic by reason",
+	}, []string{"reason"})
+
+	enrichedEvents = pa.NewCounterVec(p.CounterOpts{
+		Name: "payload_tracker_enriched_events",
+		Help: "Number of enriched status events re-emitted by outcome (produced, failed, undelivered)",
+	}, []string{"outcome"})
+
+	skippedTombstones = pa.NewCounterVec(p.CounterOpts{
+		Name: "payload_tracker_skipped_tombstones",
+		Help: "Number of null value tombstone messages skipped by the consumer",
+	}, []string{})
+
+	unknownServices = pa.NewCounterVec(p.CounterOpts{
+		Name: "payload_tracker_unknown_services",
+		Help: "Number of messages naming a service missing from the services table by service, past the first few services they are counted as other",
+	}, []string{"service"})
+
+	normalizedServiceAliases = pa.NewCounterVec(p.CounterOpts{
+		Name: "payload_tracker_normalized_service_aliases",
+		Help: "Number of statuses sent under a configured service alias and recorded for its service by alias and service",
+	}, []string{"alias", "service"})
+
+	payloadWrites = pa.NewCounterVec(p.CounterOpts{
+		Name: "payload_tracker_payload_writes",
+		Help: "Number of consumed messages by the write to the payloads table they resulted in (insert, update, noop-duplicate)",
+	}, []string{"operation"})
+
+	archivePrefetches = pa.NewCounterVec(p.CounterOpts{
+		Name: "payload_tracker_archive_prefetches",
+		Help: "Number of archive links prefetched by the consumer by outcome (cached, not_found, failed, dropped)",
+	}, []string{"outcome"})
+
+	orgThrottledRequests = pa.NewCounterVec(p.CounterOpts{
+		Name: "payload_tracker_org_throttled_requests",
+		Help: "Number of requests rejected by the per org rate limit by the limit the org is under (default, overridden)",
+	}, []string{"limit"})
+
+	idempotentRequests = pa.NewCounterVec(p.CounterOpts{
+		Name: "payload_tracker_idempotent_requests",
+		Help: "Number of admin writes sent with an Idempotency-Key by outcome (stored, replayed, mismatch, in_progress)",
+	}, []string{"outcome"})
 )
 
 type metricTrackingResponseWriter struct {
@@ -90,6 +178,48 @@ func IncMessageProcessErrors() {
 	messageProcessError.With(p.Labels{}).Inc()
 }
 
+// IncSkippedTombstones increments the skipped tombstone count by 1
+func IncSkippedTombstones() {
+	skippedTombstones.With(p.Labels{}).Inc()
+}
+
+// IncDeadLetteredMessages increments the dead lettered message count for the given reason by 1
+func IncDeadLetteredMessages(reason string) {
+	deadLetteredMessages.With(p.Labels{"reason": reason}).Inc()
+}
+
+// IncEnrichedEvents increments the enriched event count for the given outcome by 1
+func IncEnrichedEvents(outcome string) {
+	enrichedEvents.With(p.Labels{"outcome": outcome}).Inc()
+}
+
+// IncNormalizedServiceAliases increments the count of statuses normalized from the alias to the service by 1
+func IncNormalizedServiceAliases(alias string, service string) {
+	normalizedServiceAliases.With(p.Labels{"alias": alias, "service": service}).Inc()
+}
+
+// IncPayloadWrites increments the payload write count for the given operation by 1
+func IncPayloadWrites(operation string) {
+	payloadWrites.With(p.Labels{"operation": operation}).Inc()
+}
+
+// IncArchivePrefetches increments the archive prefetch count for the given outcome by 1
+func IncArchivePrefetches(outcome string) {
+	archivePrefetches.With(p.Labels{"outcome": outcome}).Inc()
+}
+
+// SetOldestUnprocessed sets the age of the oldest message the consumer hasn't processed
+func SetOldestUnprocessed(age time.Duration) {
+	oldestUnprocessed.With(p.Labels{}).Set(age.Seconds())
+}
+
+func setTableStats(stats []structs.TableStats) {
+	for _, table := range stats {
+		tableRows.With(p.Labels{"table": table.Table}).Set(float64(table.Rows))
+		tableBytes.With(p.Labels{"table": table.Table}).Set(float64(table.TotalBytes))
+	}
+}
+
 func IncInvalidConsumerRequestIDs() {
 	consumerInvalidRequestIDs.With(p.Labels{}).Inc()
 }
@@ -98,14 +228,67 @@ func IncInvalidAPIRequestIDs() {
 	apiInvalidRequestIDs.With(p.Labels{}).Inc()
 }
 
+// maxUnknownServiceLabels caps the unknown service names given their own label
+const maxUnknownServiceLabels = 50
+
+var (
+	unknownServiceLabels   = map[string]bool{}
+	unknownServiceLabelsMu sync.Mutex
+)
+
+// IncUnknownServices increments the unknown service count for the service by 1
+func IncUnknownServices(service string) {
+	unknownServiceLabelsMu.Lock()
+	if !unknownServiceLabels[service] {
+		if len(unknownServiceLabels) < maxUnknownServiceLabels {
+			unknownServiceLabels[service] = true
+		} else {
+			service = "other"
+		}
+	}
+	unknownServiceLabelsMu.Unlock()
+
+	unknownServices.With(p.Labels{"service": service}).Inc()
+}
+
+func incOrgThrottledRequests(limit string) {
+	orgThrottledRequests.With(p.Labels{"limit": limit}).Inc()
+}
+
+func incIdempotentRequests(outcome string) {
+	idempotentRequests.With(p.Labels{"outcome": outcome}).Inc()
+}
+
+func incCacheLookups(cache string, outcome string) {
+	cacheLookups.With(p.Labels{"cache": cache, "outcome": outcome}).Inc()
+}
+
 func observeDBTime(elapsed time.Duration) {
 	dbElapsed.With(p.Labels{}).Observe(elapsed.Seconds())
 }
 
+// observeRequestTime labels by the route pattern rather than the path so that request ids don't each get a series
+func observeRequestTime(route string, method string, elapsed time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	requestElapsed.With(p.Labels{"route": route, "method": method}).Observe(elapsed.Seconds())
+}
+
 func ObserveMessageProcessTime(elapsed time.Duration) {
 	messageProcessElapsed.With(p.Labels{}).Observe(elapsed.Seconds())
 }
 
+// ObserveMessageProcessingTime records how long handling a message took for the given outcome
+func ObserveMessageProcessingTime(outcome string, elapsed time.Duration) {
+	messageProcessingElapsed.With(p.Labels{"outcome": outcome}).Observe(elapsed.Seconds())
+}
+
+// ObserveIngestLatency records the time from a status event being emitted to it being persisted
+func ObserveIngestLatency(latency time.Duration) {
+	ingestLatency.With(p.Labels{}).Observe(latency.Seconds())
+}
+
 func (m *metricTrackingResponseWriter) Header() http.Header {
 	return m.Wrapped.Header()
 }
@@ -119,6 +302,22 @@ func (m *metricTrackingResponseWriter) Write(b []byte) (int, error) {
 	return m.Wrapped.Write(b)
 }
 
+// Flush passes through to the wrapped writer so streamed responses keep working
+func (m *metricTrackingResponseWriter) Flush() {
+	if flusher, ok := m.Wrapped.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack passes through to the wrapped writer so connections can be upgraded to websockets
+func (m *metricTrackingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := m.Wrapped.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
 // ResponseMetricsMiddleware wraps the ResponseWriter such that metrics for each
 // response type get tracked
 func ResponseMetricsMiddleware(next http.Handler) http.Handler {
@@ -129,3 +328,19 @@ func ResponseMetricsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(ww, r)
 	})
 }
+
+// RequestDurationMiddleware observes the total time spent on each request, which includes the db time
+// along with everything else such as serializing and compressing the response
+func RequestDurationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+
+		// the pattern is only complete once the request has been routed through every sub router
+		var route string
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			route = rctx.RoutePattern()
+		}
+		observeRequestTime(route, r.Method, time.Since(start))
+	})
+}
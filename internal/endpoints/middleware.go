@@ -0,0 +1,109 @@
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+)
+
+// correlationIDHeader is set by the gateway in front of the api to trace a request across services
+const correlationIDHeader = "x-rh-insights-request-id"
+
+// RecoverMiddleware turns a panic in a handler into a 500 JSON error and logs it with its stack and
+// the request's correlation id. It only covers the handlers it wraps, so panics in goroutines such as the
+// consumer event loop still crash the process. http.ErrAbortHandler is re-panicked for net/http to handle.
+func RecoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			l.Log.WithFields(logrus.Fields{
+				"correlation_id": r.Header.Get(correlationIDHeader),
+				"client_ip":      ClientIP(r),
+				"method":         r.Method,
+				"path":           r.URL.Path,
+				"panic":          rec,
+				"stack":          string(debug.Stack()),
+			}).Error("Recovered from a panic in a request handler")
+
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ConcurrencyLimitMiddleware caps the number of requests being handled at once, responding
+// with a 503 once the limit is reached. A limit of 0 disables the cap.
+func ConcurrencyLimitMiddleware(limit int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+
+		semaphore := make(chan struct{}, limit)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+				next.ServeHTTP(w, r)
+			default:
+				w.Header().Set("Retry-After", "1")
+				writeResponse(w, http.StatusServiceUnavailable, getErrorBody("Too many concurrent requests, please retry", http.StatusServiceUnavailable))
+			}
+		})
+	}
+}
+
+// PrettyJSONMiddleware indents JSON response bodies, error bodies included, when the request
+// has pretty=true. Other content types are written unchanged.
+func PrettyJSONMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); !pretty {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		pw := &prettyJSONWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(pw, r)
+
+		body := pw.body.Bytes()
+		if contentType := w.Header().Get("Content-Type"); strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, jsonAPIMediaType) {
+			var indented bytes.Buffer
+			if err := json.Indent(&indented, body, "", "  "); err == nil {
+				body = indented.Bytes()
+			}
+		}
+		w.WriteHeader(pw.status)
+		w.Write(body)
+	})
+}
+
+// prettyJSONWriter holds the response back until the handler is done so it can be indented in one go
+type prettyJSONWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (pw *prettyJSONWriter) WriteHeader(status int) {
+	pw.status = status
+}
+
+func (pw *prettyJSONWriter) Write(b []byte) (int, error) {
+	return pw.body.Write(b)
+}
@@ -0,0 +1,208 @@
+package endpoints_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
+	"github.com/redhatinsights/payload-tracker-go/internal/utils/test"
+)
+
+var _ = Describe("ConcurrencyLimitMiddleware", func() {
+	var (
+		query map[string]interface{}
+	)
+
+	BeforeEach(func() {
+		query = make(map[string]interface{})
+	})
+
+	It("Should return 503 once the limit is reached", func() {
+		entered := make(chan struct{})
+		release := make(chan struct{})
+
+		blocking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entered <- struct{}{}
+			<-release
+			w.WriteHeader(http.StatusOK)
+		})
+		handler := endpoints.ConcurrencyLimitMiddleware(1)(blocking)
+
+		first := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			req, err := test.MakeTestRequest("/api/v1/payloads", query)
+			Expect(err).To(BeNil())
+			handler.ServeHTTP(first, req)
+			close(done)
+		}()
+		<-entered
+
+		rr := httptest.NewRecorder()
+		req, err := test.MakeTestRequest("/api/v1/payloads", query)
+		Expect(err).To(BeNil())
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(rr.Header().Get("Retry-After")).ToNot(BeEmpty())
+
+		close(release)
+		<-done
+		Expect(first.Code).To(Equal(http.StatusOK))
+	})
+
+	It("Should not limit when disabled", func() {
+		handler := endpoints.ConcurrencyLimitMiddleware(0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		rr := httptest.NewRecorder()
+		req, err := test.MakeTestRequest("/api/v1/payloads", query)
+		Expect(err).To(BeNil())
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusOK))
+	})
+})
+
+var _ = Describe("PrettyJSONMiddleware", func() {
+	var (
+		query   map[string]interface{}
+		handler http.Handler
+		rr      *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		query = make(map[string]interface{})
+		rr = httptest.NewRecorder()
+		handler = endpoints.PrettyJSONMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"title":"Bad Request","status":400}`))
+		}))
+	})
+
+	It("Should leave the body compact by default", func() {
+		req, err := test.MakeTestRequest("/api/v1/payloads", query)
+		Expect(err).To(BeNil())
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		Expect(rr.Body.String()).To(Equal(`{"title":"Bad Request","status":400}`))
+	})
+
+	It("Should indent the body and keep the status with pretty=true", func() {
+		query["pretty"] = "true"
+		req, err := test.MakeTestRequest("/api/v1/payloads", query)
+		Expect(err).To(BeNil())
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusBadRequest))
+		Expect(rr.Body.String()).To(ContainSubstring("\n  \"title\": \"Bad Request\""))
+		Expect(json.Valid(rr.Body.Bytes())).To(BeTrue())
+	})
+
+	It("Should not touch other content types", func() {
+		handler = endpoints.PrettyJSONMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Write([]byte("id,request_id\n"))
+		}))
+		query["pretty"] = "true"
+		req, err := test.MakeTestRequest("/api/v1/payloads", query)
+		Expect(err).To(BeNil())
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusOK))
+		Expect(strings.Count(rr.Body.String(), "\n")).To(Equal(1))
+	})
+})
+
+var _ = Describe("RecoverMiddleware", func() {
+	It("Should return a 500 JSON error when the handler panics", func() {
+		panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("nil map")
+		})
+		handler := endpoints.RecoverMiddleware(panicking)
+
+		rr := httptest.NewRecorder()
+		req, err := test.MakeTestRequest("/api/v1/payloads", map[string]interface{}{})
+		Expect(err).To(BeNil())
+		req.Header.Set("x-rh-insights-request-id", "correlation-id")
+
+		Expect(func() { handler.ServeHTTP(rr, req) }).ToNot(Panic())
+		Expect(rr.Code).To(Equal(http.StatusInternalServerError))
+		Expect(rr.Header().Get("Content-Type")).To(HavePrefix("application/json"))
+
+		var errBody map[string]interface{}
+		Expect(json.Unmarshal(rr.Body.Bytes(), &errBody)).To(Succeed())
+		Expect(errBody["status"]).To(BeEquivalentTo(http.StatusInternalServerError))
+		Expect(errBody["message"]).To(Equal("Internal Server Issue"))
+	})
+
+	It("Should leave requests that don't panic alone", func() {
+		ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+
+		rr := httptest.NewRecorder()
+		req, err := test.MakeTestRequest("/api/v1/payloads", map[string]interface{}{})
+		Expect(err).To(BeNil())
+		endpoints.RecoverMiddleware(ok).ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusOK))
+	})
+
+	It("Should let net/http handle an aborted handler", func() {
+		aborting := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		})
+
+		rr := httptest.NewRecorder()
+		req, err := test.MakeTestRequest("/api/v1/payloads", map[string]interface{}{})
+		Expect(err).To(BeNil())
+		Expect(func() { endpoints.RecoverMiddleware(aborting).ServeHTTP(rr, req) }).To(PanicWith(http.ErrAbortHandler))
+	})
+})
+
+var _ = Describe("RequestDurationMiddleware", func() {
+	requestCount := func(route string, method string) uint64 {
+		families, err := prometheus.DefaultGatherer.Gather()
+		Expect(err).To(BeNil())
+		for _, family := range families {
+			if family.GetName() != "payload_tracker_http_request_seconds" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				labels := map[string]string{}
+				for _, label := range metric.GetLabel() {
+					labels[label.GetName()] = label.GetValue()
+				}
+				if labels["route"] == route && labels["method"] == method {
+					return metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+		return 0
+	}
+
+	It("Should observe requests by their route pattern", func() {
+		sub := chi.NewRouter()
+		sub.Get("/payloads/{request_id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+		r := chi.NewRouter()
+		r.Use(endpoints.RequestDurationMiddleware)
+		r.Mount("/api/v1/", sub)
+
+		before := requestCount("/api/v1/payloads/{request_id}", http.MethodGet)
+
+		rr := httptest.NewRecorder()
+		req, err := test.MakeTestRequest("/api/v1/payloads/e4b3d38f199f4abdb1cfbcf6e3b81f56", map[string]interface{}{})
+		Expect(err).To(BeNil())
+		r.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		Expect(requestCount("/api/v1/payloads/{request_id}", http.MethodGet)).To(Equal(before + 1))
+	})
+})
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,129 +19,458 @@ import (
 
 var (
 	RetrievePayloads          = queries.RetrievePayloads
+	RetrievePayload           = queries.RetrievePayload
 	RetrieveRequestIdPayloads = queries.RetrieveRequestIdPayloads
+	PayloadHasStatus          = queries.PayloadHasStatus
+	RetrieveArchiveLink       = queries.RetrieveArchiveLink
 	Db                        = getDb
+	ReadDb                    = getReadDb
 )
 
 func CreatePayloadArchiveLinkHandler(cfg config.TrackerConfig) http.HandlerFunc {
 	switch cfg.RequestConfig.RequestorImpl {
 	case "storage-broker":
-		return PayloadArchiveLink(RequestArchiveLink(cfg.StorageBrokerURL, cfg.StorageBrokerRequestTimeout))
+		return PayloadArchiveLink(cfg, RequestArchiveLink(cfg.StorageBrokerURL, cfg.StorageBrokerRequestTimeout, cfg.StorageBrokerRequestParam))
 	case "mock":
-		return MockArchiveLink
+		return MockArchiveLink(cfg)
 	default:
 		l.Log.Errorf("Requestor implementation %s not supported", cfg.RequestConfig.RequestorImpl)
 		return nil
 	}
 }
 
-// Payloads returns responses for the /payloads endpoint
-func Payloads(w http.ResponseWriter, r *http.Request) {
+// CreatePayloadsHandler returns a handler for the /payloads endpoint
+func CreatePayloadsHandler(cfg config.TrackerConfig) http.HandlerFunc {
+	policy := newFieldPolicy(cfg.RequestConfig)
+	// the known services and statuses the filters are validated against, cached like /services
+	known := newTTLCache("filters", time.Duration(cfg.RequestConfig.DistinctCacheTTL)*time.Second)
 
-	// init query with defaults and passed params
-	start := time.Now()
+	return func(w http.ResponseWriter, r *http.Request) {
 
-	sortBy := r.URL.Query().Get("sort_by")
-	incRequests()
+		// init query with defaults and passed params
+		start := time.Now()
 
-	q, err := initQuery(r)
+		sortBy := r.URL.Query().Get("sort_by")
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "json"
+		}
+		incRequests()
 
-	if err != nil {
-		writeResponse(w, http.StatusBadRequest, getErrorBody(fmt.Sprintf("%v", err), http.StatusBadRequest))
-		return
-	}
+		q, errs := initQuery(r, cfg.RequestConfig)
 
-	// there is a different default for sortby when searching for payloads
-	if sortBy == "" {
-		q.SortBy = "created_at"
-	}
+		// there is a different default for sortby when searching for payloads
+		if sortBy == "" {
+			q.SortBy = "created_at"
+		}
 
-	if !stringInSlice(q.SortBy, validAllSortBy) {
-		message := "sort_by must be one of " + strings.Join(validAllSortBy, ", ")
-		writeResponse(w, http.StatusBadRequest, getErrorBody(message, http.StatusBadRequest))
-		return
-	}
-	if !stringInSlice(q.SortDir, validSortDir) {
-		message := "sort_dir must be one of " + strings.Join(validSortDir, ", ")
-		writeResponse(w, http.StatusBadRequest, getErrorBody(message, http.StatusBadRequest))
-		return
-	}
+		validAllSortBy := cfg.RequestConfig.PayloadsSortBy
+		if !stringInSlice(q.SortBy, validAllSortBy) {
+			errs.add("sort_by", "sort_by must be one of "+strings.Join(validAllSortBy, ", "))
+		}
+		if !stringInSlice(q.SortDir, validSortDir) {
+			errs.add("sort_dir", "sort_dir must be one of "+strings.Join(validSortDir, ", "))
+		}
 
-	if !validTimestamps(q, false) {
-		message := "invalid timestamp format provided"
-		writeResponse(w, http.StatusBadRequest, getErrorBody(message, http.StatusBadRequest))
-		return
-	}
+		validateTimestamps(&errs, q, false)
 
-	count, payloads := RetrievePayloads(Db(), q.Page, q.PageSize, q)
-	duration := time.Since(start).Seconds()
-	observeDBTime(time.Since(start))
+		if !stringInSlice(format, validFormats) {
+			errs.add("format", "format must be one of "+strings.Join(validFormats, ", "))
+		}
+		delimiter, err := csvDelimiter(r.URL.Query().Get("delimiter"))
+		if err != nil {
+			errs.add("delimiter", err.Error())
+		}
 
-	payloadsData := structs.PayloadsData{count, duration, payloads}
+		// archives are only known to storage-broker, so they are looked up for the page rather than filtered on
+		includeArchive := false
+		if value := r.URL.Query().Get("include_archive"); value != "" {
+			if includeArchive, err = strconv.ParseBool(value); err != nil {
+				errs.add("include_archive", "include_archive must be true or false")
+			}
+		}
+		if includeArchive && format == "csv" {
+			errs.add("include_archive", "include_archive is not supported with format=csv")
+		}
+		if q.LatestOnly && format == "csv" {
+			errs.add("latest_only", "latest_only is not supported with format=csv")
+		}
+		if q.IncludeServices && format == "csv" {
+			errs.add("include_services", "include_services is not supported with format=csv")
+		}
+		if q.TerminalStatuses != nil && format == "csv" {
+			errs.add("include_terminal", "include_terminal is not supported with format=csv")
+		}
+		if q.Human && format == "csv" {
+			errs.add("human", "human is not supported with format=csv")
+		}
 
-	dataJson, err := json.Marshal(payloadsData)
-	if err != nil {
-		l.Log.Error(err)
-		writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
-		return
-	}
+		// embed=statuses nests the statuses of each payload on the page, at the verbosity of /payloads/{request_id}
+		embed, verbosity := r.URL.Query().Get("embed"), r.URL.Query().Get("verbosity")
+		if embed != "" && embed != "statuses" {
+			errs.add("embed", "embed must be statuses")
+		}
+		if verbosity != "" && embed == "" {
+			errs.add("verbosity", "verbosity is only supported with embed")
+		}
+		if embed == "statuses" {
+			if verbosity == "" {
+				verbosity = cfg.RequestConfig.DefaultVerbosity
+			}
+			if !stringInSlice(verbosity, validVerbosity) {
+				errs.add("verbosity", "verbosity must be one of "+strings.Join(validVerbosity, ", "))
+			}
+			if format == "csv" {
+				errs.add("embed", "embed is not supported with format=csv")
+			}
+			// the cap is shared out between the payloads on the page, each of them gets at least one status
+			limit := cfg.RequestConfig.MaxEmbeddedStatuses
+			if q.PageSize < 1 || q.PageSize > limit {
+				errs.add("page_size", fmt.Sprintf("page_size must be between 1 and %d with embed=statuses", limit))
+			}
+			q.EmbedStatuses = &structs.EmbedStatuses{Verbosity: verbosity, Limit: limit}
+		}
 
-	writeResponse(w, http.StatusOK, string(dataJson))
-}
+		// every status filter is a subquery per payload, so stacking them is capped
+		if count, limit := queries.SubqueryFilters(q), cfg.RequestConfig.MaxSubqueryFilters; count > limit {
+			errs.add("filters", fmt.Sprintf("at most %d status filters can be combined, got %d", limit, count))
+		}
 
-// RequestIdPayloads returns a response for /payloads/{request_id}
-func RequestIdPayloads(w http.ResponseWriter, r *http.Request) {
+		// without strict validation an unknown service has no statuses, so it excludes nothing
+		if len(q.ServiceNE) > 0 && cfg.RequestConfig.StrictServiceValidation {
+			knownServices, err := distinctValues(known, "services", RetrieveDistinctServices)
+			if err != nil {
+				l.Log.Error("Error retrieving the services: ", err)
+				writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+				return
+			}
+			for _, service := range q.ServiceNE {
+				if !stringInSlice(service, knownServices) {
+					errs.add("service_ne", "service_ne contains unknown service: "+service)
+				}
+			}
+		}
 
-	reqID := chi.URLParam(r, "request_id")
-	verbosity := r.URL.Query().Get("verbosity")
+		if len(q.ServiceStatus) > 0 {
+			knownServices, err := distinctValues(known, "services", RetrieveDistinctServices)
+			if err != nil {
+				l.Log.Error("Error retrieving the services: ", err)
+				writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+				return
+			}
+			knownStatuses, err := distinctValues(known, "statuses", RetrieveDistinctStatuses)
+			if err != nil {
+				l.Log.Error("Error retrieving the statuses: ", err)
+				writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+				return
+			}
+			for _, pair := range q.ServiceStatus {
+				if !stringInSlice(pair.Service, knownServices) {
+					errs.add("service_status", "service_status contains unknown service: "+pair.Service)
+				}
+				if !stringInSlice(pair.Status, knownStatuses) {
+					errs.add("service_status", "service_status contains unknown status: "+pair.Status)
+				}
+			}
+		}
 
-	q, err := initQuery(r)
+		if writeValidationErrors(w, errs) {
+			return
+		}
+		if !checkDeletedAccess(w, r, q, cfg.AdminRole) {
+			return
+		}
 
-	if err != nil {
-		writeResponse(w, http.StatusBadRequest, getErrorBody(fmt.Sprintf("%v", err), http.StatusBadRequest))
-		return
-	}
+		if includeArchive {
+			statusCode, err := checkArchiveAccess(r, cfg)
+			if err != nil {
+				writeResponse(w, statusCode, getErrorBody(fmt.Sprintf("%v", err), statusCode))
+				return
+			}
+		}
 
-	if !stringInSlice(q.SortBy, validIDSortBy) {
-		message := "sort_by must be one of " + strings.Join(validIDSortBy, ", ")
-		writeResponse(w, http.StatusBadRequest, getErrorBody(message, http.StatusBadRequest))
-		return
-	}
-	if !stringInSlice(q.SortDir, validSortDir) {
-		message := "sort_dir must be one of " + strings.Join(validSortDir, ", ")
-		writeResponse(w, http.StatusBadRequest, getErrorBody(message, http.StatusBadRequest))
-		return
-	}
+		dbQuery, timedOut := requestReadDb(r)
+		count, payloads := RetrievePayloads(dbQuery, q.Page, q.PageSize, q)
+		if writeStatementTimeout(w, timedOut) {
+			return
+		}
+		elapsed := time.Since(start)
+		duration := elapsed.Seconds()
+		observeDBTime(elapsed)
+
+		// the numeric elapsed stays for programmatic clients, the string is added alongside it
+		elapsedHuman := ""
+		if q.Human {
+			elapsedHuman = elapsed.Round(time.Millisecond).String()
+		}
 
-	payloads := RetrieveRequestIdPayloads(Db(), reqID, q.SortBy, q.SortDir, verbosity)
+		// the same count as the body, for clients that read it from the header, a skipped count has none
+		if !q.SkipCount {
+			w.Header().Set("X-Total-Count", strconv.FormatInt(count, 10))
+		}
 
-	if payloads == nil || len(payloads) == 0 {
-		writeResponse(w, http.StatusNotFound, getErrorBody("payload with id: "+reqID+" not found", http.StatusNotFound))
-		return
-	}
+		if format == "csv" {
+			if err := writePayloadsCSV(w, payloads, delimiter, policy, cfg.RequestConfig.MaxResponseBytes); err != nil {
+				l.Log.Error(err)
+			}
+			return
+		}
+
+		var payloadsData interface{} = structs.PayloadsData{Count: count, Elapsed: duration, Data: payloads, ElapsedHuman: elapsedHuman}
+		var data interface{} = payloads
+		if includeArchive {
+			enriched, err := withArchives(r.Context(), payloads, cfg.RequestConfig)
+			if err != nil {
+				l.Log.Error(err)
+				writeResponse(w, http.StatusInternalServerError, getErrorBody(fmt.Sprintf("%v", err), http.StatusInternalServerError))
+				return
+			}
+			data = enriched
+			payloadsData = structs.ArchivePayloadsData{Count: count, Elapsed: duration, Data: enriched, ElapsedHuman: elapsedHuman}
+		}
 
-	durations := queries.CalculateDurations(payloads)
+		if cfg.RequestConfig.ResponseEnvelope {
+			payloadsData = structs.EnvelopedResponse{Meta: structs.ResponseMeta{Count: count, Elapsed: duration, ElapsedHuman: elapsedHuman}, Data: data}
+		}
 
-	payloadsData := structs.PayloadRetrievebyID{Data: payloads, Durations: durations}
+		contentType := "application/json"
+		if wantsJSONAPI(r) {
+			resources, err := toJSONAPIResources("payloads", data)
+			if err != nil {
+				l.Log.Error(err)
+				writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+				return
+			}
+			contentType = jsonAPIMediaType
+			payloadsData = structs.JSONAPIDocument{Meta: structs.ResponseMeta{Count: count, Elapsed: duration, ElapsedHuman: elapsedHuman}, Data: resources}
+		}
 
-	dataJson, err := json.Marshal(payloadsData)
-	if err != nil {
-		l.Log.Error(err)
-		writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
-		return
+		dataJson, err := marshalResponse(policy, payloadsData)
+		if err == nil && cfg.RequestConfig.TotalCountHeaderOnly {
+			dataJson, err = omitCount(dataJson)
+		}
+		if err != nil {
+			l.Log.Error(err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+			return
+		}
+
+		writeLimitedResponse(w, cfg.RequestConfig.MaxResponseBytes, contentType, string(dataJson))
 	}
+}
+
+// CreateRequestIdPayloadsHandler returns a handler for /payloads/{request_id}
+func CreateRequestIdPayloadsHandler(cfg config.TrackerConfig) http.HandlerFunc {
+	policy := newFieldPolicy(cfg.RequestConfig)
+	// the known services exclude_services is validated against, cached like /services
+	known := newTTLCache("filters", time.Duration(cfg.RequestConfig.DistinctCacheTTL)*time.Second)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		reqID := chi.URLParam(r, "request_id")
+		verbosity := r.URL.Query().Get("verbosity")
+		if verbosity == "" {
+			verbosity = cfg.RequestConfig.DefaultVerbosity
+		}
+		durationUnit := r.URL.Query().Get("duration_unit")
+		if durationUnit == "" {
+			durationUnit = "s"
+		}
+
+		q, errs := initQuery(r, cfg.RequestConfig)
+
+		validIDSortBy := cfg.RequestConfig.RequestIDSortBy
+		if !stringInSlice(q.SortBy, validIDSortBy) {
+			errs.add("sort_by", "sort_by must be one of "+strings.Join(validIDSortBy, ", "))
+		}
+		if !stringInSlice(q.SortDir, validSortDir) {
+			errs.add("sort_dir", "sort_dir must be one of "+strings.Join(validSortDir, ", "))
+		}
+		if !stringInSlice(durationUnit, validDurationUnits) {
+			errs.add("duration_unit", "duration_unit must be one of "+strings.Join(validDurationUnits, ", "))
+		}
+
+		// all statuses are returned unless paging is asked for
+		paged := r.URL.Query().Get("page") != "" || r.URL.Query().Get("page_size") != ""
+
+		excludedServices := queryList(r, "exclude_services")
+		if len(excludedServices) > 0 {
+			knownServices, err := distinctValues(known, "services", RetrieveDistinctServices)
+			if err != nil {
+				l.Log.Error("Error retrieving the services: ", err)
+				writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+				return
+			}
+			for _, service := range excludedServices {
+				if !stringInSlice(service, knownServices) {
+					errs.add("exclude_services", "exclude_services contains unknown service: "+service)
+				}
+			}
+		}
+
+		fields := queryList(r, "fields")
+		for _, field := range fields {
+			if !stringInSlice(field, validStatusFields) {
+				errs.add("fields", "fields must be from "+strings.Join(validStatusFields, ", "))
+				break
+			}
+		}
+
+		// the statuses are still read to work out the durations, they are just left out of the response
+		durationsOnly := false
+		if value := r.URL.Query().Get("durations_only"); value != "" {
+			var err error
+			if durationsOnly, err = strconv.ParseBool(value); err != nil {
+				errs.add("durations_only", "durations_only must be true or false")
+			}
+		}
+		if durationsOnly && len(fields) > 0 {
+			errs.add("fields", "fields is not supported with durations_only=true")
+		}
+
+		// the durations still cover the whole history, only the rows in between are left out of the response
+		summary := false
+		if value := r.URL.Query().Get("summary"); value != "" {
+			var err error
+			if summary, err = strconv.ParseBool(value); err != nil {
+				errs.add("summary", "summary must be true or false")
+			}
+		}
+		if summary && paged {
+			errs.add("summary", "summary is not supported with page or page_size")
+		}
+
+		includeSLA := false
+		if value := r.URL.Query().Get("include_sla"); value != "" {
+			var err error
+			if includeSLA, err = strconv.ParseBool(value); err != nil {
+				errs.add("include_sla", "include_sla must be true or false")
+			}
+		}
+		if includeSLA && cfg.RequestConfig.SLASeconds <= 0 {
+			errs.add("include_sla", "include_sla is not supported without a configured SLA")
+		}
+
+		includeStatusCounts := false
+		if value := r.URL.Query().Get("status_counts"); value != "" {
+			var err error
+			if includeStatusCounts, err = strconv.ParseBool(value); err != nil {
+				errs.add("status_counts", "status_counts must be true or false")
+			}
+		}
+
+		// best-effort lookups get an empty 200 for unknown request ids rather than a 404
+		notFoundOK := false
+		if value := r.URL.Query().Get("not_found_ok"); value != "" {
+			var err error
+			if notFoundOK, err = strconv.ParseBool(value); err != nil {
+				errs.add("not_found_ok", "not_found_ok must be true or false")
+			}
+		}
+
+		if writeValidationErrors(w, errs) {
+			return
+		}
+		if !checkDeletedAccess(w, r, q, cfg.AdminRole) {
+			return
+		}
 
-	writeResponse(w, http.StatusOK, string(dataJson))
+		dbQuery, timedOut := requestReadDb(r)
+		payloads := RetrieveRequestIdPayloads(dbQuery, reqID, q.SortBy, q.SortDir, verbosity, q.IncludeDeleted)
+		if writeStatementTimeout(w, timedOut) {
+			return
+		}
+
+		found := len(payloads) > 0
+		if !found && !notFoundOK {
+			writeResponse(w, http.StatusNotFound, getErrorBody("payload with id: "+reqID+" not found", http.StatusNotFound))
+			return
+		}
+		if !found {
+			payloads = []structs.SinglePayloadData{}
+		}
+
+		// durations cover every status, not only the requested page, less any excluded services
+		rawDurations := map[string]time.Duration{}
+		if found {
+			rawDurations = queries.CalculateRawDurations(queries.ExcludeServices(payloads, excludedServices))
+		}
+		var slaBreached *bool
+		if includeSLA && found {
+			// the SLA is on the whole payload, so excluded services still count towards it
+			sla := time.Duration(cfg.RequestConfig.SLASeconds) * time.Second
+			elapsed, remaining, breached := queries.SLADurations(payloads, sla, cfg.RequestConfig.TerminalStatuses, time.Now())
+			rawDurations["sla_elapsed"] = elapsed
+			rawDurations["sla_remaining"] = remaining
+			slaBreached = &breached
+		}
+		durations := queries.FormatDurations(rawDurations, durationUnit)
+		// the counts are over the whole history like the durations, excluded services included
+		var statusCounts map[string]int
+		if includeStatusCounts {
+			statusCounts = queries.StatusCounts(payloads)
+		}
+		var durationsHuman map[string]string
+		if q.Human {
+			durationsHuman = queries.HumanDurations(rawDurations)
+		}
+		if durationsOnly {
+			dataJson, err := json.Marshal(structs.DurationsRetrievebyID{Durations: durations, DurationsHuman: durationsHuman, SLABreached: slaBreached, StatusCounts: statusCounts})
+			if err != nil {
+				l.Log.Error(err)
+				writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+				return
+			}
+			writeLimitedResponse(w, cfg.RequestConfig.MaxResponseBytes, "application/json", string(dataJson))
+			return
+		}
+
+		count := len(payloads)
+		if paged {
+			payloads = queries.PageStatuses(payloads, q.Page, q.PageSize, q.PageBase)
+		}
+		if summary {
+			payloads = queries.SummaryStatuses(payloads)
+		}
+
+		var payloadsData interface{} = structs.PayloadRetrievebyID{Count: count, Data: payloads, Durations: durations, DurationsHuman: durationsHuman, SLABreached: slaBreached, StatusCounts: statusCounts}
+		var data interface{} = payloads
+
+		// projection only trims the response, durations above were computed from every column
+		if len(fields) > 0 {
+			projected, err := projectFields(payloads, fields)
+			if err != nil {
+				l.Log.Error(err)
+				writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+				return
+			}
+			data = projected
+			payloadsData = structs.ProjectedPayloadRetrievebyID{Count: count, Data: projected, Durations: durations, DurationsHuman: durationsHuman, SLABreached: slaBreached, StatusCounts: statusCounts}
+		}
+
+		if cfg.RequestConfig.ResponseEnvelope {
+			payloadsData = structs.EnvelopedResponse{Meta: structs.ResponseMeta{Count: int64(count), Durations: durations, DurationsHuman: durationsHuman, SLABreached: slaBreached, StatusCounts: statusCounts}, Data: data}
+		}
+
+		dataJson, err := marshalResponse(policy, payloadsData)
+		if err != nil {
+			l.Log.Error(err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+			return
+		}
+
+		writeLimitedResponse(w, cfg.RequestConfig.MaxResponseBytes, "application/json", string(dataJson))
+	}
 }
 
 // PayloadArchiveLink returns a response for /payloads/{request_id}/archiveLink
-func PayloadArchiveLink(requestArchiveLink func(context.Context, string) (*structs.PayloadArchiveLink, error)) http.HandlerFunc {
+func PayloadArchiveLink(cfg config.TrackerConfig, requestArchiveLink func(context.Context, string) (*structs.PayloadArchiveLink, error)) http.HandlerFunc {
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		reqID := chi.URLParam(r, "request_id")
 
-		statusCode, err := checkForRole(r, config.Get().StorageBrokerURLRole)
+		statusCode, err := checkArchiveAccess(r, cfg)
 		if err != nil {
 			writeResponse(w, statusCode, getErrorBody(fmt.Sprintf("%v", err), statusCode))
 			return
@@ -152,7 +482,28 @@ func PayloadArchiveLink(requestArchiveLink func(context.Context, string) (*struc
 			return
 		}
 
-		payloadArchiveLink, err := requestArchiveLink(r.Context(), reqID)
+		// payloads that never made it to storage have no archive, so storage-broker isn't asked for one
+		if required := cfg.StorageBrokerRequiredStatus; required != "" {
+			service, status := RequiredArchiveStatus(required)
+
+			dbQuery, timedOut := requestReadDb(r)
+			exists := PayloadExists(dbQuery, reqID)
+			hasStatus := exists && PayloadHasStatus(dbQuery, reqID, service, status)
+			if writeStatementTimeout(w, timedOut) {
+				return
+			}
+
+			if !exists {
+				writeResponse(w, http.StatusNotFound, getErrorBody("payload with id: "+reqID+" not found", http.StatusNotFound))
+				return
+			}
+			if !hasStatus {
+				writeResponse(w, http.StatusConflict, getErrorBody(fmt.Sprintf("payload %s has no %s status, it was not uploaded so there is no archive", reqID, required), http.StatusConflict))
+				return
+			}
+		}
+
+		payloadArchiveLink, err := cachedArchiveLink(r, reqID, cfg.ArchivePrefetchConfig.Enabled, requestArchiveLink)
 		if err != nil {
 			l.Log.Errorf("Error getting archive link from storage-broker for request id: %s, error: %v", reqID, err)
 			writeResponse(w, http.StatusInternalServerError, getErrorBody(fmt.Sprintf("%v", err), http.StatusInternalServerError))
@@ -176,52 +527,125 @@ func PayloadArchiveLink(requestArchiveLink func(context.Context, string) (*struc
 	}
 }
 
-func MockArchiveLink(w http.ResponseWriter, r *http.Request) {
-	reqID := chi.URLParam(r, "request_id")
-	url := fmt.Sprintf("http://%s:%s/app/payload-tracker/api/v1/archive/%s", config.Get().Hostname, config.Get().PublicPort, reqID)
+// cachedArchiveLink serves the link prefetched by the consumer when there is one, falling back to storage-broker
+func cachedArchiveLink(r *http.Request, reqID string, prefetched bool, requestArchiveLink func(context.Context, string) (*structs.PayloadArchiveLink, error)) (*structs.PayloadArchiveLink, error) {
+	if !prefetched {
+		return requestArchiveLink(r.Context(), reqID)
+	}
 
-	response := &structs.PayloadArchiveLink{
-		Url: url,
+	dbQuery, _ := requestReadDb(r)
+	if url := RetrieveArchiveLink(dbQuery, reqID); url != "" {
+		incCacheLookups("archive_link", "hit")
+		return &structs.PayloadArchiveLink{Url: url}, nil
 	}
-	dataJson, _ := json.Marshal(response)
+	incCacheLookups("archive_link", "miss")
+	return requestArchiveLink(r.Context(), reqID)
+}
 
-	writeResponse(w, http.StatusOK, string(dataJson))
+// RequiredArchiveStatus splits the configured service:status, a bare status can come from any service
+func RequiredArchiveStatus(required string) (service string, status string) {
+	if i := strings.Index(required, ":"); i >= 0 {
+		return required[:i], required[i+1:]
+	}
+	return "", required
 }
 
-func PayloadKibanaLink(w http.ResponseWriter, r *http.Request) {
+func MockArchiveLink(cfg config.TrackerConfig) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		reqID := chi.URLParam(r, "request_id")
+		url := fmt.Sprintf("http://%s:%s/app/payload-tracker/api/v1/archive/%s", cfg.Hostname, cfg.PublicPort, reqID)
 
-	reqID := chi.URLParam(r, "request_id")
+		response := &structs.PayloadArchiveLink{
+			Url: url,
+		}
+		dataJson, _ := json.Marshal(response)
 
-	if !isValidUUID(reqID) {
-		IncInvalidAPIRequestIDs()
-		writeResponse(w, http.StatusBadRequest, getErrorBody(fmt.Sprintf("%s is not a valid UUID", reqID), http.StatusBadRequest))
-		return
+		writeResponse(w, http.StatusOK, string(dataJson))
 	}
+}
 
-	service := r.URL.Query().Get("service")
+func CreatePayloadKibanaLinkHandler(cfg config.TrackerConfig) http.HandlerFunc {
 
-	cfg := config.Get()
-	serviceField := cfg.KibanaConfig.ServiceField
-	kibanaUrl := cfg.KibanaConfig.DashboardURL
-	kibanaIndex := cfg.KibanaConfig.Index
+	return func(w http.ResponseWriter, r *http.Request) {
 
-	kibanaQuery := "request_id:" + reqID
-	if service != "" {
-		kibanaQuery += fmt.Sprintf(" AND %s:%s", serviceField, service)
-	}
+		reqID := chi.URLParam(r, "request_id")
+
+		if !isValidUUID(reqID) {
+			IncInvalidAPIRequestIDs()
+			writeResponse(w, http.StatusBadRequest, getErrorBody(fmt.Sprintf("%s is not a valid UUID", reqID), http.StatusBadRequest))
+			return
+		}
+
+		service := r.URL.Query().Get("service")
 
-	kibanaLink := fmt.Sprintf("%s?_g=(filters:!(),refreshInterval:(pause:!t,value:0),time:(from:now-24h,to:now))&_a=(columns:!(_source),filters:!(),index:'%s',interval:auto,query:(language:lucene,query:'%s'),sort:!('@timestamp',desc))", kibanaUrl, kibanaIndex, kibanaQuery)
-	logging.Log.Debugf("Generated kibana link: %s", kibanaLink)
+		serviceField := cfg.KibanaConfig.ServiceField
+		kibanaUrl := cfg.KibanaConfig.DashboardURL
+		kibanaIndex := cfg.KibanaConfig.Index
 
-	payloadKibanaLink := structs.PayloadKibanaLink{
-		Url: kibanaLink,
+		kibanaQuery := "request_id:" + reqID
+		if service != "" {
+			kibanaQuery += fmt.Sprintf(" AND %s:%s", serviceField, service)
+		}
+
+		kibanaLink := fmt.Sprintf("%s?_g=(filters:!(),refreshInterval:(pause:!t,value:0),time:(from:now-24h,to:now))&_a=(columns:!(_source),filters:!(),index:'%s',interval:auto,query:(language:lucene,query:'%s'),sort:!('@timestamp',desc))", kibanaUrl, kibanaIndex, kibanaQuery)
+		logging.Log.Debugf("Generated kibana link: %s", kibanaLink)
+
+		payloadKibanaLink := structs.PayloadKibanaLink{
+			Url: kibanaLink,
+		}
+
+		dataJson, err := json.Marshal(payloadKibanaLink)
+		if err != nil {
+			writeResponse(w, http.StatusInternalServerError, getErrorBody(fmt.Sprintf("%v", err), http.StatusInternalServerError))
+			return
+		}
+
+		writeResponse(w, http.StatusOK, string(dataJson))
 	}
+}
+
+// endpointEnabled reports whether the named endpoint is enabled, logging the ones that are disabled
+func endpointEnabled(name string, on bool) bool {
+	if !on {
+		l.Log.Infof("The %s endpoint is disabled", name)
+	}
+	return on
+}
 
-	dataJson, err := json.Marshal(payloadKibanaLink)
-	if err != nil {
-		writeResponse(w, http.StatusInternalServerError, getErrorBody(fmt.Sprintf("%v", err), http.StatusInternalServerError))
-		return
+// servedIf returns the handler of an enabled endpoint and a 404 for a disabled one. The routes of a disabled
+// endpoint stay registered since chi would otherwise answer 405 where a route of another method matches, like
+// POST /payloads/archiveLinks does GET /payloads/{request_id}
+func servedIf(on bool, handler http.Handler) http.Handler {
+	if !on {
+		return http.NotFoundHandler()
 	}
+	return handler
+}
+
+// RegisterPayloadRoutes registers the payloads, request_id, archiveLink and stats routes, the routes of an endpoint
+// disabled in cfg answer 404
+func RegisterPayloadRoutes(r chi.Router, cfg config.TrackerConfig, orgRateLimit func(http.Handler) http.Handler) {
+	payloads := endpointEnabled("payloads", cfg.EndpointConfig.Payloads)
+	requestID := endpointEnabled("request_id", cfg.EndpointConfig.RequestID)
+	archiveLink := endpointEnabled("archiveLink", cfg.EndpointConfig.ArchiveLink)
+	stats := endpointEnabled("stats", cfg.EndpointConfig.Stats)
+
+	r.With(ResponseMetricsMiddleware, orgRateLimit).Method(http.MethodGet, "/payloads", servedIf(payloads, CreatePayloadsHandler(cfg)))
+	r.With(ResponseMetricsMiddleware).Method(http.MethodGet, "/payloads/{request_id}", servedIf(requestID, CreateRequestIdPayloadsHandler(cfg)))
+	r.With(ResponseMetricsMiddleware).Method(http.MethodGet, "/payloads/{request_id}/archiveLink", servedIf(archiveLink, CreatePayloadArchiveLinkHandler(cfg)))
+	r.With(ResponseMetricsMiddleware).Method(http.MethodPost, "/payloads/archiveLinks", servedIf(archiveLink, PayloadArchiveLinks(cfg, ArchiveLookup)))
+	r.With(ResponseMetricsMiddleware).Method(http.MethodGet, "/stats/durations", servedIf(stats, CreateDurationStatsHandler(cfg)))
+	r.With(ResponseMetricsMiddleware).Method(http.MethodGet, "/stats/services", servedIf(stats, CreateServiceStatsHandler(cfg)))
+}
+
+// RegisterPayloadStreamRoutes registers the payload event stream and the status WebSocket. They stay open for as
+// long as the client listens, so each has its own limit rather than the one of the other api routes, and since they
+// stream payload data they answer 404 along with the payloads endpoint when it is disabled.
+func RegisterPayloadStreamRoutes(r chi.Router, cfg config.TrackerConfig, events *StatusEvents) {
+	heartbeat := time.Duration(cfg.RequestConfig.EventsHeartbeat) * time.Second
+	payloads := cfg.EndpointConfig.Payloads
 
-	writeResponse(w, http.StatusOK, string(dataJson))
+	r.With(ResponseMetricsMiddleware, ConcurrencyLimitMiddleware(cfg.RequestConfig.MaxEventStreams)).Method(http.MethodGet, "/payloads/{request_id}/events", servedIf(payloads, PayloadEvents(events, heartbeat)))
+	r.With(ResponseMetricsMiddleware, ConcurrencyLimitMiddleware(cfg.RequestConfig.MaxStatusSubscribers)).Method(http.MethodGet, "/ws/statuses", servedIf(payloads, StatusesWebSocket(cfg, events, heartbeat)))
 }
@@ -3,10 +3,13 @@ package endpoints_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -94,15 +97,19 @@ func getFourReqIdStatuses(requestId string, verbosity string) []structs.SinglePa
 var (
 	payloadReturnCount int64
 	payloadReturnData  []models.Payloads
+	payloadQuery       structs.Query
 
 	reqIdPayloadData []structs.SinglePayloadData
+	reqIdVerbosity   string
 )
 
-func mockedRetrievePayloads(_ *gorm.DB, _ int, _ int, _ structs.Query) (int64, []models.Payloads) {
+func mockedRetrievePayloads(_ *gorm.DB, _ int, _ int, apiQuery structs.Query) (int64, []models.Payloads) {
+	payloadQuery = apiQuery
 	return payloadReturnCount, payloadReturnData
 }
 
-func mockedRequestIdPayloads(_ *gorm.DB, _ string, _ string, _ string, _ string) []structs.SinglePayloadData {
+func mockedRequestIdPayloads(_ *gorm.DB, _ string, _ string, _ string, verbosity string, _ bool) []structs.SinglePayloadData {
+	reqIdVerbosity = verbosity
 	return reqIdPayloadData
 }
 
@@ -115,7 +122,7 @@ var _ = Describe("Payloads", func() {
 
 	BeforeEach(func() {
 		rr = httptest.NewRecorder()
-		handler = http.HandlerFunc(endpoints.Payloads)
+		handler = perRequest(endpoints.CreatePayloadsHandler)
 
 		endpoints.RetrievePayloads = mockedRetrievePayloads
 		query = make(map[string]interface{})
@@ -140,6 +147,8 @@ var _ = Describe("Payloads", func() {
 				payloadData := models.Payloads{
 					Id:          1,
 					RequestId:   getUUID(),
+					Account:     "1234",
+					OrgId:       "5678",
 					InventoryId: getUUID(),
 					SystemId:    getUUID(),
 					CreatedAt:   time.Now().Round(0),
@@ -159,216 +168,1894 @@ var _ = Describe("Payloads", func() {
 
 				Expect(respData.Data[0].Id).To(Equal(payloadData.Id))
 				Expect(respData.Data[0].RequestId).To(Equal(payloadData.RequestId))
+				Expect(respData.Data[0].Account).To(Equal(payloadData.Account))
+				Expect(respData.Data[0].OrgId).To(Equal(payloadData.OrgId))
 				Expect(respData.Data[0].InventoryId).To(Equal(payloadData.InventoryId))
 				Expect(respData.Data[0].SystemId).To(Equal(payloadData.SystemId))
 				Expect(respData.Data[0].CreatedAt.String()).To(Equal(payloadData.CreatedAt.String()))
 			})
 		})
 
-		Context("With invalid sort_dir parameter", func() {
-			It("should return HTTP 400", func() {
-				query["sort_dir"] = "ascs"
+		Context("With an org_id filter", func() {
+			It("should serialize the account", func() {
+				query["org_id"] = "5678"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+
+				payloadReturnCount = 1
+				payloadReturnData = []models.Payloads{{Id: 1, RequestId: getUUID(), Account: "1234", OrgId: "5678"}}
+
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData struct {
+					Data []map[string]interface{} `json:"data"`
+				}
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				json.Unmarshal(readBody, &respData)
+
+				Expect(respData.Data[0]).To(HaveKeyWithValue("account", "1234"))
+				Expect(respData.Data[0]).To(HaveKeyWithValue("id", "1"))
+			})
+		})
+
+		Context("With csv format", func() {
+			It("should use the requested delimiter", func() {
+				query["format"] = "csv"
+				query["delimiter"] = "%3B"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+
+				createdAt, _ := time.Parse(time.RFC3339, "2024-01-15T10:00:00Z")
+				payloadReturnCount = 1
+				payloadReturnData = []models.Payloads{{Id: 1, RequestId: "abc", Account: "1234", OrgId: "5678", CreatedAt: createdAt}}
+
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(rr.Header().Get("Content-Type")).To(Equal("text/csv"))
+				Expect(rr.Body.String()).To(Equal("id;request_id;account;org_id;inventory_id;system_id;created_at\n1;abc;1234;5678;;;2024-01-15T10:00:00Z\n"))
+			})
+
+			It("should quote the cells a spreadsheet would read as formulas", func() {
+				query["format"] = "csv"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+
+				createdAt, _ := time.Parse(time.RFC3339, "2024-01-15T10:00:00Z")
+				payloadReturnCount = 1
+				payloadReturnData = []models.Payloads{{Id: 1, RequestId: "abc", Account: "=1+1", OrgId: "+5678", InventoryId: "-inv", SystemId: "@SUM(A1)", CreatedAt: createdAt}}
+
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(rr.Body.String()).To(Equal("id,request_id,account,org_id,inventory_id,system_id,created_at\n1,abc,'=1+1,'+5678,'-inv,'@SUM(A1),2024-01-15T10:00:00Z\n"))
+			})
+
+			It("should return HTTP 400 for a response over the max response size", func() {
+				os.Setenv("MAX_RESPONSE_BYTES", "16")
+				defer os.Unsetenv("MAX_RESPONSE_BYTES")
+
+				query["format"] = "csv"
 				req, err := test.MakeTestRequest("/api/v1/payloads", query)
 				Expect(err).To(BeNil())
+
+				payloadReturnCount = 1
+				payloadReturnData = []models.Payloads{{Id: 1, RequestId: "abc"}}
+
 				handler.ServeHTTP(rr, req)
 				Expect(rr.Code).To(Equal(400))
-				Expect(rr.Body).ToNot(BeNil())
+				Expect(rr.Header().Get("Content-Type")).To(Equal("application/json"))
+				Expect(rr.Body.String()).To(ContainSubstring("page_size"))
+			})
+
+			It("should return HTTP 400 for an unsafe delimiter", func() {
+				for _, delimiter := range []string{"%3B%3B", "%22", "a"} {
+					rr = httptest.NewRecorder()
+					query["format"] = "csv"
+					query["delimiter"] = delimiter
+					req, err := test.MakeTestRequest("/api/v1/payloads", query)
+					Expect(err).To(BeNil())
+					handler.ServeHTTP(rr, req)
+					Expect(rr.Code).To(Equal(400))
+				}
 			})
 		})
 
-		Context("With invalid sort_by parameter", func() {
-			It("should return HTTP 400", func() {
-				query["sort_by"] = "request_id"
+		Context("With an account list", func() {
+			AfterEach(func() {
+				os.Unsetenv("MAX_ACCOUNTS")
+			})
+
+			It("should pass every account with the org_id and time filters", func() {
+				query["account"] = "1234, 5678"
+				query["org_id"] = "000001"
+				query["created_at_gt"] = "2024-01-01T00:00:00Z"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.Accounts).To(Equal([]string{"1234", "5678"}))
+				Expect(payloadQuery.OrgID).To(Equal("000001"))
+				Expect(payloadQuery.CreatedAtGT).To(Equal("2024-01-01T00:00:00Z"))
+			})
+
+			It("should return HTTP 400 for empty elements", func() {
+				for _, value := range []string{"1234,", ",1234", "1234,,5678", "1234, ,5678"} {
+					rr = httptest.NewRecorder()
+					query["account"] = value
+					req, err := test.MakeTestRequest("/api/v1/payloads", query)
+					Expect(err).To(BeNil())
+					handler.ServeHTTP(rr, req)
+					Expect(rr.Code).To(Equal(400), value)
+				}
+			})
+
+			It("should return HTTP 400 past the configured number of accounts", func() {
+				os.Setenv("MAX_ACCOUNTS", "2")
+				query["account"] = "1,2,3"
 				req, err := test.MakeTestRequest("/api/v1/payloads", query)
 				Expect(err).To(BeNil())
 				handler.ServeHTTP(rr, req)
 				Expect(rr.Code).To(Equal(400))
-				Expect(rr.Body).ToNot(BeNil())
+				Expect(rr.Body.String()).To(ContainSubstring("account must list at most 2 accounts, got 3"))
 			})
 		})
 
-		validTimestamps := map[string]string{
-			"created_at_lt":  "2021-08-04T17:53:29.724476-04:00",
-			"created_at_lte": "2021-08-04T17:53:29.724476-04:00",
-			"created_at_gt":  "2021-08-04T17:46:22.078999-04:00",
-			"created_at_gte": "2021-08-04T17:46:22.078999-04:00",
-		}
-		Context("With valid timestamps query parameter", func() {
-			It("should return HTTP 200", func() {
-				for k, v := range validTimestamps {
-					query = make(map[string]interface{})
-					query[k] = v
+		Context("With an account range", func() {
+			It("should pass both bounds with the time filters", func() {
+				query["account_gt"] = "1000"
+				query["account_lt"] = "0002000"
+				query["created_at_gt"] = "2024-01-01T00:00:00Z"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.AccountGT).To(Equal("1000"))
+				Expect(payloadQuery.AccountLT).To(Equal("0002000"))
+				Expect(payloadQuery.CreatedAtGT).To(Equal("2024-01-01T00:00:00Z"))
+			})
+
+			It("should return HTTP 400 for bounds that aren't numbers", func() {
+				for _, value := range []string{"abc", "-5", "1.5"} {
+					rr = httptest.NewRecorder()
+					query["account_gt"] = value
 					req, err := test.MakeTestRequest("/api/v1/payloads", query)
 					Expect(err).To(BeNil())
 					handler.ServeHTTP(rr, req)
-					Expect(rr.Code).To(Equal(200))
-					Expect(rr.Body).ToNot(BeNil())
+					Expect(rr.Code).To(Equal(400))
 				}
 			})
 		})
 
-		invalidTimestamps := map[string]string{
-			"created_at_lt":  "invalid",
-			"created_at_lte": "nope",
-			"created_at_gt":  "nah",
-			"created_at_gte": "nice try..but no",
-		}
-		Context("With invalid timestamps query parameter", func() {
-			It("should return HTTP 400", func() {
-				for k, v := range invalidTimestamps {
-					query = make(map[string]interface{})
-					query[k] = v
+		Context("With a status_ne parameter", func() {
+			It("should split comma separated statuses", func() {
+				query["status"] = "success"
+				query["status_ne"] = "error, failed,"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.Status).To(Equal("success"))
+				Expect(payloadQuery.StatusNE).To(Equal([]string{"error", "failed"}))
+			})
+		})
+
+		Context("With a service_ne parameter", func() {
+			AfterEach(func() {
+				os.Unsetenv("STRICT_SERVICE_VALIDATION")
+			})
+
+			It("should split comma separated services", func() {
+				query["service_ne"] = "ingress-bridge, puptoo,"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.ServiceNE).To(Equal([]string{"ingress-bridge", "puptoo"}))
+			})
+
+			It("should return HTTP 400 for unknown services with strict validation", func() {
+				os.Setenv("STRICT_SERVICE_VALIDATION", "true")
+				endpoints.RetrieveDistinctServices = func(_ *gorm.DB) ([]string, error) { return []string{"puptoo"}, nil }
+				query["service_ne"] = "puptoo,bogus"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+				Expect(rr.Body.String()).To(ContainSubstring("bogus"))
+			})
+		})
+
+		Context("With a min_statuses parameter", func() {
+			It("should pass the minimum to the query", func() {
+				query["min_statuses"] = 5
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.MinStatuses).To(Equal(5))
+			})
+
+			It("should return HTTP 400 when it is not a positive integer", func() {
+				for _, minStatuses := range []string{"0", "-1", "many"} {
+					rr = httptest.NewRecorder()
+					query["min_statuses"] = minStatuses
 					req, err := test.MakeTestRequest("/api/v1/payloads", query)
 					Expect(err).To(BeNil())
 					handler.ServeHTTP(rr, req)
 					Expect(rr.Code).To(Equal(400))
-					Expect(rr.Body).ToNot(BeNil())
 				}
 			})
 		})
-	})
 
-})
+		Context("With a has_message parameter", func() {
+			It("should pass the flag to the query", func() {
+				for value, expected := range map[string]bool{"true": true, "false": false} {
+					query["has_message"] = value
+					req, err := test.MakeTestRequest("/api/v1/payloads", query)
+					Expect(err).To(BeNil())
+					handler.ServeHTTP(rr, req)
+					Expect(payloadQuery.HasMessage).ToNot(BeNil())
+					Expect(*payloadQuery.HasMessage).To(Equal(expected))
+				}
+			})
 
-var _ = Describe("RequestIdPayloads", func() {
-	var (
-		handler http.Handler
-		rr      *httptest.ResponseRecorder
+			It("should not filter on status messages without it", func() {
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.HasMessage).To(BeNil())
+			})
 
-		requestId string
-		query     map[string]interface{}
-	)
+			It("should return HTTP 400 for a value other than true or false", func() {
+				query["has_message"] = "sometimes"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+		})
 
-	BeforeEach(func() {
-		rr = httptest.NewRecorder()
-		handler = http.HandlerFunc(endpoints.RequestIdPayloads)
+		Context("With a latest_only parameter", func() {
+			It("should pass the flag to the query and serialize the latest status", func() {
+				date, _ := time.Parse(time.RFC3339, "2022-06-03T14:00:32Z")
+				payloadReturnData = []models.Payloads{{
+					Id:           1,
+					RequestId:    getUUID(),
+					LatestStatus: &models.LatestStatus{Service: "puptoo", Status: "success", Date: date},
+				}}
+				query["latest_only"] = "true"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.LatestOnly).To(BeTrue())
+				Expect(rr.Body.String()).To(ContainSubstring(`"latest_status":{"service":"puptoo","status":"success","date":"2022-06-03T14:00:32Z"}`))
+			})
 
-		endpoints.RetrieveRequestIdPayloads = mockedRequestIdPayloads
-		requestId = getUUID()
-		query = make(map[string]interface{})
-	})
+			It("should return HTTP 400 with csv format", func() {
+				query["latest_only"] = "true"
+				query["format"] = "csv"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+		})
+
+		Context("With an include_services parameter", func() {
+			It("should pass the flag to the query and serialize the services", func() {
+				payloadReturnData = []models.Payloads{{Id: 1, RequestId: getUUID(), FirstService: "ingress", LastService: "puptoo"}}
+				query["include_services"] = "true"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.IncludeServices).To(BeTrue())
+				Expect(rr.Body.String()).To(ContainSubstring(`"first_service":"ingress","last_service":"puptoo"`))
+			})
+
+			It("should leave the services out by default", func() {
+				payloadReturnData = []models.Payloads{{Id: 1, RequestId: getUUID()}}
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.IncludeServices).To(BeFalse())
+				Expect(rr.Body.String()).ToNot(ContainSubstring("first_service"))
+			})
+
+			It("should return HTTP 400 with csv format", func() {
+				query["include_services"] = "true"
+				query["format"] = "csv"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+		})
+
+		Context("With an embed parameter", func() {
+			AfterEach(func() {
+				os.Unsetenv("MAX_EMBEDDED_STATUSES")
+				os.Unsetenv("RESPONSE_FIELDS_EXCLUDE")
+			})
+
+			It("should pass the verbosity and cap to the query and serialize the statuses", func() {
+				date, _ := time.Parse(time.RFC3339, "2022-06-03T14:00:32Z")
+				payloadReturnData = []models.Payloads{{
+					Id:                1,
+					RequestId:         getUUID(),
+					Statuses:          []models.EmbeddedStatus{{Service: "puptoo", Status: "success", Date: date}},
+					StatusesTruncated: true,
+				}}
+				query["embed"] = "statuses"
+				query["verbosity"] = "2"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.EmbedStatuses).To(Equal(&structs.EmbedStatuses{Verbosity: "2", Limit: 1000}))
+				Expect(rr.Body.String()).To(ContainSubstring(`"statuses":[{"service":"puptoo","status":"success","date":"2022-06-03T14:00:32Z"}],"statuses_truncated":true`))
+			})
+
+			It("should use the default verbosity", func() {
+				query["embed"] = "statuses"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.EmbedStatuses.Verbosity).To(Equal("0"))
+			})
+
+			It("should leave the statuses out by default", func() {
+				payloadReturnData = []models.Payloads{{Id: 1, RequestId: getUUID()}}
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.EmbedStatuses).To(BeNil())
+				Expect(rr.Body.String()).ToNot(ContainSubstring("statuses"))
+			})
+
+			It("should drop the status fields left out by the field policy", func() {
+				os.Setenv("RESPONSE_FIELDS_EXCLUDE", "status_msg")
+				date, _ := time.Parse(time.RFC3339, "2022-06-03T14:00:32Z")
+				payloadReturnData = []models.Payloads{{
+					Id:        1,
+					RequestId: getUUID(),
+					Statuses:  []models.EmbeddedStatus{{Service: "puptoo", Status: "error", StatusMsg: "failed", Date: date}},
+				}}
+				query["embed"] = "statuses"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(rr.Body.String()).To(ContainSubstring(`"statuses":[{"date":"2022-06-03T14:00:32Z","service":"puptoo","status":"error"}]`))
+			})
+
+			It("should return HTTP 400 for a page larger than the cap", func() {
+				os.Setenv("MAX_EMBEDDED_STATUSES", "5")
+				query["embed"] = "statuses"
+				query["page_size"] = "10"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+
+			It("should return HTTP 400 for a page_size below 1", func() {
+				query["embed"] = "statuses"
+				query["page_size"] = "0"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+				Expect(rr.Body.String()).To(ContainSubstring("page_size must be between 1 and 1000 with embed=statuses"))
+			})
+
+			It("should return HTTP 400 for an unknown embed", func() {
+				query["embed"] = "services"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+
+			It("should return HTTP 400 for an unknown verbosity", func() {
+				query["embed"] = "statuses"
+				query["verbosity"] = "3"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+
+			It("should return HTTP 400 for a verbosity without embed", func() {
+				query["verbosity"] = "1"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+
+			It("should return HTTP 400 with csv format", func() {
+				query["embed"] = "statuses"
+				query["format"] = "csv"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+		})
+
+		Context("With a business_hours parameter", func() {
+			It("should pass the configured hours and timezone to the query", func() {
+				query["business_hours"] = "true"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.BusinessHours).To(Equal(&structs.BusinessHours{Timezone: "UTC", Start: 9, End: 17}))
+			})
+
+			It("should use the timezone from business_hours_tz", func() {
+				query["business_hours"] = "true"
+				query["business_hours_tz"] = "America/New_York"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.BusinessHours.Timezone).To(Equal("America/New_York"))
+			})
+
+			It("should return HTTP 400 for an unknown timezone", func() {
+				query["business_hours"] = "true"
+				query["business_hours_tz"] = "Mars/Olympus_Mons"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+				Expect(rr.Body.String()).To(ContainSubstring("business_hours_tz"))
+			})
+		})
+
+		Context("With several invalid parameters", func() {
+			It("should list every one of them in a single HTTP 400", func() {
+				query["sort_by"] = "bogus"
+				query["sort_dir"] = "sideways"
+				query["created_at_lt"] = "yesterday"
+				query["page_size"] = "many"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+
+				var respData structs.ErrorResponse
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+
+				Expect(respData.Status).To(Equal(400))
+				fields := []string{}
+				for _, fieldError := range respData.Errors {
+					fields = append(fields, fieldError.Field)
+				}
+				Expect(fields).To(ConsistOf("sort_by", "sort_dir", "created_at_lt", "page_size"))
+			})
+		})
+
+		Context("With an out of range page_size", func() {
+			AfterEach(func() {
+				os.Unsetenv("MAX_PAGE_SIZE")
+			})
+
+			It("should return HTTP 400 for a page_size below 1", func() {
+				for _, pageSize := range []string{"0", "-1"} {
+					rr = httptest.NewRecorder()
+					query["page_size"] = pageSize
+					req, err := test.MakeTestRequest("/api/v1/payloads", query)
+					Expect(err).To(BeNil())
+					handler.ServeHTTP(rr, req)
+					Expect(rr.Code).To(Equal(400))
+					Expect(rr.Body.String()).To(ContainSubstring("page_size must be a positive integer"))
+				}
+			})
+
+			It("should return HTTP 400 for a page_size over the max page size", func() {
+				os.Setenv("MAX_PAGE_SIZE", "50")
+				query["page_size"] = "51"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+				Expect(rr.Body.String()).To(ContainSubstring("page_size must be at most 50"))
+
+				rr = httptest.NewRecorder()
+				query["page_size"] = "50"
+				req, err = test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+			})
+		})
+
+		Context("With a skip_count parameter", func() {
+			It("should pass the flag to the query", func() {
+				query["skip_count"] = "true"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.SkipCount).To(BeTrue())
+			})
+
+			It("should return HTTP 400 for a value other than true or false", func() {
+				query["skip_count"] = "sometimes"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+		})
+
+		Context("With an include_staleness parameter", func() {
+			It("should pass the flag to the query and serialize the staleness", func() {
+				staleness := 90.5
+				payloadReturnData = []models.Payloads{{Id: 1, RequestId: getUUID(), SecondsSinceUpdate: &staleness}}
+				query["include_staleness"] = "true"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.IncludeStaleness).To(BeTrue())
+				Expect(rr.Body.String()).To(ContainSubstring(`"seconds_since_update":90.5`))
+			})
+
+			It("should return HTTP 400 for a value other than true or false", func() {
+				query["include_staleness"] = "very"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+		})
+
+		Context("With a request_id_prefix parameter", func() {
+			It("should pass the prefix to the query", func() {
+				query["request_id_prefix"] = "2024"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.RequestIDPrefix).To(Equal("2024"))
+			})
+
+			It("should return HTTP 400 when the prefix is too short", func() {
+				query["request_id_prefix"] = "202"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+		})
+
+		Context("With a service_status parameter", func() {
+			BeforeEach(func() {
+				endpoints.RetrieveDistinctServices = func(_ *gorm.DB) ([]string, error) { return []string{"puptoo", "advisor"}, nil }
+				endpoints.RetrieveDistinctStatuses = func(_ *gorm.DB) ([]string, error) { return []string{"error", "success"}, nil }
+			})
+
+			It("should cache the known services and statuses", func() {
+				lookups := 0
+				endpoints.RetrieveDistinctServices = func(_ *gorm.DB) ([]string, error) {
+					lookups++
+					return []string{"puptoo", "advisor"}, nil
+				}
+				endpoints.RetrieveDistinctStatuses = func(_ *gorm.DB) ([]string, error) {
+					lookups++
+					return []string{"error", "success"}, nil
+				}
+				cachingHandler := endpoints.CreatePayloadsHandler(*config.Get())
+
+				query["service_status"] = "puptoo:error"
+				for i := 0; i < 3; i++ {
+					rr = httptest.NewRecorder()
+					req, err := test.MakeTestRequest("/api/v1/payloads", query)
+					Expect(err).To(BeNil())
+					cachingHandler.ServeHTTP(rr, req)
+					Expect(rr.Code).To(Equal(200))
+				}
+				Expect(lookups).To(Equal(2))
+			})
+
+			It("should pass the pairs to the query", func() {
+				query["service_status"] = "puptoo:error,advisor:success"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.ServiceStatus).To(Equal([]structs.ServiceStatus{
+					{Service: "puptoo", Status: "error"},
+					{Service: "advisor", Status: "success"},
+				}))
+			})
+
+			It("should return HTTP 400 for malformed pairs", func() {
+				for _, pairs := range []string{"puptoo", "puptoo:", ":error", "puptoo:error:extra", "puptoo:error,advisor"} {
+					rr = httptest.NewRecorder()
+					query["service_status"] = pairs
+					req, err := test.MakeTestRequest("/api/v1/payloads", query)
+					Expect(err).To(BeNil())
+					handler.ServeHTTP(rr, req)
+					Expect(rr.Code).To(Equal(400))
+				}
+			})
+
+			It("should return HTTP 400 for unknown services and statuses", func() {
+				for _, pairs := range []string{"bogus:error", "puptoo:bogus"} {
+					rr = httptest.NewRecorder()
+					query["service_status"] = pairs
+					req, err := test.MakeTestRequest("/api/v1/payloads", query)
+					Expect(err).To(BeNil())
+					handler.ServeHTTP(rr, req)
+					Expect(rr.Code).To(Equal(400))
+				}
+			})
+		})
+
+		Context("With a date parameter", func() {
+			It("should filter on the whole UTC day", func() {
+				query["date"] = "2024-01-15"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.CreatedAtGTE).To(Equal("2024-01-15T00:00:00Z"))
+				Expect(payloadQuery.CreatedAtLT).To(Equal("2024-01-16T00:00:00Z"))
+			})
+
+			It("should return HTTP 400 for a malformed date", func() {
+				query["date"] = "2024-1-15"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+
+			It("should compute the day boundaries in the tz timezone", func() {
+				query["date"] = "2024-03-10"
+				query["tz"] = "America/New_York"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				// the clocks go forward that day, so it is 23 hours long
+				Expect(payloadQuery.CreatedAtGTE).To(Equal("2024-03-10T05:00:00Z"))
+				Expect(payloadQuery.CreatedAtLT).To(Equal("2024-03-11T04:00:00Z"))
+			})
+
+			It("should return HTTP 400 for an unknown timezone", func() {
+				query["date"] = "2024-01-15"
+				query["tz"] = "Mars/Olympus_Mons"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+				Expect(rr.Body.String()).To(ContainSubstring("Mars/Olympus_Mons is not a known timezone"))
+			})
+
+			It("should return HTTP 400 for tz without a date", func() {
+				query["tz"] = "America/New_York"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+
+			It("should return HTTP 400 when combined with created_at bounds", func() {
+				query["date"] = "2024-01-15"
+				query["created_at_gt"] = "2024-01-15T10:00:00Z"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+		})
+
+		Context("With include_terminal=true", func() {
+			BeforeEach(func() {
+				query["include_terminal"] = "true"
+			})
+
+			AfterEach(func() {
+				os.Unsetenv("TERMINAL_STATUSES")
+			})
+
+			It("should mark the rows with the configured terminal statuses", func() {
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.TerminalStatuses).To(Equal([]string{"success", "error"}))
+			})
+
+			It("should use the terminal statuses of the pipeline", func() {
+				os.Setenv("TERMINAL_STATUSES", "announced,failed")
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.TerminalStatuses).To(Equal([]string{"announced", "failed"}))
+			})
+
+			It("should not mark the rows by default", func() {
+				delete(query, "include_terminal")
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.TerminalStatuses).To(BeNil())
+			})
+
+			It("should return HTTP 400 with format=csv", func() {
+				query["format"] = "csv"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+		})
+
+		Context("With include_deleted=true", func() {
+			BeforeEach(func() {
+				query["include_deleted"] = "true"
+			})
+
+			It("should return HTTP 403 without the admin role", func() {
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				req.Header.Set("x-rh-identity", validIdentityHeader)
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(http.StatusForbidden))
+			})
+
+			It("should keep soft deleted payloads for admins", func() {
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				req.Header.Set("x-rh-identity", adminIdentityHeader)
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.IncludeDeleted).To(BeTrue())
+			})
+		})
+
+		Context("With mutually exclusive parameters", func() {
+			It("should return HTTP 400 naming each conflict", func() {
+				conflicts := []map[string]interface{}{
+					{"date": "2024-01-15", "created_at_lte": "2024-01-15T10:00:00Z"},
+					{"created_at_gt": "2024-01-15T10:00:00Z", "created_at_gte": "2024-01-15T10:00:00Z"},
+					{"created_at_lt": "2024-01-15T10:00:00Z", "created_at_lte": "2024-01-15T10:00:00Z"},
+					{"date_gt": "2024-01-15T10:00:00Z", "date_gte": "2024-01-15T10:00:00Z"},
+					{"date_lt": "2024-01-15T10:00:00Z", "date_lte": "2024-01-15T10:00:00Z"},
+				}
+				messages := []string{
+					"date cannot be combined with created_at_lt, created_at_lte, created_at_gt or created_at_gte",
+					"created_at_gt cannot be combined with created_at_gte",
+					"created_at_lt cannot be combined with created_at_lte",
+					"date_gt cannot be combined with date_gte",
+					"date_lt cannot be combined with date_lte",
+				}
+				for i, conflict := range conflicts {
+					rr = httptest.NewRecorder()
+					req, err := test.MakeTestRequest("/api/v1/payloads", conflict)
+					Expect(err).To(BeNil())
+					handler.ServeHTTP(rr, req)
+					Expect(rr.Code).To(Equal(400))
+					Expect(rr.Body.String()).To(ContainSubstring(messages[i]))
+				}
+			})
+
+			It("should allow bounds on both sides", func() {
+				query["created_at_gte"] = "2024-01-15T10:00:00Z"
+				query["created_at_lt"] = "2024-01-16T10:00:00Z"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+			})
+		})
+
+		Context("With the default page base", func() {
+			It("should start from page 0", func() {
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.Page).To(Equal(0))
+				Expect(payloadQuery.PageBase).To(Equal(0))
+			})
+
+			It("should return HTTP 400 for a negative page", func() {
+				query["page"] = -1
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+		})
+
+		Context("With include_archive", func() {
+			var archived string
+
+			BeforeEach(func() {
+				archived = getUUID()
+				payloadReturnData = []models.Payloads{{Id: 1, RequestId: archived}, {Id: 2, RequestId: getUUID()}}
+				endpoints.ArchiveLookup = func(_ context.Context, reqID string) (*structs.PayloadArchiveLink, error) {
+					if reqID == archived {
+						return &structs.PayloadArchiveLink{Url: "http://archive/" + reqID}, nil
+					}
+					return &structs.PayloadArchiveLink{}, nil
+				}
+				query["include_archive"] = "true"
+			})
+
+			It("should say which payloads still have an archive", func() {
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				req.Header.Set("x-rh-identity", validIdentityHeader)
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData structs.ArchivePayloadsData
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+				Expect(respData.Data).To(HaveLen(2))
+				Expect(respData.Data[0].RequestId).To(Equal(archived))
+				Expect(respData.Data[0].HasArchive).To(BeTrue())
+				Expect(respData.Data[1].HasArchive).To(BeFalse())
+			})
+
+			It("should require the archive link role", func() {
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				req.Header.Set("x-rh-identity", invalidIdentityHeader)
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(http.StatusForbidden))
+			})
+
+			It("should return HTTP 500 when the lookup fails", func() {
+				endpoints.ArchiveLookup = func(_ context.Context, _ string) (*structs.PayloadArchiveLink, error) {
+					return nil, errors.New("storage-broker is down")
+				}
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				req.Header.Set("x-rh-identity", validIdentityHeader)
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(500))
+			})
+
+			It("should return HTTP 400 for a value other than true or false", func() {
+				query["include_archive"] = "maybe"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				req.Header.Set("x-rh-identity", validIdentityHeader)
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+		})
+
+		Context("With more status filters than allowed", func() {
+			BeforeEach(func() {
+				os.Setenv("MAX_SUBQUERY_FILTERS", "2")
+			})
+
+			AfterEach(func() {
+				os.Unsetenv("MAX_SUBQUERY_FILTERS")
+			})
+
+			It("should return HTTP 400", func() {
+				query["service"] = "puptoo"
+				query["status_ne"] = "error"
+				query["has_message"] = "true"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+				Expect(rr.Body.String()).To(ContainSubstring("at most 2 status filters can be combined, got 3"))
+			})
+
+			It("should allow filters up to the limit", func() {
+				query["service"] = "puptoo"
+				query["status"] = "success"
+				query["status_ne"] = "error"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+			})
+		})
+
+		Context("With a response over the max response size", func() {
+			BeforeEach(func() {
+				os.Setenv("MAX_RESPONSE_BYTES", "16")
+			})
+
+			AfterEach(func() {
+				os.Unsetenv("MAX_RESPONSE_BYTES")
+			})
+
+			It("should return HTTP 400 instead of the data", func() {
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+				Expect(rr.Body.String()).To(ContainSubstring("page_size"))
+			})
+		})
+
+		Context("With the X-Total-Count header", func() {
+			AfterEach(func() {
+				payloadReturnCount = 0
+				os.Unsetenv("TOTAL_COUNT_HEADER_ONLY")
+				os.Unsetenv("RESPONSE_ENVELOPE")
+			})
+
+			It("should carry the same count as the body", func() {
+				payloadReturnCount = 42
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(rr.Header().Get("X-Total-Count")).To(Equal("42"))
+
+				var respData structs.PayloadsData
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+				Expect(respData.Count).To(Equal(int64(42)))
+			})
+
+			It("should be left out when the count is skipped", func() {
+				query["skip_count"] = "true"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(rr.Header()).ToNot(HaveKey("X-Total-Count"))
+			})
+
+			It("should only be in the header when configured", func() {
+				os.Setenv("TOTAL_COUNT_HEADER_ONLY", "true")
+				payloadReturnCount = 42
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(rr.Header().Get("X-Total-Count")).To(Equal("42"))
+
+				var body map[string]json.RawMessage
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &body)).To(Succeed())
+				Expect(body).ToNot(HaveKey("count"))
+				Expect(body).To(HaveKey("data"))
+				Expect(body).To(HaveKey("elapsed"))
+			})
+
+			It("should leave count out of the envelope meta when configured", func() {
+				os.Setenv("TOTAL_COUNT_HEADER_ONLY", "true")
+				os.Setenv("RESPONSE_ENVELOPE", "true")
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var envelope map[string]json.RawMessage
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &envelope)).To(Succeed())
+				var meta map[string]interface{}
+				Expect(json.Unmarshal(envelope["meta"], &meta)).To(Succeed())
+				Expect(meta).ToNot(HaveKey("count"))
+				Expect(meta).To(HaveKey("elapsed"))
+			})
+		})
+
+		Context("With the response envelope enabled", func() {
+			BeforeEach(func() {
+				os.Setenv("RESPONSE_ENVELOPE", "true")
+			})
+
+			AfterEach(func() {
+				os.Unsetenv("RESPONSE_ENVELOPE")
+			})
+
+			It("should move count and elapsed into meta", func() {
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var envelope map[string]json.RawMessage
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &envelope)).To(Succeed())
+				Expect(envelope).To(HaveLen(2))
+				Expect(envelope).To(HaveKey("data"))
+
+				var meta map[string]interface{}
+				Expect(json.Unmarshal(envelope["meta"], &meta)).To(Succeed())
+				Expect(meta).To(HaveKey("count"))
+				Expect(meta).To(HaveKey("elapsed"))
+			})
+		})
+
+		Context("With a response field policy", func() {
+			AfterEach(func() {
+				os.Unsetenv("RESPONSE_FIELDS_INCLUDE")
+				os.Unsetenv("RESPONSE_FIELDS_EXCLUDE")
+			})
+
+			It("should leave out excluded fields", func() {
+				os.Setenv("RESPONSE_FIELDS_EXCLUDE", "id,account")
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+
+				payloadReturnCount = 1
+				payloadReturnData = []models.Payloads{{Id: 1, RequestId: "abc", Account: "1234", OrgId: "5678"}}
+
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData struct {
+					Count int64                    `json:"count"`
+					Data  []map[string]interface{} `json:"data"`
+				}
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+				Expect(respData.Count).To(Equal(int64(1)))
+				Expect(respData.Data[0]).To(HaveKeyWithValue("request_id", "abc"))
+				Expect(respData.Data[0]).To(HaveKeyWithValue("org_id", "5678"))
+				Expect(respData.Data[0]).ToNot(HaveKey("id"))
+				Expect(respData.Data[0]).ToNot(HaveKey("account"))
+			})
+
+			It("should keep only included fields in JSON:API attributes", func() {
+				os.Setenv("RESPONSE_FIELDS_INCLUDE", "request_id,org_id")
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				req.Header.Set("Accept", "application/vnd.api+json")
+
+				payloadReturnCount = 1
+				payloadReturnData = []models.Payloads{{Id: 1, RequestId: "abc", Account: "1234", OrgId: "5678"}}
+
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var document structs.JSONAPIDocument
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &document)).To(Succeed())
+				Expect(document.Meta.Count).To(Equal(int64(1)))
+				Expect(document.Data[0].ID).To(Equal("abc"))
+				Expect(document.Data[0].Attributes).To(Equal(map[string]interface{}{"org_id": "5678"}))
+			})
+
+			It("should drop excluded csv columns", func() {
+				os.Setenv("RESPONSE_FIELDS_EXCLUDE", "id,account")
+				query["format"] = "csv"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+
+				createdAt, _ := time.Parse(time.RFC3339, "2024-01-15T10:00:00Z")
+				payloadReturnCount = 1
+				payloadReturnData = []models.Payloads{{Id: 1, RequestId: "abc", Account: "1234", OrgId: "5678", CreatedAt: createdAt}}
+
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(rr.Body.String()).To(Equal("request_id,org_id,inventory_id,system_id,created_at\nabc,5678,,,2024-01-15T10:00:00Z\n"))
+			})
+		})
+
+		Context("With human", func() {
+			It("should add the elapsed time as a duration string", func() {
+				query["human"] = "true"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData structs.PayloadsData
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+				elapsed, err := time.ParseDuration(respData.ElapsedHuman)
+				Expect(err).To(BeNil())
+				Expect(elapsed.Seconds()).To(BeNumerically("~", respData.Elapsed, 0.001))
+			})
+
+			It("should leave it out by default", func() {
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(rr.Body.String()).ToNot(ContainSubstring("elapsed_human"))
+			})
+
+			It("should return HTTP 400 with csv format", func() {
+				query["human"] = "true"
+				query["format"] = "csv"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+		})
+
+		Context("With a JSON:API Accept header", func() {
+			It("should return resource objects with meta", func() {
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				req.Header.Set("Accept", "application/vnd.api+json")
+
+				requestID := getUUID()
+				payloadReturnCount = 1
+				payloadReturnData = []models.Payloads{{Id: 1, RequestId: requestID, Account: "1234", OrgId: "5678"}}
+
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(rr.Header().Get("Content-Type")).To(Equal("application/vnd.api+json"))
+
+				var document structs.JSONAPIDocument
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &document)).To(Succeed())
+				Expect(document.Meta.Count).To(Equal(int64(1)))
+				Expect(document.Data).To(HaveLen(1))
+				Expect(document.Data[0].Type).To(Equal("payloads"))
+				Expect(document.Data[0].ID).To(Equal(requestID))
+				Expect(document.Data[0].Attributes).To(HaveKeyWithValue("org_id", "5678"))
+				Expect(document.Data[0].Attributes).ToNot(HaveKey("request_id"))
+				Expect(document.Data[0].Attributes).ToNot(HaveKey("id"))
+			})
+
+			It("should keep plain JSON by default", func() {
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				req.Header.Set("Accept", "application/json")
+
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(rr.Header().Get("Content-Type")).To(Equal("application/json"))
+			})
+		})
+
+		Context("With a page base of 1", func() {
+			BeforeEach(func() {
+				os.Setenv("PAGE_BASE", "1")
+			})
+
+			AfterEach(func() {
+				os.Unsetenv("PAGE_BASE")
+			})
+
+			It("should start from page 1", func() {
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.Page).To(Equal(1))
+				Expect(payloadQuery.PageBase).To(Equal(1))
+			})
+
+			It("should pass the second page through", func() {
+				query["page"] = 2
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.Page).To(Equal(2))
+			})
+
+			It("should return HTTP 400 for page 0", func() {
+				query["page"] = 0
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+		})
+
+		Context("Without a sort_dir parameter", func() {
+			It("should list the newest payloads first", func() {
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.SortBy).To(Equal("created_at"))
+				Expect(payloadQuery.SortDir).To(Equal("desc"))
+			})
+
+			It("should be overridden by an explicit sort_dir", func() {
+				query["sort_dir"] = "asc"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(payloadQuery.SortDir).To(Equal("asc"))
+			})
+		})
+
+		Context("With invalid sort_dir parameter", func() {
+			It("should return HTTP 400", func() {
+				query["sort_dir"] = "ascs"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+				Expect(rr.Body).ToNot(BeNil())
+			})
+		})
+
+		Context("With invalid sort_by parameter", func() {
+			It("should return HTTP 400", func() {
+				query["sort_by"] = "request_id"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+				Expect(rr.Body).ToNot(BeNil())
+			})
+		})
+
+		Context("With a configured set of sort_by columns", func() {
+			BeforeEach(func() {
+				os.Setenv("PAYLOADS_SORT_BY", "created_at,org_id")
+			})
+
+			AfterEach(func() {
+				os.Unsetenv("PAYLOADS_SORT_BY")
+			})
+
+			It("should return HTTP 400 for a column outside the configured set", func() {
+				query["sort_by"] = "account"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+
+				var respData structs.ErrorResponse
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				json.Unmarshal(readBody, &respData)
+				Expect(respData.Message).To(Equal("sort_by must be one of created_at, org_id"))
+			})
+
+			It("should allow a configured column", func() {
+				query["sort_by"] = "org_id"
+				req, err := test.MakeTestRequest("/api/v1/payloads", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+			})
+		})
+
+		validTimestamps := map[string]string{
+			"created_at_lt":  "2021-08-04T17:53:29.724476-04:00",
+			"created_at_lte": "2021-08-04T17:53:29.724476-04:00",
+			"created_at_gt":  "2021-08-04T17:46:22.078999-04:00",
+			"created_at_gte": "2021-08-04T17:46:22.078999-04:00",
+		}
+		Context("With valid timestamps query parameter", func() {
+			It("should return HTTP 200", func() {
+				for k, v := range validTimestamps {
+					query = make(map[string]interface{})
+					query[k] = v
+					req, err := test.MakeTestRequest("/api/v1/payloads", query)
+					Expect(err).To(BeNil())
+					handler.ServeHTTP(rr, req)
+					Expect(rr.Code).To(Equal(200))
+					Expect(rr.Body).ToNot(BeNil())
+				}
+			})
+		})
+
+		invalidTimestamps := map[string]string{
+			"created_at_lt":  "invalid",
+			"created_at_lte": "nope",
+			"created_at_gt":  "nah",
+			"created_at_gte": "nice try..but no",
+		}
+		Context("With invalid timestamps query parameter", func() {
+			It("should return HTTP 400", func() {
+				for k, v := range invalidTimestamps {
+					query = make(map[string]interface{})
+					query[k] = v
+					req, err := test.MakeTestRequest("/api/v1/payloads", query)
+					Expect(err).To(BeNil())
+					handler.ServeHTTP(rr, req)
+					Expect(rr.Code).To(Equal(400))
+					Expect(rr.Body).ToNot(BeNil())
+				}
+			})
+		})
+	})
+
+})
+
+var _ = Describe("RequestIdPayloads", func() {
+	var (
+		handler http.Handler
+		rr      *httptest.ResponseRecorder
+
+		requestId string
+		query     map[string]interface{}
+	)
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		handler = perRequest(endpoints.CreateRequestIdPayloadsHandler)
+
+		endpoints.RetrieveRequestIdPayloads = mockedRequestIdPayloads
+		requestId = getUUID()
+		query = make(map[string]interface{})
+	})
+
+	Describe("Get to /payloads/{request_id}", func() {
+		reqIdStatuses := getFourReqIdStatuses(requestId, "2")
+		Context("with a valid request", func() {
+			It("should return HTTP 200", func() {
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(rr.Body).ToNot(BeNil())
+			})
+		})
+
+		Context("without a verbosity parameter", func() {
+			AfterEach(func() {
+				os.Unsetenv("DEFAULT_VERBOSITY")
+			})
+
+			It("should use the configured default verbosity", func() {
+				reqIdPayloadData = reqIdStatuses
+
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(reqIdVerbosity).To(Equal("0"))
+
+				os.Setenv("DEFAULT_VERBOSITY", "2")
+				rr = httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(reqIdVerbosity).To(Equal("2"))
+			})
+
+			It("should let an explicit verbosity override the default", func() {
+				os.Setenv("DEFAULT_VERBOSITY", "2")
+				reqIdPayloadData = reqIdStatuses
+
+				query["verbosity"] = "1"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(reqIdVerbosity).To(Equal("1"))
+			})
+		})
+
+		Context("with an invalid request id, and db returns empty set", func() {
+			It("should return HTTP 404", func() {
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = make([]structs.SinglePayloadData, 0)
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(404))
+				Expect(rr.Body).ToNot(BeNil())
+
+				var respData structs.ErrorResponse
+
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				json.Unmarshal(readBody, &respData)
+
+				Expect(respData.Status).To(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("with an invalid request id, and db returns nil", func() {
+			It("should return HTTP 404", func() {
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = nil
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(404))
+				Expect(rr.Body).ToNot(BeNil())
+
+				var respData structs.ErrorResponse
+
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				json.Unmarshal(readBody, &respData)
+
+				Expect(respData.Status).To(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("With invalid sort_dir parameter", func() {
+			It("should return HTTP 400", func() {
+				query["sort_dir"] = "des"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+				Expect(rr.Body).ToNot(BeNil())
+			})
+		})
+
+		Context("With invalid sort_by parameter", func() {
+			It("should return HTTP 400", func() {
+				query["sort_by"] = "account"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+				Expect(rr.Body).ToNot(BeNil())
+			})
+		})
+
+		reqIdStatuses = getFourReqIdStatuses(requestId, "2")
+		Context("With valid data from DB", func() {
+			It("should pass the data forward", func() {
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(rr.Body).ToNot(BeNil())
+
+				var respData structs.PayloadRetrievebyID
+
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				json.Unmarshal(readBody, &respData)
+
+				Expect(respData.Data[0].ID).To(Equal(reqIdStatuses[0].ID))
+				Expect(respData.Data[0].Service).To(Equal(reqIdStatuses[0].Service))
+				Expect(respData.Data[0].Account).To(Equal(reqIdStatuses[0].Account))
+				Expect(respData.Data[0].OrgID).To(Equal(reqIdStatuses[0].OrgID))
+				Expect(respData.Data[0].RequestID).To(Equal(reqIdStatuses[0].RequestID))
+				Expect(respData.Data[0].InventoryID).To(Equal(reqIdStatuses[0].InventoryID))
+				Expect(respData.Data[0].SystemID).To(Equal(reqIdStatuses[0].SystemID))
+				Expect(respData.Data[0].CreatedAt.String()).To(Equal(reqIdStatuses[0].CreatedAt.String()))
+				Expect(respData.Data[0].Status).To(Equal(reqIdStatuses[0].Status))
+				Expect(respData.Data[0].StatusMsg).To(Equal(reqIdStatuses[0].StatusMsg))
+				Expect(respData.Data[0].Date.String()).To(Equal(reqIdStatuses[0].Date.String()))
+				Expect(respData.Data[1].Source).To(Equal(reqIdStatuses[1].Source))
+			})
+
+			It("should correctly calculate durations", func() {
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(rr.Body).ToNot(BeNil())
+
+				var respData structs.PayloadRetrievebyID
+
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				json.Unmarshal(readBody, &respData)
+
+				Expect(respData.Durations["puptoo:inventory"]).To(Equal("00:00:05.625000"))
+				Expect(respData.Durations["puptoo:undefined"]).To(Equal("00:00:09.970000"))
+			})
+
+			It("should return durations in milliseconds", func() {
+				query["duration_unit"] = "ms"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData structs.PayloadRetrievebyID
+
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				json.Unmarshal(readBody, &respData)
+
+				Expect(respData.Durations["puptoo:inventory"]).To(Equal("5625.000"))
+				Expect(respData.Durations["puptoo:undefined"]).To(Equal("9970.000"))
+			})
+
+			It("should serialize ids as strings", func() {
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData struct {
+					Data []map[string]interface{} `json:"data"`
+				}
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				json.Unmarshal(readBody, &respData)
+
+				Expect(respData.Data[0]).To(HaveKeyWithValue("id", "1"))
+				Expect(respData.Data[0]["inventory_id"]).To(BeAssignableToTypeOf(""))
+			})
+
+			It("should only return the selected fields", func() {
+				query["fields"] = "service,status"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData struct {
+					Data      []map[string]interface{} `json:"data"`
+					Durations map[string]string        `json:"duration"`
+				}
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				json.Unmarshal(readBody, &respData)
+
+				Expect(respData.Data).To(HaveLen(len(reqIdStatuses)))
+				Expect(respData.Data[0]).To(Equal(map[string]interface{}{"service": "puptoo", "status": "received"}))
+				Expect(respData.Durations["puptoo:inventory"]).To(Equal("00:00:05.625000"))
+			})
+
+			It("should reject unknown fields", func() {
+				query["fields"] = "service,password"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+
+			It("should page the statuses and keep the full durations", func() {
+				query["page"] = 1
+				query["page_size"] = 2
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData structs.PayloadRetrievebyID
+
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				json.Unmarshal(readBody, &respData)
+
+				Expect(respData.Count).To(Equal(len(reqIdStatuses)))
+				Expect(respData.Data).To(HaveLen(2))
+				Expect(respData.Data[0].Date.String()).To(Equal(reqIdStatuses[2].Date.String()))
+				Expect(respData.Durations["puptoo:inventory"]).To(Equal("00:00:05.625000"))
+			})
+
+			It("should return every status without paging params", func() {
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData structs.PayloadRetrievebyID
+
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				json.Unmarshal(readBody, &respData)
+
+				Expect(respData.Count).To(Equal(len(reqIdStatuses)))
+				Expect(respData.Data).To(HaveLen(len(reqIdStatuses)))
+			})
+
+			It("should leave excluded services out of the durations only", func() {
+				endpoints.RetrieveDistinctServices = func(_ *gorm.DB) ([]string, error) { return []string{"puptoo"}, nil }
+				query["exclude_services"] = "puptoo"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData structs.PayloadRetrievebyID
+
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				json.Unmarshal(readBody, &respData)
+
+				Expect(respData.Data).To(HaveLen(len(reqIdStatuses)))
+				Expect(respData.Durations).ToNot(HaveKey("puptoo:inventory"))
+				Expect(respData.Durations["total_time"]).To(Equal("00:00:00.000000"))
+			})
+
+			It("should reject unknown excluded services", func() {
+				endpoints.RetrieveDistinctServices = func(_ *gorm.DB) ([]string, error) { return []string{"puptoo"}, nil }
+				query["exclude_services"] = "puptoo,bogus"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+
+			It("should reject an unknown duration unit", func() {
+				query["duration_unit"] = "ns"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+
+			It("should return only the durations with durations_only", func() {
+				query["durations_only"] = "true"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData map[string]json.RawMessage
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+				Expect(respData).To(HaveLen(1))
+
+				var durations map[string]string
+				Expect(json.Unmarshal(respData["duration"], &durations)).To(Succeed())
+				Expect(durations["puptoo:inventory"]).To(Equal("00:00:05.625000"))
+			})
+
+			It("should add human readable durations with human", func() {
+				query["human"] = "true"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData structs.PayloadRetrievebyID
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+				Expect(respData.Durations["puptoo:inventory"]).To(Equal("00:00:05.625000"))
+				Expect(respData.DurationsHuman["puptoo:inventory"]).To(Equal("5.625s"))
+			})
+
+			It("should still return HTTP 404 for an unknown request_id with durations_only", func() {
+				query["durations_only"] = "true"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = make([]structs.SinglePayloadData, 0)
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(404))
+			})
+
+			It("should reject fields with durations_only", func() {
+				query["durations_only"] = "true"
+				query["fields"] = "service"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+			})
+		})
+
+		Context("with include_sla", func() {
+			AfterEach(func() {
+				os.Unsetenv("SLA_SECONDS")
+			})
+
+			It("should return HTTP 400 without a configured SLA", func() {
+				query["include_sla"] = "true"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+				Expect(rr.Body.String()).To(ContainSubstring("include_sla is not supported without a configured SLA"))
+			})
+
+			It("should add the elapsed and remaining SLA time to the durations", func() {
+				os.Setenv("SLA_SECONDS", "60")
+				query["include_sla"] = "true"
+				query["duration_unit"] = "ms"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData structs.PayloadRetrievebyID
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+				Expect(respData.Durations["sla_elapsed"]).To(Equal("13604.000"))
+				Expect(respData.Durations["sla_remaining"]).To(Equal("46396.000"))
+				Expect(respData.SLABreached).ToNot(BeNil())
+				Expect(*respData.SLABreached).To(BeFalse())
+			})
+
+			It("should flag a payload over its SLA", func() {
+				os.Setenv("SLA_SECONDS", "10")
+				query["include_sla"] = "true"
+				query["durations_only"] = "true"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData structs.DurationsRetrievebyID
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+				Expect(respData.Durations["sla_remaining"]).To(Equal("00:00:00.000000"))
+				Expect(*respData.SLABreached).To(BeTrue())
+			})
 
-	Describe("Get to /payloads/{request_id}", func() {
-		reqIdStatuses := getFourReqIdStatuses(requestId, "2")
-		Context("with a valid request", func() {
-			It("should return HTTP 200", func() {
+			It("should leave the SLA out by default", func() {
+				os.Setenv("SLA_SECONDS", "60")
 				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
 				Expect(err).To(BeNil())
 
 				reqIdPayloadData = reqIdStatuses
 				handler.ServeHTTP(rr, req)
 				Expect(rr.Code).To(Equal(200))
-				Expect(rr.Body).ToNot(BeNil())
+				Expect(rr.Body.String()).ToNot(ContainSubstring("sla_"))
 			})
 		})
 
-		Context("with an invalid request id, and db returns empty set", func() {
-			It("should return HTTP 404", func() {
+		Context("with summary", func() {
+			It("should return the oldest and newest statuses with durations over all of them", func() {
 				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
 				Expect(err).To(BeNil())
-
-				reqIdPayloadData = make([]structs.SinglePayloadData, 0)
+				reqIdPayloadData = reqIdStatuses
 				handler.ServeHTTP(rr, req)
-				Expect(rr.Code).To(Equal(404))
-				Expect(rr.Body).ToNot(BeNil())
-
-				var respData structs.ErrorResponse
-
+				var fullData structs.PayloadRetrievebyID
 				readBody, _ := ioutil.ReadAll(rr.Body)
-				json.Unmarshal(readBody, &respData)
+				Expect(json.Unmarshal(readBody, &fullData)).To(Succeed())
 
-				Expect(respData.Status).To(Equal(http.StatusNotFound))
+				rr = httptest.NewRecorder()
+				query["summary"] = "true"
+				req, err = test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData structs.PayloadRetrievebyID
+				readBody, _ = ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+				Expect(respData.Count).To(Equal(len(reqIdStatuses)))
+				Expect(respData.Data).To(HaveLen(2))
+				Expect(respData.Data[0].Date.Equal(reqIdStatuses[0].Date)).To(BeTrue())
+				Expect(respData.Data[1].Date.Equal(reqIdStatuses[len(reqIdStatuses)-1].Date)).To(BeTrue())
+				Expect(respData.Durations).To(Equal(fullData.Durations))
 			})
-		})
 
-		Context("with an invalid request id, and db returns nil", func() {
-			It("should return HTTP 404", func() {
+			It("should return HTTP 404 for an unknown request id", func() {
+				query["summary"] = "true"
 				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
 				Expect(err).To(BeNil())
 
 				reqIdPayloadData = nil
 				handler.ServeHTTP(rr, req)
 				Expect(rr.Code).To(Equal(404))
-				Expect(rr.Body).ToNot(BeNil())
-
-				var respData structs.ErrorResponse
-
-				readBody, _ := ioutil.ReadAll(rr.Body)
-				json.Unmarshal(readBody, &respData)
-
-				Expect(respData.Status).To(Equal(http.StatusNotFound))
 			})
-		})
 
-		Context("With invalid sort_dir parameter", func() {
-			It("should return HTTP 400", func() {
-				query["sort_dir"] = "des"
+			It("should return HTTP 400 along with paging", func() {
+				query["summary"] = "true"
+				query["page_size"] = "2"
 				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
 				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
 				handler.ServeHTTP(rr, req)
 				Expect(rr.Code).To(Equal(400))
-				Expect(rr.Body).ToNot(BeNil())
+				Expect(rr.Body.String()).To(ContainSubstring("summary is not supported with page or page_size"))
 			})
 		})
 
-		Context("With invalid sort_by parameter", func() {
-			It("should return HTTP 400", func() {
-				query["sort_by"] = "account"
+		Context("with not_found_ok", func() {
+			It("should return HTTP 200 with empty data for an unknown request id", func() {
+				query["not_found_ok"] = "true"
 				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
 				Expect(err).To(BeNil())
+
+				reqIdPayloadData = nil
 				handler.ServeHTTP(rr, req)
-				Expect(rr.Code).To(Equal(400))
-				Expect(rr.Body).ToNot(BeNil())
+				Expect(rr.Code).To(Equal(200))
+
+				var respData map[string]json.RawMessage
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+				Expect(string(respData["count"])).To(Equal("0"))
+				Expect(string(respData["data"])).To(Equal("[]"))
+				Expect(string(respData["duration"])).To(Equal("{}"))
 			})
-		})
 
-		reqIdStatuses = getFourReqIdStatuses(requestId, "2")
-		Context("With valid data from DB", func() {
-			It("should pass the data forward", func() {
+			It("should still return the statuses of a known request id", func() {
+				query["not_found_ok"] = "true"
 				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
-
 				Expect(err).To(BeNil())
 
 				reqIdPayloadData = reqIdStatuses
 				handler.ServeHTTP(rr, req)
 				Expect(rr.Code).To(Equal(200))
-				Expect(rr.Body).ToNot(BeNil())
 
 				var respData structs.PayloadRetrievebyID
-
 				readBody, _ := ioutil.ReadAll(rr.Body)
-				json.Unmarshal(readBody, &respData)
+				Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+				Expect(respData.Count).To(Equal(len(reqIdStatuses)))
+			})
 
-				Expect(respData.Data[0].ID).To(Equal(reqIdStatuses[0].ID))
-				Expect(respData.Data[0].Service).To(Equal(reqIdStatuses[0].Service))
-				Expect(respData.Data[0].Account).To(Equal(reqIdStatuses[0].Account))
-				Expect(respData.Data[0].OrgID).To(Equal(reqIdStatuses[0].OrgID))
-				Expect(respData.Data[0].RequestID).To(Equal(reqIdStatuses[0].RequestID))
-				Expect(respData.Data[0].InventoryID).To(Equal(reqIdStatuses[0].InventoryID))
-				Expect(respData.Data[0].SystemID).To(Equal(reqIdStatuses[0].SystemID))
-				Expect(respData.Data[0].CreatedAt.String()).To(Equal(reqIdStatuses[0].CreatedAt.String()))
-				Expect(respData.Data[0].Status).To(Equal(reqIdStatuses[0].Status))
-				Expect(respData.Data[0].StatusMsg).To(Equal(reqIdStatuses[0].StatusMsg))
-				Expect(respData.Data[0].Date.String()).To(Equal(reqIdStatuses[0].Date.String()))
-				Expect(respData.Data[1].Source).To(Equal(reqIdStatuses[1].Source))
+			It("should return HTTP 404 by default", func() {
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = nil
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(404))
 			})
+		})
 
-			It("should correctly calculate durations", func() {
+		Context("with status_counts", func() {
+			expectedCounts := map[string]int{"received": 2, "processing": 1, "processed": 1, "success": 2}
+
+			It("should count the statuses over the whole history", func() {
+				query["status_counts"] = "true"
+				query["page_size"] = "2"
 				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
 				Expect(err).To(BeNil())
 
 				reqIdPayloadData = reqIdStatuses
 				handler.ServeHTTP(rr, req)
 				Expect(rr.Code).To(Equal(200))
-				Expect(rr.Body).ToNot(BeNil())
 
 				var respData structs.PayloadRetrievebyID
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+				Expect(respData.Data).To(HaveLen(2))
+				Expect(respData.StatusCounts).To(Equal(expectedCounts))
+			})
+
+			It("should add the counts to the durations only response", func() {
+				query["status_counts"] = "true"
+				query["durations_only"] = "true"
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
 
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData structs.DurationsRetrievebyID
 				readBody, _ := ioutil.ReadAll(rr.Body)
-				json.Unmarshal(readBody, &respData)
+				Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+				Expect(respData.StatusCounts).To(Equal(expectedCounts))
+			})
 
-				Expect(respData.Durations["puptoo:inventory"]).To(Equal("00:00:05.625000"))
-				Expect(respData.Durations["puptoo:undefined"]).To(Equal("00:00:09.970000"))
+			It("should leave the counts out by default", func() {
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(rr.Body.String()).ToNot(ContainSubstring("status_counts"))
 			})
 		})
 
@@ -399,6 +2086,66 @@ var _ = Describe("RequestIdPayloads", func() {
 			})
 		})
 
+		Context("With the response envelope enabled", func() {
+			BeforeEach(func() {
+				os.Setenv("RESPONSE_ENVELOPE", "true")
+			})
+
+			AfterEach(func() {
+				os.Unsetenv("RESPONSE_ENVELOPE")
+			})
+
+			It("should move count and duration into meta", func() {
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData struct {
+					Meta structs.ResponseMeta        `json:"meta"`
+					Data []structs.SinglePayloadData `json:"data"`
+				}
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+
+				Expect(respData.Meta.Count).To(Equal(int64(len(reqIdStatuses))))
+				Expect(respData.Meta.Durations).To(HaveKey("total_time"))
+				Expect(respData.Data).To(HaveLen(len(reqIdStatuses)))
+			})
+		})
+
+		Context("With a response field policy", func() {
+			AfterEach(func() {
+				os.Unsetenv("RESPONSE_FIELDS_EXCLUDE")
+			})
+
+			It("should leave out excluded fields and keep the durations", func() {
+				os.Setenv("RESPONSE_FIELDS_EXCLUDE", "inventory_id,system_id")
+				req, err := test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s", requestId), query)
+				Expect(err).To(BeNil())
+
+				reqIdPayloadData = reqIdStatuses
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+
+				var respData struct {
+					Durations map[string]string        `json:"duration"`
+					Data      []map[string]interface{} `json:"data"`
+				}
+				readBody, _ := ioutil.ReadAll(rr.Body)
+				Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+				Expect(respData.Durations).To(HaveKey("total_time"))
+				Expect(respData.Data).To(HaveLen(len(reqIdStatuses)))
+				for _, status := range respData.Data {
+					Expect(status).To(HaveKey("service"))
+					Expect(status).ToNot(HaveKey("inventory_id"))
+					Expect(status).ToNot(HaveKey("system_id"))
+				}
+			})
+		})
+
 		reqIdStatuses = getFourReqIdStatuses(requestId, "0")
 		Context("Get to /payloads/{request_id} Verbosity 0", func() {
 			It("should pass the data forward", func() {
@@ -433,6 +2180,164 @@ var _ = Describe("RequestIdPayloads", func() {
 	})
 })
 
+var _ = Describe("Payload routes", func() {
+	var requestId string
+
+	passthrough := func(next http.Handler) http.Handler { return next }
+
+	serve := func(method string, path string) int {
+		r := chi.NewRouter()
+		endpoints.RegisterPayloadRoutes(r, *config.Get(), passthrough)
+
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr.Code
+	}
+
+	serveStream := func(path string) *httptest.ResponseRecorder {
+		r := chi.NewRouter()
+		endpoints.RegisterPayloadStreamRoutes(r, *config.Get(), endpoints.NewStatusEvents())
+
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	BeforeEach(func() {
+		endpoints.RetrievePayloads = mockedRetrievePayloads
+		endpoints.RetrieveRequestIdPayloads = mockedRequestIdPayloads
+		requestId = getUUID()
+		payloadReturnData = []models.Payloads{{Id: 1, RequestId: requestId}}
+		reqIdPayloadData = getFourReqIdStatuses(requestId, "2")
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("ENDPOINTS_PAYLOADS_ENABLED")
+		os.Unsetenv("ENDPOINTS_REQUEST_ID_ENABLED")
+		os.Unsetenv("ENDPOINTS_ARCHIVE_LINK_ENABLED")
+		os.Unsetenv("ENDPOINTS_STATS_ENABLED")
+	})
+
+	It("should register the endpoints by default", func() {
+		Expect(serve(http.MethodGet, "/payloads")).To(Equal(http.StatusOK))
+		Expect(serve(http.MethodGet, "/payloads/"+requestId)).To(Equal(http.StatusOK))
+	})
+
+	It("should return 404 from the routes of a disabled endpoint", func() {
+		os.Setenv("ENDPOINTS_PAYLOADS_ENABLED", "false")
+		os.Setenv("ENDPOINTS_ARCHIVE_LINK_ENABLED", "false")
+		os.Setenv("ENDPOINTS_STATS_ENABLED", "false")
+
+		Expect(serve(http.MethodGet, "/payloads")).To(Equal(http.StatusNotFound))
+		Expect(serve(http.MethodGet, "/payloads/"+requestId+"/archiveLink")).To(Equal(http.StatusNotFound))
+		Expect(serve(http.MethodPost, "/payloads/archiveLinks")).To(Equal(http.StatusNotFound))
+		Expect(serve(http.MethodGet, "/stats/durations")).To(Equal(http.StatusNotFound))
+		Expect(serve(http.MethodGet, "/stats/services")).To(Equal(http.StatusNotFound))
+
+		// request_id is still enabled
+		Expect(serve(http.MethodGet, "/payloads/"+requestId)).To(Equal(http.StatusOK))
+	})
+
+	It("should register the event stream and status WebSocket by default", func() {
+		endpoints.PayloadExists = func(_ *gorm.DB, _ string) bool { return false }
+
+		rr := serveStream("/payloads/" + requestId + "/events")
+		Expect(rr.Code).To(Equal(http.StatusNotFound))
+		Expect(rr.Body.String()).To(ContainSubstring("payload with id: " + requestId + " not found"))
+
+		Expect(serveStream("/ws/statuses").Code).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should return 404 from the event stream and status WebSocket when the payloads endpoint is disabled", func() {
+		os.Setenv("ENDPOINTS_PAYLOADS_ENABLED", "false")
+		endpoints.PayloadExists = func(_ *gorm.DB, _ string) bool { return true }
+
+		for _, path := range []string{"/payloads/" + requestId + "/events", "/ws/statuses"} {
+			rr := serveStream(path)
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+			Expect(rr.Body.String()).To(Equal("404 page not found\n"))
+		}
+	})
+
+	It("should return 404 from /payloads/{request_id} when the request_id endpoint is disabled", func() {
+		os.Setenv("ENDPOINTS_REQUEST_ID_ENABLED", "false")
+
+		Expect(serve(http.MethodGet, "/payloads/"+requestId)).To(Equal(http.StatusNotFound))
+		Expect(serve(http.MethodGet, "/payloads")).To(Equal(http.StatusOK))
+	})
+})
+
+var _ = Describe("ValidateSortConfig", func() {
+	It("should accept the default sort configuration", func() {
+		Expect(endpoints.ValidateSortConfig(config.Get())).To(Succeed())
+	})
+
+	It("should reject an unknown column", func() {
+		cfg := config.Get()
+		cfg.RequestConfig.PayloadsSortBy = []string{"created_at", "status"}
+		Expect(endpoints.ValidateSortConfig(cfg)).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("ValidateVerbosityConfig", func() {
+	It("should accept the default verbosity", func() {
+		Expect(endpoints.ValidateVerbosityConfig(config.Get())).To(Succeed())
+	})
+
+	It("should reject an unknown level", func() {
+		cfg := config.Get()
+		cfg.RequestConfig.DefaultVerbosity = "3"
+		Expect(endpoints.ValidateVerbosityConfig(cfg)).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("ValidateQueryPlanConfig", func() {
+	It("should accept the default filter order and hints", func() {
+		Expect(endpoints.ValidateQueryPlanConfig(config.Get())).To(Succeed())
+	})
+
+	It("should accept hints for known filter combinations", func() {
+		cfg := config.Get()
+		cfg.RequestConfig.PayloadsQueryHints = []string{"org_id+created_at=IndexScan(payloads payloads_org_id_created_at_idx)"}
+		Expect(endpoints.ValidateQueryPlanConfig(cfg)).To(Succeed())
+	})
+
+	It("should reject unknown or repeated filters in the order", func() {
+		cfg := config.Get()
+		cfg.RequestConfig.PayloadsFilterOrder = []string{"org_id", "status_msg"}
+		Expect(endpoints.ValidateQueryPlanConfig(cfg)).ToNot(Succeed())
+
+		cfg.RequestConfig.PayloadsFilterOrder = []string{"org_id", "org_id"}
+		Expect(endpoints.ValidateQueryPlanConfig(cfg)).ToNot(Succeed())
+	})
+
+	It("should reject malformed hints", func() {
+		cfg := config.Get()
+		cfg.RequestConfig.PayloadsQueryHints = []string{"org_id+created_at"}
+		Expect(endpoints.ValidateQueryPlanConfig(cfg)).ToNot(Succeed())
+
+		cfg.RequestConfig.PayloadsQueryHints = []string{"org_id+status_msg=SeqScan(payloads)"}
+		Expect(endpoints.ValidateQueryPlanConfig(cfg)).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("ValidateBusinessHoursConfig", func() {
+	It("should accept the default business hours", func() {
+		Expect(endpoints.ValidateBusinessHoursConfig(config.Get())).To(Succeed())
+	})
+
+	It("should reject an unknown timezone or an empty range", func() {
+		cfg := config.Get()
+		cfg.RequestConfig.BusinessHoursTimezone = "Local"
+		Expect(endpoints.ValidateBusinessHoursConfig(cfg)).ToNot(Succeed())
+
+		cfg = config.Get()
+		cfg.RequestConfig.BusinessHoursStart = 17
+		cfg.RequestConfig.BusinessHoursEnd = 9
+		Expect(endpoints.ValidateBusinessHoursConfig(cfg)).ToNot(Succeed())
+	})
+})
+
 var _ = Describe("PayloadArchiveLink", func() {
 	var (
 		handler http.Handler
@@ -440,19 +2345,25 @@ var _ = Describe("PayloadArchiveLink", func() {
 
 		requestId string
 		query     map[string]interface{}
+
+		mockStorageBrokerServer *httptest.Server
+		brokerQuery             url.Values
 	)
 
 	BeforeEach(func() {
 		rr = httptest.NewRecorder()
 
 		// Mock out the storage broker server.  This allows us to test the response handling code.
-		mockStorageBrokerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mockStorageBrokerServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			brokerQuery = r.URL.Query()
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte("{\"url\": \"www.example.com\"}"))
 		}))
 
-		handler = http.HandlerFunc(endpoints.PayloadArchiveLink(endpoints.RequestArchiveLink(mockStorageBrokerServer.URL, 10)))
+		handler = perRequest(func(cfg config.TrackerConfig) http.HandlerFunc {
+			return endpoints.PayloadArchiveLink(cfg, endpoints.RequestArchiveLink(mockStorageBrokerServer.URL, 10, cfg.StorageBrokerRequestParam))
+		})
 
 		requestId = getUUID()
 		query = make(map[string]interface{})
@@ -510,6 +2421,153 @@ var _ = Describe("PayloadArchiveLink", func() {
 		})
 	})
 
+	Context("When requesting the link from storage-broker", func() {
+		AfterEach(func() {
+			os.Unsetenv("STORAGEBROKERREQUESTPARAM")
+		})
+
+		It("Should send the request id as request_id by default", func() {
+			_, err := endpoints.RequestArchiveLink(mockStorageBrokerServer.URL, 1000, config.Get().StorageBrokerRequestParam)(context.Background(), requestId)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(brokerQuery).To(Equal(url.Values{"request_id": {requestId}}))
+		})
+
+		It("Should send the request id under the configured parameter", func() {
+			os.Setenv("STORAGEBROKERREQUESTPARAM", "payload")
+			_, err := endpoints.RequestArchiveLink(mockStorageBrokerServer.URL, 1000, config.Get().StorageBrokerRequestParam)(context.Background(), requestId)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(brokerQuery).To(Equal(url.Values{"payload": {requestId}}))
+		})
+
+		It("Should encode the request id and keep the query of the url", func() {
+			_, err := endpoints.RequestArchiveLink(mockStorageBrokerServer.URL+"?version=2", 1000, config.Get().StorageBrokerRequestParam)(context.Background(), "a&b=c d")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(brokerQuery).To(Equal(url.Values{"request_id": {"a&b=c d"}, "version": {"2"}}))
+		})
+	})
+
+	Context("With archive links limited to some orgs", func() {
+		var archiveReq *http.Request
+
+		BeforeEach(func() {
+			var err error
+			archiveReq, err = test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s/archiveLink", requestId), query)
+			Expect(err).To(BeNil())
+			archiveReq.Header.Set("x-rh-identity", validIdentityHeader)
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("request_id", requestId)
+			archiveReq = archiveReq.WithContext(context.WithValue(archiveReq.Context(), chi.RouteCtxKey, rctx))
+		})
+
+		AfterEach(func() {
+			os.Unsetenv("STORAGEBROKERALLOWEDORGS")
+		})
+
+		It("Should return the URL to an allowed org", func() {
+			os.Setenv("STORAGEBROKERALLOWEDORGS", "000002,000001")
+			handler.ServeHTTP(rr, archiveReq)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+		})
+
+		It("Should return 403 to other orgs with the role", func() {
+			os.Setenv("STORAGEBROKERALLOWEDORGS", "000002")
+			handler.ServeHTTP(rr, archiveReq)
+			Expect(rr.Code).To(Equal(http.StatusForbidden))
+		})
+	})
+
+	Context("With a required status configured", func() {
+		var (
+			exists     bool
+			hasStatus  bool
+			askedFor   []string
+			archiveReq *http.Request
+		)
+
+		BeforeEach(func() {
+			os.Setenv("STORAGEBROKERREQUIREDSTATUS", "ingress:success")
+			exists, hasStatus, askedFor = true, true, nil
+			endpoints.PayloadExists = func(_ *gorm.DB, _ string) bool { return exists }
+			endpoints.PayloadHasStatus = func(_ *gorm.DB, _ string, service string, status string) bool {
+				askedFor = []string{service, status}
+				return hasStatus
+			}
+
+			var err error
+			archiveReq, err = test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s/archiveLink", requestId), query)
+			Expect(err).To(BeNil())
+			archiveReq.Header.Set("x-rh-identity", validIdentityHeader)
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("request_id", requestId)
+			archiveReq = archiveReq.WithContext(context.WithValue(archiveReq.Context(), chi.RouteCtxKey, rctx))
+		})
+
+		AfterEach(func() {
+			os.Unsetenv("STORAGEBROKERREQUIREDSTATUS")
+		})
+
+		It("Should return the URL once the payload has the status", func() {
+			handler.ServeHTTP(rr, archiveReq)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(askedFor).To(Equal([]string{"ingress", "success"}))
+		})
+
+		It("Should return 409 when the payload never reported the status", func() {
+			hasStatus = false
+			handler.ServeHTTP(rr, archiveReq)
+			Expect(rr.Code).To(Equal(http.StatusConflict))
+			Expect(rr.Body.String()).To(ContainSubstring("ingress:success"))
+		})
+
+		It("Should return 404 for an unknown payload", func() {
+			exists = false
+			handler.ServeHTTP(rr, archiveReq)
+			Expect(rr.Code).To(Equal(http.StatusNotFound))
+			Expect(askedFor).To(BeNil())
+		})
+	})
+
+	Context("With archive links prefetched", func() {
+		var (
+			cachedURL  string
+			archiveReq *http.Request
+		)
+
+		BeforeEach(func() {
+			os.Setenv("ARCHIVE_PREFETCH_ENABLED", "true")
+			endpoints.RetrieveArchiveLink = func(_ *gorm.DB, _ string) string { return cachedURL }
+
+			var err error
+			archiveReq, err = test.MakeTestRequest(fmt.Sprintf("/api/v1/payloads/%s/archiveLink", requestId), query)
+			Expect(err).To(BeNil())
+			archiveReq.Header.Set("x-rh-identity", validIdentityHeader)
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("request_id", requestId)
+			archiveReq = archiveReq.WithContext(context.WithValue(archiveReq.Context(), chi.RouteCtxKey, rctx))
+		})
+
+		AfterEach(func() {
+			os.Unsetenv("ARCHIVE_PREFETCH_ENABLED")
+		})
+
+		It("Should serve the prefetched URL", func() {
+			cachedURL = "www.example.com/prefetched"
+			handler.ServeHTTP(rr, archiveReq)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Body.String()).To(ContainSubstring("www.example.com/prefetched"))
+		})
+
+		It("Should ask storage-broker for links that weren't prefetched", func() {
+			cachedURL = ""
+			handler.ServeHTTP(rr, archiveReq)
+			Expect(rr.Code).To(Equal(http.StatusOK))
+			Expect(rr.Body.String()).To(ContainSubstring(`"www.example.com"`))
+		})
+	})
+
 })
 
 var _ = Describe("PayloadKibanaLink", func() {
@@ -524,7 +2582,7 @@ var _ = Describe("PayloadKibanaLink", func() {
 
 	BeforeEach(func() {
 		rr = httptest.NewRecorder()
-		handler = http.HandlerFunc(endpoints.PayloadKibanaLink)
+		handler = perRequest(endpoints.CreatePayloadKibanaLinkHandler)
 
 		requestId = getUUID()
 		cfg = config.Get()
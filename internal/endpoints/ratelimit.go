@@ -0,0 +1,103 @@
+package endpoints
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/httprate"
+)
+
+// OrgRateLimitMiddleware limits requests per org_id from the identity header, responding with a 429
+// and Retry-After once an org goes over its limit for the minute. overrides are org_id:limit pairs
+// replacing the default limit for that org, and exempt org_ids are never limited. Requests without
+// an org_id are left to the IP limit, as is everything when the default limit is 0.
+func OrgRateLimitMiddleware(limit int, overrides []string, exempt []string) (func(http.Handler) http.Handler, error) {
+	orgLimits := map[string]int{}
+	for _, override := range overrides {
+		parts := strings.Split(override, ":")
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("org rate limit overrides must be org_id:limit pairs, got %s", override)
+		}
+		orgLimit, err := strconv.Atoi(parts[1])
+		if err != nil || orgLimit <= 0 {
+			return nil, fmt.Errorf("org rate limit override for %s must be a positive integer", parts[0])
+		}
+		orgLimits[parts[0]] = orgLimit
+	}
+
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+
+		// the limit is fixed per limiter, so each distinct limit gets its own
+		newLimiter := func(requestLimit int) http.Handler {
+			return httprate.NewRateLimiter(requestLimit, time.Minute,
+				httprate.WithKeyFuncs(func(r *http.Request) (string, error) {
+					return identityOrgID(r), nil
+				}),
+				httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
+					// org_ids come from the client, so the counter is labelled by the limit the org is under
+					if _, ok := orgLimits[identityOrgID(r)]; ok {
+						incOrgThrottledRequests("overridden")
+					} else {
+						incOrgThrottledRequests("default")
+					}
+					writeResponse(w, http.StatusTooManyRequests, getErrorBody("Too many requests for this org, please retry later", http.StatusTooManyRequests))
+				}),
+			).Handler(next)
+		}
+
+		defaultLimiter := newLimiter(limit)
+		limiters := map[int]http.Handler{limit: defaultLimiter}
+		for _, orgLimit := range orgLimits {
+			if _, ok := limiters[orgLimit]; !ok {
+				limiters[orgLimit] = newLimiter(orgLimit)
+			}
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			orgID := identityOrgID(r)
+			if orgID == "" || stringInSlice(orgID, exempt) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if orgLimit, ok := orgLimits[orgID]; ok {
+				limiters[orgLimit].ServeHTTP(w, r)
+				return
+			}
+			defaultLimiter.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// identityOrgID returns the org_id of the identity header, falling back to the internal org_id
+// older identities carry, or an empty string when there isn't one
+func identityOrgID(r *http.Request) string {
+	decoded, err := base64.StdEncoding.DecodeString(r.Header.Get("x-rh-identity"))
+	if err != nil {
+		return ""
+	}
+
+	var identityHeaderData struct {
+		Identity struct {
+			OrgID    string `json:"org_id"`
+			Internal struct {
+				OrgID string `json:"org_id"`
+			} `json:"internal"`
+		} `json:"identity"`
+	}
+	if err := json.Unmarshal(decoded, &identityHeaderData); err != nil {
+		return ""
+	}
+
+	if identityHeaderData.Identity.OrgID != "" {
+		return identityHeaderData.Identity.OrgID
+	}
+	return identityHeaderData.Identity.Internal.OrgID
+}
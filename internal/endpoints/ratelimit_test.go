@@ -0,0 +1,104 @@
+package endpoints_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
+	"github.com/redhatinsights/payload-tracker-go/internal/utils/test"
+)
+
+func orgIdentityHeader(orgID string) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(`{"identity": {"org_id": "%s"}}`, orgID)))
+}
+
+var _ = Describe("OrgRateLimitMiddleware", func() {
+	var (
+		handler http.Handler
+		query   map[string]interface{}
+	)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(identity string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, err := test.MakeTestRequest("/api/v1/payloads", query)
+		Expect(err).To(BeNil())
+		if identity != "" {
+			req.Header.Set("x-rh-identity", identity)
+		}
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	BeforeEach(func() {
+		query = make(map[string]interface{})
+		middleware, err := endpoints.OrgRateLimitMiddleware(2, []string{"big:4"}, []string{"internal"})
+		Expect(err).To(BeNil())
+		handler = middleware(ok)
+	})
+
+	It("Should return 429 with Retry-After once an org is over its limit", func() {
+		Expect(serve(orgIdentityHeader("noisy")).Code).To(Equal(http.StatusOK))
+		Expect(serve(orgIdentityHeader("noisy")).Code).To(Equal(http.StatusOK))
+
+		rr := serve(orgIdentityHeader("noisy"))
+		Expect(rr.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rr.Header().Get("Retry-After")).ToNot(BeEmpty())
+
+		Expect(serve(orgIdentityHeader("quiet")).Code).To(Equal(http.StatusOK))
+	})
+
+	It("Should apply the org overrides", func() {
+		for i := 0; i < 4; i++ {
+			Expect(serve(orgIdentityHeader("big")).Code).To(Equal(http.StatusOK))
+		}
+		Expect(serve(orgIdentityHeader("big")).Code).To(Equal(http.StatusTooManyRequests))
+	})
+
+	It("Should count the throttled requests by the limit rather than the org", func() {
+		throttled := func(limit string) float64 {
+			return testutil.ToFloat64(endpoints.OrgThrottledRequests.WithLabelValues(limit))
+		}
+		defaults, overridden := throttled("default"), throttled("overridden")
+
+		for i := 0; i < 3; i++ {
+			serve(orgIdentityHeader("noisy"))
+		}
+		for i := 0; i < 5; i++ {
+			serve(orgIdentityHeader("big"))
+		}
+
+		Expect(throttled("default")).To(Equal(defaults + 1))
+		Expect(throttled("overridden")).To(Equal(overridden + 1))
+	})
+
+	It("Should not limit exempt orgs or requests without an org", func() {
+		for i := 0; i < 5; i++ {
+			Expect(serve(orgIdentityHeader("internal")).Code).To(Equal(http.StatusOK))
+			Expect(serve("").Code).To(Equal(http.StatusOK))
+		}
+	})
+
+	It("Should use the internal org_id of older identities", func() {
+		for i := 0; i < 2; i++ {
+			Expect(serve(validIdentityHeader).Code).To(Equal(http.StatusOK))
+		}
+		Expect(serve(validIdentityHeader).Code).To(Equal(http.StatusTooManyRequests))
+	})
+
+	It("Should reject malformed overrides", func() {
+		for _, override := range []string{"big", "big:0", ":4", "big:many"} {
+			_, err := endpoints.OrgRateLimitMiddleware(2, []string{override}, nil)
+			Expect(err).ToNot(BeNil())
+		}
+	})
+})
@@ -9,21 +9,24 @@ import (
 	"github.com/redhatinsights/payload-tracker-go/internal/structs"
 )
 
-// RolesArchiveLink returns a response for /roles/archiveLink
-func RolesArchiveLink(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// CreateRolesArchiveLinkHandler returns a handler for /roles/archiveLink
+func CreateRolesArchiveLinkHandler(cfg config.TrackerConfig) http.HandlerFunc {
 
-	statusCode, err := checkForRole(r, config.Get().StorageBrokerURLRole)
-	if err != nil {
-		writeResponse(w, statusCode, getErrorBody(fmt.Sprintf("%v", err), statusCode))
-		return
-	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		statusCode, err := checkArchiveAccess(r, cfg)
+		if err != nil {
+			writeResponse(w, statusCode, getErrorBody(fmt.Sprintf("%v", err), statusCode))
+			return
+		}
 
-	allowed, _ := json.Marshal(
-		structs.ArchiveLinkRole{
-			Allowed: true,
-		},
-	)
+		allowed, _ := json.Marshal(
+			structs.ArchiveLinkRole{
+				Allowed: true,
+			},
+		)
 
-	writeResponse(w, http.StatusOK, string(allowed))
+		writeResponse(w, http.StatusOK, string(allowed))
+	}
 }
@@ -3,10 +3,12 @@ package endpoints_test
 import (
 	"net/http"
 	"net/http/httptest"
+	"os"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
 	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
 	"github.com/redhatinsights/payload-tracker-go/internal/utils/test"
 )
@@ -27,7 +29,7 @@ var _ = Describe("Roles", func() {
 			It("Should return 401", func() {
 				req, err := test.MakeTestRequest("/api/v1/roles/archiveLink", query)
 				Expect(err).To(BeNil())
-				handler = http.HandlerFunc(endpoints.RolesArchiveLink)
+				handler = endpoints.CreateRolesArchiveLinkHandler(*config.Get())
 				rr = httptest.NewRecorder()
 				handler.ServeHTTP(rr, req)
 				Expect(rr.Code).To(Equal(http.StatusUnauthorized))
@@ -39,7 +41,7 @@ var _ = Describe("Roles", func() {
 				req, err := test.MakeTestRequest("/api/v1/roles/archiveLink", query)
 				Expect(err).To(BeNil())
 				req.Header.Set("x-rh-identity", invalidIdentityHeader)
-				handler = http.HandlerFunc(endpoints.RolesArchiveLink)
+				handler = endpoints.CreateRolesArchiveLinkHandler(*config.Get())
 				rr = httptest.NewRecorder()
 				handler.ServeHTTP(rr, req)
 				Expect(rr.Code).To(Equal(http.StatusForbidden))
@@ -51,12 +53,29 @@ var _ = Describe("Roles", func() {
 				req, err := test.MakeTestRequest("/api/v1/roles/archiveLink", query)
 				Expect(err).To(BeNil())
 				req.Header.Set("x-rh-identity", validIdentityHeader)
-				handler = http.HandlerFunc(endpoints.RolesArchiveLink)
+				handler = endpoints.CreateRolesArchiveLinkHandler(*config.Get())
 				rr = httptest.NewRecorder()
 				handler.ServeHTTP(rr, req)
 				Expect(rr.Code).To(Equal(http.StatusOK))
 			})
 		})
 
+		Context("With archive links limited to other orgs", func() {
+			AfterEach(func() {
+				os.Unsetenv("STORAGEBROKERALLOWEDORGS")
+			})
+
+			It("Should return 403", func() {
+				os.Setenv("STORAGEBROKERALLOWEDORGS", "000002")
+				req, err := test.MakeTestRequest("/api/v1/roles/archiveLink", query)
+				Expect(err).To(BeNil())
+				req.Header.Set("x-rh-identity", validIdentityHeader)
+				handler = endpoints.CreateRolesArchiveLinkHandler(*config.Get())
+				rr = httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(http.StatusForbidden))
+			})
+		})
+
 	})
 })
@@ -0,0 +1,100 @@
+package endpoints
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+)
+
+// debugHeader forces a request to be sampled whatever the sampling rate
+const debugHeader = "x-payload-tracker-debug"
+
+type sampledKey struct{}
+
+var (
+	sampleRand   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	sampleRandMu sync.Mutex
+
+	debugLogger     *logrus.Logger
+	debugLoggerOnce sync.Once
+)
+
+// SamplingMiddleware picks a share of the requests, given by rate from 0 to 1, to trace with debug logging
+// and the SQL of each query logged along with its time. Requests with the debug header are always picked.
+func SamplingMiddleware(rate float64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(debugHeader) == "" && !sample(rate) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), sampledKey{}, true))
+			log := requestLogger(r)
+			start := time.Now()
+			log.Debug("Sampled request started")
+			next.ServeHTTP(w, r)
+			log.WithField("elapsed", time.Since(start).Seconds()).Debug("Sampled request finished")
+		})
+	}
+}
+
+func sample(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	sampleRandMu.Lock()
+	defer sampleRandMu.Unlock()
+	return sampleRand.Float64() < rate
+}
+
+func isSampled(r *http.Request) bool {
+	sampled, _ := r.Context().Value(sampledKey{}).(bool)
+	return sampled
+}
+
+// requestLogger logs at debug level for sampled requests whatever the configured level is
+func requestLogger(r *http.Request) *logrus.Entry {
+	fields := logrus.Fields{"correlation_id": r.Header.Get(correlationIDHeader), "method": r.Method, "path": r.URL.Path}
+	if !isSampled(r) {
+		return l.Log.WithFields(fields)
+	}
+
+	debugLoggerOnce.Do(func() {
+		debugLogger = &logrus.Logger{
+			Out:          l.Log.Out,
+			Hooks:        l.Log.Hooks,
+			Formatter:    l.Log.Formatter,
+			ReportCaller: l.Log.ReportCaller,
+			Level:        logrus.DebugLevel,
+			ExitFunc:     l.Log.ExitFunc,
+		}
+	})
+	return debugLogger.WithFields(fields)
+}
+
+// traceQueries logs every query of a sampled request with its time, under the db_methods module
+func traceQueries(r *http.Request, dbQuery *gorm.DB) *gorm.DB {
+	if dbQuery == nil || !isSampled(r) {
+		return dbQuery
+	}
+	queryLogger := requestLogger(r).WithField(l.ModuleField, "db_methods")
+	return dbQuery.Session(&gorm.Session{Logger: logger.New(debugWriter{queryLogger}, logger.Config{LogLevel: logger.Info})})
+}
+
+// debugWriter writes the gorm query log at debug level
+type debugWriter struct {
+	*logrus.Entry
+}
+
+func (w debugWriter) Printf(format string, args ...interface{}) {
+	w.Debugf(format, args...)
+}
@@ -0,0 +1,89 @@
+package endpoints_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+	"github.com/redhatinsights/payload-tracker-go/internal/utils/test"
+)
+
+var _ = Describe("SamplingMiddleware", func() {
+	var (
+		hook    *logrustest.Hook
+		handled bool
+		next    http.Handler
+	)
+
+	sampledRequests := func() int {
+		count := 0
+		for _, entry := range hook.AllEntries() {
+			if entry.Message == "Sampled request finished" {
+				count++
+			}
+		}
+		return count
+	}
+
+	serve := func(rate float64, debug bool) {
+		rr := httptest.NewRecorder()
+		req, err := test.MakeTestRequest("/api/v1/payloads", map[string]interface{}{})
+		Expect(err).To(BeNil())
+		if debug {
+			req.Header.Set("x-payload-tracker-debug", "1")
+		}
+		endpoints.SamplingMiddleware(rate)(next).ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusOK))
+	}
+
+	BeforeEach(func() {
+		hook = logrustest.NewLocal(l.Log)
+		handled = false
+		next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handled = true
+			w.WriteHeader(http.StatusOK)
+		})
+	})
+
+	It("Should not sample any request at a rate of 0", func() {
+		serve(0, false)
+		Expect(handled).To(BeTrue())
+		Expect(sampledRequests()).To(Equal(0))
+	})
+
+	It("Should sample every request at a rate of 1", func() {
+		serve(1, false)
+		Expect(handled).To(BeTrue())
+		Expect(sampledRequests()).To(Equal(1))
+	})
+
+	It("Should always sample requests with the debug header", func() {
+		serve(0, true)
+		Expect(handled).To(BeTrue())
+		Expect(sampledRequests()).To(Equal(1))
+	})
+})
+
+var _ = Describe("ValidateSamplingConfig", func() {
+	It("Should accept rates from 0 to 1", func() {
+		cfg := config.Get()
+		for _, rate := range []float64{0, 0.05, 1} {
+			cfg.RequestConfig.TraceSampleRate = rate
+			Expect(endpoints.ValidateSamplingConfig(cfg)).To(Succeed())
+		}
+	})
+
+	It("Should reject rates outside of 0 to 1", func() {
+		cfg := config.Get()
+		for _, rate := range []float64{-0.1, 1.5} {
+			cfg.RequestConfig.TraceSampleRate = rate
+			Expect(endpoints.ValidateSamplingConfig(cfg)).ToNot(Succeed())
+		}
+	})
+})
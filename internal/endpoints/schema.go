@@ -0,0 +1,131 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+)
+
+// param describes a query parameter along with the parameters it can't be combined with
+func param(name string, paramType string, values ...string) structs.ParamSchema {
+	schema := structs.ParamSchema{Name: name, Type: paramType, Values: values}
+	for _, rule := range exclusiveParams {
+		if rule.param == name {
+			schema.Conflicts = append(schema.Conflicts, rule.conflicts...)
+		} else if stringInSlice(name, rule.conflicts) {
+			schema.Conflicts = append(schema.Conflicts, rule.param)
+		}
+	}
+	return schema
+}
+
+// listingParams are the parameters shared by every listing endpoint
+func listingParams() []structs.ParamSchema {
+	return []structs.ParamSchema{
+		param("page", "integer"),
+		param("page_size", "integer"),
+		param("sort_dir", "string", validSortDir...),
+		param("pretty", "boolean"),
+		param("include_deleted", "boolean"),
+	}
+}
+
+func createdAtParams() []structs.ParamSchema {
+	return []structs.ParamSchema{
+		param("created_at_lt", "timestamp"),
+		param("created_at_lte", "timestamp"),
+		param("created_at_gt", "timestamp"),
+		param("created_at_gte", "timestamp"),
+		param("date", "date"),
+		param("tz", "timezone"),
+	}
+}
+
+// apiSchema describes the listing endpoints from the lists their parameters are validated against
+func apiSchema(cfg *config.TrackerConfig) structs.Schema {
+	payloads := append(listingParams(), createdAtParams()...)
+	payloads = append(payloads,
+		param("account", "list"),
+		param("account_gt", "integer"),
+		param("account_lt", "integer"),
+		param("org_id", "string"),
+		param("inventory_id", "string"),
+		param("system_id", "string"),
+		param("request_id_prefix", "string"),
+		param("service", "string"),
+		param("status", "string"),
+		param("status_msg", "string"),
+		param("msg_path", "string"),
+		param("msg_value", "string"),
+		param("service_ne", "list"),
+		param("status_ne", "list"),
+		param("service_status", "list"),
+		param("has_message", "boolean"),
+		param("min_statuses", "integer"),
+		param("latest_only", "boolean"),
+		param("include_services", "boolean"),
+		param("include_staleness", "boolean"),
+		param("include_terminal", "boolean"),
+		param("include_archive", "boolean"),
+		param("embed", "string", "statuses"),
+		param("verbosity", "string", validVerbosity...),
+		param("business_hours", "boolean"),
+		param("business_hours_tz", "timezone"),
+		param("human", "boolean"),
+		param("skip_count", "boolean"),
+		param("format", "string", validFormats...),
+		param("delimiter", "string", validCSVDelimiters...),
+	)
+
+	requestID := append(listingParams(),
+		param("verbosity", "string", validVerbosity...),
+		param("duration_unit", "string", validDurationUnits...),
+		param("fields", "list", validStatusFields...),
+		param("durations_only", "boolean"),
+		param("include_sla", "boolean"),
+		param("summary", "boolean"),
+		param("not_found_ok", "boolean"),
+		param("status_counts", "boolean"),
+		param("exclude_services", "list"),
+		param("human", "boolean"),
+	)
+
+	statuses := append(listingParams(), createdAtParams()...)
+	statuses = append(statuses,
+		param("date_lt", "timestamp"),
+		param("date_lte", "timestamp"),
+		param("date_gt", "timestamp"),
+		param("date_gte", "timestamp"),
+		param("service", "string"),
+		param("source", "string"),
+		param("status", "string"),
+		param("status_msg", "string"),
+		param("msg_path", "string"),
+		param("msg_value", "string"),
+	)
+
+	return structs.Schema{Endpoints: []structs.EndpointSchema{
+		{Path: "/payloads", SortBy: cfg.RequestConfig.PayloadsSortBy, Params: payloads},
+		{Path: "/payloads/{request_id}", SortBy: cfg.RequestConfig.RequestIDSortBy, Params: requestID},
+		{Path: "/statuses", SortBy: validStatusesSortBy, Params: statuses},
+	}}
+}
+
+// CreateSchemaHandler returns a handler for /schema describing the parameters the listing endpoints accept
+func CreateSchemaHandler(cfg config.TrackerConfig) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		dataJson, err := json.Marshal(apiSchema(&cfg))
+		if err != nil {
+			l.Log.Error(err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+			return
+		}
+
+		writeResponse(w, http.StatusOK, string(dataJson))
+	}
+}
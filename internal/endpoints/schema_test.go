@@ -0,0 +1,78 @@
+package endpoints_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+	"github.com/redhatinsights/payload-tracker-go/internal/utils/test"
+)
+
+var _ = Describe("Schema", func() {
+	var (
+		handler http.Handler
+		rr      *httptest.ResponseRecorder
+		schema  structs.Schema
+	)
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		handler = endpoints.CreateSchemaHandler(*config.Get())
+
+		req, err := test.MakeTestRequest("/api/v1/schema", map[string]interface{}{})
+		Expect(err).To(BeNil())
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(200))
+
+		body, _ := ioutil.ReadAll(rr.Body)
+		schema = structs.Schema{}
+		Expect(json.Unmarshal(body, &schema)).To(Succeed())
+	})
+
+	endpoint := func(path string) structs.EndpointSchema {
+		for _, e := range schema.Endpoints {
+			if e.Path == path {
+				return e
+			}
+		}
+		Fail("no schema for " + path)
+		return structs.EndpointSchema{}
+	}
+
+	param := func(e structs.EndpointSchema, name string) structs.ParamSchema {
+		for _, p := range e.Params {
+			if p.Name == name {
+				return p
+			}
+		}
+		Fail("no " + name + " parameter for " + e.Path)
+		return structs.ParamSchema{}
+	}
+
+	It("Should list the columns each listing can be sorted by", func() {
+		Expect(endpoint("/payloads").SortBy).To(ConsistOf("account", "org_id", "inventory_id", "system_id", "created_at"))
+		Expect(endpoint("/payloads/{request_id}").SortBy).To(ContainElement("service"))
+		Expect(endpoint("/statuses").SortBy).To(ContainElement("request_id"))
+	})
+
+	It("Should describe the parameter types and their accepted values", func() {
+		payloads := endpoint("/payloads")
+		Expect(param(payloads, "created_at_gt").Type).To(Equal("timestamp"))
+		Expect(param(payloads, "account_gt").Type).To(Equal("integer"))
+		Expect(param(payloads, "format").Values).To(ConsistOf("json", "csv"))
+		Expect(param(endpoint("/payloads/{request_id}"), "fields").Values).To(ContainElement("status_msg"))
+	})
+
+	It("Should name the parameters that can't be combined", func() {
+		payloads := endpoint("/payloads")
+		Expect(param(payloads, "date").Conflicts).To(ContainElement("created_at_lte"))
+		Expect(param(payloads, "created_at_gte").Conflicts).To(ConsistOf("date", "created_at_gt"))
+	})
+})
@@ -1,18 +1,100 @@
 package endpoints
 
 import (
+	"encoding/json"
 	"net/http"
+	"time"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+	"github.com/redhatinsights/payload-tracker-go/internal/queries"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+)
+
+var (
+	RetrieveDurationStats = queries.RetrieveDurationStats
+	RetrieveServiceStats  = queries.RetrieveServiceStats
 )
 
-// StatsRetrieve holds a given stat
-type StatsRetrieve struct {
-	Message string `json:"message"`
+// requireWindow rejects requests whose created_at window is open on either end, an unbounded window would aggregate the whole table
+func requireWindow(errs *validationErrors, q structs.Query) {
+	if (q.CreatedAtGT == "" && q.CreatedAtGTE == "") || (q.CreatedAtLT == "" && q.CreatedAtLTE == "") {
+		errs.add("created_at", "a created_at window is required, with created_at_gt or created_at_gte and created_at_lt or created_at_lte")
+	}
+}
+
+// CreateDurationStatsHandler returns a handler for /stats/durations
+func CreateDurationStatsHandler(cfg config.TrackerConfig) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+		incRequests()
+
+		q, errs := initQuery(r, cfg.RequestConfig)
+
+		requireWindow(&errs, q)
+		validateTimestamps(&errs, q, false)
+
+		if writeValidationErrors(w, errs) {
+			return
+		}
+		if !checkDeletedAccess(w, r, q, cfg.AdminRole) {
+			return
+		}
+
+		dbQuery, timedOut := requestReadDb(r)
+		stats := RetrieveDurationStats(dbQuery, q, cfg.RequestConfig.StatsSampleLimit)
+		if writeStatementTimeout(w, timedOut) {
+			return
+		}
+		observeDBTime(time.Since(start))
+
+		dataJson, err := json.Marshal(stats)
+		if err != nil {
+			l.Log.Error(err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+			return
+		}
+
+		writeLimitedResponse(w, cfg.RequestConfig.MaxResponseBytes, "application/json", string(dataJson))
+	}
 }
 
-func Stats(w http.ResponseWriter, r *http.Request) {
+// CreateServiceStatsHandler returns a handler for /stats/services
+func CreateServiceStatsHandler(cfg config.TrackerConfig) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+		incRequests()
+
+		q, errs := initQuery(r, cfg.RequestConfig)
+
+		requireWindow(&errs, q)
+		validateTimestamps(&errs, q, false)
+
+		if writeValidationErrors(w, errs) {
+			return
+		}
+		if !checkDeletedAccess(w, r, q, cfg.AdminRole) {
+			return
+		}
+
+		dbQuery, timedOut := requestReadDb(r)
+		services := RetrieveServiceStats(dbQuery, q, cfg.RequestConfig.StatsBucketLimit)
+		if writeStatementTimeout(w, timedOut) {
+			return
+		}
+		observeDBTime(time.Since(start))
+
+		dataJson, err := json.Marshal(structs.ServiceStats{Count: len(services), Data: services})
+		if err != nil {
+			l.Log.Error(err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+			return
+		}
 
-	// stat := r.URL.Query().Get("stat")
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Statuses"))
+		writeLimitedResponse(w, cfg.RequestConfig.MaxResponseBytes, "application/json", string(dataJson))
+	}
 }
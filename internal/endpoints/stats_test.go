@@ -0,0 +1,123 @@
+package endpoints_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/gorm"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+	"github.com/redhatinsights/payload-tracker-go/internal/utils/test"
+)
+
+var _ = Describe("DurationStats", func() {
+	var (
+		handler http.Handler
+		rr      *httptest.ResponseRecorder
+		query   map[string]interface{}
+
+		statsQuery structs.Query
+		statsLimit int
+	)
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		handler = endpoints.CreateDurationStatsHandler(*config.Get())
+		query = make(map[string]interface{})
+
+		endpoints.RetrieveDurationStats = func(_ *gorm.DB, apiQuery structs.Query, limit int) structs.DurationStats {
+			statsQuery = apiQuery
+			statsLimit = limit
+			return structs.DurationStats{Count: 3, P50: 1.5, P95: 4, P99: 4.8}
+		}
+	})
+
+	It("Should return the percentiles for the window", func() {
+		query["created_at_gt"] = "2024-01-01T00:00:00Z"
+		query["created_at_lte"] = "2024-02-01T00:00:00Z"
+		req, err := test.MakeTestRequest("/api/v1/stats/durations", query)
+		Expect(err).To(BeNil())
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		var respData structs.DurationStats
+		readBody, _ := ioutil.ReadAll(rr.Body)
+		Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+		Expect(respData).To(Equal(structs.DurationStats{Count: 3, P50: 1.5, P95: 4, P99: 4.8}))
+		Expect(statsQuery.CreatedAtGT).To(Equal("2024-01-01T00:00:00Z"))
+		Expect(statsQuery.CreatedAtLTE).To(Equal("2024-02-01T00:00:00Z"))
+		Expect(statsLimit).To(Equal(10000))
+	})
+
+	It("Should require both ends of the window", func() {
+		query["created_at_gt"] = "2024-01-01T00:00:00Z"
+		req, err := test.MakeTestRequest("/api/v1/stats/durations", query)
+		Expect(err).To(BeNil())
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("Should reject invalid timestamps", func() {
+		query["created_at_gt"] = "yesterday"
+		query["created_at_lt"] = "2024-02-01T00:00:00Z"
+		req, err := test.MakeTestRequest("/api/v1/stats/durations", query)
+		Expect(err).To(BeNil())
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusBadRequest))
+	})
+})
+
+var _ = Describe("ServiceStats", func() {
+	var (
+		handler http.Handler
+		rr      *httptest.ResponseRecorder
+		query   map[string]interface{}
+
+		statsQuery structs.Query
+		statsLimit int
+	)
+
+	BeforeEach(func() {
+		rr = httptest.NewRecorder()
+		handler = endpoints.CreateServiceStatsHandler(*config.Get())
+		query = make(map[string]interface{})
+
+		endpoints.RetrieveServiceStats = func(_ *gorm.DB, apiQuery structs.Query, limit int) []structs.ServiceCount {
+			statsQuery = apiQuery
+			statsLimit = limit
+			return []structs.ServiceCount{{Service: "ingress", Payloads: 12}, {Service: "puptoo", Payloads: 9}}
+		}
+	})
+
+	It("Should return the payloads per service for the window", func() {
+		query["created_at_gte"] = "2024-01-01T00:00:00Z"
+		query["created_at_lt"] = "2024-02-01T00:00:00Z"
+		req, err := test.MakeTestRequest("/api/v1/stats/services", query)
+		Expect(err).To(BeNil())
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusOK))
+
+		var respData structs.ServiceStats
+		readBody, _ := ioutil.ReadAll(rr.Body)
+		Expect(json.Unmarshal(readBody, &respData)).To(Succeed())
+		Expect(respData.Count).To(Equal(2))
+		Expect(respData.Data).To(Equal([]structs.ServiceCount{{Service: "ingress", Payloads: 12}, {Service: "puptoo", Payloads: 9}}))
+		Expect(statsQuery.CreatedAtGTE).To(Equal("2024-01-01T00:00:00Z"))
+		Expect(statsQuery.CreatedAtLT).To(Equal("2024-02-01T00:00:00Z"))
+		Expect(statsLimit).To(Equal(100))
+	})
+
+	It("Should require both ends of the window", func() {
+		query["created_at_lt"] = "2024-02-01T00:00:00Z"
+		req, err := test.MakeTestRequest("/api/v1/stats/services", query)
+		Expect(err).To(BeNil())
+		handler.ServeHTTP(rr, req)
+		Expect(rr.Code).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -1,12 +1,11 @@
 package endpoints
 
 import (
-	"encoding/json"
-	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
 	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
 	"github.com/redhatinsights/payload-tracker-go/internal/queries"
 	"github.com/redhatinsights/payload-tracker-go/internal/structs"
@@ -16,43 +15,47 @@ var (
 	RetrieveStatuses = queries.RetrieveStatuses
 )
 
-func Statuses(w http.ResponseWriter, r *http.Request) {
-	// init query with defaults and passed params
-	start := time.Now()
-
-	q, err := initQuery(r)
-
-	if err != nil {
-		writeResponse(w, http.StatusBadRequest, getErrorBody(fmt.Sprintf("%v", err), http.StatusBadRequest))
-		return
-	}
-
-	if !stringInSlice(q.SortBy, validStatusesSortBy) {
-		message := "sort_by must be one of " + strings.Join(validStatusesSortBy, ", ")
-		writeResponse(w, http.StatusBadRequest, getErrorBody(message, http.StatusBadRequest))
-		return
-	}
-	if !stringInSlice(q.SortDir, validSortDir) {
-		message := "sort_dir must be one of " + strings.Join(validSortDir, ", ")
-		writeResponse(w, http.StatusBadRequest, getErrorBody(message, http.StatusBadRequest))
-		return
+// CreateStatusesHandler returns a handler for /statuses
+func CreateStatusesHandler(cfg config.TrackerConfig) http.HandlerFunc {
+	policy := newFieldPolicy(cfg.RequestConfig)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// init query with defaults and passed params
+		start := time.Now()
+
+		q, errs := initQuery(r, cfg.RequestConfig)
+
+		if !stringInSlice(q.SortBy, validStatusesSortBy) {
+			errs.add("sort_by", "sort_by must be one of "+strings.Join(validStatusesSortBy, ", "))
+		}
+		if !stringInSlice(q.SortDir, validSortDir) {
+			errs.add("sort_dir", "sort_dir must be one of "+strings.Join(validSortDir, ", "))
+		}
+		validateTimestamps(&errs, q, true)
+
+		if writeValidationErrors(w, errs) {
+			return
+		}
+		if !checkDeletedAccess(w, r, q, cfg.AdminRole) {
+			return
+		}
+
+		dbQuery, timedOut := requestReadDb(r)
+		count, payloads := RetrieveStatuses(dbQuery, q)
+		if writeStatementTimeout(w, timedOut) {
+			return
+		}
+		duration := time.Since(start).Seconds()
+
+		statusesData := structs.StatusesData{count, duration, payloads}
+
+		dataJson, err := marshalResponse(policy, statusesData)
+		if err != nil {
+			l.Log.Error(err)
+			writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
+			return
+		}
+
+		writeLimitedResponse(w, cfg.RequestConfig.MaxResponseBytes, "application/json", string(dataJson))
 	}
-	if !validTimestamps(q, true) {
-		message := "invalid timestamp format provided"
-		writeResponse(w, http.StatusBadRequest, getErrorBody(message, http.StatusBadRequest))
-		return
-	}
-	count, payloads := RetrieveStatuses(Db(), q)
-	duration := time.Since(start).Seconds()
-
-	statusesData := structs.StatusesData{count, duration, payloads}
-
-	dataJson, err := json.Marshal(statusesData)
-	if err != nil {
-		l.Log.Error(err)
-		writeResponse(w, http.StatusInternalServerError, getErrorBody("Internal Server Issue", http.StatusInternalServerError))
-		return
-	}
-
-	writeResponse(w, http.StatusOK, string(dataJson))
 }
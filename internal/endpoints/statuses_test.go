@@ -10,6 +10,7 @@ import (
 	. "github.com/onsi/gomega"
 	"gorm.io/gorm"
 
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
 	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
 	"github.com/redhatinsights/payload-tracker-go/internal/structs"
 	"github.com/redhatinsights/payload-tracker-go/internal/utils/test"
@@ -33,7 +34,7 @@ var _ = Describe("Statuses", func() {
 
 	BeforeEach(func() {
 		rr = httptest.NewRecorder()
-		handler = http.HandlerFunc(endpoints.Statuses)
+		handler = endpoints.CreateStatusesHandler(*config.Get())
 
 		endpoints.RetrieveStatuses = mockedRetrieveStatuses
 		query = make(map[string]interface{})
@@ -145,6 +146,49 @@ var _ = Describe("Statuses", func() {
 			"date_gt":        "halloween",
 			"date_gte":       "trickortreat",
 		}
+		Context("With msg_path and msg_value", func() {
+			var captured structs.Query
+
+			BeforeEach(func() {
+				endpoints.RetrieveStatuses = func(_ *gorm.DB, q structs.Query) (int64, []structs.StatusRetrieve) {
+					captured = q
+					return 0, nil
+				}
+			})
+
+			It("filters on the JSON value at the path", func() {
+				query["msg_path"] = "error.code"
+				query["msg_value"] = "E42"
+				req, err := test.MakeTestRequest("/api/v1/statuses", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(200))
+				Expect(captured.MsgPath).To(Equal("error.code"))
+				Expect(captured.MsgValue).To(Equal("E42"))
+			})
+
+			It("should return HTTP 400 when only one of them is given", func() {
+				query["msg_path"] = "error.code"
+				req, err := test.MakeTestRequest("/api/v1/statuses", query)
+				Expect(err).To(BeNil())
+				handler.ServeHTTP(rr, req)
+				Expect(rr.Code).To(Equal(400))
+				Expect(rr.Body.String()).To(ContainSubstring("msg_path and msg_value must be given together"))
+			})
+
+			It("should return HTTP 400 for an invalid path", func() {
+				for _, path := range []string{"error..code", ".error", "error code", "error.'code'"} {
+					rr = httptest.NewRecorder()
+					query["msg_path"] = path
+					query["msg_value"] = "E42"
+					req, err := test.MakeTestRequest("/api/v1/statuses", query)
+					Expect(err).To(BeNil())
+					handler.ServeHTTP(rr, req)
+					Expect(rr.Code).To(Equal(400), path)
+				}
+			})
+		})
+
 		Context("With invalid timestamps query parameter", func() {
 			It("should return HTTP 400", func() {
 				for k, v := range invalidTimestamps {
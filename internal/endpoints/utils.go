@@ -5,15 +5,21 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
 	"github.com/redhatinsights/payload-tracker-go/internal/db"
 	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+	"github.com/redhatinsights/payload-tracker-go/internal/queries"
 	"github.com/redhatinsights/payload-tracker-go/internal/structs"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
@@ -21,18 +27,75 @@ import (
 
 var (
 	validSortBy         = []string{"created_at", "account", "org_id", "system_id", "inventory_id", "service", "source", "status_msg", "date", "request_id", "status"}
-	validAllSortBy      = []string{"account", "org_id", "inventory_id", "system_id", "created_at"}
-	validIDSortBy       = []string{"service", "source", "status_msg", "date", "created_at"}
+	knownAllSortBy      = []string{"id", "request_id", "account", "org_id", "inventory_id", "system_id", "created_at"}
+	knownIDSortBy       = []string{"service", "source", "status", "status_msg", "date", "created_at"}
 	validStatusesSortBy = []string{"service", "source", "request_id", "status", "status_msg", "date", "created_at"}
 	validSortDir        = []string{"asc", "desc"}
+	validDurationUnits  = []string{"s", "ms"}
+	validVerbosity      = []string{"0", "1", "2"}
+	validFormats        = []string{"json", "csv"}
+	validStatusFields   = []string{"id", "service", "source", "account", "org_id", "request_id", "inventory_id", "system_id", "created_at", "status", "status_msg", "date", "received_at"}
+	validCSVDelimiters  = []string{",", ";", "|", ":", "\t"}
+	validMsgPath        = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
 )
 
+const dateOnlyFormat = "2006-01-02"
+
+// exclusiveParams maps a query parameter to the parameters it can't be used with, each rule is one that
+// would leave the query ambiguous:
+//   - date already sets both created_at bounds for the day
+//   - an exclusive and an inclusive bound on the same side leave open which of the two applies
+var exclusiveParams = []struct {
+	param     string
+	conflicts []string
+}{
+	{"date", []string{"created_at_lt", "created_at_lte", "created_at_gt", "created_at_gte"}},
+	{"created_at_gt", []string{"created_at_gte"}},
+	{"created_at_lt", []string{"created_at_lte"}},
+	{"date_gt", []string{"date_gte"}},
+	{"date_lt", []string{"date_lte"}},
+}
+
+// checkExclusiveParams reports each parameter used together with one it excludes, it returns the parameters
+// in conflict so that they aren't applied
+func checkExclusiveParams(r *http.Request, errs *validationErrors) map[string]bool {
+	conflicting := map[string]bool{}
+	for _, rule := range exclusiveParams {
+		if r.URL.Query().Get(rule.param) == "" {
+			continue
+		}
+		for _, conflict := range rule.conflicts {
+			if r.URL.Query().Get(conflict) != "" {
+				errs.add(rule.param, rule.param+" cannot be combined with "+joinOr(rule.conflicts))
+				conflicting[rule.param] = true
+				break
+			}
+		}
+	}
+	return conflicting
+}
+
+// joinOr lists the values as "a, b or c"
+func joinOr(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return strings.Join(values[:len(values)-1], ", ") + " or " + values[len(values)-1]
+}
+
 // initQuery intializes the query with default values
-func initQuery(r *http.Request) (structs.Query, error) {
+func initQuery(r *http.Request, cfg config.RequestCfg) (structs.Query, validationErrors) {
+
+	pageBase := cfg.PageBase
+	// the hints are checked by ValidateQueryPlanConfig at startup
+	queryHints, _ := parseQueryHints(cfg.PayloadsQueryHints)
 
 	q := structs.Query{
-		Page:         0,
+		Page:         pageBase,
 		PageSize:     10,
+		PageBase:     pageBase,
+		FilterOrder:  cfg.PayloadsFilterOrder,
+		QueryHints:   queryHints,
 		SortBy:       "date",
 		SortDir:      "desc",
 		InventoryID:  r.URL.Query().Get("inventory_id"),
@@ -41,12 +104,13 @@ func initQuery(r *http.Request) (structs.Query, error) {
 		CreatedAtGT:  r.URL.Query().Get("created_at_gt"),
 		CreatedAtLTE: r.URL.Query().Get("created_at_lte"),
 		CreatedAtGTE: r.URL.Query().Get("created_at_gte"),
-		Account:      r.URL.Query().Get("account"),
 		OrgID:        r.URL.Query().Get("org_id"),
 
 		Service:   r.URL.Query().Get("service"),
+		ServiceNE: queryList(r, "service_ne"),
 		Source:    r.URL.Query().Get("source"),
 		Status:    r.URL.Query().Get("status"),
+		StatusNE:  queryList(r, "status_ne"),
 		StatusMsg: r.URL.Query().Get("status_msg"),
 		DateLT:    r.URL.Query().Get("date_lt"),
 		DateLTE:   r.URL.Query().Get("date_lte"),
@@ -54,7 +118,175 @@ func initQuery(r *http.Request) (structs.Query, error) {
 		DateGTE:   r.URL.Query().Get("date_gte"),
 	}
 
-	var err error
+	var errs validationErrors
+	conflicting := checkExclusiveParams(r, &errs)
+
+	// date is shorthand for created_at bounds covering that whole day, in UTC unless tz names another timezone
+	day, tz := r.URL.Query().Get("date"), r.URL.Query().Get("tz")
+	location := time.UTC
+	if tz != "" {
+		if day == "" {
+			errs.add("tz", "tz is only supported with date")
+		} else if err := validateTimezone(tz); err != nil {
+			errs.add("tz", err.Error())
+		} else {
+			location, _ = time.LoadLocation(tz)
+		}
+	}
+	if day != "" && !conflicting["date"] {
+		if start, err := time.ParseInLocation(dateOnlyFormat, day, location); err != nil {
+			errs.add("date", "date must be in YYYY-MM-DD format")
+		} else {
+			// the day is added in its timezone so that a daylight saving change still ends it at midnight
+			q.CreatedAtGTE = start.UTC().Format(time.RFC3339)
+			q.CreatedAtLT = start.AddDate(0, 0, 1).UTC().Format(time.RFC3339)
+		}
+	}
+
+	if value := r.URL.Query().Get("skip_count"); value != "" {
+		var err error
+		if q.SkipCount, err = strconv.ParseBool(value); err != nil {
+			errs.add("skip_count", "skip_count must be true or false")
+		}
+	}
+
+	if value := r.URL.Query().Get("has_message"); value != "" {
+		hasMessage, err := strconv.ParseBool(value)
+		if err != nil {
+			errs.add("has_message", "has_message must be true or false")
+		}
+		q.HasMessage = &hasMessage
+	}
+
+	if value := r.URL.Query().Get("latest_only"); value != "" {
+		var err error
+		if q.LatestOnly, err = strconv.ParseBool(value); err != nil {
+			errs.add("latest_only", "latest_only must be true or false")
+		}
+	}
+
+	if value := r.URL.Query().Get("include_services"); value != "" {
+		var err error
+		if q.IncludeServices, err = strconv.ParseBool(value); err != nil {
+			errs.add("include_services", "include_services must be true or false")
+		}
+	}
+
+	if value := r.URL.Query().Get("business_hours"); value != "" {
+		businessHours, err := strconv.ParseBool(value)
+		if err != nil {
+			errs.add("business_hours", "business_hours must be true or false")
+		}
+		if businessHours {
+			q.BusinessHours = &structs.BusinessHours{Timezone: cfg.BusinessHoursTimezone, Start: cfg.BusinessHoursStart, End: cfg.BusinessHoursEnd}
+			if tz := r.URL.Query().Get("business_hours_tz"); tz != "" {
+				q.BusinessHours.Timezone = tz
+			}
+			if err := validateTimezone(q.BusinessHours.Timezone); err != nil {
+				errs.add("business_hours_tz", err.Error())
+			}
+		}
+	}
+
+	if value := r.URL.Query().Get("include_staleness"); value != "" {
+		var err error
+		if q.IncludeStaleness, err = strconv.ParseBool(value); err != nil {
+			errs.add("include_staleness", "include_staleness must be true or false")
+		}
+	}
+
+	if value := r.URL.Query().Get("human"); value != "" {
+		var err error
+		if q.Human, err = strconv.ParseBool(value); err != nil {
+			errs.add("human", "human must be true or false")
+		}
+	}
+
+	if value := r.URL.Query().Get("include_terminal"); value != "" {
+		includeTerminal, err := strconv.ParseBool(value)
+		if err != nil {
+			errs.add("include_terminal", "include_terminal must be true or false")
+		}
+		if includeTerminal {
+			// an empty set is kept apart from nil so that the rows are still marked, as not terminal
+			q.TerminalStatuses = append([]string{}, cfg.TerminalStatuses...)
+		}
+	}
+
+	if value := r.URL.Query().Get("include_deleted"); value != "" {
+		var err error
+		if q.IncludeDeleted, err = strconv.ParseBool(value); err != nil {
+			errs.add("include_deleted", "include_deleted must be true or false")
+		}
+	}
+
+	if prefix := r.URL.Query().Get("request_id_prefix"); prefix != "" {
+		minPrefix := cfg.MinRequestIDPrefix
+		if len(prefix) < minPrefix {
+			errs.add("request_id_prefix", fmt.Sprintf("request_id_prefix must be at least %d characters", minPrefix))
+		}
+		q.RequestIDPrefix = prefix
+	}
+
+	// msg_path is the dot separated keys, or array indexes, leading to the JSON value in status_msg to compare to msg_value
+	msgPath, msgValue := r.URL.Query().Get("msg_path"), r.URL.Query()["msg_value"]
+	if msgPath != "" || msgValue != nil {
+		if msgPath == "" || msgValue == nil {
+			errs.add("msg_path", "msg_path and msg_value must be given together")
+		} else if !validMsgPath.MatchString(msgPath) {
+			errs.add("msg_path", "msg_path must be dot separated keys of letters, digits, _ or -, such as error.code")
+		} else {
+			q.MsgPath = msgPath
+			q.MsgValue = msgValue[0]
+		}
+	}
+
+	for _, pair := range queryList(r, "service_status") {
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			errs.add("service_status", fmt.Sprintf("service_status must be a comma separated list of service:status pairs, got %s", pair))
+			continue
+		}
+		q.ServiceStatus = append(q.ServiceStatus, structs.ServiceStatus{Service: parts[0], Status: parts[1]})
+	}
+
+	if value := r.URL.Query().Get("account"); value != "" {
+		maxAccounts := cfg.MaxAccounts
+		for _, account := range strings.Split(value, ",") {
+			if account = strings.TrimSpace(account); account == "" {
+				errs.add("account", "account must be a comma separated list without empty elements")
+				break
+			}
+			q.Accounts = append(q.Accounts, account)
+		}
+		if len(q.Accounts) > maxAccounts {
+			errs.add("account", fmt.Sprintf("account must list at most %d accounts, got %d", maxAccounts, len(q.Accounts)))
+		}
+	}
+
+	for _, param := range []string{"account_gt", "account_lt"} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+			errs.add(param, param+" must be a non-negative integer")
+			continue
+		}
+		if param == "account_gt" {
+			q.AccountGT = value
+		} else {
+			q.AccountLT = value
+		}
+	}
+
+	if r.URL.Query().Get("min_statuses") != "" {
+		var err error
+		q.MinStatuses, err = strconv.Atoi(r.URL.Query().Get("min_statuses"))
+		if err != nil || q.MinStatuses <= 0 {
+			errs.add("min_statuses", "min_statuses must be a positive integer")
+		}
+	}
 
 	if r.URL.Query().Get("sort_by") != "" || stringInSlice(r.URL.Query().Get("sort_by"), validSortBy) {
 		q.SortBy = r.URL.Query().Get("sort_by")
@@ -65,20 +297,214 @@ func initQuery(r *http.Request) (structs.Query, error) {
 	}
 
 	if r.URL.Query().Get("page") != "" {
+		var err error
 		q.Page, err = strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil {
+			errs.add("page", "page must be an integer")
+		} else if q.Page < pageBase {
+			errs.add("page", fmt.Sprintf("page must be %d or greater", pageBase))
+		}
 	}
 
 	if r.URL.Query().Get("page_size") != "" {
+		var err error
 		q.PageSize, err = strconv.Atoi(r.URL.Query().Get("page_size"))
+		if err != nil {
+			errs.add("page_size", "page_size must be an integer")
+		} else if q.PageSize < 1 {
+			errs.add("page_size", "page_size must be a positive integer")
+		} else if q.PageSize > cfg.MaxPageSize {
+			errs.add("page_size", fmt.Sprintf("page_size must be at most %d", cfg.MaxPageSize))
+		}
+	}
+
+	return q, errs
+}
+
+// validationErrors collects every invalid parameter of a request so they are all reported in one response
+type validationErrors []structs.FieldError
+
+func (errs *validationErrors) add(field string, message string) {
+	*errs = append(*errs, structs.FieldError{Field: field, Message: message})
+}
+
+func (errs validationErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// writeValidationErrors responds with a 400 listing every invalid parameter, it reports whether there were any
+func writeValidationErrors(w http.ResponseWriter, errs validationErrors) bool {
+	if len(errs) == 0 {
+		return false
+	}
+
+	errBodyJson, _ := json.Marshal(structs.ErrorResponse{
+		Title:   http.StatusText(http.StatusBadRequest),
+		Message: errs.Error(),
+		Status:  http.StatusBadRequest,
+		Errors:  errs,
+	})
+	writeResponse(w, http.StatusBadRequest, string(errBodyJson))
+	return true
+}
+
+// ValidateSortConfig checks that the configured sort_by columns exist for each endpoint
+func ValidateSortConfig(cfg *config.TrackerConfig) error {
+	for _, column := range cfg.RequestConfig.PayloadsSortBy {
+		if !stringInSlice(column, knownAllSortBy) {
+			return fmt.Errorf("%s is not a sortable /payloads column, must be one of %s", column, strings.Join(knownAllSortBy, ", "))
+		}
+	}
+	for _, column := range cfg.RequestConfig.RequestIDSortBy {
+		if !stringInSlice(column, knownIDSortBy) {
+			return fmt.Errorf("%s is not a sortable /payloads/{request_id} column, must be one of %s", column, strings.Join(knownIDSortBy, ", "))
+		}
+	}
+	return nil
+}
+
+// ValidateVerbosityConfig checks that the configured default verbosity is one of the levels
+func ValidateVerbosityConfig(cfg *config.TrackerConfig) error {
+	if !stringInSlice(cfg.RequestConfig.DefaultVerbosity, validVerbosity) {
+		return fmt.Errorf("%s is not a verbosity level, must be one of %s", cfg.RequestConfig.DefaultVerbosity, strings.Join(validVerbosity, ", "))
+	}
+	return nil
+}
+
+// ValidateQueryPlanConfig checks that the configured filter order and query hints only name known filters
+func ValidateQueryPlanConfig(cfg *config.TrackerConfig) error {
+	seen := map[string]bool{}
+	for _, filter := range cfg.RequestConfig.PayloadsFilterOrder {
+		if !stringInSlice(filter, queries.PayloadFilters) {
+			return fmt.Errorf("%s is not a /payloads filter that can be ordered, must be one of %s", filter, strings.Join(queries.PayloadFilters, ", "))
+		}
+		if seen[filter] {
+			return fmt.Errorf("%s is listed more than once in the filter order", filter)
+		}
+		seen[filter] = true
+	}
+	_, err := parseQueryHints(cfg.RequestConfig.PayloadsQueryHints)
+	return err
+}
+
+// parseQueryHints reads filter+filter=hint entries into hints keyed by the combination of filters
+func parseQueryHints(entries []string) (map[string]string, error) {
+	hints := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("query hint %q must be in the form filter+filter=hint", entry)
+		}
+		filters := strings.Split(strings.TrimSpace(parts[0]), "+")
+		for _, filter := range filters {
+			if !stringInSlice(filter, queries.HintFilters) {
+				return nil, fmt.Errorf("query hint %q names unknown filter %s, must be one of %s", entry, filter, strings.Join(queries.HintFilters, ", "))
+			}
+		}
+		hints[queries.QueryHintKey(filters)] = strings.TrimSpace(parts[1])
+	}
+	return hints, nil
+}
+
+// ValidateBusinessHoursConfig checks the default timezone and that the hours make a range within a day
+func ValidateBusinessHoursConfig(cfg *config.TrackerConfig) error {
+	if err := validateTimezone(cfg.RequestConfig.BusinessHoursTimezone); err != nil {
+		return err
+	}
+	start, end := cfg.RequestConfig.BusinessHoursStart, cfg.RequestConfig.BusinessHoursEnd
+	if start < 0 || end > 24 || start >= end {
+		return fmt.Errorf("business hours must be a range within 0 to 24, got %d to %d", start, end)
+	}
+	return nil
+}
+
+// validateTimezone accepts the IANA zone names that postgres also knows, Local would be the server's own zone
+func validateTimezone(tz string) error {
+	if tz == "" || tz == "Local" {
+		return fmt.Errorf("%q is not a timezone, use an IANA name such as America/New_York", tz)
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return fmt.Errorf("%s is not a known timezone", tz)
 	}
+	return nil
+}
+
+// queryList splits a comma separated query parameter, dropping any empty entries
+func queryList(r *http.Request, name string) []string {
+	var list []string
+	for _, item := range strings.Split(r.URL.Query().Get(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
 
-	return q, err
+// projectFields keeps only the given json fields of each status
+func projectFields(statuses []structs.SinglePayloadData, fields []string) ([]map[string]interface{}, error) {
+	projected := make([]map[string]interface{}, 0, len(statuses))
+	for _, status := range statuses {
+		statusJson, err := json.Marshal(status)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]interface{}
+		if err := json.Unmarshal(statusJson, &all); err != nil {
+			return nil, err
+		}
+
+		selected := make(map[string]interface{})
+		for _, field := range fields {
+			if value, ok := all[field]; ok {
+				selected[field] = value
+			}
+		}
+		projected = append(projected, selected)
+	}
+	return projected, nil
 }
 
 func getDb() *gorm.DB {
 	return db.DB
 }
 
+func getReadDb() *gorm.DB {
+	return db.ReadDB
+}
+
+// requestReadDb returns the read DB bound to the request's context, and a function reporting whether
+// postgres cancelled any of the request's queries for running past the statement timeout
+func requestReadDb(r *http.Request) (*gorm.DB, func() bool) {
+	ctx, timedOut := db.TrackStatementTimeouts(r.Context())
+	dbQuery := ReadDb()
+	if dbQuery != nil {
+		dbQuery = dbQuery.WithContext(ctx)
+	}
+	return traceQueries(r, dbQuery), timedOut
+}
+
+// ValidateSamplingConfig checks that the trace sample rate is a fraction of the requests
+func ValidateSamplingConfig(cfg *config.TrackerConfig) error {
+	if rate := cfg.RequestConfig.TraceSampleRate; rate < 0 || rate > 1 {
+		return fmt.Errorf("trace sample rate must be from 0.0 to 1.0, got %v", rate)
+	}
+	return nil
+}
+
+// writeStatementTimeout responds with a 503 when a query was cancelled by the statement timeout,
+// returning whether it did
+func writeStatementTimeout(w http.ResponseWriter, timedOut func() bool) bool {
+	if !timedOut() {
+		return false
+	}
+	writeResponse(w, http.StatusServiceUnavailable, getErrorBody("The query took too long, narrow the filters or retry later", http.StatusServiceUnavailable))
+	return true
+}
+
 func getErrorBody(message string, status int) string {
 	errBody := structs.ErrorResponse{
 		Title:   http.StatusText(status),
@@ -101,21 +527,37 @@ func stringInSlice(a string, list []string) bool {
 }
 
 // Check timestamp format
-func validTimestamps(q structs.Query, all bool) bool {
-	timestampQueries := []string{q.CreatedAtLT, q.CreatedAtGT, q.CreatedAtLTE, q.CreatedAtGTE, q.DateLT, q.DateGT, q.DateLTE, q.DateGTE}
-
-	if !all {
-		timestampQueries = []string{q.CreatedAtLT, q.CreatedAtGT, q.CreatedAtLTE, q.CreatedAtGTE}
+func validateTimestamps(errs *validationErrors, q structs.Query, all bool) {
+	type timestampQuery struct{ field, value string }
+	timestampQueries := []timestampQuery{
+		{"created_at_lt", q.CreatedAtLT}, {"created_at_gt", q.CreatedAtGT}, {"created_at_lte", q.CreatedAtLTE}, {"created_at_gte", q.CreatedAtGTE},
+	}
+	if all {
+		timestampQueries = append(timestampQueries, []timestampQuery{
+			{"date_lt", q.DateLT}, {"date_gt", q.DateGT}, {"date_lte", q.DateLTE}, {"date_gte", q.DateGTE},
+		}...)
 	}
 
 	for _, ts := range timestampQueries {
-		if ts != "" {
-			_, err := time.Parse(time.RFC3339, ts)
-			if err != nil {
-				return false
+		if ts.value != "" {
+			if _, err := time.Parse(time.RFC3339, ts.value); err != nil {
+				errs.add(ts.field, ts.field+" must be an RFC3339 timestamp")
 			}
 		}
 	}
+}
+
+// checkDeletedAccess responds with an error unless the soft deleted payloads asked for with include_deleted=true
+// are requested by an admin, it reports whether the request can go ahead
+func checkDeletedAccess(w http.ResponseWriter, r *http.Request, q structs.Query, adminRole string) bool {
+	if !q.IncludeDeleted {
+		return true
+	}
+	statusCode, err := checkForRole(r, adminRole)
+	if err != nil {
+		writeResponse(w, statusCode, getErrorBody(fmt.Sprintf("include_deleted requires the admin role: %v", err), statusCode))
+		return false
+	}
 	return true
 }
 
@@ -161,22 +603,89 @@ func checkForRole(r *http.Request, role string) (int, error) {
 	return http.StatusOK, nil
 }
 
+// identityFields returns the user and org of the identity header for logging who made a request, the
+// header itself is left out of the logs since it is the caller's whole identity document
+func identityFields(r *http.Request) logrus.Fields {
+	var identityHeaderData struct {
+		Identity struct {
+			Associate struct {
+				Email string `json:"email"`
+			} `json:"associate"`
+			User struct {
+				Username string `json:"username"`
+			} `json:"user"`
+		} `json:"identity"`
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(r.Header.Get("x-rh-identity")); err == nil {
+		json.Unmarshal(decoded, &identityHeaderData)
+	}
+
+	user := identityHeaderData.Identity.User.Username
+	if user == "" {
+		user = identityHeaderData.Identity.Associate.Email
+	}
+	return logrus.Fields{"user": user, "org_id": identityOrgID(r)}
+}
+
+// checkArchiveAccess checks for the archive link role and, while archive links are limited to some orgs,
+// that the org of the identity header is one of them
+func checkArchiveAccess(r *http.Request, cfg config.TrackerConfig) (int, error) {
+	if statusCode, err := checkForRole(r, cfg.StorageBrokerURLRole); err != nil {
+		return statusCode, err
+	}
+
+	if len(cfg.StorageBrokerAllowedOrgs) > 0 {
+		orgID := identityOrgID(r)
+		if !stringInSlice(orgID, cfg.StorageBrokerAllowedOrgs) {
+			l.Log.WithFields(logrus.Fields{"org_id": orgID, "path": r.URL.Path}).Info("Denied archive access to an org outside the allowed orgs")
+			return http.StatusForbidden, errors.New("Archive downloads are not available to your org yet")
+		}
+	}
+
+	return http.StatusOK, nil
+}
+
 // Write HTTP Response
 func writeResponse(w http.ResponseWriter, status int, message string) {
-	w.Header().Set("Content-Type", "application/json")
+	writeTypedResponse(w, status, "application/json", message)
+}
+
+// writeTypedResponse is writeResponse for JSON bodies served under another media type
+func writeTypedResponse(w http.ResponseWriter, status int, contentType string, message string) {
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(status)
 	w.Write([]byte(message))
 }
 
-// Send a request for an ArchiveLink to storage-broker
-func RequestArchiveLink(baseUrl string, timeout int) func(ctx context.Context, reqID string) (*structs.PayloadArchiveLink, error) {
+// writeLimitedResponse writes the rows of a listing, refusing them when they are over maxBytes rather
+// than building them up on both ends, a maxBytes of 0 serves them whatever their size
+func writeLimitedResponse(w http.ResponseWriter, maxBytes int, contentType string, message string) {
+	if maxBytes > 0 && len(message) > maxBytes {
+		l.Log.WithFields(logrus.Fields{"size": len(message), "limit": maxBytes}).Warn("Refusing response over the max response size")
+		writeResponse(w, http.StatusBadRequest, getErrorBody("Response is too large, narrow the filters or reduce page_size", http.StatusBadRequest))
+		return
+	}
+	writeTypedResponse(w, http.StatusOK, contentType, message)
+}
+
+// Send a request for an ArchiveLink to storage-broker, with the request id as the requestParam query parameter
+func RequestArchiveLink(baseUrl string, timeout int, requestParam string) func(ctx context.Context, reqID string) (*structs.PayloadArchiveLink, error) {
 
 	return func(ctx context.Context, reqID string) (*structs.PayloadArchiveLink, error) {
 		client := http.Client{
 			Timeout: time.Duration(timeout) * time.Millisecond,
 		}
 
-		response, err := client.Get(baseUrl + "?request_id=" + reqID)
+		// the request id is encoded into the query so that it can't change the rest of the url
+		archiveUrl, err := url.Parse(baseUrl)
+		if err != nil {
+			return nil, err
+		}
+		query := archiveUrl.Query()
+		query.Set(requestParam, reqID)
+		archiveUrl.RawQuery = query.Encode()
+
+		response, err := client.Get(archiveUrl.String())
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,85 @@
+package endpoints
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+)
+
+const websocketWriteTimeout = 10 * time.Second
+
+var upgrader = websocket.Upgrader{}
+
+// StatusesWebSocket returns a handler for /ws/statuses, sending every new status as a JSON message.
+// The service and status query params given when connecting filter the statuses sent.
+func StatusesWebSocket(cfg config.TrackerConfig, events *StatusEvents, heartbeat time.Duration) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		statusCode, err := checkForRole(r, cfg.StatusStreamRole)
+		if err != nil {
+			writeResponse(w, statusCode, getErrorBody(fmt.Sprintf("%v", err), statusCode))
+			return
+		}
+
+		service := r.URL.Query().Get("service")
+		status := r.URL.Query().Get("status")
+
+		// subscribe before upgrading so statuses written once the client is connected are not missed
+		statuses, unsubscribe := events.SubscribeAll()
+		defer unsubscribe()
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// the upgrader has already responded with the error
+			l.Log.Debug("WebSocket upgrade failed: ", err)
+			return
+		}
+		defer conn.Close()
+
+		// the client has to answer each ping before the next one, replacing the server read timeout
+		conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * heartbeat))
+		})
+
+		// nothing is expected from the client, reading only notices it going away
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-closed:
+				return
+			case event := <-statuses:
+				if (service != "" && event.Service != service) || (status != "" && event.Status != status) {
+					continue
+				}
+				conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+				if err := conn.WriteJSON(event); err != nil {
+					l.Log.Debug("WebSocket write failed: ", err)
+					return
+				}
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(websocketWriteTimeout)); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package endpoints_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+)
+
+var _ = Describe("StatusesWebSocket", func() {
+	var (
+		events *endpoints.StatusEvents
+		server *httptest.Server
+		url    string
+	)
+
+	BeforeEach(func() {
+		events = endpoints.NewStatusEvents()
+		server = httptest.NewServer(endpoints.StatusesWebSocket(*config.Get(), events, time.Second))
+		url = "ws" + strings.TrimPrefix(server.URL, "http")
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	dial := func(url string, identity string) (*websocket.Conn, *http.Response, error) {
+		header := http.Header{}
+		header.Set("x-rh-identity", identity)
+		return websocket.DefaultDialer.Dial(url, header)
+	}
+
+	It("Should return 403 without the required role", func() {
+		_, resp, err := dial(url, validIdentityHeader)
+		Expect(err).To(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+	})
+
+	It("Should send the statuses matching the filters", func() {
+		conn, _, err := dial(url+"?service=puptoo", adminIdentityHeader)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		events.Publish(structs.SinglePayloadData{RequestID: "skipped", Service: "ingress", Status: "received"})
+		events.Publish(structs.SinglePayloadData{RequestID: "sent", Service: "puptoo", Status: "success"})
+
+		var status structs.SinglePayloadData
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		Expect(conn.ReadJSON(&status)).To(Succeed())
+		Expect(status.RequestID).To(Equal("sent"))
+		Expect(status.Status).To(Equal("success"))
+	})
+})
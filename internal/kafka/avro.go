@@ -0,0 +1,402 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	config "github.com/redhatinsights/payload-tracker-go/internal/config"
+)
+
+var avroPrimitives = []string{"null", "boolean", "int", "long", "float", "double", "bytes", "string"}
+
+var errShortAvro = errors.New("avro message is shorter than its schema")
+
+// avroSchema is the part of an avro schema needed to decode a message
+type avroSchema struct {
+	Type        string
+	Name        string
+	LogicalType string
+	Fields      []avroField
+	Items       *avroSchema
+	Values      *avroSchema
+	Symbols     []string
+	Size        int
+	Branches    []*avroSchema // the types of a union
+}
+
+type avroField struct {
+	Name   string
+	Schema *avroSchema
+}
+
+func parseAvroSchema(raw []byte) (*avroSchema, error) {
+	var definition interface{}
+	if err := json.Unmarshal(raw, &definition); err != nil {
+		return nil, err
+	}
+	return resolveAvroSchema(definition, "", map[string]*avroSchema{})
+}
+
+// resolveAvroSchema walks a schema definition, named types are recorded so that later fields can refer to them
+func resolveAvroSchema(definition interface{}, namespace string, named map[string]*avroSchema) (*avroSchema, error) {
+	switch d := definition.(type) {
+	case string:
+		if isAvroPrimitive(d) {
+			return &avroSchema{Type: d}, nil
+		}
+		if s, ok := named[d]; ok {
+			return s, nil
+		}
+		if s, ok := named[namespace+"."+d]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unknown avro type %q", d)
+	case []interface{}:
+		union := &avroSchema{Type: "union"}
+		for _, branch := range d {
+			s, err := resolveAvroSchema(branch, namespace, named)
+			if err != nil {
+				return nil, err
+			}
+			union.Branches = append(union.Branches, s)
+		}
+		return union, nil
+	case map[string]interface{}:
+		return resolveAvroObject(d, namespace, named)
+	}
+	return nil, fmt.Errorf("invalid avro schema: %v", definition)
+}
+
+func resolveAvroObject(d map[string]interface{}, namespace string, named map[string]*avroSchema) (*avroSchema, error) {
+	typeName, ok := d["type"].(string)
+	if !ok {
+		// {"type": [...]} or {"type": {...}} only wraps another schema
+		return resolveAvroSchema(d["type"], namespace, named)
+	}
+
+	s := &avroSchema{Type: typeName}
+	s.LogicalType, _ = d["logicalType"].(string)
+
+	switch typeName {
+	case "record", "error", "enum", "fixed":
+		s.Name, _ = d["name"].(string)
+		if ns, ok := d["namespace"].(string); ok {
+			namespace = ns
+		}
+		if dot := strings.LastIndex(s.Name, "."); dot >= 0 {
+			namespace, s.Name = s.Name[:dot], s.Name[dot+1:]
+		}
+		named[s.Name] = s
+		if namespace != "" {
+			named[namespace+"."+s.Name] = s
+		}
+	}
+
+	switch typeName {
+	case "record", "error":
+		s.Type = "record"
+		fields, _ := d["fields"].([]interface{})
+		for _, f := range fields {
+			field, _ := f.(map[string]interface{})
+			name, _ := field["name"].(string)
+			fieldSchema, err := resolveAvroSchema(field["type"], namespace, named)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %v", name, err)
+			}
+			s.Fields = append(s.Fields, avroField{Name: name, Schema: fieldSchema})
+		}
+	case "enum":
+		symbols, _ := d["symbols"].([]interface{})
+		for _, symbol := range symbols {
+			name, _ := symbol.(string)
+			s.Symbols = append(s.Symbols, name)
+		}
+	case "fixed":
+		size, _ := d["size"].(float64)
+		s.Size = int(size)
+	case "array":
+		items, err := resolveAvroSchema(d["items"], namespace, named)
+		if err != nil {
+			return nil, err
+		}
+		s.Items = items
+	case "map":
+		values, err := resolveAvroSchema(d["values"], namespace, named)
+		if err != nil {
+			return nil, err
+		}
+		s.Values = values
+	default:
+		if !isAvroPrimitive(typeName) {
+			return resolveAvroSchema(typeName, namespace, named)
+		}
+	}
+
+	return s, nil
+}
+
+func isAvroPrimitive(typeName string) bool {
+	for _, primitive := range avroPrimitives {
+		if typeName == primitive {
+			return true
+		}
+	}
+	return false
+}
+
+// avroReader decodes the avro binary encoding
+type avroReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *avroReader) next(n int) ([]byte, error) {
+	if n < 0 || n > len(r.buf)-r.pos {
+		return nil, errShortAvro
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// long reads a zig-zag encoded variable length int or long
+func (r *avroReader) long() (int64, error) {
+	var u uint64
+	for shift := uint(0); ; shift += 7 {
+		if shift > 63 {
+			return 0, errors.New("avro varint overflows a long")
+		}
+		b, err := r.next(1)
+		if err != nil {
+			return 0, err
+		}
+		u |= uint64(b[0]&0x7f) << shift
+		if b[0]&0x80 == 0 {
+			break
+		}
+	}
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+func (r *avroReader) bytes() ([]byte, error) {
+	n, err := r.long()
+	if err != nil {
+		return nil, err
+	}
+	if n > int64(len(r.buf)) {
+		return nil, errShortAvro
+	}
+	return r.next(int(n))
+}
+
+// blocks reads the items of an array or a map, which are written as blocks ended by an empty one
+func (r *avroReader) blocks(item func() error) error {
+	for {
+		count, err := r.long()
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return nil
+		}
+		if count < 0 {
+			// a negative count is followed by the size of the block, which is only needed to skip it
+			count = -count
+			if _, err := r.long(); err != nil {
+				return err
+			}
+		}
+		for i := int64(0); i < count; i++ {
+			if err := item(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// decode reads a value of the schema into the types encoding/json marshals it from,
+// timestamps become RFC3339 strings so the message parses the same as a JSON one
+func (r *avroReader) decode(s *avroSchema) (interface{}, error) {
+	switch s.Type {
+	case "null":
+		return nil, nil
+	case "boolean":
+		b, err := r.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case "int", "long":
+		v, err := r.long()
+		if err != nil {
+			return nil, err
+		}
+		switch s.LogicalType {
+		case "timestamp-millis":
+			return time.Unix(0, v*int64(time.Millisecond)).UTC().Format(time.RFC3339Nano), nil
+		case "timestamp-micros":
+			return time.Unix(0, v*int64(time.Microsecond)).UTC().Format(time.RFC3339Nano), nil
+		}
+		return v, nil
+	case "float":
+		b, err := r.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(b)), nil
+	case "double":
+		b, err := r.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case "bytes":
+		return r.bytes()
+	case "string":
+		b, err := r.bytes()
+		return string(b), err
+	case "fixed":
+		return r.next(s.Size)
+	case "enum":
+		i, err := r.long()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= int64(len(s.Symbols)) {
+			return nil, fmt.Errorf("avro enum %s has no symbol %d", s.Name, i)
+		}
+		return s.Symbols[i], nil
+	case "union":
+		i, err := r.long()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= int64(len(s.Branches)) {
+			return nil, fmt.Errorf("avro union has no branch %d", i)
+		}
+		return r.decode(s.Branches[i])
+	case "record":
+		record := make(map[string]interface{}, len(s.Fields))
+		for _, field := range s.Fields {
+			v, err := r.decode(field.Schema)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %v", field.Name, err)
+			}
+			record[field.Name] = v
+		}
+		return record, nil
+	case "array":
+		items := []interface{}{}
+		err := r.blocks(func() error {
+			v, err := r.decode(s.Items)
+			items = append(items, v)
+			return err
+		})
+		return items, err
+	case "map":
+		values := map[string]interface{}{}
+		err := r.blocks(func() error {
+			key, err := r.bytes()
+			if err != nil {
+				return err
+			}
+			v, err := r.decode(s.Values)
+			values[string(key)] = v
+			return err
+		})
+		return values, err
+	}
+	return nil, fmt.Errorf("unsupported avro type %q", s.Type)
+}
+
+// schemaRegistry resolves the writer schemas of avro messages, schemas never change for an id so they are kept for good
+type schemaRegistry struct {
+	url     string
+	client  *http.Client
+	mu      sync.Mutex
+	schemas map[uint32]*avroSchema
+}
+
+func newSchemaRegistry(url string, timeout time.Duration) *schemaRegistry {
+	return &schemaRegistry{
+		url:     strings.TrimSuffix(url, "/"),
+		client:  &http.Client{Timeout: timeout},
+		schemas: map[uint32]*avroSchema{},
+	}
+}
+
+func (r *schemaRegistry) schema(id uint32) (*avroSchema, error) {
+	r.mu.Lock()
+	schema, ok := r.schemas[id]
+	r.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	resp, err := r.client.Get(fmt.Sprintf("%s/schemas/ids/%d", r.url, id))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("schema registry returned %d for schema %d", resp.StatusCode, id)
+	}
+
+	var body struct {
+		Schema string `json:"schema"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	schema, err = parseAvroSchema([]byte(body.Schema))
+	if err != nil {
+		return nil, fmt.Errorf("schema %d: %v", id, err)
+	}
+
+	r.mu.Lock()
+	r.schemas[id] = schema
+	r.mu.Unlock()
+
+	return schema, nil
+}
+
+// avroDecoder converts messages in the schema registry wire format, a zero magic byte and the big endian
+// schema id followed by the avro encoded message, into the JSON that the handler parses
+func avroDecoder(registry *schemaRegistry) func([]byte) ([]byte, error) {
+	return func(value []byte) ([]byte, error) {
+		if len(value) < 5 || value[0] != 0 {
+			return nil, errors.New("message is not in the schema registry wire format")
+		}
+
+		schema, err := registry.schema(binary.BigEndian.Uint32(value[1:5]))
+		if err != nil {
+			return nil, err
+		}
+
+		reader := &avroReader{buf: value[5:]}
+		decoded, err := reader.decode(schema)
+		if err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(decoded)
+	}
+}
+
+// newMessageDecoder returns the decoder for the configured message format, JSON messages don't need one
+func newMessageDecoder(cfg *config.TrackerConfig) func([]byte) ([]byte, error) {
+	if cfg.KafkaConfig.KafkaMessageFormat != "avro" {
+		return nil
+	}
+	timeout := time.Duration(cfg.KafkaConfig.KafkaTimeout) * time.Millisecond
+	return avroDecoder(newSchemaRegistry(cfg.KafkaConfig.KafkaSchemaRegistryURL, timeout))
+}
@@ -0,0 +1,145 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	k "github.com/confluentinc/confluent-kafka-go/kafka"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	"github.com/redhatinsights/payload-tracker-go/internal/models/message"
+)
+
+const statusSchema = `{
+	"type": "record",
+	"name": "PayloadStatus",
+	"namespace": "com.redhat.cloud",
+	"fields": [
+		{"name": "service", "type": "string"},
+		{"name": "request_id", "type": "string"},
+		{"name": "org_id", "type": ["null", "string"], "default": null},
+		{"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["received", "processing", "success"]}},
+		{"name": "date", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "tags", "type": {"type": "map", "values": "string"}}
+	]
+}`
+
+func avroLong(v int64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutVarint(buf, v)]
+}
+
+func avroString(s string) []byte {
+	return append(avroLong(int64(len(s))), s...)
+}
+
+func avroMessage(schemaID uint32, body ...[]byte) []byte {
+	value := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(value[1:], schemaID)
+	for _, b := range body {
+		value = append(value, b...)
+	}
+	return value
+}
+
+var _ = Describe("Kafka avro messages", func() {
+	var (
+		registry       *httptest.Server
+		registryHits   int
+		date           time.Time
+		validAvroValue []byte
+	)
+
+	BeforeEach(func() {
+		registryHits = 0
+		registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			registryHits++
+			if r.URL.Path != "/schemas/ids/7" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"schema": statusSchema})
+		}))
+
+		date = time.Date(2022, 6, 7, 11, 0, 10, 356000000, time.UTC)
+		validAvroValue = avroMessage(7,
+			avroString("puptoo"),
+			avroString("e4b3d38f199f4abdb1cfbcf6e3b81f56"),
+			avroLong(1), avroString("000001"),
+			avroLong(2),
+			avroLong(date.UnixNano()/int64(time.Millisecond)),
+			avroLong(1), avroString("source"), avroString("test"), avroLong(0),
+		)
+	})
+
+	AfterEach(func() {
+		registry.Close()
+	})
+
+	It("Decodes into a payload status message", func() {
+		decode := avroDecoder(newSchemaRegistry(registry.URL, time.Second))
+
+		value, err := decode(validAvroValue)
+		Expect(err).ToNot(HaveOccurred())
+
+		payloadStatus := &message.PayloadStatusMessage{}
+		Expect(json.Unmarshal(value, payloadStatus)).To(Succeed())
+		Expect(payloadStatus.Service).To(Equal("puptoo"))
+		Expect(payloadStatus.RequestID).To(Equal("e4b3d38f199f4abdb1cfbcf6e3b81f56"))
+		Expect(payloadStatus.OrgID).To(Equal("000001"))
+		Expect(payloadStatus.Status).To(Equal("success"))
+		Expect(payloadStatus.Date.Time.Equal(date)).To(BeTrue())
+	})
+
+	It("Caches schemas by id", func() {
+		decode := avroDecoder(newSchemaRegistry(registry.URL, time.Second))
+
+		for i := 0; i < 3; i++ {
+			_, err := decode(validAvroValue)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(registryHits).To(Equal(1))
+	})
+
+	It("Fails for messages without the wire format header", func() {
+		decode := avroDecoder(newSchemaRegistry(registry.URL, time.Second))
+
+		_, err := decode([]byte(`{"service": "puptoo"}`))
+		Expect(err).To(HaveOccurred())
+		Expect(registryHits).To(Equal(0))
+	})
+
+	It("Fails for unknown schemas and truncated messages", func() {
+		decode := avroDecoder(newSchemaRegistry(registry.URL, time.Second))
+
+		_, err := decode(avroMessage(8, avroString("puptoo")))
+		Expect(err).To(HaveOccurred())
+
+		_, err = decode(validAvroValue[:len(validAvroValue)-4])
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Are not processed when they fail to decode", func() {
+		topic := "topic.payload.status"
+		msg := &k.Message{
+			Value:          []byte("not avro"),
+			TopicPartition: k.TopicPartition{Topic: &topic},
+		}
+
+		msgHandler := handler{decode: avroDecoder(newSchemaRegistry(registry.URL, time.Second))}
+		Expect(msgHandler.onMessage(context.Background(), msg, config.Get())).ToNot(Succeed())
+	})
+
+	It("Need a schema registry", func() {
+		Expect(validateMessageFormat("json", "")).To(Succeed())
+		Expect(validateMessageFormat("avro", registry.URL)).To(Succeed())
+		Expect(validateMessageFormat("avro", "")).ToNot(Succeed())
+		Expect(validateMessageFormat("protobuf", registry.URL)).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,70 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+type polledMessage struct {
+	next      kafka.Offset // the offset of the next message that hasn't been processed
+	timestamp time.Time
+}
+
+// backlogAge tracks how far behind the consumer is in time. A partition is behind while its high watermark is past
+// the next offset to process, and the oldest message it hasn't processed is no older than the last one polled from it,
+// so the age of that message is taken as the age of the backlog.
+type backlogAge struct {
+	polled map[partitionKey]polledMessage
+}
+
+func newBacklogAge() *backlogAge {
+	return &backlogAge{polled: map[partitionKey]polledMessage{}}
+}
+
+// observe records a polled message, processed says whether the consumer moved past it or will be served it again
+func (b *backlogAge) observe(msg *kafka.Message, processed bool) {
+	if msg.TopicPartition.Topic == nil || msg.Timestamp.IsZero() {
+		return
+	}
+
+	next := msg.TopicPartition.Offset
+	if processed {
+		next++
+	}
+	key := partitionKey{*msg.TopicPartition.Topic, msg.TopicPartition.Partition}
+	b.polled[key] = polledMessage{next: next, timestamp: msg.Timestamp}
+}
+
+// age returns the age of the oldest unprocessed message across the assigned partitions, partitions that are no
+// longer assigned are forgotten
+func (b *backlogAge) age(now time.Time, assigned []kafka.TopicPartition, highWatermark func(string, int32) (int64, error)) time.Duration {
+	current := map[partitionKey]bool{}
+	for _, tp := range assigned {
+		if tp.Topic != nil {
+			current[partitionKey{*tp.Topic, tp.Partition}] = true
+		}
+	}
+
+	var oldest time.Duration
+	for key, polled := range b.polled {
+		if !current[key] {
+			delete(b.polled, key)
+			continue
+		}
+
+		high, err := highWatermark(key.topic, key.partition)
+		if err != nil || int64(polled.next) >= high {
+			continue
+		}
+		if age := now.Sub(polled.timestamp); age > oldest {
+			oldest = age
+		}
+	}
+	return oldest
+}
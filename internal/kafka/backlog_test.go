@@ -0,0 +1,70 @@
+package kafka
+
+import (
+	"errors"
+	"time"
+
+	k "github.com/confluentinc/confluent-kafka-go/kafka"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Kafka backlog age", func() {
+	var (
+		topic    string
+		now      time.Time
+		high     map[int32]int64
+		assigned []k.TopicPartition
+	)
+
+	polled := func(partition int32, offset k.Offset, age time.Duration) *k.Message {
+		return &k.Message{
+			TopicPartition: k.TopicPartition{Topic: &topic, Partition: partition, Offset: offset},
+			Timestamp:      now.Add(-age),
+		}
+	}
+
+	highWatermark := func(_ string, partition int32) (int64, error) {
+		if offset, ok := high[partition]; ok {
+			return offset, nil
+		}
+		return 0, errors.New("no watermark")
+	}
+
+	BeforeEach(func() {
+		topic = "platform.payload-status"
+		now = time.Now()
+		high = map[int32]int64{0: 10, 1: 10}
+		assigned = []k.TopicPartition{{Topic: &topic, Partition: 0}, {Topic: &topic, Partition: 1}}
+	})
+
+	It("Is the age of the oldest message on a partition that is behind", func() {
+		backlog := newBacklogAge()
+		backlog.observe(polled(0, 4, time.Minute), true)
+		backlog.observe(polled(1, 7, 2*time.Minute), true)
+
+		Expect(backlog.age(now, assigned, highWatermark)).To(Equal(2 * time.Minute))
+	})
+
+	It("Is 0 once every partition is caught up", func() {
+		backlog := newBacklogAge()
+		backlog.observe(polled(0, 9, time.Minute), true)
+
+		Expect(backlog.age(now, assigned, highWatermark)).To(BeZero())
+	})
+
+	It("Counts a message rewound while paused as unprocessed", func() {
+		backlog := newBacklogAge()
+		backlog.observe(polled(0, 9, time.Minute), false)
+
+		Expect(backlog.age(now, assigned, highWatermark)).To(Equal(time.Minute))
+	})
+
+	It("Forgets partitions that are no longer assigned", func() {
+		backlog := newBacklogAge()
+		backlog.observe(polled(1, 2, time.Hour), true)
+
+		Expect(backlog.age(now, assigned[:1], highWatermark)).To(BeZero())
+		Expect(backlog.age(now, assigned, highWatermark)).To(BeZero())
+	})
+})
@@ -3,10 +3,12 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 
 	"github.com/redhatinsights/payload-tracker-go/internal/config"
@@ -15,64 +17,133 @@ import (
 	models "github.com/redhatinsights/payload-tracker-go/internal/models/db"
 	"github.com/redhatinsights/payload-tracker-go/internal/models/message"
 	"github.com/redhatinsights/payload-tracker-go/internal/queries"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
 )
 
 var (
 	tableNames = []string{"service", "source", "status"}
 )
 
+const orgIDHeader = "org_id"
+
 type handler struct {
-	db *gorm.DB
+	db       *gorm.DB
+	producer *kafka.Producer
+	// decode converts messages that aren't JSON, it is nil for JSON messages
+	decode func([]byte) ([]byte, error)
+	// prefetch is nil unless archive links are prefetched
+	prefetch *archivePrefetcher
+	// confirmDeadLetters waits for each dead letter to be delivered rather than only queued
+	confirmDeadLetters bool
 }
 
+// outcomes of handling a message, as labelled on the processing time
+const (
+	outcomeSuccess         = "success"
+	outcomeValidationError = "validation-error"
+	outcomeDBError         = "db-error"
+)
+
 // OnMessage takes in each payload status message and processes it
-func (this *handler) onMessage(ctx context.Context, msg *kafka.Message, cfg *config.TrackerConfig) {
+func (this *handler) onMessage(ctx context.Context, msg *kafka.Message, cfg *config.TrackerConfig) error {
+	start := time.Now()
+	outcome, err := this.processMessage(ctx, msg, cfg)
+	endpoints.ObserveMessageProcessingTime(outcome, time.Since(start))
+	return err
+}
+
+// processMessage parses, validates and inserts the status, it returns the outcome of the message along with any error
+func (this *handler) processMessage(ctx context.Context, msg *kafka.Message, cfg *config.TrackerConfig) (string, error) {
 	// Track the time from beginning of handling the message to the insert
 	start := time.Now()
-	l.Log.Debug("Processing Payload Message ", msg.Value)
+	log := messageLogger(msg)
+	// compacted topics delete keys with a null value, there is no status to record
+	if msg.Value == nil {
+		log.Debug("Skipping tombstone message")
+		endpoints.IncSkippedTombstones()
+		return outcomeSuccess, nil
+	}
+
+	log.Debug("Processing Payload Message ", msg.Value)
 
 	payloadStatus := &message.PayloadStatusMessage{}
 	sanitizedPayloadStatus := &models.PayloadStatuses{}
 
-	if err := json.Unmarshal(msg.Value, payloadStatus); err != nil {
+	value := msg.Value
+	if this.decode != nil {
+		decoded, err := this.decode(msg.Value)
+		if err != nil {
+			log.Error("ERROR: Decoding Payload Status Event: ", err)
+			return outcomeValidationError, this.deadLetter(msg, cfg, "decode", err)
+		}
+		value = decoded
+	}
+
+	// producers naming fields differently are mapped onto the message fields before anything is validated
+	mapped, err := mapFields(value, cfg.KafkaConfig.KafkaFieldMapping)
+	if err != nil {
+		log.Error("ERROR: Mapping Payload Status Event fields: ", err)
+		return outcomeValidationError, this.deadLetter(msg, cfg, "validation", err)
+	}
+	value = mapped
+
+	if err := json.Unmarshal(value, payloadStatus); err != nil {
 		// PROBE: Add probe here for error unmarshaling JSON
 		if cfg.DebugConfig.LogStatusJson {
-			l.Log.Error("ERROR: Unmarshaling Payload Status Event: ", err, " Raw Message: ", string(msg.Value))
+			log.Error("ERROR: Unmarshaling Payload Status Event: ", err, " Raw Message: ", string(value))
 		} else {
-			l.Log.Error("ERROR: Unmarshaling Payload Status Event: ", err)
+			log.Error("ERROR: Unmarshaling Payload Status Event: ", err)
 		}
-		return
+		return outcomeValidationError, this.deadLetter(msg, cfg, "validation", err)
 	}
 
 	if !validateRequestID(cfg.RequestConfig.ValidateRequestIDLength, payloadStatus.RequestID) {
-		return
+		err := fmt.Errorf("invalid request_id: %s", payloadStatus.RequestID)
+		return outcomeValidationError, this.deadLetter(msg, cfg, "validation", err)
 	}
 
+	applyHeaderOrgID(log, msg, payloadStatus)
+
 	// Sanitize the payload
 	sanitizePayload(payloadStatus)
+	if rawService := normalizeService(log, cfg.KafkaConfig.KafkaServiceAliases, payloadStatus); rawService != "" && cfg.KafkaConfig.KafkaRecordRawService {
+		sanitizedPayloadStatus.RawService = rawService
+	}
+
+	// unknown services are decided on before anything is written for the message
+	existingService := queries.GetServiceByName(this.db, payloadStatus.Service)
+	if (models.Services{}) == existingService {
+		endpoints.IncUnknownServices(payloadStatus.Service)
+		if cfg.KafkaConfig.KafkaUnknownServicePolicy == "dead_letter" {
+			err := fmt.Errorf("unknown service: %s", payloadStatus.Service)
+			log.Warn("Dropping message from an unknown service: ", payloadStatus.Service)
+			return outcomeValidationError, this.deadLetter(msg, cfg, "unknown_service", err)
+		}
+		log.Warn("Creating unknown service: ", payloadStatus.Service)
+	}
 
 	// Upsert into Payloads Table
 	payload := createPayload(payloadStatus)
 
-	upsertResult, payloadId := queries.UpsertPayloadByRequestId(this.db, payloadStatus.RequestID, payload)
+	upsertResult, payloadId, operation := queries.UpsertPayloadByRequestId(this.db, payloadStatus.RequestID, payload)
 	if upsertResult.Error != nil {
-		l.Log.Error("ERROR Payload table upsert failed: ", upsertResult.Error)
-		return
+		log.Error("ERROR Payload table upsert failed: ", upsertResult.Error)
+		return outcomeDBError, upsertResult.Error
 	}
+	endpoints.IncPayloadWrites(operation)
 	sanitizedPayloadStatus.PayloadId = payloadId
 
 	// Check if service/source/status are in table
 	// this section checks the subsiquent DB tables to see if the service_id, source_id, and status_id exist for the given message
-	l.Log.Debug("Adding Status, Sources, and Services to sanitizedPayload")
+	log.Debug("Adding Status, Sources, and Services to sanitizedPayload")
 
 	// Status & Service: Always defined in the message
 	existingStatus := queries.GetStatusByName(this.db, payloadStatus.Status)
-	existingService := queries.GetServiceByName(this.db, payloadStatus.Service)
 	if (models.Statuses{}) == existingStatus {
 		statusResult, newStatus := queries.CreateStatusTableEntry(this.db, payloadStatus.Status)
 		if statusResult.Error != nil {
-			l.Log.Error("Error Creating Statuses Table Entry ERROR: ", statusResult.Error)
-			return
+			log.Error("Error Creating Statuses Table Entry ERROR: ", statusResult.Error)
+			return outcomeDBError, statusResult.Error
 		}
 
 		sanitizedPayloadStatus.Status = newStatus
@@ -83,8 +154,8 @@ func (this *handler) onMessage(ctx context.Context, msg *kafka.Message, cfg *con
 	if (models.Services{}) == existingService {
 		serviceResult, newService := queries.CreateServiceTableEntry(this.db, payloadStatus.Service)
 		if serviceResult.Error != nil {
-			l.Log.Error("Error Creating Service Table Entry ERROR: ", serviceResult.Error)
-			return
+			log.Error("Error Creating Service Table Entry ERROR: ", serviceResult.Error)
+			return outcomeDBError, serviceResult.Error
 		}
 
 		sanitizedPayloadStatus.Service = newService
@@ -98,8 +169,8 @@ func (this *handler) onMessage(ctx context.Context, msg *kafka.Message, cfg *con
 		if (models.Sources{}) == existingSource {
 			result, newSource := queries.CreateSourceTableEntry(this.db, payloadStatus.Source)
 			if result.Error != nil {
-				l.Log.Error("Error Creating Sources Table Entry ERROR: ", result.Error)
-				return
+				log.Error("Error Creating Sources Table Entry ERROR: ", result.Error)
+				return outcomeDBError, result.Error
 			}
 
 			sanitizedPayloadStatus.Source = newSource
@@ -114,23 +185,203 @@ func (this *handler) onMessage(ctx context.Context, msg *kafka.Message, cfg *con
 
 	// Insert Date
 	sanitizedPayloadStatus.Date = payloadStatus.Date.Time
+	if cfg.KafkaConfig.KafkaRecordReceivedAt {
+		receivedAt := time.Now()
+		sanitizedPayloadStatus.ReceivedAt = &receivedAt
+	}
 
 	// Insert payload into DB
 	endpoints.ObserveMessageProcessTime(time.Since(start))
 	endpoints.IncMessagesProcessed()
-	result := queries.InsertPayloadStatus(this.db, sanitizedPayloadStatus)
-	if result.Error != nil {
-		endpoints.IncMessageProcessErrors()
-		l.Log.Debug("Failed to insert sanitized PayloadStatus with ERROR: ", result.Error)
-		result = queries.InsertPayloadStatus(this.db, sanitizedPayloadStatus)
-		if result.Error != nil {
-			l.Log.Debug("Failed to re-insert sanitized PayloadStatus with ERROR: ", result.Error)
-			result = queries.InsertPayloadStatus(this.db, sanitizedPayloadStatus)
-			if result.Error != nil {
-				l.Log.Error("Failed final attempt to re-insert PayloadStatus with ERROR: ", result.Error)
-			}
+	if err := this.insertPayloadStatus(log, sanitizedPayloadStatus, cfg.DatabaseConfig.DBInsertRetries); err != nil {
+		log.Error("Failed final attempt to re-insert PayloadStatus with ERROR: ", err)
+		return outcomeDBError, this.deadLetter(msg, cfg, "exhausted_retries", err)
+	}
+	endpoints.ObserveIngestLatency(ingestLatency(payloadStatus.Date.Time, msg, time.Now()))
+	this.emitEnriched(msg, cfg, payloadStatus, sanitizedPayloadStatus)
+	if this.prefetch != nil {
+		this.prefetch.onStatus(payloadStatus)
+	}
+
+	if err := queries.NotifyStatusEvent(this.db, statusEvent(payloadStatus)); err != nil {
+		log.Error("Failed to publish status event: ", err)
+	}
+
+	return outcomeSuccess, nil
+}
+
+// statusEvent is the status as streamed to /payloads/{request_id}/events subscribers
+func statusEvent(payloadStatus *message.PayloadStatusMessage) structs.SinglePayloadData {
+	return structs.SinglePayloadData{
+		RequestID: payloadStatus.RequestID,
+		Service:   payloadStatus.Service,
+		Source:    payloadStatus.Source,
+		Status:    payloadStatus.Status,
+		StatusMsg: payloadStatus.StatusMSG,
+		Date:      payloadStatus.Date.Time,
+	}
+}
+
+// ingestLatency is the time since the event's date, or the kafka timestamp when the event has none.
+// Clock skew between producers and the consumer can put the event in the future, so it is clamped at zero.
+func ingestLatency(eventTime time.Time, msg *kafka.Message, now time.Time) time.Duration {
+	if eventTime.IsZero() {
+		eventTime = msg.Timestamp
+	}
+	if eventTime.IsZero() {
+		return 0
+	}
+
+	latency := now.Sub(eventTime)
+	if latency < 0 {
+		return 0
+	}
+	return latency
+}
+
+// insertPayloadStatus inserts the status, retrying up to the given number of attempts
+func (this *handler) insertPayloadStatus(log *logrus.Entry, payloadStatus *models.PayloadStatuses, attempts int) error {
+	var err error
+
+	for attempt := 1; attempt <= attempts || attempt == 1; attempt++ {
+		result := queries.InsertPayloadStatus(this.db, payloadStatus)
+		if result.Error == nil {
+			return nil
+		}
+
+		if attempt == 1 {
+			endpoints.IncMessageProcessErrors()
+		}
+
+		err = result.Error
+		log.Debugf("Failed attempt %d to insert sanitized PayloadStatus with ERROR: %v", attempt, err)
+	}
+
+	return err
+}
+
+// deadLetteredError is the error of a message that was forwarded to the dead letter topic
+type deadLetteredError struct {
+	error
+}
+
+func (e deadLetteredError) Unwrap() error {
+	return e.error
+}
+
+// deadLetter forwards a message that could not be processed to the dead letter topic, when one is configured.
+// It returns the cause as a deadLetteredError once the message is produced, or delivered when the handler
+// confirms its dead letters, and the cause unchanged otherwise.
+func (this *handler) deadLetter(msg *kafka.Message, cfg *config.TrackerConfig, reason string, cause error) error {
+	topic := cfg.KafkaConfig.KafkaDeadLetterTopic
+	if this.producer == nil || topic == "" {
+		return cause
+	}
+
+	deadLetter := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Key:            msg.Key,
+		Value:          msg.Value,
+		Headers: []kafka.Header{
+			{Key: "dlq_reason", Value: []byte(reason)},
+			{Key: "dlq_error", Value: []byte(cause.Error())},
+		},
+	}
+
+	var delivery chan kafka.Event
+	if this.confirmDeadLetters {
+		delivery = make(chan kafka.Event, 1)
+	}
+
+	if err := this.producer.Produce(deadLetter, delivery); err != nil {
+		messageLogger(msg).Error("ERROR: Failed to dead letter message: ", err)
+		return cause
+	}
+	if delivery != nil {
+		if m, ok := (<-delivery).(*kafka.Message); ok && m.TopicPartition.Error != nil {
+			messageLogger(msg).Error("ERROR: Failed to deliver dead letter message: ", m.TopicPartition.Error)
+			return cause
 		}
 	}
+
+	messageLogger(msg).WithField("reason", reason).Info("Dead lettered message: ", cause)
+
+	endpoints.IncDeadLetteredMessages(reason)
+
+	return deadLetteredError{cause}
+}
+
+// emitEnriched produces the persisted status to the enriched topic, when one is configured. The message is
+// only queued so a slow or failing broker doesn't hold up consumption, failures are logged and counted.
+func (this *handler) emitEnriched(msg *kafka.Message, cfg *config.TrackerConfig, payloadStatus *message.PayloadStatusMessage, persisted *models.PayloadStatuses) {
+	topic := cfg.KafkaConfig.KafkaEnrichedTopic
+	if this.producer == nil || topic == "" {
+		return
+	}
+
+	value, err := json.Marshal(enrichedStatus(payloadStatus, persisted))
+	if err != nil {
+		messageLogger(msg).Error("ERROR: Failed to marshal enriched event: ", err)
+		endpoints.IncEnrichedEvents("failed")
+		return
+	}
+
+	enriched := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Key:            []byte(payloadStatus.RequestID),
+		Value:          value,
+	}
+	if err := this.producer.Produce(enriched, nil); err != nil {
+		messageLogger(msg).Error("ERROR: Failed to produce enriched event: ", err)
+		endpoints.IncEnrichedEvents("failed")
+		return
+	}
+
+	endpoints.IncEnrichedEvents("produced")
+}
+
+// enrichedStatus is the status as it was persisted, the names come from the sanitized message
+func enrichedStatus(payloadStatus *message.PayloadStatusMessage, persisted *models.PayloadStatuses) message.EnrichedStatusMessage {
+	return message.EnrichedStatusMessage{
+		PayloadID:   persisted.PayloadId,
+		Service:     payloadStatus.Service,
+		Source:      payloadStatus.Source,
+		Account:     payloadStatus.Account,
+		OrgID:       payloadStatus.OrgID,
+		RequestID:   payloadStatus.RequestID,
+		InventoryID: payloadStatus.InventoryID,
+		SystemID:    payloadStatus.SystemID,
+		Status:      payloadStatus.Status,
+		StatusMSG:   payloadStatus.StatusMSG,
+		Date:        persisted.Date,
+		ReceivedAt:  persisted.ReceivedAt,
+	}
+}
+
+// applyHeaderOrgID fills in the org_id from the message headers when the body doesn't carry one
+func applyHeaderOrgID(log *logrus.Entry, msg *kafka.Message, payloadStatus *message.PayloadStatusMessage) {
+	for _, header := range msg.Headers {
+		if header.Key != orgIDHeader || len(header.Value) == 0 {
+			continue
+		}
+
+		headerOrgID := string(header.Value)
+		if payloadStatus.OrgID == "" {
+			payloadStatus.OrgID = headerOrgID
+		} else if payloadStatus.OrgID != headerOrgID {
+			log.Warnf("org_id %s in the message body does not match org_id %s in the headers, using the body", payloadStatus.OrgID, headerOrgID)
+		}
+		return
+	}
+}
+
+// messageLogger adds the kafka metadata of a message, including its key, to the log fields
+func messageLogger(msg *kafka.Message) *logrus.Entry {
+	return l.Log.WithFields(logrus.Fields{
+		"kafka_key":       string(msg.Key),
+		"kafka_partition": msg.TopicPartition.Partition,
+		"kafka_offset":    msg.TopicPartition.Offset.String(),
+	})
 }
 
 func validateRequestID(requestIDLength int, requestID string) bool {
@@ -153,6 +404,23 @@ func sanitizePayload(msg *message.PayloadStatusMessage) {
 	}
 }
 
+// normalizeService records a status sent under an alias for its service, it returns the alias when it was one
+func normalizeService(log *logrus.Entry, aliasPairs []string, payloadStatus *message.PayloadStatusMessage) string {
+	// the pairs are checked when the consumer starts
+	aliases, _ := serviceAliases(aliasPairs)
+	service, ok := aliases[payloadStatus.Service]
+	if !ok {
+		return ""
+	}
+
+	// the debug log has the message, the counter shows an alias is still in use at any level
+	log.Debugf("Normalizing service alias %s to %s", payloadStatus.Service, service)
+	endpoints.IncNormalizedServiceAliases(payloadStatus.Service, service)
+	rawService := payloadStatus.Service
+	payloadStatus.Service = service
+	return rawService
+}
+
 func createPayload(msg *message.PayloadStatusMessage) (table models.Payloads) {
 	payloadTable := models.Payloads{
 		Id:          msg.PayloadID,
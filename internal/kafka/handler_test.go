@@ -3,14 +3,20 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"time"
 
 	k "github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 
 	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	models "github.com/redhatinsights/payload-tracker-go/internal/models/db"
 	"github.com/redhatinsights/payload-tracker-go/internal/models/message"
 	"github.com/redhatinsights/payload-tracker-go/internal/queries"
 	"github.com/redhatinsights/payload-tracker-go/internal/utils/test"
@@ -66,7 +72,7 @@ var _ = Describe("Kafka message handler", func() {
 
 			msgHandler.onMessage(context.Background(), payloadStatusMessage, config.Get())
 
-			dbResult := queries.RetrieveRequestIdPayloads(db(), payloadMsgVal.RequestID, "created_at", "asc", "0")
+			dbResult := queries.RetrieveRequestIdPayloads(db(), payloadMsgVal.RequestID, "created_at", "asc", "0", false)
 
 			Expect(dbResult[0].Service).To(Equal(payloadMsgVal.Service))
 			Expect(dbResult[0].Account).To(Equal(payloadMsgVal.Account))
@@ -78,6 +84,20 @@ var _ = Describe("Kafka message handler", func() {
 			Expect(dbResult[0].StatusMsg).To(Equal(payloadMsgVal.StatusMSG))
 			Expect(dbResult[0].Source).To(Equal(payloadMsgVal.Source))
 		})
+
+		It("Records when the status was received apart from its date", func() {
+			payloadMsgVal := getSimplePayloadStatusMessage()
+			payloadMsgVal.RequestID = strings.Replace(uuid.New().String(), "-", "", -1)
+			before := time.Now()
+
+			Expect(msgHandler.onMessage(context.Background(), newKafkaMessage(payloadMsgVal), config.Get())).To(Succeed())
+
+			dbResult := queries.RetrieveRequestIdPayloads(db(), payloadMsgVal.RequestID, "created_at", "asc", "0", false)
+			Expect(dbResult).To(HaveLen(1))
+			Expect(dbResult[0].ReceivedAt).ToNot(BeNil())
+			Expect(dbResult[0].ReceivedAt.Before(before)).To(BeFalse())
+			Expect(dbResult[0].Date.Equal(payloadMsgVal.Date.Time)).To(BeTrue())
+		})
 	})
 
 	Describe("On valid request ID", func() {
@@ -115,9 +135,336 @@ var _ = Describe("Kafka message handler", func() {
 
 			msgHandler.onMessage(context.Background(), payloadStatusMessage, config.Get())
 
-			dbResult := queries.RetrieveRequestIdPayloads(db(), payloadMsgVal.RequestID, "created_at", "asc", "0")
+			dbResult := queries.RetrieveRequestIdPayloads(db(), payloadMsgVal.RequestID, "created_at", "asc", "0", false)
 
 			Expect(len(dbResult)).To(Equal(0))
 		})
 	})
+
+	Describe("On a message from an unknown service", func() {
+		It("Creates the service by default", func() {
+			payloadMsgVal := getSimplePayloadStatusMessage()
+			payloadMsgVal.RequestID = uuid.New().String()[:32]
+			payloadMsgVal.Service = "unknown-" + uuid.New().String()[:8]
+
+			Expect(msgHandler.onMessage(context.Background(), newKafkaMessage(payloadMsgVal), config.Get())).To(Succeed())
+
+			Expect(queries.GetServiceByName(db(), payloadMsgVal.Service).Name).To(Equal(payloadMsgVal.Service))
+		})
+
+		It("Does not create db entries when dead lettering", func() {
+			cfg := config.Get()
+			cfg.KafkaConfig.KafkaUnknownServicePolicy = "dead_letter"
+
+			payloadMsgVal := getSimplePayloadStatusMessage()
+			payloadMsgVal.RequestID = uuid.New().String()[:32]
+			payloadMsgVal.Service = "unknown-" + uuid.New().String()[:8]
+
+			Expect(msgHandler.onMessage(context.Background(), newKafkaMessage(payloadMsgVal), cfg)).ToNot(Succeed())
+
+			dbResult := queries.RetrieveRequestIdPayloads(db(), payloadMsgVal.RequestID, "created_at", "asc", "0", false)
+			Expect(len(dbResult)).To(Equal(0))
+			Expect(queries.GetServiceByName(db(), payloadMsgVal.Service).Name).To(BeEmpty())
+		})
+	})
+
+	Describe("On a message from a service alias", func() {
+		It("Records the status for the service along with the alias", func() {
+			cfg := config.Get()
+			cfg.KafkaConfig.KafkaServiceAliases = []string{"Host-Inventory:inventory"}
+			cfg.KafkaConfig.KafkaRecordRawService = true
+
+			payloadMsgVal := getSimplePayloadStatusMessage()
+			payloadMsgVal.RequestID = uuid.New().String()[:32]
+			payloadMsgVal.Service = "host-inventory"
+
+			Expect(msgHandler.onMessage(context.Background(), newKafkaMessage(payloadMsgVal), cfg)).To(Succeed())
+
+			dbResult := queries.RetrieveRequestIdPayloads(db(), payloadMsgVal.RequestID, "created_at", "asc", "0", false)
+			Expect(dbResult).To(HaveLen(1))
+			Expect(dbResult[0].Service).To(Equal("inventory"))
+
+			var rawService string
+			db().Table("payload_statuses").Select("raw_service").Where("id = ?", dbResult[0].ID).Scan(&rawService)
+			Expect(rawService).To(Equal("host-inventory"))
+		})
+	})
+})
+
+var _ = Describe("Kafka tombstone messages", func() {
+	It("Are skipped without an error", func() {
+		topic := "topic.payload.status"
+		tombstone := &k.Message{
+			Key:            []byte("e4b3d38f199f4abdb1cfbcf6e3b81f56"),
+			TopicPartition: k.TopicPartition{Topic: &topic},
+		}
+
+		msgHandler := handler{}
+		Expect(msgHandler.onMessage(context.Background(), tombstone, config.Get())).To(Succeed())
+	})
+})
+
+var _ = Describe("Kafka insert retries", func() {
+	It("Return the final error once every attempt has failed", func() {
+		// nothing listens on the port, so every insert fails
+		unreachable, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 user=test dbname=test sslmode=disable connect_timeout=1"), &gorm.Config{
+			DisableAutomaticPing: true,
+			Logger:               logger.Discard,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		attempts := 0
+		Expect(unreachable.Callback().Create().Before("gorm:create").Register("count_attempts", func(*gorm.DB) {
+			attempts++
+		})).To(Succeed())
+
+		cfg := config.Get()
+		cfg.DatabaseConfig.DBInsertRetries = 3
+		msgHandler := handler{db: unreachable}
+		log := messageLogger(newKafkaMessage(getSimplePayloadStatusMessage()))
+
+		err = msgHandler.insertPayloadStatus(log, &models.PayloadStatuses{}, cfg.DatabaseConfig.DBInsertRetries)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("127.0.0.1"))
+		Expect(attempts).To(Equal(cfg.DatabaseConfig.DBInsertRetries))
+	})
+})
+
+var _ = Describe("Kafka message processing time", func() {
+	processed := func(outcome string) uint64 {
+		families, err := prometheus.DefaultGatherer.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		for _, family := range families {
+			if family.GetName() != "payload_tracker_message_processing_seconds" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "outcome" && label.GetValue() == outcome {
+						return metric.GetHistogram().GetSampleCount()
+					}
+				}
+			}
+		}
+		return 0
+	}
+
+	It("Is observed by outcome", func() {
+		topic := "topic.payload.status"
+		msgHandler := handler{}
+
+		before := processed("success")
+		tombstone := &k.Message{TopicPartition: k.TopicPartition{Topic: &topic}}
+		Expect(msgHandler.onMessage(context.Background(), tombstone, config.Get())).To(Succeed())
+		Expect(processed("success")).To(Equal(before + 1))
+
+		before = processed("validation-error")
+		invalid := &k.Message{Value: []byte("not json"), TopicPartition: k.TopicPartition{Topic: &topic}}
+		Expect(msgHandler.onMessage(context.Background(), invalid, config.Get())).ToNot(Succeed())
+		Expect(processed("validation-error")).To(Equal(before + 1))
+	})
+})
+
+var _ = Describe("Kafka message logger", func() {
+	It("Includes the message key in the log fields", func() {
+		msg := newKafkaMessage(getSimplePayloadStatusMessage())
+		msg.Key = []byte("partition-key")
+
+		entry := messageLogger(msg)
+
+		Expect(entry.Data["kafka_key"]).To(Equal("partition-key"))
+		Expect(entry.Data["kafka_partition"]).To(Equal(int32(0)))
+	})
+})
+
+var _ = Describe("Kafka ingest latency", func() {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	It("Measures from the event date", func() {
+		msg := newKafkaMessage(getSimplePayloadStatusMessage())
+		msg.Timestamp = now.Add(-time.Hour)
+
+		Expect(ingestLatency(now.Add(-time.Minute), msg, now)).To(Equal(time.Minute))
+	})
+
+	It("Falls back to the kafka timestamp", func() {
+		msg := newKafkaMessage(getSimplePayloadStatusMessage())
+		msg.Timestamp = now.Add(-time.Second)
+
+		Expect(ingestLatency(time.Time{}, msg, now)).To(Equal(time.Second))
+	})
+
+	It("Clamps dates in the future to zero", func() {
+		msg := newKafkaMessage(getSimplePayloadStatusMessage())
+
+		Expect(ingestLatency(now.Add(time.Minute), msg, now)).To(BeZero())
+	})
+})
+
+var _ = Describe("Kafka org_id header", func() {
+	It("Uses the header when the body has no org_id", func() {
+		payloadStatus := getSimplePayloadStatusMessage()
+		payloadStatus.OrgID = ""
+		msg := newKafkaMessage(payloadStatus)
+		msg.Headers = []k.Header{{Key: "org_id", Value: []byte("12345")}}
+
+		applyHeaderOrgID(messageLogger(msg), msg, &payloadStatus)
+
+		Expect(payloadStatus.OrgID).To(Equal("12345"))
+	})
+
+	It("Prefers the org_id in the body", func() {
+		payloadStatus := getSimplePayloadStatusMessage()
+		payloadStatus.OrgID = "67890"
+		msg := newKafkaMessage(payloadStatus)
+		msg.Headers = []k.Header{{Key: "org_id", Value: []byte("12345")}}
+
+		applyHeaderOrgID(messageLogger(msg), msg, &payloadStatus)
+
+		Expect(payloadStatus.OrgID).To(Equal("67890"))
+	})
+})
+
+var _ = Describe("Kafka enriched events", func() {
+	It("Carry the sanitized status along with what the tracker added", func() {
+		payloadStatus := getSimplePayloadStatusMessage()
+		payloadStatus.Service = "PupToo"
+		sanitizePayload(&payloadStatus)
+		receivedAt := time.Now()
+		persisted := &models.PayloadStatuses{PayloadId: 42, Date: payloadStatus.Date.Time, ReceivedAt: &receivedAt}
+
+		value, err := json.Marshal(enrichedStatus(&payloadStatus, persisted))
+		Expect(err).ToNot(HaveOccurred())
+
+		var enriched map[string]interface{}
+		Expect(json.Unmarshal(value, &enriched)).To(Succeed())
+		Expect(enriched).To(HaveKeyWithValue("payload_id", BeEquivalentTo(42)))
+		Expect(enriched).To(HaveKeyWithValue("service", "puptoo"))
+		Expect(enriched).To(HaveKeyWithValue("request_id", payloadStatus.RequestID))
+		Expect(enriched).To(HaveKeyWithValue("date", "2022-06-07T11:00:10.356Z"))
+		Expect(enriched).To(HaveKey("received_at"))
+	})
+
+	It("Are not emitted without an enriched topic", func() {
+		cfg := *config.Get()
+		cfg.KafkaConfig.KafkaEnrichedTopic = ""
+		payloadStatus := getSimplePayloadStatusMessage()
+
+		msgHandler := handler{}
+		Expect(func() {
+			msgHandler.emitEnriched(newKafkaMessage(payloadStatus), &cfg, &payloadStatus, &models.PayloadStatuses{})
+		}).ToNot(Panic())
+	})
+})
+
+var _ = Describe("Kafka status inserter", func() {
+	It("Validates statuses like consumed messages", func() {
+		insert := NewStatusInserter(config.Get(), nil)
+
+		Expect(insert(context.Background(), []byte("not json"))).ToNot(Succeed())
+
+		payloadMsgVal := getSimplePayloadStatusMessage()
+		payloadMsgVal.RequestID = uuid.New().String()
+		value, _ := json.Marshal(payloadMsgVal)
+		Expect(insert(context.Background(), value)).To(MatchError("invalid request_id: " + payloadMsgVal.RequestID))
+	})
+})
+
+var _ = Describe("Kafka consumer group", func() {
+	It("Needs a group id", func() {
+		Expect(validateGroupID("payload_tracker")).To(Succeed())
+		Expect(validateGroupID("")).ToNot(Succeed())
+		Expect(validateGroupID("  ")).ToNot(Succeed())
+	})
+
+	It("Joins as a static member named after the host when enabled", func() {
+		cfg := *config.Get()
+		cfg.Hostname = "payload-tracker-consumer-0"
+		cfg.KafkaConfig.KafkaGroupID = "payload_tracker"
+
+		cfg.KafkaConfig.KafkaGroupInstanceHostname = false
+		Expect(consumerConfigMap(&cfg)).ToNot(HaveKey("group.instance.id"))
+
+		cfg.KafkaConfig.KafkaGroupInstanceHostname = true
+		configMap := consumerConfigMap(&cfg)
+		Expect(configMap).To(HaveKeyWithValue("group.id", "payload_tracker"))
+		Expect(configMap).To(HaveKeyWithValue("group.instance.id", "payload_tracker-payload-tracker-consumer-0"))
+	})
+})
+
+var _ = Describe("Kafka offset reset policy", func() {
+	It("Accepts earliest and latest", func() {
+		Expect(validateOffsetReset("earliest")).To(Succeed())
+		Expect(validateOffsetReset("latest")).To(Succeed())
+	})
+
+	It("Rejects anything else", func() {
+		Expect(validateOffsetReset("smallest")).ToNot(Succeed())
+	})
+
+	It("Is applied with and without SASL", func() {
+		cfg := *config.Get()
+		cfg.KafkaConfig.KafkaAutoOffsetReset = "earliest"
+		Expect(consumerConfigMap(&cfg)).To(HaveKeyWithValue("auto.offset.reset", "earliest"))
+
+		cfg.KafkaConfig.SASLMechanism = "PLAIN"
+		configMap := consumerConfigMap(&cfg)
+		Expect(configMap).To(HaveKeyWithValue("auto.offset.reset", "earliest"))
+		Expect(configMap).To(HaveKeyWithValue("auto.commit.interval.ms", cfg.KafkaConfig.KafkaAutoCommitInterval))
+	})
+})
+
+var _ = Describe("Kafka poll settings", func() {
+	It("Accepts positive values", func() {
+		Expect(validatePoll(100, 500)).To(Succeed())
+	})
+
+	It("Rejects a timeout or max records that isn't positive", func() {
+		Expect(validatePoll(0, 500)).ToNot(Succeed())
+		Expect(validatePoll(100, 0)).ToNot(Succeed())
+		Expect(validatePoll(-1, -1)).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("Kafka unknown service policy", func() {
+	It("Accepts create and dead_letter", func() {
+		Expect(validateUnknownServicePolicy("create")).To(Succeed())
+		Expect(validateUnknownServicePolicy("dead_letter")).To(Succeed())
+	})
+
+	It("Rejects anything else", func() {
+		Expect(validateUnknownServicePolicy("drop")).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("Kafka service aliases", func() {
+	It("Map each alias to its service", func() {
+		aliases, err := serviceAliases([]string{"Host-Inventory:inventory", "ingress-svc:ingress"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(aliases).To(Equal(map[string]string{"host-inventory": "inventory", "ingress-svc": "ingress"}))
+	})
+
+	It("Rejects pairs that aren't alias:service", func() {
+		for _, pair := range []string{"inventory", "host-inventory:", ":inventory", "a:b:c"} {
+			_, err := serviceAliases([]string{pair})
+			Expect(err).To(HaveOccurred())
+		}
+	})
+
+	It("Normalize a service sent under an alias", func() {
+		payloadStatus := getSimplePayloadStatusMessage()
+		payloadStatus.Service = "host-inventory"
+		log := messageLogger(newKafkaMessage(payloadStatus))
+
+		Expect(normalizeService(log, []string{"host-inventory:inventory"}, &payloadStatus)).To(Equal("host-inventory"))
+		Expect(payloadStatus.Service).To(Equal("inventory"))
+	})
+
+	It("Leave other services as they are", func() {
+		payloadStatus := getSimplePayloadStatusMessage()
+		log := messageLogger(newKafkaMessage(payloadStatus))
+
+		Expect(normalizeService(log, []string{"host-inventory:inventory"}, &payloadStatus)).To(BeEmpty())
+		Expect(payloadStatus.Service).To(Equal("puptoo"))
+	})
 })
@@ -0,0 +1,20 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"gorm.io/gorm"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+)
+
+// NewStatusInserter records statuses posted to /admin/statuses through the same validation and inserts as
+// consumed messages. Statuses are always JSON, and without a producer failures are not dead lettered.
+func NewStatusInserter(cfg *config.TrackerConfig, db *gorm.DB) func(context.Context, []byte) error {
+	handler := &handler{db: db}
+
+	return func(ctx context.Context, value []byte) error {
+		return handler.onMessage(ctx, &kafka.Message{Value: value}, cfg)
+	}
+}
@@ -2,9 +2,13 @@ package kafka
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"gorm.io/gorm"
@@ -14,32 +18,37 @@ import (
 	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
 )
 
+var validOffsetResets = []string{"earliest", "latest"}
+
+var validUnknownServicePolicies = []string{"create", "dead_letter"}
+
+var validMessageFormats = []string{"json", "avro"}
+
 // NewConsumer Creates brand new consumer instance based on topic
 func NewConsumer(ctx context.Context, config *config.TrackerConfig, topic string) (*kafka.Consumer, error) {
-	var configMap kafka.ConfigMap
-
-	if config.KafkaConfig.SASLMechanism != "" {
-		configMap = kafka.ConfigMap{
-			"bootstrap.servers":        config.KafkaConfig.KafkaBootstrapServers,
-			"group.id":                 config.KafkaConfig.KafkaGroupID,
-			"security.protocol":        config.KafkaConfig.Protocol,
-			"sasl.mechanism":           config.KafkaConfig.SASLMechanism,
-			"ssl.ca.location":          config.KafkaConfig.KafkaCA,
-			"sasl.username":            config.KafkaConfig.KafkaUsername,
-			"sasl.password":            config.KafkaConfig.KafkaPassword,
-			"go.logs.channel.enable":   true,
-			"allow.auto.create.topics": true,
-		}
-	} else {
-		configMap = kafka.ConfigMap{
-			"bootstrap.servers":        config.KafkaConfig.KafkaBootstrapServers,
-			"group.id":                 config.KafkaConfig.KafkaGroupID,
-			"auto.offset.reset":        config.KafkaConfig.KafkaAutoOffsetReset,
-			"auto.commit.interval.ms":  config.KafkaConfig.KafkaAutoCommitInterval,
-			"go.logs.channel.enable":   true,
-			"allow.auto.create.topics": true,
-		}
+	if err := validateGroupID(config.KafkaConfig.KafkaGroupID); err != nil {
+		return nil, err
+	}
+	if err := validateOffsetReset(config.KafkaConfig.KafkaAutoOffsetReset); err != nil {
+		return nil, err
 	}
+	if err := validateUnknownServicePolicy(config.KafkaConfig.KafkaUnknownServicePolicy); err != nil {
+		return nil, err
+	}
+	if err := validatePoll(config.KafkaConfig.KafkaPollTimeoutMs, config.KafkaConfig.KafkaMaxPollRecords); err != nil {
+		return nil, err
+	}
+	if _, err := serviceAliases(config.KafkaConfig.KafkaServiceAliases); err != nil {
+		return nil, err
+	}
+	if _, err := fieldMapping(config.KafkaConfig.KafkaFieldMapping); err != nil {
+		return nil, err
+	}
+	if err := validateMessageFormat(config.KafkaConfig.KafkaMessageFormat, config.KafkaConfig.KafkaSchemaRegistryURL); err != nil {
+		return nil, err
+	}
+
+	configMap := consumerConfigMap(config)
 
 	consumer, err := kafka.NewConsumer(&configMap)
 
@@ -54,26 +63,179 @@ func NewConsumer(ctx context.Context, config *config.TrackerConfig, topic string
 	}
 
 	l.Log.Info("Connected to Kafka")
+	l.Log.Infof("Consumer group %s starts from the %s offset when it has no committed offset", config.KafkaConfig.KafkaGroupID, config.KafkaConfig.KafkaAutoOffsetReset)
+	if instanceID := groupInstanceID(config); instanceID != "" {
+		l.Log.Infof("Consumer joins group %s as static member %s", config.KafkaConfig.KafkaGroupID, instanceID)
+	} else {
+		l.Log.Infof("Consumer joins group %s with a member id assigned by the broker", config.KafkaConfig.KafkaGroupID)
+	}
 
 	return consumer, nil
 }
 
+// validateGroupID checks that there is a group for the replicas to share the partitions within
+func validateGroupID(groupID string) error {
+	if strings.TrimSpace(groupID) == "" {
+		return fmt.Errorf("kafka.group.id must not be empty")
+	}
+	return nil
+}
+
+// groupInstanceID is the static member id of the consumer, which keeps its partitions across restarts,
+// or an empty string to have the broker assign a new member id on each join
+func groupInstanceID(config *config.TrackerConfig) string {
+	if !config.KafkaConfig.KafkaGroupInstanceHostname || config.Hostname == "" {
+		return ""
+	}
+	return config.KafkaConfig.KafkaGroupID + "-" + config.Hostname
+}
+
+// validateOffsetReset checks the policy applied when the consumer group has no committed offset
+func validateOffsetReset(policy string) error {
+	for _, valid := range validOffsetResets {
+		if policy == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("kafka.auto.offset.reset must be one of earliest, latest, got %q", policy)
+}
+
+// validateUnknownServicePolicy checks what happens to messages from a service not in the services table
+func validateUnknownServicePolicy(policy string) error {
+	for _, valid := range validUnknownServicePolicies {
+		if policy == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("kafka.unknown.service.policy must be one of create, dead_letter, got %q", policy)
+}
+
+// validatePoll checks how long the event loop waits for an event and how many it handles per poll
+func validatePoll(timeoutMs int, maxRecords int) error {
+	if timeoutMs <= 0 {
+		return fmt.Errorf("kafka.poll.timeout.ms must be positive, got %d", timeoutMs)
+	}
+	if maxRecords <= 0 {
+		return fmt.Errorf("kafka.max.poll.records must be positive, got %d", maxRecords)
+	}
+	return nil
+}
+
+// serviceAliases maps each alias to its service from alias:service pairs, names are lowercase like the messages' once sanitized
+func serviceAliases(pairs []string) (map[string]string, error) {
+	aliases := map[string]string{}
+	for _, pair := range pairs {
+		parts := strings.Split(strings.ToLower(pair), ":")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("kafka.service.aliases must be a comma separated list of alias:service pairs, got %q", pair)
+		}
+		aliases[parts[0]] = parts[1]
+	}
+	return aliases, nil
+}
+
+// validateMessageFormat checks how message values are encoded, avro schemas are looked up in the registry
+func validateMessageFormat(format string, registryURL string) error {
+	for _, valid := range validMessageFormats {
+		if format == valid {
+			if format == "avro" && registryURL == "" {
+				return fmt.Errorf("kafka.schema.registry.url is required when kafka.message.format is avro")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("kafka.message.format must be one of json, avro, got %q", format)
+}
+
+// NewProducer creates a producer used to forward messages, such as dead letters, back onto kafka
+func NewProducer(config *config.TrackerConfig) (*kafka.Producer, error) {
+	configMap := kafka.ConfigMap{
+		"bootstrap.servers":        config.KafkaConfig.KafkaBootstrapServers,
+		"request.required.acks":    config.KafkaConfig.KafkaRequestRequiredAcks,
+		"message.send.max.retries": config.KafkaConfig.KafkaMessageSendMaxRetries,
+		"retry.backoff.ms":         config.KafkaConfig.KafkaRetryBackoffMs,
+	}
+
+	if config.KafkaConfig.SASLMechanism != "" {
+		configMap["security.protocol"] = config.KafkaConfig.Protocol
+		configMap["sasl.mechanism"] = config.KafkaConfig.SASLMechanism
+		configMap["ssl.ca.location"] = config.KafkaConfig.KafkaCA
+		configMap["sasl.username"] = config.KafkaConfig.KafkaUsername
+		configMap["sasl.password"] = config.KafkaConfig.KafkaPassword
+	}
+
+	producer, err := kafka.NewProducer(&configMap)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Delivery reports have to be drained or the producer will block
+	go func() {
+		for e := range producer.Events() {
+			if m, ok := e.(*kafka.Message); ok && m.TopicPartition.Error != nil {
+				l.Log.Errorf("Failed to deliver message to %v: %v", m.TopicPartition, m.TopicPartition.Error)
+				if m.TopicPartition.Topic != nil && *m.TopicPartition.Topic == config.KafkaConfig.KafkaEnrichedTopic {
+					endpoints.IncEnrichedEvents("undelivered")
+				}
+			}
+		}
+	}()
+
+	return producer, nil
+}
+
+// ConsumerControl lets the consumer event loop be paused and resumed without leaving the consumer group
+type ConsumerControl struct {
+	paused int32
+}
+
+// Pause stops the event loop from processing messages
+func (c *ConsumerControl) Pause() {
+	atomic.StoreInt32(&c.paused, 1)
+}
+
+// Resume lets the event loop process messages again
+func (c *ConsumerControl) Resume() {
+	atomic.StoreInt32(&c.paused, 0)
+}
+
+// Paused reports whether the event loop has been paused
+func (c *ConsumerControl) Paused() bool {
+	return atomic.LoadInt32(&c.paused) == 1
+}
+
 // NewConsumerEventLoop creates a new consumer event loop based on the information passed with it
 func NewConsumerEventLoop(
 	ctx context.Context,
 	cfg *config.TrackerConfig,
 	consumer *kafka.Consumer,
 	db *gorm.DB,
+	control *ConsumerControl,
 ) {
 
 	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
 
 	handler := &handler{
-		db: db,
+		db:       db,
+		decode:   newMessageDecoder(cfg),
+		prefetch: newArchivePrefetcher(ctx, cfg, db),
+	}
+
+	if cfg.KafkaConfig.KafkaDeadLetterTopic != "" || cfg.KafkaConfig.KafkaEnrichedTopic != "" {
+		producer, err := NewProducer(cfg)
+		if err != nil {
+			l.Log.Error("ERROR: Unable to create dead letter and enriched event producer: ", err)
+		} else {
+			defer producer.Close()
+			handler.producer = producer
+		}
 	}
 
 	run := true
+	paused := false
+	backlog := newBacklogAge()
 
 	for run {
 		select {
@@ -82,24 +244,126 @@ func NewConsumerEventLoop(
 			run = false
 		default:
 
-			event := consumer.Poll(100)
-			if event == nil {
-				continue
+			if control.Paused() != paused {
+				paused = control.Paused()
+				togglePartitions(consumer, paused)
 			}
 
-			switch e := event.(type) {
-			case *kafka.Message:
-				endpoints.IncConsumedMessages()
-				handler.onMessage(ctx, e, cfg)
-			case kafka.Error:
-				endpoints.IncConsumeErrors()
-				l.Log.Errorf("Consumer error: %v (%v)\n", e.Code(), e)
-			default:
-				l.Log.Infof("Ignored %v\n", e)
+			// wait for the first event, then take whatever else is already fetched up to the max
+			// before checking for signals and pauses again
+			event := consumer.Poll(cfg.KafkaConfig.KafkaPollTimeoutMs)
+		batch:
+			for records := 0; event != nil; {
+				switch e := event.(type) {
+				case *kafka.Message:
+					if paused {
+						// the message was fetched before the pause took effect (or after a rebalance),
+						// so rewind to it and keep its offset from being committed, the rest of the batch
+						// is left unpolled until the consumer resumes
+						rewindMessage(consumer, e)
+						togglePartitions(consumer, true)
+						backlog.observe(e, false)
+						break batch
+					}
+					endpoints.IncConsumedMessages()
+					handler.onMessage(ctx, e, cfg)
+					backlog.observe(e, true)
+				case kafka.Error:
+					endpoints.IncConsumeErrors()
+					l.Log.Errorf("Consumer error: %v (%v)\n", e.Code(), e)
+				default:
+					l.Log.Infof("Ignored %v\n", e)
+				}
+
+				if records++; records >= cfg.KafkaConfig.KafkaMaxPollRecords {
+					break
+				}
+				event = consumer.Poll(0)
 			}
 
+			updateBacklogAge(consumer, backlog)
+
 		}
 	}
 
 	consumer.Close()
 }
+
+// updateBacklogAge sets the oldest unprocessed message metric, the watermarks are the ones the client last fetched
+// so this doesn't call out to the brokers
+func updateBacklogAge(consumer *kafka.Consumer, backlog *backlogAge) {
+	assigned, err := consumer.Assignment()
+	if err != nil {
+		return
+	}
+	endpoints.SetOldestUnprocessed(backlog.age(time.Now(), assigned, func(topic string, partition int32) (int64, error) {
+		_, high, err := consumer.GetWatermarkOffsets(topic, partition)
+		return high, err
+	}))
+}
+
+// togglePartitions pauses or resumes fetching on every partition assigned to the consumer
+func togglePartitions(consumer *kafka.Consumer, pause bool) {
+	assigned, err := consumer.Assignment()
+	if err != nil {
+		l.Log.Error("ERROR: Unable to get consumer assignment: ", err)
+		return
+	}
+
+	if pause {
+		err = consumer.Pause(assigned)
+	} else {
+		err = consumer.Resume(assigned)
+	}
+
+	if err != nil {
+		l.Log.Error("ERROR: Unable to toggle consumer partitions: ", err)
+		return
+	}
+
+	l.Log.Infof("Consumer paused: %v", pause)
+}
+
+func rewindMessage(consumer *kafka.Consumer, msg *kafka.Message) {
+	if _, err := consumer.StoreOffsets([]kafka.TopicPartition{msg.TopicPartition}); err != nil {
+		l.Log.Error("ERROR: Unable to store offset of paused message: ", err)
+	}
+	if err := consumer.Seek(msg.TopicPartition, 0); err != nil {
+		l.Log.Error("ERROR: Unable to rewind paused message: ", err)
+	}
+}
+
+func consumerConfigMap(config *config.TrackerConfig) kafka.ConfigMap {
+	var configMap kafka.ConfigMap
+	if config.KafkaConfig.SASLMechanism != "" {
+		configMap = kafka.ConfigMap{
+			"bootstrap.servers":        config.KafkaConfig.KafkaBootstrapServers,
+			"group.id":                 config.KafkaConfig.KafkaGroupID,
+			"security.protocol":        config.KafkaConfig.Protocol,
+			"sasl.mechanism":           config.KafkaConfig.SASLMechanism,
+			"ssl.ca.location":          config.KafkaConfig.KafkaCA,
+			"sasl.username":            config.KafkaConfig.KafkaUsername,
+			"sasl.password":            config.KafkaConfig.KafkaPassword,
+			"go.logs.channel.enable":   true,
+			"allow.auto.create.topics": true,
+		}
+	} else {
+		configMap = kafka.ConfigMap{
+			"bootstrap.servers":        config.KafkaConfig.KafkaBootstrapServers,
+			"group.id":                 config.KafkaConfig.KafkaGroupID,
+			"go.logs.channel.enable":   true,
+			"allow.auto.create.topics": true,
+		}
+	}
+
+	// the offset policy applies whether or not the brokers need SASL
+	configMap["auto.offset.reset"] = config.KafkaConfig.KafkaAutoOffsetReset
+	configMap["auto.commit.interval.ms"] = config.KafkaConfig.KafkaAutoCommitInterval
+
+	if instanceID := groupInstanceID(config); instanceID != "" {
+		configMap["group.instance.id"] = instanceID
+		configMap["client.id"] = instanceID
+	}
+
+	return configMap
+}
@@ -0,0 +1,94 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+var (
+	// mappableFields are the message fields the columns are read from
+	mappableFields = []string{"service", "source", "account", "org_id", "request_id", "inventory_id", "system_id", "status", "status_msg", "date"}
+	// requiredMappedFields must be found under one of their names once they are mapped, or the message is dead lettered
+	requiredMappedFields = []string{"service", "request_id", "status", "date"}
+)
+
+// fieldMapping maps each field to the names it is looked up under from field:name pairs. A field may be listed
+// more than once to try several names in order, and is looked up under its own name last so that producers
+// sending it as-is keep working. Names may be dotted paths into nested objects.
+func fieldMapping(pairs []string) (map[string][]string, error) {
+	mapping := map[string][]string{}
+	for _, pair := range pairs {
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("kafka.field.mapping must be a comma separated list of field:name pairs, got %q", pair)
+		}
+		if !stringInSlice(parts[0], mappableFields) {
+			return nil, fmt.Errorf("kafka.field.mapping field %s must be one of %s", parts[0], strings.Join(mappableFields, ", "))
+		}
+		mapping[parts[0]] = append(mapping[parts[0]], parts[1])
+	}
+	return mapping, nil
+}
+
+// mapFields rewrites the message so each mapped field is under the name the consumer reads it from,
+// the message is returned as it is when nothing is mapped
+func mapFields(value []byte, pairs []string) ([]byte, error) {
+	if len(pairs) == 0 {
+		return value, nil
+	}
+	// the pairs are checked when the consumer starts
+	mapping, _ := fieldMapping(pairs)
+
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(value, &document); err != nil {
+		return nil, err
+	}
+
+	for field, names := range mapping {
+		found := false
+		for _, name := range append(names, field) {
+			if raw, ok := lookupPath(document, name); ok {
+				document[field] = raw
+				found = true
+				break
+			}
+		}
+		if !found && stringInSlice(field, requiredMappedFields) {
+			return nil, fmt.Errorf("missing %s, looked up as %s", field, strings.Join(append(names, field), ", "))
+		}
+	}
+
+	return json.Marshal(document)
+}
+
+// lookupPath finds the value at a dotted path, a null value counts as missing
+func lookupPath(document map[string]json.RawMessage, path string) (json.RawMessage, bool) {
+	keys := strings.Split(path, ".")
+	current := document
+	for i, key := range keys {
+		raw, ok := current[key]
+		if !ok || string(raw) == "null" {
+			return nil, false
+		}
+		if i == len(keys)-1 {
+			return raw, true
+		}
+		// each level is decoded into a map of its own, decoding into current would merge it into the document
+		var next map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &next); err != nil {
+			return nil, false
+		}
+		current = next
+	}
+	return nil, false
+}
+
+func stringInSlice(value string, values []string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
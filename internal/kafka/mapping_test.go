@@ -0,0 +1,99 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	k "github.com/confluentinc/confluent-kafka-go/kafka"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	"github.com/redhatinsights/payload-tracker-go/internal/models/message"
+)
+
+var _ = Describe("Kafka field mapping", func() {
+	const producerMessage = `{
+		"service": "puptoo",
+		"requestId": "e4b3d38f199f4abdb1cfbcf6e3b81f56",
+		"meta": {"org": "000001"},
+		"status": "success",
+		"date": "2022-06-07T11:00:10.356Z"
+	}`
+
+	It("Needs field:name pairs for known fields", func() {
+		_, err := fieldMapping([]string{"request_id:requestId", "request_id:reqId"})
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = fieldMapping([]string{"request_id"})
+		Expect(err).To(HaveOccurred())
+		_, err = fieldMapping([]string{"requestId:request_id"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("Leaves messages as they are without a mapping", func() {
+		value := []byte(`{"requestId": "e4b3d38f199f4abdb1cfbcf6e3b81f56"}`)
+		mapped, err := mapFields(value, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(mapped).To(Equal(value))
+	})
+
+	It("Reads the fields under their mapped names and paths", func() {
+		mapped, err := mapFields([]byte(producerMessage), []string{"request_id:requestId", "org_id:meta.org"})
+		Expect(err).ToNot(HaveOccurred())
+
+		payloadStatus := &message.PayloadStatusMessage{}
+		Expect(json.Unmarshal(mapped, payloadStatus)).To(Succeed())
+		Expect(payloadStatus.RequestID).To(Equal("e4b3d38f199f4abdb1cfbcf6e3b81f56"))
+		Expect(payloadStatus.OrgID).To(Equal("000001"))
+		Expect(payloadStatus.Service).To(Equal("puptoo"))
+	})
+
+	It("Leaves the top level fields alone when reading a nested path", func() {
+		value := []byte(`{"service": "ingress", "request_id": "e4b3d38f199f4abdb1cfbcf6e3b81f56", "meta": {"service": "other", "org": "000001"}}`)
+		mapped, err := mapFields(value, []string{"org_id:meta.org"})
+		Expect(err).ToNot(HaveOccurred())
+
+		payloadStatus := &message.PayloadStatusMessage{}
+		Expect(json.Unmarshal(mapped, payloadStatus)).To(Succeed())
+		Expect(payloadStatus.Service).To(Equal("ingress"))
+		Expect(payloadStatus.OrgID).To(Equal("000001"))
+	})
+
+	It("Falls back to the field's own name", func() {
+		value := []byte(`{"service": "puptoo", "request_id": "e4b3d38f199f4abdb1cfbcf6e3b81f56", "status": "success", "date": "2022-06-07T11:00:10.356Z"}`)
+		mapped, err := mapFields(value, []string{"request_id:requestId"})
+		Expect(err).ToNot(HaveOccurred())
+
+		payloadStatus := &message.PayloadStatusMessage{}
+		Expect(json.Unmarshal(mapped, payloadStatus)).To(Succeed())
+		Expect(payloadStatus.RequestID).To(Equal("e4b3d38f199f4abdb1cfbcf6e3b81f56"))
+	})
+
+	It("Fails for a message missing a mapped required field", func() {
+		_, err := mapFields([]byte(`{"service": "puptoo", "status": "success"}`), []string{"request_id:requestId"})
+		Expect(err).To(MatchError(ContainSubstring("missing request_id")))
+
+		_, err = mapFields([]byte(`{"service": "puptoo", "status": "success"}`), []string{"org_id:meta.org"})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Context("In the message handler", func() {
+		AfterEach(func() {
+			os.Unsetenv("KAFKA_FIELD_MAPPING")
+		})
+
+		It("Does not process messages missing a mapped required field", func() {
+			os.Setenv("KAFKA_FIELD_MAPPING", "request_id:uuid")
+			topic := "topic.payload.status"
+			msg := &k.Message{
+				Value:          []byte(`{"service": "puptoo", "status": "success", "date": "2022-06-07T11:00:10.356Z"}`),
+				TopicPartition: k.TopicPartition{Topic: &topic},
+			}
+
+			msgHandler := handler{}
+			Expect(msgHandler.onMessage(context.Background(), msg, config.Get())).To(MatchError(ContainSubstring("missing request_id")))
+		})
+	})
+})
@@ -0,0 +1,112 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	"github.com/redhatinsights/payload-tracker-go/internal/endpoints"
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+	"github.com/redhatinsights/payload-tracker-go/internal/models/message"
+	"github.com/redhatinsights/payload-tracker-go/internal/queries"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+)
+
+// archivePrefetcher requests the archive links of payloads as they reach the prefetch status and stores them
+// for the api, so that PayloadArchiveLink doesn't wait on storage-broker for recently uploaded payloads
+type archivePrefetcher struct {
+	db      *gorm.DB
+	lookup  func(context.Context, string) (*structs.PayloadArchiveLink, error)
+	limiter *rate.Limiter
+	queue   chan string
+	service string
+	status  string
+	ttl     time.Duration
+}
+
+// newArchivePrefetcher starts the prefetch workers, it returns nil when prefetching is disabled or
+// the requestor can't look up archives
+func newArchivePrefetcher(ctx context.Context, cfg *config.TrackerConfig, db *gorm.DB) *archivePrefetcher {
+	prefetchCfg := cfg.ArchivePrefetchConfig
+	if !prefetchCfg.Enabled {
+		return nil
+	}
+
+	lookup := endpoints.CreateArchiveLookup(*cfg)
+	if lookup == nil {
+		l.Log.Warnf("Archive links are not prefetched, requestor %s can't look them up", cfg.RequestConfig.RequestorImpl)
+		return nil
+	}
+
+	service, status := endpoints.RequiredArchiveStatus(prefetchCfg.Status)
+	prefetcher := &archivePrefetcher{
+		db:      db,
+		lookup:  lookup,
+		limiter: rate.NewLimiter(rate.Limit(prefetchCfg.RatePerSecond), 1),
+		queue:   make(chan string, prefetchCfg.QueueSize),
+		service: service,
+		status:  status,
+		ttl:     time.Duration(prefetchCfg.LinkTTL) * time.Second,
+	}
+
+	workers := prefetchCfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go prefetcher.work(ctx)
+	}
+
+	return prefetcher
+}
+
+// onStatus queues the payload when the status is the prefetch one, a full queue drops it rather than
+// hold up the consumer, the api still asks storage-broker for links that weren't prefetched
+func (p *archivePrefetcher) onStatus(payloadStatus *message.PayloadStatusMessage) {
+	if payloadStatus.Status != p.status || (p.service != "" && payloadStatus.Service != p.service) {
+		return
+	}
+
+	select {
+	case p.queue <- payloadStatus.RequestID:
+	default:
+		endpoints.IncArchivePrefetches("dropped")
+	}
+}
+
+func (p *archivePrefetcher) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case reqID := <-p.queue:
+			if err := p.limiter.Wait(ctx); err != nil {
+				return
+			}
+			p.prefetch(ctx, reqID)
+		}
+	}
+}
+
+func (p *archivePrefetcher) prefetch(ctx context.Context, reqID string) {
+	archiveLink, err := p.lookup(ctx, reqID)
+	if err != nil {
+		l.Log.Debugf("Failed to prefetch the archive link for request id %s: %v", reqID, err)
+		endpoints.IncArchivePrefetches("failed")
+		return
+	}
+	if archiveLink.Url == "" {
+		endpoints.IncArchivePrefetches("not_found")
+		return
+	}
+
+	if result := queries.UpsertArchiveLink(p.db, reqID, archiveLink.Url, time.Now().Add(p.ttl)); result.Error != nil {
+		l.Log.Debugf("Failed to store the prefetched archive link for request id %s: %v", reqID, result.Error)
+		endpoints.IncArchivePrefetches("failed")
+		return
+	}
+	endpoints.IncArchivePrefetches("cached")
+}
@@ -0,0 +1,80 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/time/rate"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+	"github.com/redhatinsights/payload-tracker-go/internal/models/message"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+)
+
+var _ = Describe("Archive link prefetch", func() {
+	var prefetcher *archivePrefetcher
+
+	BeforeEach(func() {
+		prefetcher = &archivePrefetcher{
+			limiter: rate.NewLimiter(rate.Inf, 1),
+			queue:   make(chan string, 1),
+			service: "ingress",
+			status:  "upload-success",
+		}
+	})
+
+	It("Is disabled by default", func() {
+		Expect(newArchivePrefetcher(context.Background(), config.Get(), nil)).To(BeNil())
+	})
+
+	It("Queues payloads reaching the prefetch status from the service", func() {
+		prefetcher.onStatus(&message.PayloadStatusMessage{Service: "puptoo", Status: "upload-success", RequestID: "other-service"})
+		prefetcher.onStatus(&message.PayloadStatusMessage{Service: "ingress", Status: "processing", RequestID: "other-status"})
+		prefetcher.onStatus(&message.PayloadStatusMessage{Service: "ingress", Status: "upload-success", RequestID: "uploaded"})
+
+		Expect(prefetcher.queue).To(Receive(Equal("uploaded")))
+		Expect(prefetcher.queue).ToNot(Receive())
+	})
+
+	It("Drops payloads rather than wait on a full queue", func() {
+		for _, reqID := range []string{"first", "second"} {
+			prefetcher.onStatus(&message.PayloadStatusMessage{Service: "ingress", Status: "upload-success", RequestID: reqID})
+		}
+
+		Expect(prefetcher.queue).To(Receive(Equal("first")))
+		Expect(prefetcher.queue).ToNot(Receive())
+	})
+
+	It("Doesn't store anything for payloads without a link", func() {
+		var lookedUp []string
+		prefetcher.lookup = func(_ context.Context, reqID string) (*structs.PayloadArchiveLink, error) {
+			lookedUp = append(lookedUp, reqID)
+			if reqID == "failing" {
+				return nil, errors.New("storage-broker is down")
+			}
+			return &structs.PayloadArchiveLink{}, nil
+		}
+
+		// without a DB a store would panic
+		prefetcher.prefetch(context.Background(), "missing")
+		prefetcher.prefetch(context.Background(), "failing")
+		Expect(lookedUp).To(Equal([]string{"missing", "failing"}))
+	})
+
+	It("Looks up the queued payloads in the background", func() {
+		looked := make(chan string, 1)
+		prefetcher.lookup = func(_ context.Context, reqID string) (*structs.PayloadArchiveLink, error) {
+			looked <- reqID
+			return &structs.PayloadArchiveLink{}, nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go prefetcher.work(ctx)
+
+		prefetcher.onStatus(&message.PayloadStatusMessage{Service: "ingress", Status: "upload-success", RequestID: "uploaded"})
+		Eventually(looked).Should(Receive(Equal("uploaded")))
+	})
+})
@@ -0,0 +1,161 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"gorm.io/gorm"
+
+	config "github.com/redhatinsights/payload-tracker-go/internal/config"
+	l "github.com/redhatinsights/payload-tracker-go/internal/logging"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+)
+
+// NewDeadLetterReplayer returns a function that reads up to limit messages off of the dead letter topic, as it
+// stood when the replay started, and runs them back through the message handler. Messages that still fail are
+// sent back with the producer, one that can't be sent back is left uncommitted along with the rest of its partition.
+func NewDeadLetterReplayer(cfg *config.TrackerConfig, db *gorm.DB, producer *kafka.Producer) func(context.Context, int) (structs.ReplayResult, error) {
+	return func(ctx context.Context, limit int) (structs.ReplayResult, error) {
+		var result structs.ReplayResult
+
+		if cfg.KafkaConfig.KafkaDeadLetterTopic == "" {
+			return result, errors.New("dead letter topic is not configured")
+		}
+		if producer == nil {
+			return result, errors.New("kafka producer is not available")
+		}
+
+		configMap := consumerConfigMap(cfg)
+		configMap["group.id"] = cfg.KafkaConfig.KafkaGroupID + "-replay"
+		configMap["auto.offset.reset"] = "earliest"
+		configMap["enable.auto.commit"] = false
+
+		consumer, err := kafka.NewConsumer(&configMap)
+		if err != nil {
+			return result, err
+		}
+		defer consumer.Close()
+
+		if err := consumer.SubscribeTopics([]string{cfg.KafkaConfig.KafkaDeadLetterTopic}, nil); err != nil {
+			return result, err
+		}
+
+		// the dead letters that still fail are sent back to the topic, the replay stops at the offsets the
+		// topic ended at when it started so it doesn't read those back again
+		highWater, err := highWaterMarks(consumer, cfg.KafkaConfig.KafkaDeadLetterTopic, cfg.KafkaConfig.KafkaTimeout)
+		if err != nil {
+			return result, err
+		}
+
+		// messages that still fail are sent back to the dead letter topic before the replay is reported
+		defer producer.Flush(cfg.KafkaConfig.KafkaTimeout)
+
+		handler := &handler{
+			db:                 db,
+			producer:           producer,
+			decode:             newMessageDecoder(cfg),
+			confirmDeadLetters: true,
+		}
+
+		// stop once the topic has been idle for the kafka timeout
+		idle := time.Duration(cfg.KafkaConfig.KafkaTimeout) * time.Millisecond
+		deadline := time.Now().Add(idle)
+		// partitions that reached their high-water mark, or a message that can't be committed past
+		stopped := map[int32]bool{}
+
+		for result.Succeeded+result.Failed < limit && len(stopped) < len(highWater) && time.Now().Before(deadline) && ctx.Err() == nil {
+			event := consumer.Poll(100)
+			if event == nil {
+				continue
+			}
+
+			switch e := event.(type) {
+			case *kafka.Message:
+				partition, offset := e.TopicPartition.Partition, int64(e.TopicPartition.Offset)
+				if stopped[partition] {
+					continue
+				}
+				if offset >= highWater[partition] {
+					stopped[partition] = true
+					continue
+				}
+
+				succeeded, committed := replayMessage(ctx, handler, consumer, e, cfg)
+				if succeeded {
+					result.Succeeded++
+				} else {
+					result.Failed++
+				}
+				if !committed || offset+1 >= highWater[partition] {
+					stopped[partition] = true
+				}
+				deadline = time.Now().Add(idle)
+			case kafka.Error:
+				return result, e
+			}
+		}
+
+		l.Log.Infof("Replayed dead letters: %d succeeded, %d failed", result.Succeeded, result.Failed)
+
+		return result, nil
+	}
+}
+
+// offsetCommitter is the part of the consumer a replay commits its messages with
+type offsetCommitter interface {
+	CommitMessage(*kafka.Message) ([]kafka.TopicPartition, error)
+}
+
+// replayMessage runs a dead letter back through the handler and reports whether it succeeded and whether it was
+// committed. A message is only committed once it succeeded or was dead lettered again, any other failure leaves
+// it to the next replay.
+func replayMessage(ctx context.Context, handler *handler, consumer offsetCommitter, msg *kafka.Message, cfg *config.TrackerConfig) (bool, bool) {
+	err := handler.onMessage(ctx, msg, cfg)
+	if err != nil && !errors.As(err, &deadLetteredError{}) {
+		messageLogger(msg).Error("ERROR: Replayed message failed without being dead lettered, leaving it uncommitted: ", err)
+		return false, false
+	}
+
+	if _, commitErr := consumer.CommitMessage(msg); commitErr != nil {
+		l.Log.Error("ERROR: Failed to commit replayed message: ", commitErr)
+		return err == nil, false
+	}
+	return err == nil, true
+}
+
+// highWaterMarks returns the offset each partition of the topic ends at, leaving out the partitions the
+// consumer group has already committed up to it
+func highWaterMarks(consumer *kafka.Consumer, topic string, timeoutMs int) (map[int32]int64, error) {
+	metadata, err := consumer.GetMetadata(&topic, false, timeoutMs)
+	if err != nil {
+		return nil, err
+	}
+
+	var partitions []kafka.TopicPartition
+	for _, partition := range metadata.Topics[topic].Partitions {
+		partitions = append(partitions, kafka.TopicPartition{Topic: &topic, Partition: partition.ID})
+	}
+	committed, err := consumer.Committed(partitions, timeoutMs)
+	if err != nil {
+		return nil, err
+	}
+
+	highWater := make(map[int32]int64, len(committed))
+	for _, partition := range committed {
+		low, high, err := consumer.QueryWatermarkOffsets(topic, partition.Partition, timeoutMs)
+		if err != nil {
+			return nil, err
+		}
+		// without a committed offset the group starts from the earliest message
+		start := int64(partition.Offset)
+		if start < 0 {
+			start = low
+		}
+		if start < high {
+			highWater[partition.Partition] = high
+		}
+	}
+	return highWater, nil
+}
@@ -0,0 +1,67 @@
+package kafka
+
+import (
+	"context"
+
+	k "github.com/confluentinc/confluent-kafka-go/kafka"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/redhatinsights/payload-tracker-go/internal/config"
+)
+
+type recordingCommitter struct {
+	committed []*k.Message
+}
+
+func (c *recordingCommitter) CommitMessage(msg *k.Message) ([]k.TopicPartition, error) {
+	c.committed = append(c.committed, msg)
+	return []k.TopicPartition{msg.TopicPartition}, nil
+}
+
+var _ = Describe("Dead letter replay", func() {
+	var committer *recordingCommitter
+
+	BeforeEach(func() {
+		committer = &recordingCommitter{}
+	})
+
+	It("Commits a message that succeeds", func() {
+		topic := "topic.payload.status.dlq"
+		tombstone := &k.Message{TopicPartition: k.TopicPartition{Topic: &topic}}
+
+		succeeded, committed := replayMessage(context.Background(), &handler{}, committer, tombstone, config.Get())
+		Expect(succeeded).To(BeTrue())
+		Expect(committed).To(BeTrue())
+		Expect(committer.committed).To(ConsistOf(tombstone))
+	})
+
+	It("Leaves a message uncommitted when its DB insert fails", func() {
+		// nothing listens on the port, so every insert fails
+		unreachable, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 user=test dbname=test sslmode=disable connect_timeout=1"), &gorm.Config{
+			DisableAutomaticPing: true,
+			Logger:               logger.Discard,
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		msg := newKafkaMessage(getSimplePayloadStatusMessage())
+		succeeded, committed := replayMessage(context.Background(), &handler{db: unreachable}, committer, msg, config.Get())
+		Expect(succeeded).To(BeFalse())
+		Expect(committed).To(BeFalse())
+		Expect(committer.committed).To(BeEmpty())
+	})
+
+	It("Leaves an invalid message uncommitted when it can't be dead lettered again", func() {
+		topic := "topic.payload.status.dlq"
+		invalid := &k.Message{Value: []byte("not json"), TopicPartition: k.TopicPartition{Topic: &topic}}
+
+		// without a producer the message isn't sent back to the dead letter topic
+		succeeded, committed := replayMessage(context.Background(), &handler{}, committer, invalid, config.Get())
+		Expect(succeeded).To(BeFalse())
+		Expect(committed).To(BeFalse())
+		Expect(committer.committed).To(BeEmpty())
+	})
+})
@@ -0,0 +1,51 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+
+	config "github.com/redhatinsights/payload-tracker-go/internal/config"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
+)
+
+// NewReprocessAnnouncer returns a function that announces an upload again on the reprocess topic
+// with the producer and waits for the broker to acknowledge it
+func NewReprocessAnnouncer(cfg *config.TrackerConfig, producer *kafka.Producer) func(context.Context, structs.ReprocessAnnouncement) error {
+	return func(ctx context.Context, announcement structs.ReprocessAnnouncement) error {
+		topic := cfg.KafkaConfig.KafkaReprocessTopic
+		if topic == "" {
+			return errors.New("reprocess topic is not configured")
+		}
+		if producer == nil {
+			return errors.New("kafka producer is not available")
+		}
+
+		value, err := json.Marshal(announcement)
+		if err != nil {
+			return err
+		}
+
+		delivery := make(chan kafka.Event, 1)
+		err = producer.Produce(&kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+			Key:            []byte(announcement.RequestID),
+			Value:          value,
+		}, delivery)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case e := <-delivery:
+			if m, ok := e.(*kafka.Message); ok && m.TopicPartition.Error != nil {
+				return m.TopicPartition.Error
+			}
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -91,27 +91,26 @@ func InitLogger() *logrus.Logger {
 	group := cfg.CloudwatchConfig.CWLogGroup
 	stream := cfg.Hostname
 
-	switch cfg.LogLevel {
-	case "DEBUG":
-		logLevel = logrus.DebugLevel
-	case "ERROR":
-		logLevel = logrus.ErrorLevel
-	default:
-		logLevel = logrus.InfoLevel
-	}
+	logLevel = parseLevel(cfg.LogLevel)
+	levels, levelsErr := parseModuleLevels(logLevel, cfg.LogLevelOverrides)
 	if flag.Lookup("test.v") != nil {
 		logLevel = logrus.FatalLevel
+		levels, levelsErr = moduleLevels{global: logLevel}, nil
 	}
 
 	formatter := NewCloudwatchFormatter(cfg)
 
+	// entries are filtered by module after the logger lets through the most verbose level of any of them
 	Log = &logrus.Logger{
 		Out:          os.Stdout,
-		Level:        logLevel,
-		Formatter:    formatter,
+		Level:        levels.lowest(),
+		Formatter:    moduleFormatter{Formatter: formatter, levels: levels},
 		Hooks:        make(logrus.LevelHooks),
 		ReportCaller: true,
 	}
+	if levelsErr != nil {
+		Log.Fatal("Invalid log level overrides: ", levelsErr)
+	}
 
 	if key != "" {
 		cred := credentials.NewStaticCredentials(key, secret, "")
@@ -120,7 +119,7 @@ func InitLogger() *logrus.Logger {
 		if err != nil {
 			Log.Info(err)
 		}
-		Log.Hooks.Add(hook)
+		Log.Hooks.Add(moduleHook{Hook: hook, levels: levels})
 	}
 
 	return Log
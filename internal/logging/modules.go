@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// modulePackages are the packages each module that can be given its own log level logs from
+var modulePackages = map[string][]string{
+	"endpoints":  {"internal/endpoints"},
+	"db_methods": {"internal/db", "internal/queries"},
+	"consumer":   {"internal/kafka"},
+}
+
+// ModuleField tags an entry with the module it is logged for when that isn't the module of its caller,
+// such as the queries the endpoints trace for a sampled request
+const ModuleField = "module"
+
+// moduleLevels filters log entries by the level of the module they are logged from, falling back to the
+// global level for the modules without an override and for code outside of any module
+type moduleLevels struct {
+	global    logrus.Level
+	overrides map[string]logrus.Level
+}
+
+// parseLevel returns the level named by the config, info when it isn't a known level
+func parseLevel(level string) logrus.Level {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return logrus.InfoLevel
+	}
+	return parsed
+}
+
+func parseModuleLevels(global logrus.Level, pairs []string) (moduleLevels, error) {
+	levels := moduleLevels{global: global, overrides: make(map[string]logrus.Level)}
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return levels, fmt.Errorf("%s is not a module:level pair", pair)
+		}
+		if _, ok := modulePackages[parts[0]]; !ok {
+			return levels, fmt.Errorf("%s is not a module, must be one of endpoints, db_methods or consumer", parts[0])
+		}
+		level, err := logrus.ParseLevel(parts[1])
+		if err != nil {
+			return levels, fmt.Errorf("%s of module %s: %v", parts[1], parts[0], err)
+		}
+		levels.overrides[parts[0]] = level
+	}
+	return levels, nil
+}
+
+// lowest is the most verbose of the levels, the logger has to let everything it enables through before filtering
+func (m moduleLevels) lowest() logrus.Level {
+	lowest := m.global
+	for _, level := range m.overrides {
+		if level > lowest {
+			lowest = level
+		}
+	}
+	return lowest
+}
+
+func (m moduleLevels) enabled(entry *logrus.Entry) bool {
+	level := m.global
+	if override, ok := m.overrides[entryModule(entry)]; ok {
+		level = override
+	}
+	return entry.Level <= level
+}
+
+// entryModule is the module the entry is tagged with or else the module of the package it was logged from,
+// which relies on the logger reporting callers
+func entryModule(entry *logrus.Entry) string {
+	if module, ok := entry.Data[ModuleField].(string); ok {
+		if _, known := modulePackages[module]; known {
+			return module
+		}
+	}
+	if entry.Caller == nil {
+		return ""
+	}
+
+	// a function is named after its package path, such as .../internal/kafka.(*handler).onMessage
+	function := entry.Caller.Function
+	pkg := function
+	if dot := strings.Index(function[strings.LastIndex(function, "/")+1:], "."); dot >= 0 {
+		pkg = function[:strings.LastIndex(function, "/")+1+dot]
+	}
+
+	for module, packages := range modulePackages {
+		for _, modulePkg := range packages {
+			if strings.HasSuffix(pkg, "/"+modulePkg) {
+				return module
+			}
+		}
+	}
+	return ""
+}
+
+// moduleFormatter formats only the entries enabled for their module, the others are written as nothing
+type moduleFormatter struct {
+	logrus.Formatter
+	levels moduleLevels
+}
+
+func (f moduleFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if !f.levels.enabled(entry) {
+		return nil, nil
+	}
+	return f.Formatter.Format(entry)
+}
+
+// moduleHook only fires the hook for the entries enabled for their module
+type moduleHook struct {
+	logrus.Hook
+	levels moduleLevels
+}
+
+func (h moduleHook) Fire(entry *logrus.Entry) error {
+	if !h.levels.enabled(entry) {
+		return nil
+	}
+	return h.Hook.Fire(entry)
+}
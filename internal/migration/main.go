@@ -4,7 +4,6 @@ import (
 	"github.com/redhatinsights/payload-tracker-go/internal/config"
 	"github.com/redhatinsights/payload-tracker-go/internal/db"
 	"github.com/redhatinsights/payload-tracker-go/internal/logging"
-	models "github.com/redhatinsights/payload-tracker-go/internal/models/db"
 )
 
 func main() {
@@ -14,15 +13,9 @@ func main() {
 
 	db.DbConnect(cfg)
 
-	db.DB.AutoMigrate(
-		&models.Services{},
-		&models.Sources{},
-		&models.Statuses{},
-		&models.PayloadStatuses{},
-		&models.Payloads{},
-	)
-
-	db.DB.Exec("ALTER SEQUENCE payloads_id_seq AS bigint")
+	if err := db.Migrate(db.DB); err != nil {
+		logging.Log.Fatal(err)
+	}
 
 	logging.Log.Info("DB Migration Complete")
 }
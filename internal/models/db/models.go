@@ -17,6 +17,11 @@ type PayloadStatuses struct {
 	Service   Services
 	Source    Sources
 	Status    Statuses
+
+	// ReceivedAt is when the consumer persisted the status, it is null for statuses from before it was recorded
+	ReceivedAt *time.Time
+	// RawService is the name the status was sent under when it was an alias of the service, if recording it is enabled
+	RawService string `gorm:"type:varchar"`
 }
 
 type Payloads struct {
@@ -27,6 +32,8 @@ type Payloads struct {
 	SystemId    string    `json:"system_id" gorm:"type:varchar"`
 	CreatedAt   time.Time `gorm:"not null"`
 	OrgId       string    `json:"org_id" gorm:"type:varchar"`
+	// DeletedAt is set by the retention job in soft delete mode, the payload is hidden until it is purged
+	DeletedAt *time.Time
 }
 
 type Services struct {
@@ -43,3 +50,21 @@ type Statuses struct {
 	Id   int32  `gorm:"primaryKey;not null;autoIncrement"`
 	Name string `gorm:"not null;type:varchar"`
 }
+
+// ArchiveLinks are the archive links prefetched by the consumer, each is kept until it expires
+type ArchiveLinks struct {
+	RequestId string    `gorm:"primaryKey;type:varchar"`
+	Url       string    `gorm:"not null;type:varchar"`
+	ExpiresAt time.Time `gorm:"not null"`
+}
+
+// IdempotencyKeys are the responses to admin writes sent with an Idempotency-Key, each is replayed until it expires
+type IdempotencyKeys struct {
+	Key         string    `gorm:"primaryKey;type:varchar"`
+	StatusCode  int       `gorm:"not null"`
+	ContentType string    `gorm:"type:varchar"`
+	Body        []byte    `gorm:"type:bytea"`
+	ExpiresAt   time.Time `gorm:"not null"`
+	// RequestHash is the sha256 of the request body the response was for
+	RequestHash string `gorm:"type:varchar"`
+}
@@ -27,6 +27,23 @@ type PayloadStatusMessage struct {
 	Date        FormatedTime `json:"date"`
 }
 
+// EnrichedStatusMessage is a persisted status as emitted to the enriched topic, with the service names
+// normalized and the fields the tracker adds
+type EnrichedStatusMessage struct {
+	PayloadID   uint       `json:"payload_id"`
+	Service     string     `json:"service"`
+	Source      string     `json:"source,omitempty"`
+	Account     string     `json:"account,omitempty"`
+	OrgID       string     `json:"org_id,omitempty"`
+	RequestID   string     `json:"request_id"`
+	InventoryID string     `json:"inventory_id,omitempty"`
+	SystemID    string     `json:"system_id,omitempty"`
+	Status      string     `json:"status"`
+	StatusMSG   string     `json:"status_msg,omitempty"`
+	Date        time.Time  `json:"date"`
+	ReceivedAt  *time.Time `json:"received_at,omitempty"`
+}
+
 type FormatedTime struct {
 	time.Time
 }
@@ -17,16 +17,52 @@ type PayloadStatuses struct {
 	Service   Services
 	Source    Sources
 	Status    Statuses
+
+	// ReceivedAt is when the consumer persisted the status, it is null for statuses from before it was recorded
+	ReceivedAt *time.Time
 }
 
 type Payloads struct {
-	Id          uint      `json:"id" gorm:"primaryKey;not null;autoIncrement;type:bigint"`
+	Id          uint      `json:"id,string" gorm:"primaryKey;not null;autoIncrement;type:bigint"`
 	RequestId   string    `json:"request_id" gorm:"not null;type:varchar"`
 	Account     string    `json:"account" gorm:"type:varchar"`
 	InventoryId string    `json:"inventory_id" gorm:"type:varchar"`
 	SystemId    string    `json:"system_id" gorm:"type:varchar"`
 	CreatedAt   time.Time `json:"created_at" gorm:"not null"`
 	OrgId       string    `json:"org_id" gorm:"varchar"`
+	// SecondsSinceUpdate is only selected by /payloads with include_staleness=true
+	SecondsSinceUpdate *float64 `json:"seconds_since_update,omitempty" gorm:"->;-:migration"`
+	// Terminal is only selected by /payloads with include_terminal=true
+	Terminal *bool `json:"terminal,omitempty" gorm:"->;-:migration"`
+	// LatestStatus is only filled in by /payloads with latest_only=true
+	LatestStatus *LatestStatus `json:"latest_status,omitempty" gorm:"-"`
+	// FirstService and LastService are only filled in by /payloads with include_services=true
+	FirstService string `json:"first_service,omitempty" gorm:"-"`
+	LastService  string `json:"last_service,omitempty" gorm:"-"`
+	// Statuses are only filled in by /payloads with embed=statuses, StatusesTruncated is set when some
+	// of the earliest were left out to keep the page under its cap
+	Statuses          []EmbeddedStatus `json:"statuses,omitempty" gorm:"-"`
+	StatusesTruncated bool             `json:"statuses_truncated,omitempty" gorm:"-"`
+	// DeletedAt is when retention soft deleted the payload, only such payloads are served with include_deleted=true
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// LatestStatus is the most recent status recorded for a payload
+type LatestStatus struct {
+	Service string    `json:"service"`
+	Status  string    `json:"status"`
+	Date    time.Time `json:"date"`
+}
+
+// EmbeddedStatus is a status nested in its payload, the fields left out by the verbosity are omitted
+type EmbeddedStatus struct {
+	Service    string     `json:"service"`
+	Source     string     `json:"source,omitempty"`
+	Status     string     `json:"status"`
+	StatusMsg  string     `json:"status_msg,omitempty"`
+	Date       time.Time  `json:"date"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	ReceivedAt *time.Time `json:"received_at,omitempty"`
 }
 
 type Services struct {
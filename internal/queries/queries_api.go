@@ -2,19 +2,22 @@ package queries
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/redhatinsights/payload-tracker-go/internal/models"
+	dbModels "github.com/redhatinsights/payload-tracker-go/internal/models/db"
 	"github.com/redhatinsights/payload-tracker-go/internal/structs"
 )
 
 var (
 	payloadFields         = []string{"payloads.id", "payloads.request_id"}
 	extraPayloadFields    = []string{"payloads.account", "payloads.org_id", "payloads.system_id", "payloads.inventory_id"}
-	payloadStatusesFields = []string{"payload_statuses.status_msg", "payload_statuses.date", "payload_statuses.created_at"}
+	payloadStatusesFields = []string{"payload_statuses.status_msg", "payload_statuses.date", "payload_statuses.created_at", "payload_statuses.received_at"}
 	otherFields           = []string{"services.name as service", "sources.name as source", "statuses.name as status"}
 )
 
@@ -32,6 +35,19 @@ func defineVerbosity(verbosity string) string {
 	}
 }
 
+// embeddedStatusFields are the status columns nested in /payloads rows for each verbosity, the payload
+// columns defineVerbosity adds are left out as the row already has them
+func embeddedStatusFields(verbosity string) []string {
+	switch verbosity {
+	case "1":
+		return []string{otherFields[0], otherFields[2], payloadStatusesFields[1], payloadStatusesFields[0]}
+	case "2":
+		return []string{otherFields[0], otherFields[2], payloadStatusesFields[1]}
+	default:
+		return append(append([]string{}, otherFields...), payloadStatusesFields...)
+	}
+}
+
 func interpretDuration(duration int64) string {
 	rem := duration
 
@@ -87,35 +103,473 @@ func chainTimeConditions(dbColumn string, apiQuery structs.Query, dbQuery *gorm.
 	return dbQuery
 }
 
+// PageOffset converts a page number, counted from pageBase, into the number of rows to skip
+func PageOffset(page int, pageSize int, pageBase int) int {
+	return pageSize * (page - pageBase)
+}
+
+// PageStatuses returns a single page of the statuses already retrieved for a payload
+func PageStatuses(statuses []structs.SinglePayloadData, page int, pageSize int, pageBase int) []structs.SinglePayloadData {
+	offset := PageOffset(page, pageSize, pageBase)
+	if offset >= len(statuses) {
+		return []structs.SinglePayloadData{}
+	}
+
+	end := offset + pageSize
+	if end > len(statuses) {
+		end = len(statuses)
+	}
+	return statuses[offset:end]
+}
+
+// StatusCounts tallies how many times each status occurs in the statuses
+func StatusCounts(statuses []structs.SinglePayloadData) map[string]int {
+	counts := make(map[string]int)
+	for _, status := range statuses {
+		counts[status.Status]++
+	}
+	return counts
+}
+
+// SummaryStatuses keeps only the oldest and newest statuses by date, in the order they were given
+func SummaryStatuses(statuses []structs.SinglePayloadData) []structs.SinglePayloadData {
+	if len(statuses) <= 2 {
+		return statuses
+	}
+
+	oldest, newest := 0, 0
+	for i, status := range statuses {
+		if status.Date.Before(statuses[oldest].Date) {
+			oldest = i
+		}
+		if status.Date.After(statuses[newest].Date) {
+			newest = i
+		}
+	}
+
+	switch {
+	case oldest == newest:
+		return []structs.SinglePayloadData{statuses[oldest]}
+	case oldest < newest:
+		return []structs.SinglePayloadData{statuses[oldest], statuses[newest]}
+	default:
+		return []structs.SinglePayloadData{statuses[newest], statuses[oldest]}
+	}
+}
+
+// likeEscaper escapes the LIKE wildcards and the escape character itself
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// escapeLike makes LIKE treat the wildcards and escape character in value literally
+func escapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
+
+// excludeDeleted leaves out the payloads retention soft deleted unless they were asked for
+func excludeDeleted(dbQuery *gorm.DB, includeDeleted bool) *gorm.DB {
+	if includeDeleted {
+		return dbQuery
+	}
+	return dbQuery.Where("payloads.deleted_at IS NULL")
+}
+
+// whereMsgPath keeps the status rows whose status_msg is JSON with msg_value at msg_path, messages that aren't JSON never match
+func whereMsgPath(dbQuery *gorm.DB, apiQuery structs.Query) *gorm.DB {
+	if apiQuery.MsgPath == "" {
+		return dbQuery
+	}
+	return dbQuery.Where("status_msg_jsonb(payload_statuses.status_msg) #>> string_to_array(?, '.') = ?", apiQuery.MsgPath, apiQuery.MsgValue)
+}
+
+// payloadStatusesSubquery starts a subquery over the status rows belonging to the outer payloads row
+func payloadStatusesSubquery(dbQuery *gorm.DB) *gorm.DB {
+	return dbQuery.Session(&gorm.Session{NewDB: true}).Table("payload_statuses").Select("1").Where("payload_statuses.payload_id = payloads.id")
+}
+
+// numericAccount is the account as a number, or NULL for accounts that aren't all digits
+const numericAccount = "(CASE WHEN payloads.account ~ '^[0-9]+$' THEN payloads.account::numeric END)"
+
+// PayloadFilters are the filters on payloads columns in the default order they are applied, most selective first
+var PayloadFilters = []string{"request_id_prefix", "inventory_id", "system_id", "org_id", "account"}
+
+// HintFilters are the filters that a query hint can be keyed on
+var HintFilters = []string{"request_id_prefix", "inventory_id", "system_id", "org_id", "account", "created_at", "service", "status"}
+
+// SubqueryFilters counts the status subqueries RetrievePayloads adds for the query
+func SubqueryFilters(apiQuery structs.Query) int {
+	count := len(apiQuery.ServiceStatus)
+	if apiQuery.Service != "" || apiQuery.Status != "" || apiQuery.StatusMsg != "" || apiQuery.MsgPath != "" {
+		count++
+	}
+	if apiQuery.HasMessage != nil {
+		count++
+	}
+	if len(apiQuery.StatusNE) > 0 {
+		count++
+	}
+	if len(apiQuery.ServiceNE) > 0 {
+		count++
+	}
+	if apiQuery.MinStatuses > 0 {
+		count++
+	}
+	return count
+}
+
+// orderedPayloadFilters puts the configured filters first, any left out keep their default order after them
+func orderedPayloadFilters(order []string) []string {
+	filters := append([]string{}, order...)
+	for _, filter := range PayloadFilters {
+		found := false
+		for _, ordered := range order {
+			if ordered == filter {
+				found = true
+				break
+			}
+		}
+		if !found {
+			filters = append(filters, filter)
+		}
+	}
+	return filters
+}
+
+// QueryHintKey is the name of a combination of filters, the filters are sorted so the order they are written in doesn't matter
+func QueryHintKey(filters []string) string {
+	sorted := append([]string{}, filters...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, "+")
+}
+
+// queryHint looks up the hint configured for exactly the combination of filters in the query
+func queryHint(apiQuery structs.Query) string {
+	if len(apiQuery.QueryHints) == 0 {
+		return ""
+	}
+
+	set := map[string]bool{
+		"request_id_prefix": apiQuery.RequestIDPrefix != "",
+		"inventory_id":      apiQuery.InventoryID != "",
+		"system_id":         apiQuery.SystemID != "",
+		"org_id":            apiQuery.OrgID != "",
+		"account":           len(apiQuery.Accounts) > 0,
+		"created_at":        apiQuery.CreatedAtLT != "" || apiQuery.CreatedAtLTE != "" || apiQuery.CreatedAtGT != "" || apiQuery.CreatedAtGTE != "",
+		"service":           apiQuery.Service != "",
+		"status":            apiQuery.Status != "",
+	}
+	var filters []string
+	for _, filter := range HintFilters {
+		if set[filter] {
+			filters = append(filters, filter)
+		}
+	}
+	return apiQuery.QueryHints[QueryHintKey(filters)]
+}
+
+// planHint is a pg_hint_plan hint comment put ahead of the SELECT, postgres without the extension ignores it
+type planHint string
+
+func (h planHint) ModifyStatement(stmt *gorm.Statement) {
+	selectClause := stmt.Clauses["SELECT"]
+	selectClause.BeforeExpression = h
+	stmt.Clauses["SELECT"] = selectClause
+}
+
+func (h planHint) Build(builder clause.Builder) {
+	builder.WriteString("/*+ ")
+	builder.WriteString(strings.ReplaceAll(string(h), "*/", ""))
+	builder.WriteString(" */")
+}
+
 var RetrievePayloads = func(dbQuery *gorm.DB, page int, pageSize int, apiQuery structs.Query) (int64, []models.Payloads) {
 	var count int64
 	var payloads []models.Payloads
 
-	// query chaining
-	if apiQuery.Account != "" {
-		dbQuery = dbQuery.Where("account = ?", apiQuery.Account)
+	if hint := queryHint(apiQuery); hint != "" {
+		dbQuery = dbQuery.Clauses(planHint(hint))
+	}
+
+	// query chaining, the payloads columns go in the configured order
+	for _, filter := range orderedPayloadFilters(apiQuery.FilterOrder) {
+		switch filter {
+		case "account":
+			if len(apiQuery.Accounts) > 0 {
+				dbQuery = dbQuery.Where("account IN ?", apiQuery.Accounts)
+			}
+		case "org_id":
+			if apiQuery.OrgID != "" {
+				dbQuery = dbQuery.Where("org_id = ?", apiQuery.OrgID)
+			}
+		case "inventory_id":
+			if apiQuery.InventoryID != "" {
+				dbQuery = dbQuery.Where("inventory_id = ?", apiQuery.InventoryID)
+			}
+		case "system_id":
+			if apiQuery.SystemID != "" {
+				dbQuery = dbQuery.Where("system_id = ?", apiQuery.SystemID)
+			}
+		case "request_id_prefix":
+			if apiQuery.RequestIDPrefix != "" {
+				dbQuery = dbQuery.Where("payloads.request_id LIKE ? ESCAPE '\\'", escapeLike(apiQuery.RequestIDPrefix)+"%")
+			}
+		}
+	}
+
+	// service, status, status_msg and msg_path must match on the same status row
+	if apiQuery.Service != "" || apiQuery.Status != "" || apiQuery.StatusMsg != "" || apiQuery.MsgPath != "" {
+		statusQuery := payloadStatusesSubquery(dbQuery)
+		if apiQuery.Service != "" {
+			statusQuery = statusQuery.Joins("JOIN services on payload_statuses.service_id = services.id").Where("services.name = ?", apiQuery.Service)
+		}
+		if apiQuery.Status != "" {
+			statusQuery = statusQuery.Joins("JOIN statuses on payload_statuses.status_id = statuses.id").Where("statuses.name = ?", apiQuery.Status)
+		}
+		if apiQuery.StatusMsg != "" {
+			statusQuery = statusQuery.Where("payload_statuses.status_msg = ?", apiQuery.StatusMsg)
+		}
+		statusQuery = whereMsgPath(statusQuery, apiQuery)
+		dbQuery = dbQuery.Where("EXISTS (?)", statusQuery)
+	}
+	// a status row with a message, from the service when one is given, has to exist or to be missing
+	if apiQuery.HasMessage != nil {
+		messageQuery := payloadStatusesSubquery(dbQuery).Where("payload_statuses.status_msg <> ''")
+		if apiQuery.Service != "" {
+			messageQuery = messageQuery.Joins("JOIN services on payload_statuses.service_id = services.id").Where("services.name = ?", apiQuery.Service)
+		}
+		if *apiQuery.HasMessage {
+			dbQuery = dbQuery.Where("EXISTS (?)", messageQuery)
+		} else {
+			dbQuery = dbQuery.Where("NOT EXISTS (?)", messageQuery)
+		}
+	}
+	// excludes payloads that ever had one of the statuses, on top of the filters above
+	if len(apiQuery.StatusNE) > 0 {
+		statusQuery := payloadStatusesSubquery(dbQuery).Joins("JOIN statuses on payload_statuses.status_id = statuses.id").Where("statuses.name IN ?", apiQuery.StatusNE)
+		dbQuery = dbQuery.Where("NOT EXISTS (?)", statusQuery)
+	}
+	// excludes payloads that ever had a status from one of the services
+	if len(apiQuery.ServiceNE) > 0 {
+		serviceQuery := payloadStatusesSubquery(dbQuery).Joins("JOIN services on payload_statuses.service_id = services.id").Where("services.name IN ?", apiQuery.ServiceNE)
+		dbQuery = dbQuery.Where("NOT EXISTS (?)", serviceQuery)
 	}
-	if apiQuery.OrgID != "" {
-		dbQuery = dbQuery.Where("org_id = ?", apiQuery.OrgID)
+	// any one of the service:status pairs is enough
+	if len(apiQuery.ServiceStatus) > 0 {
+		pairs := dbQuery.Session(&gorm.Session{NewDB: true})
+		for _, pair := range apiQuery.ServiceStatus {
+			statusQuery := payloadStatusesSubquery(dbQuery).
+				Joins("JOIN services on payload_statuses.service_id = services.id").
+				Joins("JOIN statuses on payload_statuses.status_id = statuses.id").
+				Where("services.name = ? AND statuses.name = ?", pair.Service, pair.Status)
+			pairs = pairs.Or("EXISTS (?)", statusQuery)
+		}
+		dbQuery = dbQuery.Where(pairs)
+	}
+	if apiQuery.MinStatuses > 0 {
+		statusCounts := dbQuery.Session(&gorm.Session{NewDB: true}).Table("payload_statuses").Select("payload_id").Group("payload_id").Having("count(*) >= ?", apiQuery.MinStatuses)
+		dbQuery = dbQuery.Where("payloads.id IN (?)", statusCounts)
 	}
-	if apiQuery.InventoryID != "" {
-		dbQuery = dbQuery.Where("inventory_id = ?", apiQuery.InventoryID)
+
+	// accounts that aren't numbers are left out of a range rather than failing the cast, postgres
+	// doesn't promise to evaluate an AND in order so the check has to be part of the expression
+	if apiQuery.AccountGT != "" {
+		dbQuery = dbQuery.Where(numericAccount+" > ?::numeric", apiQuery.AccountGT)
 	}
-	if apiQuery.SystemID != "" {
-		dbQuery = dbQuery.Where("system_id = ?", apiQuery.SystemID)
+	if apiQuery.AccountLT != "" {
+		dbQuery = dbQuery.Where(numericAccount+" < ?::numeric", apiQuery.AccountLT)
 	}
 
+	dbQuery = excludeDeleted(dbQuery, apiQuery.IncludeDeleted)
 	dbQuery = chainTimeConditions("created_at", apiQuery, dbQuery)
+	if hours := apiQuery.BusinessHours; hours != nil {
+		dbQuery = dbQuery.Where("EXTRACT(hour FROM payloads.created_at AT TIME ZONE ?) BETWEEN ? AND ?", hours.Timezone, hours.Start, hours.End-1)
+	}
 
 	orderString := fmt.Sprintf("%s %s", apiQuery.SortBy, apiQuery.SortDir)
+	// rows with equal sort values would otherwise come back in any order and shift between pages
+	if apiQuery.SortBy != "id" {
+		orderString += ", id ASC"
+	}
 
-	dbQuery.Model(&payloads).Count(&count)
-	dbQuery.Order(orderString).Limit(pageSize).Offset(pageSize * page).Find(&payloads)
+	// the count is the expensive part of listing a large table, -1 says it was skipped
+	count = -1
+	if !apiQuery.SkipCount {
+		dbQuery.Model(&payloads).Count(&count)
+	}
+	// staleness and terminal are subqueries per returned row, so they are only selected when asked for
+	columns := []string{"payloads.*"}
+	var columnArgs []interface{}
+	if apiQuery.IncludeStaleness {
+		latest := payloadStatusesSubquery(dbQuery).Select("max(payload_statuses.date)")
+		columns = append(columns, "EXTRACT(EPOCH FROM now() - (?)) AS seconds_since_update")
+		columnArgs = append(columnArgs, latest)
+	}
+	if apiQuery.TerminalStatuses != nil {
+		latestStatus := payloadStatusesSubquery(dbQuery).Select("statuses.name").
+			Joins("JOIN statuses on payload_statuses.status_id = statuses.id").
+			Order("payload_statuses.date DESC").Limit(1)
+		// a payload without statuses, or an empty terminal set, compares to NULL
+		columns = append(columns, "COALESCE((?) IN ?, false) AS terminal")
+		columnArgs = append(columnArgs, latestStatus, apiQuery.TerminalStatuses)
+	}
+	if len(columns) > 1 {
+		dbQuery = dbQuery.Select(strings.Join(columns, ", "), columnArgs...)
+	}
+	dbQuery.Order(orderString).Limit(pageSize).Offset(PageOffset(page, pageSize, apiQuery.PageBase)).Find(&payloads)
+
+	if apiQuery.LatestOnly {
+		attachLatestStatuses(dbQuery.Session(&gorm.Session{NewDB: true}), payloads)
+	}
+	if apiQuery.IncludeServices {
+		attachFirstLastServices(dbQuery.Session(&gorm.Session{NewDB: true}), payloads)
+	}
+	if apiQuery.EmbedStatuses != nil {
+		attachStatuses(dbQuery.Session(&gorm.Session{NewDB: true}), payloads, *apiQuery.EmbedStatuses)
+	}
 
 	return count, payloads
 }
 
-var RetrieveRequestIdPayloads = func(dbQuery *gorm.DB, reqID string, sortBy string, sortDir string, verbosity string) []structs.SinglePayloadData {
+// attachLatestStatuses fills in the most recent status of each payload on the page with a single
+// DISTINCT ON query, payloads have one row per request_id so distinct payload ids are distinct request_ids
+func attachLatestStatuses(dbQuery *gorm.DB, payloads []models.Payloads) {
+	if len(payloads) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(payloads))
+	for i, payload := range payloads {
+		ids[i] = payload.Id
+	}
+
+	var latest []struct {
+		PayloadId uint
+		Service   string
+		Status    string
+		Date      time.Time
+	}
+	dbQuery.Table("payload_statuses").
+		Select("DISTINCT ON (payload_statuses.payload_id) payload_statuses.payload_id, services.name AS service, statuses.name AS status, payload_statuses.date").
+		Joins("JOIN services on payload_statuses.service_id = services.id").
+		Joins("JOIN statuses on payload_statuses.status_id = statuses.id").
+		Where("payload_statuses.payload_id IN ?", ids).
+		Order("payload_statuses.payload_id, payload_statuses.date DESC").
+		Scan(&latest)
+
+	byPayload := make(map[uint]*models.LatestStatus, len(latest))
+	for _, status := range latest {
+		byPayload[status.PayloadId] = &models.LatestStatus{Service: status.Service, Status: status.Status, Date: status.Date}
+	}
+	for i := range payloads {
+		payloads[i].LatestStatus = byPayload[payloads[i].Id]
+	}
+}
+
+// attachFirstLastServices fills in the services of the earliest and latest status of each payload on the page
+func attachFirstLastServices(dbQuery *gorm.DB, payloads []models.Payloads) {
+	if len(payloads) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(payloads))
+	for i, payload := range payloads {
+		ids[i] = payload.Id
+	}
+
+	var spans []struct {
+		PayloadId    uint
+		FirstService string
+		LastService  string
+	}
+	service := "first_value(services.name) OVER (PARTITION BY payload_statuses.payload_id ORDER BY payload_statuses.date %s)"
+	dbQuery.Table("payload_statuses").
+		Select(fmt.Sprintf("DISTINCT payload_statuses.payload_id, "+service+" AS first_service, "+service+" AS last_service", "ASC", "DESC")).
+		Joins("JOIN services on payload_statuses.service_id = services.id").
+		Where("payload_statuses.payload_id IN ?", ids).
+		Scan(&spans)
+
+	byPayload := make(map[uint]int, len(payloads))
+	for i := range payloads {
+		byPayload[payloads[i].Id] = i
+	}
+	for _, span := range spans {
+		if i, ok := byPayload[span.PayloadId]; ok {
+			payloads[i].FirstService = span.FirstService
+			payloads[i].LastService = span.LastService
+		}
+	}
+}
+
+// attachStatuses nests the statuses of each payload on the page in date order. The limit is shared out evenly
+// between the payloads, one with more statuses than its share keeps its most recent ones and is marked truncated.
+// Every payload gets at least one, even if the page is larger than the limit.
+func attachStatuses(dbQuery *gorm.DB, payloads []models.Payloads, embed structs.EmbedStatuses) {
+	if len(payloads) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(payloads))
+	for i, payload := range payloads {
+		ids[i] = payload.Id
+	}
+	perPayload := embed.Limit / len(payloads)
+	if perPayload < 1 {
+		perPayload = 1
+	}
+
+	var ranked []struct {
+		PayloadId  uint
+		Total      int
+		Service    string
+		Source     string
+		Status     string
+		StatusMsg  string
+		Date       time.Time
+		CreatedAt  *time.Time
+		ReceivedAt *time.Time
+	}
+	columns := append([]string{
+		"payload_statuses.payload_id",
+		"count(*) OVER (PARTITION BY payload_statuses.payload_id) AS total",
+		"row_number() OVER (PARTITION BY payload_statuses.payload_id ORDER BY payload_statuses.date DESC) AS status_rank",
+	}, embeddedStatusFields(embed.Verbosity)...)
+	statuses := dbQuery.Table("payload_statuses").
+		Select(strings.Join(columns, ",")).
+		Joins("JOIN services on payload_statuses.service_id = services.id").
+		Joins("LEFT JOIN sources on payload_statuses.source_id = sources.id").
+		Joins("JOIN statuses on payload_statuses.status_id = statuses.id").
+		Where("payload_statuses.payload_id IN ?", ids)
+	dbQuery.Table("(?) AS ranked", statuses).
+		Where("status_rank <= ?", perPayload).
+		Order("payload_id, date ASC").
+		Scan(&ranked)
+
+	byPayload := make(map[uint]int, len(payloads))
+	for i := range payloads {
+		byPayload[payloads[i].Id] = i
+	}
+	totals := make(map[uint]int, len(payloads))
+	for _, status := range ranked {
+		i, ok := byPayload[status.PayloadId]
+		if !ok {
+			continue
+		}
+		totals[status.PayloadId] = status.Total
+		payloads[i].Statuses = append(payloads[i].Statuses, models.EmbeddedStatus{
+			Service:    status.Service,
+			Source:     status.Source,
+			Status:     status.Status,
+			StatusMsg:  status.StatusMsg,
+			Date:       status.Date,
+			CreatedAt:  status.CreatedAt,
+			ReceivedAt: status.ReceivedAt,
+		})
+	}
+	for i := range payloads {
+		payloads[i].StatusesTruncated = totals[payloads[i].Id] > len(payloads[i].Statuses)
+	}
+}
+
+var RetrieveRequestIdPayloads = func(dbQuery *gorm.DB, reqID string, sortBy string, sortDir string, verbosity string, includeDeleted bool) []structs.SinglePayloadData {
 	var payloads []structs.SinglePayloadData
 
 	fields := defineVerbosity(verbosity)
@@ -125,11 +579,41 @@ var RetrieveRequestIdPayloads = func(dbQuery *gorm.DB, reqID string, sortBy stri
 
 	orderString := fmt.Sprintf("%s %s", sortBy, sortDir)
 
+	dbQuery = excludeDeleted(dbQuery, includeDeleted)
 	dbQuery.Where("payloads.request_id = ?", reqID).Order(orderString).Scan(&payloads)
 
 	return payloads
 }
 
+// PayloadExists reports whether a payload with the request_id has been recorded, soft deleted ones are left out
+var PayloadExists = func(dbQuery *gorm.DB, reqID string) bool {
+	var count int64
+	excludeDeleted(dbQuery.Table("payloads"), false).Where("request_id = ?", reqID).Limit(1).Count(&count)
+	return count > 0
+}
+
+// PayloadHasStatus reports whether the payload with the request_id has reported the status, from the service when one is given
+var PayloadHasStatus = func(dbQuery *gorm.DB, reqID string, service string, status string) bool {
+	var count int64
+	dbQuery = dbQuery.Table("payload_statuses").
+		Joins("JOIN payloads on payload_statuses.payload_id = payloads.id").
+		Joins("JOIN statuses on payload_statuses.status_id = statuses.id").
+		Where("payloads.request_id = ? AND statuses.name = ?", reqID, status)
+	dbQuery = excludeDeleted(dbQuery, false)
+	if service != "" {
+		dbQuery = dbQuery.Joins("JOIN services on payload_statuses.service_id = services.id").Where("services.name = ?", service)
+	}
+	dbQuery.Limit(1).Count(&count)
+	return count > 0
+}
+
+// RetrievePayload returns the payload recorded for the request_id, found is false for a soft deleted one
+var RetrievePayload = func(dbQuery *gorm.DB, reqID string) (models.Payloads, bool) {
+	var payload models.Payloads
+	result := excludeDeleted(dbQuery, false).Where("request_id = ?", reqID).Limit(1).Find(&payload)
+	return payload, result.Error == nil && result.RowsAffected > 0
+}
+
 var RetrieveStatuses = func(dbQuery *gorm.DB, apiQuery structs.Query) (int64, []structs.StatusRetrieve) {
 	var count int64
 	var payloads []structs.StatusRetrieve
@@ -154,24 +638,123 @@ var RetrieveStatuses = func(dbQuery *gorm.DB, apiQuery structs.Query) (int64, []
 	if apiQuery.StatusMsg != "" {
 		dbQuery = dbQuery.Where("payload_statuses.status_msg = ?", apiQuery.StatusMsg)
 	}
+	dbQuery = whereMsgPath(dbQuery, apiQuery)
+	dbQuery = excludeDeleted(dbQuery, apiQuery.IncludeDeleted)
 	dbQuery = chainTimeConditions("date", apiQuery, dbQuery)
 	dbQuery = chainTimeConditions("payload_statuses.created_at", apiQuery, dbQuery)
 
 	orderString := fmt.Sprintf("%s %s", apiQuery.SortBy, apiQuery.SortDir)
 	dbQuery.Model(&payloads).Count(&count)
-	dbQuery.Order(orderString).Limit(pageSize).Offset(pageSize * page).Scan(&payloads)
+	dbQuery.Order(orderString).Limit(pageSize).Offset(PageOffset(page, pageSize, apiQuery.PageBase)).Scan(&payloads)
 
 	return count, payloads
 }
 
+// RetrieveArchiveLink returns the prefetched archive link of the payload, it is empty when there is none that is still valid
+var RetrieveArchiveLink = func(dbQuery *gorm.DB, reqID string) string {
+	var url string
+	dbQuery.Table("archive_links").Select("url").Where("request_id = ? AND expires_at > ?", reqID, time.Now()).Limit(1).Scan(&url)
+	return url
+}
+
+// RetrieveIdempotentResponse returns the response stored for an idempotency key, found is false when there is
+// none that is still valid
+var RetrieveIdempotentResponse = func(dbQuery *gorm.DB, key string) (response dbModels.IdempotencyKeys, found bool) {
+	result := dbQuery.Where("key = ? AND expires_at > ?", key, time.Now()).Limit(1).Find(&response)
+	return response, result.Error == nil && result.RowsAffected > 0
+}
+
+// StoreIdempotentResponse stores the response for an idempotency key, replacing an expired one left for the key
+var StoreIdempotentResponse = func(dbQuery *gorm.DB, response dbModels.IdempotencyKeys) error {
+	return dbQuery.Clauses(clause.OnConflict{UpdateAll: true}).Create(&response).Error
+}
+
+// StatsTables are the tables whose sizes /admin/dbstats reports
+var StatsTables = []string{"payloads", "payload_statuses"}
+
+// RetrieveTableStats returns the estimated rows and total size, indexes and toast included, of each table.
+// A partitioned table is reported as the sum of its partitions. The row counts come from the statistics
+// postgres keeps for autovacuum, counting the rows exactly would scan the tables.
+var RetrieveTableStats = func(dbQuery *gorm.DB, tables []string) ([]structs.TableStats, error) {
+	var stats []structs.TableStats
+	err := dbQuery.Raw(`SELECT c.relname AS "table",
+			(SELECT COALESCE(sum(s.n_live_tup), 0) FROM pg_partition_tree(c.oid) t JOIN pg_stat_user_tables s ON s.relid = t.relid) AS rows,
+			(SELECT COALESCE(sum(pg_total_relation_size(t.relid)), 0) FROM pg_partition_tree(c.oid) t) AS total_bytes
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relname IN ? AND c.relkind IN ('r', 'p') AND n.nspname = current_schema()
+		ORDER BY c.relname`, tables).Scan(&stats).Error
+	return stats, err
+}
+
+var RetrieveDistinctServices = func(dbQuery *gorm.DB) ([]string, error) {
+	var services []string
+	err := dbQuery.Table("services").Distinct("name").Order("name").Pluck("name", &services).Error
+	return services, err
+}
+
+var RetrieveDistinctStatuses = func(dbQuery *gorm.DB) ([]string, error) {
+	var statuses []string
+	err := dbQuery.Table("statuses").Distinct("name").Order("name").Pluck("name", &statuses).Error
+	return statuses, err
+}
+
 func CalculateDurations(payloadData []structs.SinglePayloadData) map[string]string {
+	return FormatDurations(CalculateRawDurations(payloadData), "s")
+}
+
+// RetrieveDurationStats returns percentiles of the end-to-end duration of the payloads created in the window,
+// sampling at most limit payloads
+var RetrieveDurationStats = func(dbQuery *gorm.DB, apiQuery structs.Query, limit int) structs.DurationStats {
+	var stats structs.DurationStats
+
+	durations := dbQuery.Session(&gorm.Session{NewDB: true}).Table("payload_statuses").
+		Select("EXTRACT(EPOCH FROM max(payload_statuses.date) - min(payload_statuses.date)) AS duration").
+		Joins("JOIN payloads on payload_statuses.payload_id = payloads.id")
+	durations = excludeDeleted(durations, apiQuery.IncludeDeleted)
+	durations = chainTimeConditions("payloads.created_at", apiQuery, durations)
+	durations = durations.Group("payload_statuses.payload_id").Limit(limit)
+
+	dbQuery.Table("(?) AS durations", durations).Select(
+		"count(*) AS count, " +
+			"COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY duration), 0) AS p50, " +
+			"COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY duration), 0) AS p95, " +
+			"COALESCE(percentile_cont(0.99) WITHIN GROUP (ORDER BY duration), 0) AS p99",
+	).Scan(&stats)
+
+	return stats
+}
+
+// RetrieveServiceStats returns the number of distinct payloads each service reported a status for in the window,
+// keeping at most limit of the busiest services
+var RetrieveServiceStats = func(dbQuery *gorm.DB, apiQuery structs.Query, limit int) []structs.ServiceCount {
+	services := []structs.ServiceCount{}
+
+	dbQuery = dbQuery.Table("payload_statuses").
+		Select("services.name AS service, count(DISTINCT payload_statuses.payload_id) AS payloads").
+		Joins("JOIN services on payload_statuses.service_id = services.id")
+	if !apiQuery.IncludeDeleted {
+		dbQuery = excludeDeleted(dbQuery.Joins("JOIN payloads on payload_statuses.payload_id = payloads.id"), false)
+	}
+	dbQuery = chainTimeConditions("payload_statuses.created_at", apiQuery, dbQuery)
+	dbQuery.Group("services.name").Order("payloads desc, services.name").Limit(limit).Scan(&services)
+
+	return services
+}
+
+// CalculateRawDurations returns the full precision time spent in each service:source as well as the totals
+func CalculateRawDurations(payloadData []structs.SinglePayloadData) map[string]time.Duration {
 	//service:source
 
 	mapTimeArray := make(map[string][2]int64)
-	mapTimeString := make(map[string]string)
-	mapDurations := make(map[string]int64)
+	mapDurations := make(map[string]time.Duration)
 	mapDurations["total_time_in_services"] = 0
 
+	if len(payloadData) == 0 {
+		mapDurations["total_time"] = 0
+		return mapDurations
+	}
+
 	dateMinMaxArray := [2]int64{payloadData[0].Date.UnixNano(), payloadData[0].Date.UnixNano()}
 
 	for _, v := range payloadData {
@@ -199,13 +782,88 @@ func CalculateDurations(payloadData []structs.SinglePayloadData) map[string]stri
 
 	for key, timeArray := range mapTimeArray {
 		min, max := timeArray[0], timeArray[1]
-		duration := max - min
+		duration := time.Duration(max - min)
 		mapDurations["total_time_in_services"] += duration
-		mapTimeString[key] = interpretDuration(duration)
+		mapDurations[key] = duration
+	}
+
+	mapDurations["total_time"] = time.Duration(dateMinMaxArray[1] - dateMinMaxArray[0])
+
+	return mapDurations
+}
+
+// SLADurations returns the time a payload has spent against the SLA and the budget it has left, a payload is timed
+// from its first status until a terminal one or, while it is still in flight, until now
+func SLADurations(payloadData []structs.SinglePayloadData, sla time.Duration, terminalStatuses []string, now time.Time) (elapsed time.Duration, remaining time.Duration, breached bool) {
+	if len(payloadData) == 0 {
+		return 0, sla, false
+	}
+
+	first, latest := payloadData[0], payloadData[0]
+	for _, v := range payloadData {
+		if v.Date.Before(first.Date) {
+			first = v
+		}
+		if v.Date.After(latest.Date) {
+			latest = v
+		}
+	}
+
+	end := now
+	for _, status := range terminalStatuses {
+		if latest.Status == status {
+			end = latest.Date
+			break
+		}
+	}
+
+	elapsed = end.Sub(first.Date)
+	if elapsed > sla {
+		return elapsed, 0, true
+	}
+	return elapsed, sla - elapsed, false
+}
+
+// ExcludeServices drops the statuses of the given services so they do not count towards durations
+func ExcludeServices(payloadData []structs.SinglePayloadData, services []string) []structs.SinglePayloadData {
+	if len(services) == 0 {
+		return payloadData
+	}
+
+	excluded := make(map[string]bool)
+	for _, service := range services {
+		excluded[service] = true
+	}
+
+	var included []structs.SinglePayloadData
+	for _, v := range payloadData {
+		if !excluded[v.Service] {
+			included = append(included, v)
+		}
+	}
+	return included
+}
+
+// HumanDurations formats the durations as duration strings like 2m3.5s, to the millisecond
+func HumanDurations(durations map[string]time.Duration) map[string]string {
+	human := make(map[string]string, len(durations))
+	for key, duration := range durations {
+		human[key] = duration.Round(time.Millisecond).String()
 	}
+	return human
+}
+
+// FormatDurations converts durations for the response, "s" as HH:MM:SS.ffffff and "ms" as milliseconds
+func FormatDurations(durations map[string]time.Duration, unit string) map[string]string {
+	mapTimeString := make(map[string]string)
 
-	mapTimeString["total_time_in_services"] = interpretDuration(mapDurations["total_time_in_services"])
-	mapTimeString["total_time"] = interpretDuration(dateMinMaxArray[1] - dateMinMaxArray[0])
+	for key, duration := range durations {
+		if unit == "ms" {
+			mapTimeString[key] = fmt.Sprintf("%.3f", float64(duration)/float64(time.Millisecond))
+		} else {
+			mapTimeString[key] = interpretDuration(int64(duration))
+		}
+	}
 
 	return mapTimeString
 }
@@ -1,7 +1,11 @@
 package queries
 
 import (
+	"encoding/json"
+	"time"
+
 	models "github.com/redhatinsights/payload-tracker-go/internal/models/db"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -9,6 +13,12 @@ import (
 const (
 	StatusColumns = "payload_id, status_id, service_id, source_id, date, inventory_id, system_id, account, org_id"
 	PayloadJoins  = "left join Payloads on Payloads.id = PayloadStatuses.payload_id"
+
+	// StatusEventsChannel is the postgres notification channel new statuses are published on
+	StatusEventsChannel = "payload_status_events"
+
+	// postgres rejects notification payloads of 8000 bytes or more
+	maxNotifyPayload = 7999
 )
 
 var (
@@ -44,14 +54,56 @@ func GetPayloadByRequestId(db *gorm.DB, request_id string) (result models.Payloa
 	return payload, nil
 }
 
-func UpsertPayloadByRequestId(db *gorm.DB, request_id string, payload models.Payloads) (tx *gorm.DB, payloadId uint) {
-	result := db.Model(&payload).
-		Clauses(clause.OnConflict{
-			Columns:   []clause.Column{{Name: "request_id"}},
-			DoUpdates: clause.AssignmentColumns([]string{"account", "inventory_id", "system_id", "org_id"}),
-		}).
-		Create(&payload)
-	return result, payload.Id
+// Payload upsert operations, noop-duplicate is a message repeating the payload columns already stored
+const (
+	PayloadInserted  = "insert"
+	PayloadUpdated   = "update"
+	PayloadUnchanged = "noop-duplicate"
+)
+
+// UpsertPayloadByRequestId inserts the payload or updates the stored one for its request id and reports which happened,
+// a stored payload that already matches is left alone so that it isn't rewritten for every status
+func UpsertPayloadByRequestId(db *gorm.DB, request_id string, payload models.Payloads) (tx *gorm.DB, payloadId uint, operation string) {
+	var row struct {
+		Id       uint
+		Inserted bool
+	}
+	// the raw insert doesn't get gorm's autoCreateTime, so a message without a date is created now
+	createdAt := payload.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	columns := "request_id, account, inventory_id, system_id, org_id, created_at"
+	values := "?, ?, ?, ?, ?, ?"
+	args := []interface{}{request_id, payload.Account, payload.InventoryId, payload.SystemId, payload.OrgId, createdAt}
+	// the id from the message is kept as Create would, otherwise the sequence assigns one
+	if payload.Id != 0 {
+		columns = "id, " + columns
+		values = "?, " + values
+		args = append([]interface{}{payload.Id}, args...)
+	}
+
+	// xmax is only zero for a row version that was inserted rather than updated
+	result := db.Raw(`INSERT INTO payloads (`+columns+`)
+		VALUES (`+values+`)
+		ON CONFLICT (request_id) DO UPDATE SET
+			account = EXCLUDED.account, inventory_id = EXCLUDED.inventory_id, system_id = EXCLUDED.system_id, org_id = EXCLUDED.org_id
+		WHERE (payloads.account, payloads.inventory_id, payloads.system_id, payloads.org_id)
+			IS DISTINCT FROM (EXCLUDED.account, EXCLUDED.inventory_id, EXCLUDED.system_id, EXCLUDED.org_id)
+		RETURNING id, xmax = 0 AS inserted`, args...,
+	).Scan(&row)
+	if result.Error != nil {
+		return result, 0, ""
+	}
+
+	switch {
+	case result.RowsAffected == 0:
+		result = db.Model(&models.Payloads{}).Select("id").Where("request_id = ?", request_id).Scan(&row.Id)
+		return result, row.Id, PayloadUnchanged
+	case row.Inserted:
+		return result, row.Id, PayloadInserted
+	}
+	return result, row.Id, PayloadUpdated
 }
 
 func UpdatePayloadsTable(db *gorm.DB, updates models.Payloads, payloads models.Payloads) (tx *gorm.DB) {
@@ -91,3 +143,26 @@ func InsertPayloadStatus(db *gorm.DB, payloadStatus *models.PayloadStatuses) (tx
 	}
 	return db.Create(&payloadStatus)
 }
+
+// UpsertArchiveLink stores a prefetched archive link, replacing any earlier link for the request id
+func UpsertArchiveLink(db *gorm.DB, request_id string, url string, expiresAt time.Time) (tx *gorm.DB) {
+	link := models.ArchiveLinks{RequestId: request_id, Url: url, ExpiresAt: expiresAt}
+	return db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&link)
+}
+
+// NotifyStatusEvent publishes a newly stored status to any listeners on StatusEventsChannel.
+// The status message is dropped when it would push the notification over the postgres payload limit.
+func NotifyStatusEvent(db *gorm.DB, event structs.SinglePayloadData) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayload {
+		event.StatusMsg = ""
+		if payload, err = json.Marshal(event); err != nil {
+			return err
+		}
+	}
+
+	return db.Exec("SELECT pg_notify(?, ?)", StatusEventsChannel, string(payload)).Error
+}
@@ -1,7 +1,11 @@
 package queries
 
 import (
+	"strings"
+	"time"
+
 	models "github.com/redhatinsights/payload-tracker-go/internal/models/db"
+	"github.com/redhatinsights/payload-tracker-go/internal/structs"
 	"github.com/redhatinsights/payload-tracker-go/internal/utils/test"
 
 	"github.com/google/uuid"
@@ -33,4 +37,200 @@ var _ = Describe("Queries", func() {
 		Expect(payload.RequestId).To(Equal(requestId))
 		Expect(payload.Account).To(Equal("1234"))
 	})
+
+	It("Reports whether the payload upsert inserted, updated or left the payload alone", func() {
+		requestId := getUUID()
+		payload := models.Payloads{RequestId: requestId, Account: "1234", CreatedAt: time.Now()}
+
+		result, insertedId, operation := UpsertPayloadByRequestId(db(), requestId, payload)
+		Expect(result.Error).ToNot(HaveOccurred())
+		Expect(operation).To(Equal(PayloadInserted))
+
+		result, id, operation := UpsertPayloadByRequestId(db(), requestId, payload)
+		Expect(result.Error).ToNot(HaveOccurred())
+		Expect(operation).To(Equal(PayloadUnchanged))
+		Expect(id).To(Equal(insertedId))
+
+		payload.OrgId = "000001"
+		result, id, operation = UpsertPayloadByRequestId(db(), requestId, payload)
+		Expect(result.Error).ToNot(HaveOccurred())
+		Expect(operation).To(Equal(PayloadUpdated))
+		Expect(id).To(Equal(insertedId))
+
+		stored, err := GetPayloadByRequestId(db(), requestId)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stored.OrgId).To(Equal("000001"))
+	})
+
+	Context("With a soft deleted payload", func() {
+		var requestId string
+
+		BeforeEach(func() {
+			requestId = getUUID()
+			deletedAt := time.Now()
+			payload := models.Payloads{RequestId: requestId, CreatedAt: time.Now(), DeletedAt: &deletedAt}
+			Expect(db().Create(&payload).Error).ToNot(HaveOccurred())
+
+			status := models.Statuses{Name: "deleted-status-" + requestId}
+			Expect(db().Create(&status).Error).ToNot(HaveOccurred())
+			service := models.Services{Name: "deleted-service-" + requestId}
+			Expect(db().Create(&service).Error).ToNot(HaveOccurred())
+			Expect(db().Create(&models.PayloadStatuses{PayloadId: payload.Id, Status: status, Service: service, Date: time.Now()}).Error).ToNot(HaveOccurred())
+		})
+
+		It("Doesn't report it as existing", func() {
+			Expect(PayloadExists(db(), requestId)).To(BeFalse())
+		})
+
+		It("Doesn't report its statuses", func() {
+			Expect(PayloadHasStatus(db(), requestId, "", "deleted-status-"+requestId)).To(BeFalse())
+			Expect(PayloadHasStatus(db(), requestId, "deleted-service-"+requestId, "deleted-status-"+requestId)).To(BeFalse())
+		})
+
+		It("Doesn't retrieve it", func() {
+			_, found := RetrievePayload(db(), requestId)
+			Expect(found).To(BeFalse())
+		})
+	})
+
+	It("Creates a payload without a date now", func() {
+		requestId := getUUID()
+		result, _, operation := UpsertPayloadByRequestId(db(), requestId, models.Payloads{RequestId: requestId})
+		Expect(result.Error).ToNot(HaveOccurred())
+		Expect(operation).To(Equal(PayloadInserted))
+
+		stored, err := GetPayloadByRequestId(db(), requestId)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stored.CreatedAt).To(BeTemporally("~", time.Now(), time.Minute))
+	})
+
+	It("Keeps the payload id of the message", func() {
+		requestId := getUUID()
+		payloadId := uint(time.Now().UnixNano() % 1000000000)
+		_, id, _ := UpsertPayloadByRequestId(db(), requestId, models.Payloads{Id: payloadId, RequestId: requestId, CreatedAt: time.Now()})
+		Expect(id).To(Equal(payloadId))
+	})
+})
+
+var _ = Describe("PageOffset", func() {
+	It("Starts at the first row for the first page", func() {
+		Expect(PageOffset(0, 10, 0)).To(Equal(0))
+		Expect(PageOffset(1, 10, 1)).To(Equal(0))
+	})
+
+	It("Skips a full page for the second page", func() {
+		Expect(PageOffset(1, 10, 0)).To(Equal(10))
+		Expect(PageOffset(2, 10, 1)).To(Equal(10))
+	})
+})
+
+var _ = Describe("HumanDurations", func() {
+	It("Formats durations as duration strings to the millisecond", func() {
+		durations := map[string]time.Duration{
+			"total_time":    2*time.Minute + 3*time.Second + 456789*time.Microsecond,
+			"puptoo:source": 1500 * time.Microsecond,
+		}
+		Expect(HumanDurations(durations)).To(Equal(map[string]string{
+			"total_time":    "2m3.457s",
+			"puptoo:source": "2ms",
+		}))
+	})
+})
+
+var _ = Describe("PageStatuses", func() {
+	statuses := make([]structs.SinglePayloadData, 5)
+
+	It("Returns a partial last page", func() {
+		Expect(PageStatuses(statuses, 2, 2, 0)).To(HaveLen(1))
+	})
+
+	It("Returns an empty page past the end", func() {
+		Expect(PageStatuses(statuses, 3, 2, 0)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("SummaryStatuses", func() {
+	start := time.Date(2022, 6, 7, 11, 0, 0, 0, time.UTC)
+	status := func(service string, offset time.Duration) structs.SinglePayloadData {
+		return structs.SinglePayloadData{Service: service, Date: start.Add(offset)}
+	}
+
+	It("Keeps the oldest and newest statuses in the given order", func() {
+		statuses := []structs.SinglePayloadData{
+			status("b", 2*time.Second), status("c", 3*time.Second), status("a", 0), status("d", time.Second),
+		}
+		Expect(SummaryStatuses(statuses)).To(Equal([]structs.SinglePayloadData{statuses[1], statuses[2]}))
+	})
+
+	It("Returns a single status once for statuses all on the same date", func() {
+		statuses := []structs.SinglePayloadData{status("a", 0), status("b", 0), status("c", 0)}
+		Expect(SummaryStatuses(statuses)).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("Embedded status fields", func() {
+	It("Leaves out the payload columns of every verbosity", func() {
+		for _, verbosity := range []string{"0", "1", "2"} {
+			fields := embeddedStatusFields(verbosity)
+			Expect(fields).To(ContainElements("services.name as service", "statuses.name as status", "payload_statuses.date"))
+			Expect(strings.Join(fields, ",")).ToNot(ContainSubstring("payloads."))
+		}
+	})
+
+	It("Narrows the status columns as the verbosity goes up", func() {
+		Expect(embeddedStatusFields("0")).To(HaveLen(7))
+		Expect(embeddedStatusFields("1")).To(ContainElement("payload_statuses.status_msg"))
+		Expect(embeddedStatusFields("2")).ToNot(ContainElement("payload_statuses.status_msg"))
+	})
+})
+
+var _ = Describe("SLADurations", func() {
+	start := time.Date(2021, 8, 4, 7, 0, 0, 0, time.UTC)
+	statuses := []structs.SinglePayloadData{
+		{Status: "received", Date: start},
+		{Status: "processing", Date: start.Add(10 * time.Minute)},
+	}
+	terminal := []string{"success", "error"}
+
+	It("Times an in flight payload until now", func() {
+		elapsed, remaining, breached := SLADurations(statuses, time.Hour, terminal, start.Add(20*time.Minute))
+		Expect(elapsed).To(Equal(20 * time.Minute))
+		Expect(remaining).To(Equal(40 * time.Minute))
+		Expect(breached).To(BeFalse())
+	})
+
+	It("Stops timing a payload at its terminal status", func() {
+		done := append(statuses, structs.SinglePayloadData{Status: "success", Date: start.Add(30 * time.Minute)})
+		elapsed, remaining, breached := SLADurations(done, time.Hour, terminal, start.Add(2*time.Hour))
+		Expect(elapsed).To(Equal(30 * time.Minute))
+		Expect(remaining).To(Equal(30 * time.Minute))
+		Expect(breached).To(BeFalse())
+	})
+
+	It("Flags a payload over its SLA", func() {
+		elapsed, remaining, breached := SLADurations(statuses, 15*time.Minute, terminal, start.Add(20*time.Minute))
+		Expect(elapsed).To(Equal(20 * time.Minute))
+		Expect(remaining).To(BeZero())
+		Expect(breached).To(BeTrue())
+	})
+})
+
+var _ = Describe("Payload filter order", func() {
+	It("Puts the configured filters first and keeps the rest in the default order", func() {
+		Expect(orderedPayloadFilters([]string{"account", "org_id"})).To(Equal([]string{"account", "org_id", "request_id_prefix", "inventory_id", "system_id"}))
+	})
+
+	It("Uses the default order when none is configured", func() {
+		Expect(orderedPayloadFilters(nil)).To(Equal(PayloadFilters))
+	})
+})
+
+var _ = Describe("Query hints", func() {
+	hints := map[string]string{QueryHintKey([]string{"org_id", "created_at"}): "IndexScan(payloads payloads_org_id_created_at_idx)"}
+
+	It("Applies to exactly the combination of filters it is keyed on", func() {
+		Expect(queryHint(structs.Query{OrgID: "5678", CreatedAtGT: "2022-06-01T00:00:00Z", QueryHints: hints})).To(Equal("IndexScan(payloads payloads_org_id_created_at_idx)"))
+		Expect(queryHint(structs.Query{OrgID: "5678", QueryHints: hints})).To(BeEmpty())
+		Expect(queryHint(structs.Query{OrgID: "5678", Accounts: []string{"1234"}, CreatedAtGT: "2022-06-01T00:00:00Z", QueryHints: hints})).To(BeEmpty())
+	})
 })
@@ -8,28 +8,69 @@ import (
 
 // Query is a struct for holding query params
 type Query struct {
-	Page         int
-	PageSize     int
-	RequestID    string
-	SortBy       string
-	SortDir      string
-	Account      string
-	OrgID        string
-	InventoryID  string
-	SystemID     string
-	CreatedAtLT  string
-	CreatedAtLTE string
-	CreatedAtGT  string
-	CreatedAtGTE string
-
-	Service   string
-	Source    string
-	Status    string
-	StatusMsg string
-	DateLT    string
-	DateLTE   string
-	DateGT    string
-	DateGTE   string
+	Page             int
+	PageSize         int
+	PageBase         int
+	RequestID        string
+	RequestIDPrefix  string
+	SortBy           string
+	SortDir          string
+	Accounts         []string // a payload matches when it belongs to any of them
+	AccountGT        string   // account_gt and account_lt bound the numeric accounts exclusively
+	AccountLT        string
+	OrgID            string
+	InventoryID      string
+	SystemID         string
+	CreatedAtLT      string
+	CreatedAtLTE     string
+	CreatedAtGT      string
+	CreatedAtGTE     string
+	SkipCount        bool
+	IncludeStaleness bool
+	LatestOnly       bool
+	IncludeServices  bool
+	Human            bool
+	IncludeDeleted   bool
+	BusinessHours    *BusinessHours    // nil when not filtering on business hours
+	EmbedStatuses    *EmbedStatuses    // nil unless the payloads carry their statuses
+	TerminalStatuses []string          // nil unless the payloads are marked with whether they reached one
+	FilterOrder      []string          // the order the payloads column filters are applied in
+	QueryHints       map[string]string // pg_hint_plan hints by QueryHintKey of the filters they apply to
+
+	Service       string
+	ServiceNE     []string
+	Source        string
+	Status        string
+	StatusNE      []string
+	MinStatuses   int
+	ServiceStatus []ServiceStatus
+	StatusMsg     string
+	MsgPath       string // a dot separated JSON path within status_msg, empty unless filtering on one
+	MsgValue      string // the value the JSON at MsgPath must equal
+	HasMessage    *bool  // nil when not filtering on status messages
+	DateLT        string
+	DateLTE       string
+	DateGT        string
+	DateGTE       string
+}
+
+// BusinessHours is the range of hours, from Start up to End, that payloads were created within in the timezone
+type BusinessHours struct {
+	Timezone string
+	Start    int
+	End      int
+}
+
+// EmbedStatuses is how the statuses nested in the /payloads rows with embed=statuses are selected
+type EmbedStatuses struct {
+	Verbosity string
+	Limit     int // the most statuses nested in the whole page
+}
+
+// ServiceStatus is a status recorded by a particular service
+type ServiceStatus struct {
+	Service string
+	Status  string
 }
 
 // PayloadsData is the response for the /payloads endpoint
@@ -37,18 +78,113 @@ type PayloadsData struct {
 	Count   int64             `json:"count"`
 	Elapsed float64           `json:"elapsed"`
 	Data    []models.Payloads `json:"data"`
+
+	// ElapsedHuman is the elapsed time as a duration string, with human=true
+	ElapsedHuman string `json:"elapsed_human,omitempty"`
+}
+
+// ArchivePayloadsData is the response for the /payloads endpoint with include_archive=true
+type ArchivePayloadsData struct {
+	Count   int64                `json:"count"`
+	Elapsed float64              `json:"elapsed"`
+	Data    []PayloadWithArchive `json:"data"`
+
+	ElapsedHuman string `json:"elapsed_human,omitempty"`
+}
+
+// PayloadWithArchive is a payload along with whether storage-broker still has its archive
+type PayloadWithArchive struct {
+	models.Payloads
+	HasArchive bool `json:"has_archive"`
 }
 
 // PayloadRetrievebyID is the response for the /payloads/{request_id} endpoint
 type PayloadRetrievebyID struct {
+	Count     int                 `json:"count"`
 	Data      []SinglePayloadData `json:"data"`
 	Durations map[string]string   `json:"duration"`
+
+	// DurationsHuman are the durations as duration strings, with human=true
+	DurationsHuman map[string]string `json:"duration_human,omitempty"`
+
+	// SLABreached is whether the payload has gone over its SLA, with include_sla=true
+	SLABreached *bool `json:"sla_breached,omitempty"`
+
+	// StatusCounts is how many times each status was reported over the whole history, with status_counts=true
+	StatusCounts map[string]int `json:"status_counts,omitempty"`
+}
+
+// DurationsRetrievebyID is the response for the /payloads/{request_id} endpoint with durations_only=true
+type DurationsRetrievebyID struct {
+	Durations map[string]string `json:"duration"`
+
+	DurationsHuman map[string]string `json:"duration_human,omitempty"`
+	SLABreached    *bool             `json:"sla_breached,omitempty"`
+	StatusCounts   map[string]int    `json:"status_counts,omitempty"`
+}
+
+// ProjectedPayloadRetrievebyID is the response for the /payloads/{request_id} endpoint when fields are selected
+type ProjectedPayloadRetrievebyID struct {
+	Count     int                      `json:"count"`
+	Data      []map[string]interface{} `json:"data"`
+	Durations map[string]string        `json:"duration"`
+
+	DurationsHuman map[string]string `json:"duration_human,omitempty"`
+	SLABreached    *bool             `json:"sla_breached,omitempty"`
+	StatusCounts   map[string]int    `json:"status_counts,omitempty"`
+}
+
+// EnvelopedResponse is the shape of the /payloads responses when the response envelope is enabled
+type EnvelopedResponse struct {
+	Meta ResponseMeta `json:"meta"`
+	Data interface{}  `json:"data"`
+}
+
+// ResponseMeta holds everything about an enveloped response other than its rows
+type ResponseMeta struct {
+	Count     int64             `json:"count"`
+	Elapsed   float64           `json:"elapsed,omitempty"`
+	Durations map[string]string `json:"duration,omitempty"`
+
+	ElapsedHuman   string            `json:"elapsed_human,omitempty"`
+	DurationsHuman map[string]string `json:"duration_human,omitempty"`
+	SLABreached    *bool             `json:"sla_breached,omitempty"`
+	StatusCounts   map[string]int    `json:"status_counts,omitempty"`
+}
+
+// JSONAPIDocument is the /payloads response for clients that accept application/vnd.api+json
+type JSONAPIDocument struct {
+	Meta ResponseMeta      `json:"meta"`
+	Data []JSONAPIResource `json:"data"`
+}
+
+// JSONAPIResource is a JSON:API resource object
+type JSONAPIResource struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Attributes map[string]interface{} `json:"attributes"`
 }
 
 type PayloadArchiveLink struct {
 	Url string `json:"url"`
 }
 
+// ArchiveLinksRequest is the body of POST /payloads/archiveLinks
+type ArchiveLinksRequest struct {
+	RequestIDs []string `json:"request_ids"`
+}
+
+// ArchiveLinksData is the response for POST /payloads/archiveLinks keyed by request_id
+type ArchiveLinksData struct {
+	Links map[string]ArchiveLinkResult `json:"links"`
+}
+
+// ArchiveLinkResult holds either the archive link of a payload or why there isn't one
+type ArchiveLinkResult struct {
+	Url   string `json:"url,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
 type PayloadKibanaLink struct {
 	Url string `json:"url"`
 }
@@ -63,16 +199,87 @@ type StatusesData struct {
 	Data    []StatusRetrieve `json:"data"`
 }
 
+// ReplayResult is the response for the /admin/replay endpoint
+type ReplayResult struct {
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+// StatusInsertResult is the outcome of one of the statuses posted to /admin/statuses
+type StatusInsertResult struct {
+	Index     int    `json:"index"`
+	RequestID string `json:"request_id,omitempty"`
+	Inserted  bool   `json:"inserted"`
+	Error     string `json:"error,omitempty"`
+}
+
+// StatusInsertResults is the response for the /admin/statuses endpoint
+type StatusInsertResults struct {
+	Inserted int                  `json:"inserted"`
+	Failed   int                  `json:"failed"`
+	Results  []StatusInsertResult `json:"results"`
+}
+
+// ReprocessAnnouncement is the upload announcement re-emitted by /admin/reprocess/{request_id}
+type ReprocessAnnouncement struct {
+	RequestID string `json:"request_id"`
+	Account   string `json:"account,omitempty"`
+	OrgID     string `json:"org_id,omitempty"`
+	URL       string `json:"url"`
+}
+
+// ReprocessResult is the response for the /admin/reprocess/{request_id} endpoint
+type ReprocessResult struct {
+	RequestID string `json:"request_id"`
+	Account   string `json:"account,omitempty"`
+	OrgID     string `json:"org_id,omitempty"`
+	Topic     string `json:"topic"`
+}
+
+// TableStats is the size of one of the tables in the /admin/dbstats response
+type TableStats struct {
+	Table      string `json:"table"`
+	Rows       int64  `json:"rows"`
+	TotalBytes int64  `json:"total_bytes"`
+}
+
+// DBStatsData is the response for the /admin/dbstats endpoint
+type DBStatsData struct {
+	Tables []TableStats `json:"tables"`
+}
+
+// ConsumerState is the response for the /admin/consumer endpoints
+type ConsumerState struct {
+	Paused bool `json:"paused"`
+}
+
+// ServicesData is the response for the /services endpoint
+type ServicesData struct {
+	Services []string `json:"services"`
+}
+
+// DistinctStatusesData is the response for the /statuses/distinct endpoint
+type DistinctStatusesData struct {
+	Statuses []string `json:"statuses"`
+}
+
 // Error response struct for endpoints
 type ErrorResponse struct {
-	Title   string `json:"title"`
+	Title   string       `json:"title"`
+	Message string       `json:"message"`
+	Status  int          `json:"status"`
+	Errors  []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is a problem with a single request parameter
+type FieldError struct {
+	Field   string `json:"field"`
 	Message string `json:"message"`
-	Status  int    `json:"status"`
 }
 
 // SinglePayloadData is the data for a single payload
 type SinglePayloadData struct {
-	ID          uint      `json:"id,omitempty"`
+	ID          uint      `json:"id,omitempty,string"`
 	Service     string    `json:"service,omitempty"`
 	Source      string    `json:"source,omitempty"`
 	Account     string    `json:"account,omitempty"`
@@ -84,6 +291,9 @@ type SinglePayloadData struct {
 	Status      string    `json:"status,omitempty"`
 	StatusMsg   string    `json:"status_msg,omitempty"`
 	Date        time.Time `json:"date,omitempty"`
+
+	// ReceivedAt is left out for statuses persisted before it was recorded
+	ReceivedAt *time.Time `json:"received_at,omitempty"`
 }
 
 // StatusRetrieve returns a response for /payloads/statuses
@@ -96,4 +306,47 @@ type StatusRetrieve struct {
 	StatusMsg string `json:"status_msg,omitempty"`
 	Date      string `json:"date,omitempty"`
 	CreatedAt string `json:"created_at,omitempty"`
+
+	// ReceivedAt is left out for statuses persisted before it was recorded
+	ReceivedAt string `json:"received_at,omitempty"`
+}
+
+// DurationStats is the response for the /stats/durations endpoint, percentiles are in seconds
+type DurationStats struct {
+	Count int64   `json:"count"`
+	P50   float64 `json:"p50"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+}
+
+// ServiceCount is the number of distinct payloads a service reported a status for
+type ServiceCount struct {
+	Service  string `json:"service"`
+	Payloads int64  `json:"payloads"`
+}
+
+// ServiceStats is the response for the /stats/services endpoint, busiest services first
+type ServiceStats struct {
+	Count int            `json:"count"`
+	Data  []ServiceCount `json:"data"`
+}
+
+// ParamSchema describes a query parameter, values lists the accepted values when there is a fixed set of them
+type ParamSchema struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Values    []string `json:"values,omitempty"`
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// EndpointSchema describes the query parameters of a listing endpoint
+type EndpointSchema struct {
+	Path   string        `json:"path"`
+	SortBy []string      `json:"sort_by"`
+	Params []ParamSchema `json:"params"`
+}
+
+// Schema is the response for the /schema endpoint
+type Schema struct {
+	Endpoints []EndpointSchema `json:"endpoints"`
 }
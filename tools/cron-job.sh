@@ -4,15 +4,31 @@
 source /tmp/vars.sh
 
 RETENTION_DAYS=${RETENTION_DAYS:-7}
+# hard deletes expired payloads, soft sets their deleted_at and only purges them once the recovery window is over too
+RETENTION_MODE=${RETENTION_MODE:-hard}
+SOFT_DELETE_RECOVERY_DAYS=${SOFT_DELETE_RECOVERY_DAYS:-7}
 MAX_NUMBER_OF_RETRIES=${MAX_NUMBER_OF_RETRIES:-3}
 SLEEP_TIME=${SLEEP_TIME:-10}
 
 echo "RETENTION_DAYS: $RETENTION_DAYS"
+echo "RETENTION_MODE: $RETENTION_MODE"
 echo "MAX_NUMBER_OF_RETRIES: $MAX_NUMBER_OF_RETRIES"
 echo "SLEEP_TIME: $SLEEP_TIME"
 
-PGPASSWORD=$CLOWDER_DATABASE_PASSWORD psql -h $CLOWDER_DATABASE_HOSTNAME -U $CLOWDER_DATABASE_USERNAME -d $CLOWDER_DATABASE_NAME -c "DELETE FROM payload_statuses WHERE created_at < (NOW() - interval '$RETENTION_DAYS days');"
-PGPASSWORD=$CLOWDER_DATABASE_PASSWORD psql -h $CLOWDER_DATABASE_HOSTNAME -U $CLOWDER_DATABASE_USERNAME -d $CLOWDER_DATABASE_NAME -c "DELETE FROM payloads WHERE created_at < (NOW() - interval '$RETENTION_DAYS days');"
+PURGE_DAYS=$RETENTION_DAYS
+if [ "$RETENTION_MODE" = "soft" ]; then
+    echo "SOFT_DELETE_RECOVERY_DAYS: $SOFT_DELETE_RECOVERY_DAYS"
+    PURGE_DAYS=$((RETENTION_DAYS + SOFT_DELETE_RECOVERY_DAYS))
+    PGPASSWORD=$CLOWDER_DATABASE_PASSWORD psql -h $CLOWDER_DATABASE_HOSTNAME -U $CLOWDER_DATABASE_USERNAME -d $CLOWDER_DATABASE_NAME -c "UPDATE payloads SET deleted_at = NOW() WHERE deleted_at IS NULL AND created_at < (NOW() - interval '$RETENTION_DAYS days');"
+elif [ "$RETENTION_MODE" != "hard" ]; then
+    echo "RETENTION_MODE must be hard or soft"
+    exit 1
+fi
+
+PGPASSWORD=$CLOWDER_DATABASE_PASSWORD psql -h $CLOWDER_DATABASE_HOSTNAME -U $CLOWDER_DATABASE_USERNAME -d $CLOWDER_DATABASE_NAME -c "DELETE FROM payload_statuses WHERE created_at < (NOW() - interval '$PURGE_DAYS days');"
+PGPASSWORD=$CLOWDER_DATABASE_PASSWORD psql -h $CLOWDER_DATABASE_HOSTNAME -U $CLOWDER_DATABASE_USERNAME -d $CLOWDER_DATABASE_NAME -c "DELETE FROM payloads WHERE created_at < (NOW() - interval '$PURGE_DAYS days');"
+PGPASSWORD=$CLOWDER_DATABASE_PASSWORD psql -h $CLOWDER_DATABASE_HOSTNAME -U $CLOWDER_DATABASE_USERNAME -d $CLOWDER_DATABASE_NAME -c "DELETE FROM idempotency_keys WHERE expires_at < NOW();"
+PGPASSWORD=$CLOWDER_DATABASE_PASSWORD psql -h $CLOWDER_DATABASE_HOSTNAME -U $CLOWDER_DATABASE_USERNAME -d $CLOWDER_DATABASE_NAME -c "DELETE FROM archive_links WHERE expires_at < NOW();"
 PGPASSWORD=$CLOWDER_DATABASE_PASSWORD psql -h $CLOWDER_DATABASE_HOSTNAME -U $CLOWDER_DATABASE_USERNAME -d $CLOWDER_DATABASE_NAME -c "VACUUM ANALYZE payload_statuses;"
 PGPASSWORD=$CLOWDER_DATABASE_PASSWORD psql -h $CLOWDER_DATABASE_HOSTNAME -U $CLOWDER_DATABASE_USERNAME -d $CLOWDER_DATABASE_NAME -c "VACUUM ANALYZE payloads;"
 
@@ -24,4 +40,4 @@ do
     PGPASSWORD=$CLOWDER_DATABASE_PASSWORD psql -h $CLOWDER_DATABASE_HOSTNAME -U $CLOWDER_DATABASE_USERNAME -d $CLOWDER_DATABASE_NAME -c "SELECT create_partition(NOW()::DATE + INTERVAL '1 DAY', NOW()::DATE + INTERVAL '2 DAY');" && break || sleep $SLEEP_TIME
 done
 
-PGPASSWORD=$CLOWDER_DATABASE_PASSWORD psql -h $CLOWDER_DATABASE_HOSTNAME -U $CLOWDER_DATABASE_USERNAME -d $CLOWDER_DATABASE_NAME -c "SELECT drop_partition(NOW()::DATE - INTERVAL '$RETENTION_DAYS DAY', NOW()::DATE - (($RETENTION_DAYS - 1) || ' DAY')::INTERVAL);"
+PGPASSWORD=$CLOWDER_DATABASE_PASSWORD psql -h $CLOWDER_DATABASE_HOSTNAME -U $CLOWDER_DATABASE_USERNAME -d $CLOWDER_DATABASE_NAME -c "SELECT drop_partition(NOW()::DATE - INTERVAL '$PURGE_DAYS DAY', NOW()::DATE - (($PURGE_DAYS - 1) || ' DAY')::INTERVAL);"